@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// parseAggregation parses an aggregation given as space-separated settings:
+// without=<labels> (comma-separated) and, optionally, gauges=<op> (e.g.
+// "without=code,pod gauges=max").
+func parseAggregation(s string) (metrics.Aggregation, error) {
+	var a metrics.Aggregation
+	for _, setting := range strings.Fields(s) {
+		name, value, ok := strings.Cut(setting, "=")
+		switch {
+		case !ok:
+			return a, fmt.Errorf("expected name=value, but got %q", setting)
+		case name == "without":
+			a.Without = splitLabels(value)
+		case name == "gauges":
+			op, err := metrics.ParseAggregateOp(value)
+			if err != nil {
+				return a, err
+			}
+			a.Gauges = op
+		default:
+			return a, fmt.Errorf("unknown setting %q (expected without or gauges)", name)
+		}
+	}
+	return a, nil
+}
+
+// splitLabels returns the label names separated by commas or spaces in s.
+func splitLabels(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// aggregationName describes the given aggregation like PromQL (e.g. "sum
+// without (code, pod)"). Gauges aggregated otherwise are noted.
+func aggregationName(a metrics.Aggregation) string {
+	s := "sum without (" + strings.Join(a.Without, ", ") + ")"
+	if a.Gauges != metrics.AggregateSum {
+		s += ", gauges: " + a.Gauges.String()
+	}
+	return s
+}
+
+// promptKind is what is typed into the prompt of the header.
+type promptKind int
+
+const (
+	promptNone promptKind = iota
+	promptAggregation
+	promptEndpoint
+	promptPivot
+)
+
+// updatePrompt handles the keys typed into the prompt (see model.prompting)
+// and returns the command opening an endpoint typed (if any).
+func (m *model) updatePrompt(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.cancel):
+		m.prompting = promptNone
+		m.cancelEndpoint()
+	case m.connecting:
+		// The prompt is kept until the endpoint is sampled.
+	case key.Matches(msg, m.keys.browse) && m.prompting == promptEndpoint:
+		return m.openEndpoint(strings.TrimSpace(m.prompt))
+	case key.Matches(msg, m.keys.browse) && m.prompting == promptPivot:
+		m.prompting, m.pivot = promptNone, strings.TrimSpace(m.prompt)
+		m.metricsView()
+	case key.Matches(msg, m.keys.browse):
+		m.prompting = promptNone
+		m.aggregation.Without = splitLabels(m.prompt)
+		m.metricsView()
+	case key.Matches(msg, m.keys.deleteChar):
+		if r := []rune(m.prompt); len(r) > 0 {
+			m.prompt = string(r[:len(r)-1])
+		}
+	case key.Matches(msg, m.keys.deleteWord):
+		m.prompt = deleteLastWord(m.prompt)
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		m.prompt += string(msg.Runes)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestParseAggregation(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected metrics.Aggregation
+		err      bool
+	}{
+		{"", metrics.Aggregation{}, false},
+		{"without=code", metrics.Aggregation{Without: []string{"code"}}, false},
+		{"without=code,pod gauges=max", metrics.Aggregation{Without: []string{"code", "pod"}, Gauges: metrics.AggregateMax}, false},
+		{"without", metrics.Aggregation{}, true},
+		{"by=code", metrics.Aggregation{}, true},
+		{"without=code gauges=median", metrics.Aggregation{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			actual, err := parseAggregation(tt.s)
+			if (err != nil) != tt.err {
+				t.Fatalf("Expected error %v, but got %v", tt.err, err)
+			}
+			if !tt.err && !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestModel_UpdatePrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE requests_total counter\nrequests_total{code=\"200\"} 1\nrequests_total{code=\"500\"} 2\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		search:   "requests",
+		viewport: viewport.New(120, 10),
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+
+	// Typing goes to the prompt rather than to the search.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("codx")})
+	m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if !strings.Contains(m.headerView(), "Aggregate without (labels, ENTER to apply): code") || m.search != "requests" {
+		t.Errorf("Expected the prompt in the header, but got %q", m.headerView())
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.prompting != promptNone || len(m.rows) != 1 {
+		t.Fatalf("Expected 1 aggregated row, but got %d", len(m.rows))
+	}
+	if view := m.viewport.View(); !strings.HasPrefix(view, " requests_total 3 (aggregate of 2)") {
+		t.Errorf("Expected the marked aggregate, but got %q", view)
+	}
+	if !strings.Contains(m.headerView(), " sum without (code) -") {
+		t.Errorf("Expected the aggregation in the header, but got %q", m.headerView())
+	}
+
+	// Cancelling keeps the aggregation.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.prompting != promptNone || !reflect.DeepEqual(m.aggregation.Without, []string{"code"}) {
+		t.Errorf("Expected to keep the aggregation, but got %v", m.aggregation.Without)
+	}
+
+	// An empty prompt stops aggregating.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.rows) != 2 {
+		t.Errorf("Expected 2 rows, but got %d", len(m.rows))
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// exitAssertion is the exit code of a violated assertion.
+const exitAssertion = 2
+
+// assertion is a threshold on the values of the series matching a selector
+// (e.g. `queue_depth > 100`) or on their increase over the run (e.g.
+// `increase(http_requests_errors_total) > 0`). The assertion is violated, if
+// any of the series crosses the threshold.
+type assertion struct {
+	text     string
+	selector metrics.Selector
+	increase bool
+	op       string
+	value    float64
+
+	// prev and increases track the increase of each series over the run.
+	prev      map[string]float64
+	increases map[string]float64
+}
+
+// assertionOps are the comparison operators of assertions (and rules). Longer
+// operators come first, so that they are not mistaken for their prefixes.
+var assertionOps = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// assertionsFlag is a flag that may be given multiple times, each time with
+// one assertion.
+type assertionsFlag []*assertion
+
+func (f *assertionsFlag) String() string {
+	return strings.Join(f.values(), "; ")
+}
+
+func (f *assertionsFlag) Set(s string) error {
+	a, err := parseAssertion(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, a)
+	return nil
+}
+
+func (f *assertionsFlag) values() []string {
+	texts := make([]string, 0, len(*f))
+	for _, a := range *f {
+		texts = append(texts, a.text)
+	}
+	return texts
+}
+
+// parseAssertion parses an assertion of the form `selector op value`, where
+// the selector may be wrapped in increase(...).
+func parseAssertion(s string) (*assertion, error) {
+	a := &assertion{text: strings.TrimSpace(s)}
+
+	// The operator is searched for after the selector's braces, as label
+	// matchers contain operator characters as well.
+	start := strings.LastIndex(s, "}") + 1
+	i, op := -1, ""
+	for _, o := range assertionOps {
+		if j := strings.Index(s[start:], o); j >= 0 && (i < 0 || start+j < i) {
+			i, op = start+j, o
+		}
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("missing operator in assertion %q", s)
+	}
+	a.op = op
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s[i+len(op):]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value in assertion %q", s)
+	}
+	a.value = value
+
+	sel := strings.TrimSpace(s[:i])
+	if inner, ok := strings.CutPrefix(sel, "increase("); ok {
+		if !strings.HasSuffix(inner, ")") {
+			return nil, fmt.Errorf("missing closing parenthesis in assertion %q", s)
+		}
+		sel, a.increase = strings.TrimSuffix(inner, ")"), true
+	}
+	if a.selector, err = metrics.ParseSelector(sel); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// crosses returns true, if the given value crosses the threshold.
+func (a *assertion) crosses(v float64) bool {
+	return crosses(a.op, a.value, v)
+}
+
+// crosses returns true, if the given value v crosses the given threshold with
+// the given operator (see assertionOps). Values without an estimate (NaN)
+// never cross, while infinite ones compare as beyond any threshold.
+func crosses(op string, threshold, v float64) bool {
+	if math.IsNaN(v) {
+		return false
+	}
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	case "!=":
+		return v != threshold
+	}
+	return false
+}
+
+// check checks the assertion against the latest observations of the series in
+// the given dump. If any of the matching series crosses the threshold, check
+// returns all matching series (as "name = value") with the violating ones
+// marked. It also returns the number of matching series.
+func (a *assertion) check(dump [][]metrics.Observation) ([]string, int) {
+	if a.prev == nil {
+		a.prev, a.increases = make(map[string]float64), make(map[string]float64)
+	}
+	var matches []string
+	violated := false
+	for _, series := range dump {
+		o := series[0]
+		if o.Stale || !a.selector.Matches(o) {
+			continue
+		}
+		v := o.Value
+		if a.increase {
+			// Counter resets count as an increase by the value after the
+			// reset.
+			if prev, ok := a.prev[o.Name]; ok {
+				if v >= prev {
+					a.increases[o.Name] += v - prev
+				} else {
+					a.increases[o.Name] += v
+				}
+			}
+			a.prev[o.Name] = o.Value
+			v = a.increases[o.Name]
+		}
+		match := o.Name + " = " + format(v)
+		if a.crosses(v) {
+			violated = true
+			match += " (violated)"
+		}
+		matches = append(matches, match)
+	}
+	if !violated {
+		return nil, len(matches)
+	}
+	return matches, len(matches)
+}
+
+// runAssertions checks the assertions against the (already sampled once)
+// target, and then samples the target and checks the assertions after each
+// successful sample every interval until it has been sampled successfully the
+// given number of times (unless zero) or ctx is done. runAssertions reports
+// the violated assertions on w and returns false then.
+func runAssertions(ctx context.Context, t *target, assertions []*assertion, stats runStats, samples int, interval time.Duration, w io.Writer) (runStats, bool) {
+	unmatched := make(map[*assertion]bool)
+	check := func() bool {
+		dump, _ := t.store.Dump("")
+		ok := true
+		for _, a := range assertions {
+			violations, matched := a.check(dump)
+			if matched == 0 && !unmatched[a] {
+				// Series may appear later (e.g. error counters on the
+				// first error).
+				unmatched[a] = true
+				fmt.Fprintf(os.Stderr, "Warning: assertion %q matches no series\n", a.text)
+			}
+			if len(violations) == 0 {
+				continue
+			}
+			ok = false
+			fmt.Fprintf(w, "assertion failed: %s\n", a.text)
+			for _, v := range violations {
+				fmt.Fprintf(w, "  %s\n", v)
+			}
+		}
+		return ok
+	}
+
+	if !check() {
+		return stats, false
+	}
+	for !t.once && (samples == 0 || stats.samples < samples) {
+		select {
+		case <-ctx.Done():
+			return stats, true
+		case <-time.After(interval):
+		}
+		fetched, err := t.store.Sample(ctx)
+		if ctx.Err() != nil {
+			return stats, true
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching metrics:", err)
+		}
+		stats.record(fetched, err)
+		if fetched && !check() {
+			return stats, false
+		}
+	}
+	return stats, true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		in       string
+		selector string
+		increase bool
+		op       string
+		value    float64
+		err      bool
+	}{
+		{in: "queue_depth > 100", selector: "queue_depth", op: ">", value: 100},
+		{in: "queue_depth>=1e3", selector: "queue_depth", op: ">=", value: 1000},
+		{in: `up{job!="api"} == 0`, selector: `up{job!="api"}`, op: "==", value: 0},
+		{in: `increase(errors_total{code=~"5.."}) > 0`, selector: `errors_total{code=~"5.."}`, increase: true, op: ">", value: 0},
+		{in: "queue_depth", err: true},
+		{in: "queue_depth > many", err: true},
+		{in: "increase(errors_total > 0", err: true},
+		{in: "> 0", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			a, err := parseAssertion(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Expected an error, but got %+v", a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if a.selector.String() != tt.selector || a.increase != tt.increase || a.op != tt.op || a.value != tt.value {
+				t.Errorf("Expected %v %v %v %v, but got %v %v %v %v", tt.selector, tt.increase, tt.op, tt.value, a.selector, a.increase, a.op, a.value)
+			}
+		})
+	}
+}
+
+func TestCrosses(t *testing.T) {
+	tests := []struct {
+		op       string
+		v        float64
+		expected bool
+	}{
+		{">", 101, true},
+		{">", 100, false},
+		{">", math.Inf(1), true},
+		{"<", math.Inf(-1), true},
+		{">", math.NaN(), false},
+		{"!=", math.NaN(), false},
+	}
+	for _, tt := range tests {
+		if actual := crosses(tt.op, 100, tt.v); actual != tt.expected {
+			t.Errorf("Expected %v for %v %s 100, but got %v", tt.expected, tt.v, tt.op, actual)
+		}
+	}
+}
+
+func TestAssertion_Check(t *testing.T) {
+	observe := func(values ...float64) [][]metrics.Observation {
+		var dump [][]metrics.Observation
+		for i, v := range values {
+			code := []string{"200", "500"}[i]
+			dump = append(dump, []metrics.Observation{{
+				Name:   `requests_total {code="` + code + `"}`,
+				Metric: "requests_total",
+				Labels: []metrics.Label{{Name: "code", Value: code}},
+				Value:  v,
+			}})
+		}
+		return dump
+	}
+
+	a, err := parseAssertion("requests_total > 10")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if violations, matched := a.check(observe(5, 8)); len(violations) != 0 || matched != 2 {
+		t.Errorf("Expected no violations of 2 series, but got %q of %d", violations, matched)
+	}
+	expected := []string{`requests_total {code="200"} = 20 (violated)`, `requests_total {code="500"} = 8`}
+	if violations, _ := a.check(observe(20, 8)); strings.Join(violations, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, but got %q", expected, violations)
+	}
+
+	a, err = parseAssertion(`increase(requests_total{code="500"}) > 5`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, tt := range []struct {
+		values   []float64
+		violated bool
+	}{
+		{values: []float64{100, 100}},
+		{values: []float64{200, 104}},
+		// The reset counts as an increase by 2.
+		{values: []float64{300, 2}, violated: true},
+	} {
+		if violations, matched := a.check(observe(tt.values...)); (len(violations) > 0) != tt.violated || matched != 1 {
+			t.Errorf("%d: Expected violated %v, but got %q of %d", i, tt.violated, violations, matched)
+		}
+	}
+
+	a, err = parseAssertion("missing > 0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if violations, matched := a.check(observe(1, 2)); len(violations) != 0 || matched != 0 {
+		t.Errorf("Expected no matches, but got %q of %d", violations, matched)
+	}
+}
+
+func TestRunAssertions(t *testing.T) {
+	tests := []struct {
+		assertion string
+		ok        bool
+		output    string
+	}{
+		{assertion: "go_goroutines > 100", ok: true},
+		{assertion: "go_goroutines > 10", output: "assertion failed: go_goroutines > 10\n  go_goroutines = 42 (violated)\n"},
+		{assertion: "increase(http_requests_total) > 0", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.assertion, func(t *testing.T) {
+			a, err := parseAssertion(tt.assertion)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			tgt := &target{store: metrics.NewStore(5, metrics.NewFileFetcher("../../metrics/testdata/metrics.prom"))}
+			if _, err := tgt.store.Sample(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var sb strings.Builder
+			stats, ok := runAssertions(context.Background(), tgt, []*assertion{a}, runStats{samples: 1}, 3, time.Millisecond, &sb)
+			if ok != tt.ok || sb.String() != tt.output {
+				t.Errorf("Expected %v %q, but got %v %q", tt.ok, tt.output, ok, sb.String())
+			}
+			if tt.ok && stats.samples != 3 {
+				t.Errorf("Expected 3 samples, but got %v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// writeOSC52 writes the OSC 52 escape sequence setting the clipboard of the
+// terminal to the given text. Unlike the local clipboard, it also works over
+// SSH (if the terminal supports it).
+func writeOSC52(w io.Writer, text string) error {
+	_, err := fmt.Fprintf(w, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// copyText copies the given text to the clipboard of the terminal (see
+// writeOSC52) and, if available, to the local clipboard. It returns an error
+// only if both fail.
+func (m *model) copyText(text string) error {
+	err := writeOSC52(m.terminal, text)
+	if m.copyLocal == nil {
+		return err
+	}
+	if localErr := m.copyLocal(text); localErr != nil && err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
+// yank copies the name of the top row of the viewport (along with its value
+// with value) and reports it in the footer. The name of a series is copied
+// as exposed by the endpoint (see rawName).
+func (m *model) yank(value bool) {
+	i := m.viewport.YOffset
+	if i >= len(m.rows) {
+		return
+	}
+	r := m.rows[i]
+	text := r.name
+	if len(r.obs) > 0 && r.obs[0].Name == r.name {
+		text = rawName(r.obs[0])
+	}
+	if value {
+		// The value is copied unrounded.
+		text += " " + format(r.value)
+	}
+	if err := m.copyText(text); err != nil {
+		m.flashMessage("copy failed: " + err.Error())
+		return
+	}
+	m.flashMessage("copied " + printable(text))
+}
+
+// rawName returns the flat name of the given observation (e.g.
+// `http_requests_total {code="200"}`) with its metric name and label values
+// as exposed by the endpoint, i.e. without escaping their control characters
+// (see metrics.FlatName).
+func rawName(o metrics.Observation) string {
+	if len(o.Labels) == 0 {
+		return o.Metric
+	}
+	var sb strings.Builder
+	sb.WriteString(o.Metric + " {")
+	for i, l := range o.Labels {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(metrics.QuoteName(l.Name) + `="` + l.Value + `"`)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestModel_Yank(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := os.WriteFile(path, []byte("# TYPE a gauge\na{x=\"1\"} 0.123456789\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	var terminal bytes.Buffer
+	var local string
+	m := &model{
+		targets:   []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		keys:      newKeymap(),
+		viewport:  viewport.New(80, 1),
+		terminal:  &terminal,
+		copyLocal: func(s string) error { local = s; return nil },
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"y", `a {x="1"}`},
+		{"Y", `a {x="1"} 0.123456789`},
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	for _, tt := range tests {
+		terminal.Reset()
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(tt.key)})
+		osc := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(tt.expected)) + "\a"
+		if terminal.String() != osc || local != tt.expected {
+			t.Errorf("Expected %q to be copied, but got %q and %q", tt.expected, terminal.String(), local)
+		}
+		if expected := "copied " + tt.expected; m.flash != expected {
+			t.Errorf("Expected %q, but got %q", expected, m.flash)
+		}
+	}
+
+	// Copying succeeds if either clipboard does.
+	m.copyLocal = func(string) error { return errors.New("no clipboard") }
+	if err := m.copyText("a"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRawName(t *testing.T) {
+	tests := []struct {
+		o        metrics.Observation
+		expected string
+	}{
+		{metrics.NewObservation("up", nil, metrics.ObservationGauge, time.Now(), 1), "up"},
+		{metrics.NewObservation("a", []metrics.Label{{Name: "x", Value: "1\n2"}, {Name: "service.name", Value: "b"}}, metrics.ObservationGauge, time.Now(), 1), "a {x=\"1\n2\", \"service.name\"=\"b\"}"},
+	}
+	for _, tt := range tests {
+		if actual := rawName(tt.o); actual != tt.expected {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// commonLabels returns the labels (name and value) shared by all the given
+// rows, except those of the synthetic series (see metrics.SeriesUp) and of
+// expressions, in the order of the first row. There are none for fewer than
+// two rows, which would leave nothing to tell apart.
+func commonLabels(rows []row) []metrics.Label {
+	var common []metrics.Label
+	n := 0
+	for _, r := range rows {
+		if isSynthetic(r.obs[0].Metric) || r.obs[0].Kind == metrics.ObservationExpression {
+			continue
+		}
+		labels := r.obs[0].Labels
+		if n++; n == 1 {
+			common = slices.Clone(labels)
+			continue
+		}
+		common = slices.DeleteFunc(common, func(l metrics.Label) bool { return !slices.Contains(labels, l) })
+		if len(common) == 0 {
+			return nil
+		}
+	}
+	if n < 2 {
+		return nil
+	}
+	return common
+}
+
+// isSynthetic returns true, if the given metric is one of the synthetic series
+// describing the scrape (see metrics.SeriesUp).
+func isSynthetic(metric string) bool {
+	return metric == metrics.SeriesUp || metric == metrics.SeriesScrapeDuration || metric == metrics.SeriesScrapeSamples
+}
+
+// withoutLabels returns the flat name of the given series without the given
+// labels.
+func withoutLabels(o metrics.Observation, labels []metrics.Label) string {
+	rest := slices.DeleteFunc(slices.Clone(o.Labels), func(l metrics.Label) bool { return slices.Contains(labels, l) })
+	return metrics.FlatName(o.Metric, rest)
+}
+
+// labelsText returns the given labels as in flat names, without the braces
+// (e.g. `instance="10.0.3.4:9100", job="node"`).
+func labelsText(labels []metrics.Label) string {
+	return strings.TrimSuffix(strings.TrimPrefix(metrics.FlatName("", labels), " {"), "}")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestCommonLabels(t *testing.T) {
+	now := time.Now()
+	newRow := func(labels ...metrics.Label) row {
+		return row{obs: []metrics.Observation{metrics.NewObservation("up", labels, metrics.ObservationGauge, now, 1)}}
+	}
+	job, instance := metrics.Label{Name: "job", Value: "node"}, metrics.Label{Name: "instance", Value: "10.0.3.4:9100"}
+	tests := []struct {
+		name     string
+		rows     []row
+		expected []metrics.Label
+	}{
+		{"shared", []row{newRow(instance, job, metrics.Label{Name: "cpu", Value: "0"}), newRow(instance, job, metrics.Label{Name: "cpu", Value: "1"})}, []metrics.Label{instance, job}},
+		{"different values", []row{newRow(job), newRow(metrics.Label{Name: "job", Value: "api"})}, nil},
+		{"missing", []row{newRow(job), newRow()}, nil},
+		{"single row", []row{newRow(job)}, nil},
+		{"no rows", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := commonLabels(tt.rows); !slices.Equal(actual, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestModel_HoistLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE node_cpu_seconds_total counter\n" +
+		"node_cpu_seconds_total{cpu=\"0\",instance=\"10.0.3.4:9100\",job=\"node\"} 1\n" +
+		"node_cpu_seconds_total{cpu=\"1\",instance=\"10.0.3.4:9100\",job=\"node\"} 2\n" +
+		"# TYPE node_load1 gauge\nnode_load1{instance=\"10.0.3.4:9100\",job=\"node\"} 0.5\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		height:   12,
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+	if m.viewport.Height != 10 {
+		t.Errorf("Expected a viewport of 10 lines, but got %d", m.viewport.Height)
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlV})
+	if expected := `common labels: instance="10.0.3.4:9100", job="node"`; !strings.Contains(m.headerView(), expected) {
+		t.Errorf("Expected %q in the header, but got %q", expected, m.headerView())
+	}
+	if m.viewport.Height != 9 {
+		t.Errorf("Expected the viewport to make room for the common labels, but got %d lines", m.viewport.Height)
+	}
+	view := m.viewport.View()
+	for _, expected := range []string{`node_cpu_seconds_total {cpu="0"} 1`, "node_load1 0.5"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("Expected %q in the view, but got %q", expected, view)
+		}
+	}
+	if !hasRow(m, `node_load1 {instance="10.0.3.4:9100", job="node"}`) {
+		t.Errorf("Expected the rows to keep their names")
+	}
+	// Exports show the full names.
+	if export := m.renderMetrics(lipgloss.NewStyle()); !strings.Contains(export, ` node_load1 {instance="10.0.3.4:9100", job="node"} 0.5`) {
+		t.Errorf("Expected the full names in the export, but got %q", export)
+	}
+
+	// The common labels follow the search.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("cpu")})
+	m.metricsView()
+	if expected := `common labels: instance="10.0.3.4:9100", job="node"`; !strings.Contains(m.headerView(), expected) {
+		t.Errorf("Expected %q in the header, but got %q", expected, m.headerView())
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(`{cpu="0"}`)})
+	m.metricsView()
+	if strings.Contains(m.headerView(), "common labels") || m.viewport.Height != 10 {
+		t.Errorf("Expected no common labels of a single row, but got %q", m.headerView())
+	}
+}
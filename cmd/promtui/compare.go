@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/maruel/natural"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// comparison is a series compared between two targets (A and B). Either side
+// may be missing.
+type comparison struct {
+	name string
+	a, b *metrics.Observation
+}
+
+// diverges returns true, if the values of both sides differ by more than the
+// given tolerance relative to the larger one.
+func (c comparison) diverges(tolerance float64) bool {
+	if c.a == nil || c.b == nil {
+		return true
+	}
+	a, b := c.a.Value, c.b.Value
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) != math.IsNaN(b)
+	}
+	if a == b {
+		return false
+	}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return true
+	}
+	return math.Abs(a-b) > tolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// latest returns the latest observation of each (derived) series of the given
+// dump, keyed by name. Stale series are left out.
+func latest(dump [][]metrics.Observation, d metrics.Deriver, showDerived bool) map[string]metrics.Observation {
+	obs := make(map[string]metrics.Observation)
+	for _, series := range dump {
+		for _, s := range d.Derive(series) {
+			if len(s) == 0 || s[0].Stale || (!showDerived && isDerived(s[0].Kind)) {
+				continue
+			}
+			obs[s[0].Name] = s[0]
+		}
+	}
+	return obs
+}
+
+// compare compares the latest observations of two targets. The comparisons
+// cover the union of the series of both targets, naturally sorted by name.
+func compare(a, b map[string]metrics.Observation) []comparison {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(natural.StringSlice(names))
+
+	comparisons := make([]comparison, 0, len(names))
+	for _, name := range names {
+		c := comparison{name: name}
+		if o, ok := a[name]; ok {
+			c.a = &o
+		}
+		if o, ok := b[name]; ok {
+			c.b = &o
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+// renderComparisons renders the comparisons one per line (name, value of A,
+// value of B, and difference). Diverging values are highlighted.
+func renderComparisons(comparisons []comparison, tolerance float64, f valueFormatter, st styles, maxWidthStyle lipgloss.Style) string {
+	value := func(o *metrics.Observation, side string) string {
+		switch {
+		case o == nil:
+			return "missing on " + side
+		}
+		if v, ok := special(o.Value, st.glyphs); ok {
+			return v
+		}
+		return f.value(*o, o.Value)
+	}
+
+	nameWidth, aWidth := 0, 0
+	for _, c := range comparisons {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(c.name))
+		aWidth = max(aWidth, utf8.RuneCountInString(value(c.a, "A")))
+	}
+
+	var sb strings.Builder
+	for _, c := range comparisons {
+		prefix := " "
+		if o := c.a; (o != nil && isDerived(o.Kind)) || (o == nil && isDerived(c.b.Kind)) {
+			prefix = "+"
+		}
+		s := fmt.Sprintf("%s%-*s  %-*s  %s", prefix, nameWidth, c.name, aWidth, value(c.a, "A"), value(c.b, "B"))
+		if !c.diverges(tolerance) {
+			sb.WriteString(maxWidthStyle.Render(s) + "\n")
+			continue
+		}
+		s = st.changed.Render(s)
+		if c.a != nil && c.b != nil && finite(c.a.Value) && finite(c.b.Value) {
+			delta := c.b.Value - c.a.Value
+			sign := "+"
+			if delta < 0 {
+				sign = "-"
+			}
+			s += st.increase.Render(" (" + sign + f.delta(*c.a, math.Abs(delta)) + ")")
+		}
+		sb.WriteString(maxWidthStyle.Render(s) + "\n")
+	}
+	return sb.String()
+}
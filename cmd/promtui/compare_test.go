@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestCompare(t *testing.T) {
+	obs := func(name string, value float64) metrics.Observation {
+		return metrics.NewObservation(name, nil, metrics.ObservationGauge, time.Now(), value)
+	}
+	a := map[string]metrics.Observation{
+		"queue_depth_10": obs("queue_depth_10", 500),
+		"queue_depth_2":  obs("queue_depth_2", 10),
+		"only_a":         obs("only_a", 1),
+	}
+	b := map[string]metrics.Observation{
+		"queue_depth_10": obs("queue_depth_10", 10),
+		"queue_depth_2":  obs("queue_depth_2", 10.5),
+		"only_b":         obs("only_b", 1),
+	}
+	comparisons := compare(a, b)
+
+	expected := []struct {
+		name     string
+		diverges bool
+	}{
+		{"only_a", true},
+		{"only_b", true},
+		{"queue_depth_2", false},
+		{"queue_depth_10", true},
+	}
+	if len(comparisons) != len(expected) {
+		t.Fatalf("Expected %d comparisons, but got %d", len(expected), len(comparisons))
+	}
+	for i, e := range expected {
+		c := comparisons[i]
+		if c.name != e.name {
+			t.Errorf("Expected %q, but got %q", e.name, c.name)
+		}
+		if c.diverges(0.1) != e.diverges {
+			t.Errorf("Expected divergence %v for %q", e.diverges, c.name)
+		}
+	}
+
+	out := renderComparisons(comparisons, 0.1, valueFormatter{decimals: 2}, newStyles(nil, false), lipgloss.NewStyle())
+	if !strings.Contains(out, "missing on B") || !strings.Contains(out, "missing on A") {
+		t.Errorf("Expected missing series to be marked, but got %q", out)
+	}
+}
+
+func TestComparison_Diverges(t *testing.T) {
+	tests := []struct {
+		a, b     float64
+		expected bool
+	}{
+		{1, 1, false},
+		{100, 109, false},
+		{100, 120, true},
+		{-100, 100, true},
+		{0, 0, false},
+		{math.NaN(), math.NaN(), false},
+		{math.NaN(), 1, true},
+		{math.Inf(1), math.Inf(1), false},
+		{math.Inf(1), 1, true},
+	}
+	for _, tt := range tests {
+		a := metrics.NewObservation("a", nil, metrics.ObservationGauge, time.Now(), tt.a)
+		b := metrics.NewObservation("a", nil, metrics.ObservationGauge, time.Now(), tt.b)
+		if actual := (comparison{a: &a, b: &b}).diverges(0.1); actual != tt.expected {
+			t.Errorf("Expected %v for %v and %v, but got %v", tt.expected, tt.a, tt.b, actual)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables setting flags (e.g.
+// PROMTUI_RATE_WINDOW sets -rate-window).
+const envPrefix = "PROMTUI_"
+
+// unconfigurable are the flags that can only be given on the command line.
+var unconfigurable = map[string]bool{
+	"help":         true,
+	"version":      true,
+	"config":       true,
+	"print-config": true,
+	"list-targets": true,
+}
+
+// profilesKey is the config key of the named target profiles.
+const profilesKey = "targets"
+
+// keysKey is the config key of the key bindings overriding the default ones
+// (see keymap.remap).
+const keysKey = "keys"
+
+// listFlag is a flag that may be given multiple times. In the config file it
+// is set by a list and in the environment by newline-separated values.
+type listFlag interface {
+	flag.Value
+	values() []string
+}
+
+// defaultConfigPath returns the path of the config file used if -config is
+// not given (e.g. ~/.config/promtui/config.yaml).
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "promtui", "config.yaml")
+}
+
+// envName returns the name of the environment variable setting the flag with
+// the given name.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig reads the config file at the given path, which maps flag names to
+// values (or lists of values for flags that may be given multiple times). A
+// missing file (or an empty path) is an error only if required.
+func loadConfig(path string, required bool) (map[string]any, error) {
+	if path == "" && !required {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var config map[string]any
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// applyConfig sets the flags of flags that have not been set on the command line
+// from the environment (see envName) or, if not set there either, from the
+// given config. Unknown keys of the config are reported on warn, so that
+// configs of newer versions still work.
+func applyConfig(flags *flag.FlagSet, config map[string]any, lookupEnv func(string) (string, bool), warn io.Writer) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for key := range config {
+		if f := flags.Lookup(key); f == nil || unconfigurable[key] {
+			fmt.Fprintf(warn, "Warning: unknown config key %q\n", key)
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || unconfigurable[f.Name] {
+			return
+		}
+		_, isList := f.Value.(listFlag)
+		if v, ok := lookupEnv(envName(f.Name)); ok {
+			values := []string{v}
+			if isList {
+				values = strings.Split(v, "\n")
+			}
+			if err = setAll(flags, f.Name, values); err != nil {
+				err = fmt.Errorf("environment variable %s: %w", envName(f.Name), err)
+			}
+			return
+		}
+		v, ok := config[f.Name]
+		if !ok {
+			return
+		}
+		var values []string
+		switch v := v.(type) {
+		case []any:
+			if !isList {
+				err = fmt.Errorf("config key %q: expected a single value, but got a list", f.Name)
+				return
+			}
+			for _, e := range v {
+				values = append(values, fmt.Sprint(e))
+			}
+		case map[string]any:
+			err = fmt.Errorf("config key %q: expected a value, but got a map", f.Name)
+			return
+		case nil:
+			return
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		if err = setAll(flags, f.Name, values); err != nil {
+			err = fmt.Errorf("config key %q: %w", f.Name, err)
+		}
+	})
+	return err
+}
+
+// profiles removes the named target profiles (each mapping flag names to
+// values, like the config itself) from the given config and returns them.
+func profiles(config map[string]any) (map[string]map[string]any, error) {
+	v, ok := config[profilesKey]
+	delete(config, profilesKey)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("config key %q: expected a map of profiles", profilesKey)
+	}
+	ps := make(map[string]map[string]any, len(m))
+	for name, p := range m {
+		switch p := p.(type) {
+		case map[string]any:
+			ps[name] = p
+		case nil:
+			ps[name] = nil
+		default:
+			return nil, fmt.Errorf("profile %q: expected a map", name)
+		}
+	}
+	return ps, nil
+}
+
+// keyBindings removes the key bindings (mapping binding names to a key or a
+// list of keys) from the given config and returns them.
+func keyBindings(config map[string]any) (map[string][]string, error) {
+	v, ok := config[keysKey]
+	delete(config, keysKey)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("config key %q: expected a map of key bindings", keysKey)
+	}
+	bindings := make(map[string][]string, len(m))
+	for name, keys := range m {
+		switch keys := keys.(type) {
+		case []any:
+			for _, k := range keys {
+				bindings[name] = append(bindings[name], fmt.Sprint(k))
+			}
+		case map[string]any, nil:
+			return nil, fmt.Errorf("key binding %q: expected a key or a list of keys", name)
+		default:
+			bindings[name] = []string{fmt.Sprint(keys)}
+		}
+	}
+	return bindings, nil
+}
+
+// profileNames returns the sorted names of the given profiles.
+func profileNames(ps map[string]map[string]any) []string {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveTarget returns the profile with the given name. If there is none and
+// the name is not an endpoint (a URL or - for stdin), it returns an error
+// hinting at similar profile names.
+func resolveTarget(name string, ps map[string]map[string]any) (profile map[string]any, isProfile bool, err error) {
+	if p, ok := ps[name]; ok {
+		return p, true, nil
+	}
+	if name == "-" || strings.Contains(name, "://") {
+		return nil, false, nil
+	}
+	if similar := closeMatches(name, profileNames(ps)); len(similar) > 0 {
+		return nil, false, fmt.Errorf("unknown target %q (did you mean %s?)", name, strings.Join(similar, ", "))
+	}
+	return nil, false, fmt.Errorf("unknown target %q (see -list-targets)", name)
+}
+
+// closeMatches returns those of the given names that contain s or are within a
+// small edit distance of it.
+func closeMatches(s string, names []string) []string {
+	var matches []string
+	for _, name := range names {
+		if strings.Contains(name, s) || strings.Contains(s, name) ||
+			levenshtein(s, name) <= max(2, len(s)/3) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// levenshtein returns the edit distance of the given strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = slices.Min([]int{prev[j] + 1, cur[j-1] + 1, prev[j-1] + cost})
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// setAll sets the flag with the given name to each of the given values.
+func setAll(flags *flag.FlagSet, name string, values []string) error {
+	for _, v := range values {
+		if err := flags.Set(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printConfig writes the effective configuration (the values of all
+// configurable flags) as YAML to w.
+func printConfig(flags *flag.FlagSet, w io.Writer) error {
+	config := make(map[string]any)
+	flags.VisitAll(func(f *flag.Flag) {
+		if unconfigurable[f.Name] {
+			return
+		}
+		switch v := f.Value.(type) {
+		case listFlag:
+			config[f.Name] = v.values()
+		case flag.Getter:
+			switch g := v.Get().(type) {
+			case bool, int, float64:
+				config[f.Name] = g
+			default:
+				config[f.Name] = v.String()
+			}
+		default:
+			config[f.Name] = v.String()
+		}
+	})
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(config); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return enc.Close()
+}
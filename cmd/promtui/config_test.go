@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFlags returns a flag set with a few flags resembling those of main.
+func newTestFlags() (*flag.FlagSet, *endpointsFlag, *time.Duration, *string, *int) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	endpoints := &endpointsFlag{endpoints: []string{"http://localhost/metrics"}}
+	fs.Var(endpoints, "endpoint", "")
+	interval := fs.Duration("interval", 5*time.Second, "")
+	search := fs.String("search", "", "")
+	history := fs.Int("history", 3, "")
+	fs.Bool("help", false, "")
+	return fs, endpoints, interval, search, history
+}
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `endpoint:
+  - http://a/metrics
+  - http://b/metrics
+interval: 2s
+search: from_file
+history: 10
+unknown: 1
+help: true
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config, err := loadConfig(path, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fs, endpoints, interval, search, history := newTestFlags()
+	if err := fs.Parse([]string{"-history", "5"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	env := map[string]string{"PROMTUI_SEARCH": "from_env"}
+	lookupEnv := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+	var warn strings.Builder
+	if err := applyConfig(fs, config, lookupEnv, &warn); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if expected := []string{"http://a/metrics", "http://b/metrics"}; !slices.Equal(endpoints.endpoints, expected) {
+		t.Errorf("Expected %v, but got %v", expected, endpoints.endpoints)
+	}
+	if *interval != 2*time.Second {
+		t.Errorf("Expected %v, but got %v", 2*time.Second, *interval)
+	}
+	if *search != "from_env" {
+		t.Errorf("Expected %v, but got %v", "from_env", *search)
+	}
+	if *history != 5 {
+		t.Errorf("Expected %v, but got %v", 5, *history)
+	}
+	for _, key := range []string{`"unknown"`, `"help"`} {
+		if !strings.Contains(warn.String(), key) {
+			t.Errorf("Expected a warning about %s, but got %q", key, warn.String())
+		}
+	}
+}
+
+func TestApplyConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]any
+		env    map[string]string
+	}{
+		{name: "list", config: map[string]any{"search": []any{"a", "b"}}},
+		{name: "map", config: map[string]any{"search": map[string]any{"a": "b"}}},
+		{name: "invalid", config: map[string]any{"interval": "often"}},
+		{name: "invalid env", env: map[string]string{"PROMTUI_HISTORY": "many"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _, _, _, _ := newTestFlags()
+			lookupEnv := func(k string) (string, bool) { v, ok := tt.env[k]; return v, ok }
+			var warn strings.Builder
+			if err := applyConfig(fs, tt.config, lookupEnv, &warn); err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if config, err := loadConfig(path, false); err != nil || config != nil {
+		t.Errorf("Expected no config, but got %v (%v)", config, err)
+	}
+	if _, err := loadConfig(path, true); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	fs, _, _, _, _ := newTestFlags()
+	if err := fs.Parse([]string{"-endpoint", "http://a/metrics,http://b/metrics", "-interval", "1m"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var sb strings.Builder
+	if err := printConfig(fs, &sb); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `endpoint:
+  - http://a/metrics
+  - http://b/metrics
+history: 3
+interval: 1m0s
+search: ""
+`
+	if sb.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, sb.String())
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	config := map[string]any{
+		"interval": "2s",
+		"targets": map[string]any{
+			"prod-api":    map[string]any{"endpoint": "http://prod/metrics"},
+			"staging-api": map[string]any{"endpoint": "http://staging/metrics"},
+			"empty":       nil,
+		},
+	}
+	ps, err := profiles(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := config["targets"]; ok {
+		t.Errorf("Expected the profiles to be removed from the config, but got %v", config)
+	}
+	if expected := []string{"empty", "prod-api", "staging-api"}; !slices.Equal(profileNames(ps), expected) {
+		t.Errorf("Expected %v, but got %v", expected, profileNames(ps))
+	}
+
+	if _, err := profiles(map[string]any{"targets": []any{"prod-api"}}); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
+
+func TestKeyBindings(t *testing.T) {
+	config := map[string]any{
+		"interval": "2s",
+		"keys":     map[string]any{"pause": "space", "refresh": []any{"r", "ctrl+r"}},
+	}
+	bindings, err := keyBindings(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := config["keys"]; ok {
+		t.Errorf("Expected the key bindings to be removed from the config, but got %v", config)
+	}
+	if !slices.Equal(bindings["pause"], []string{"space"}) || !slices.Equal(bindings["refresh"], []string{"r", "ctrl+r"}) {
+		t.Errorf("Expected pause and refresh to be remapped, but got %v", bindings)
+	}
+
+	if _, err := keyBindings(map[string]any{"keys": []any{"space"}}); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	ps := map[string]map[string]any{
+		"prod-api":    {"endpoint": "http://prod/metrics"},
+		"staging-api": {"endpoint": "http://staging/metrics"},
+		"worker":      {"endpoint": "http://worker/metrics"},
+	}
+	tests := []struct {
+		name      string
+		isProfile bool
+		err       string
+	}{
+		{name: "prod-api", isProfile: true},
+		{name: "http://localhost:9100/metrics"},
+		{name: "-"},
+		{name: "prod-ap", err: `unknown target "prod-ap" (did you mean prod-api?)`},
+		{name: "api", err: `unknown target "api" (did you mean prod-api, staging-api?)`},
+		{name: "database", err: `unknown target "database" (see -list-targets)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, isProfile, err := resolveTarget(tt.name, ps)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if isProfile != tt.isProfile {
+				t.Errorf("Expected %v, but got %v", tt.isProfile, isProfile)
+			}
+		})
+	}
+}
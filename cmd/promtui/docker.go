@@ -0,0 +1,246 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// defaultDockerHost is the Docker daemon talked to, unless overridden by
+// DOCKER_HOST.
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerTarget is a container scraped at the host port its port is published
+// on (or else at its bridge IP), given as <container>:<port>[/<path>] (e.g.
+// api:9090/metrics).
+type dockerTarget struct {
+	container, port, path string
+}
+
+// parseDockerTarget parses the given container target (see dockerTarget). The
+// path defaults to /metrics.
+func parseDockerTarget(s string) (dockerTarget, error) {
+	container, rest, _ := strings.Cut(s, ":")
+	port, path, _ := strings.Cut(rest, "/")
+	if container == "" || port == "" {
+		return dockerTarget{}, fmt.Errorf("missing container or port in %q (expected <container>:<port>[/<path>])", s)
+	}
+	if path == "" {
+		path = "metrics"
+	}
+	return dockerTarget{container: container, port: port, path: "/" + path}, nil
+}
+
+// dockerInspect is the part of the inspection of a container needed to reach
+// it.
+type dockerInspect struct {
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+		IPAddress string `json:"IPAddress"`
+		Networks  map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerClient talks to the API of the Docker daemon (see DOCKER_HOST).
+type dockerClient struct {
+	base   string
+	client *http.Client
+}
+
+// newDockerClient returns a client of the Docker daemon given by DOCKER_HOST
+// (a unix socket or a TCP address), or of defaultDockerHost.
+func newDockerClient() (*dockerClient, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("parse DOCKER_HOST: %w", err)
+	}
+	switch u.Scheme {
+	case "unix":
+		transport := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", u.Path)
+		}}
+		return &dockerClient{base: "http://docker", client: &http.Client{Transport: transport}}, nil
+	case "tcp", "http":
+		return &dockerClient{base: "http://" + u.Host, client: &http.Client{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported DOCKER_HOST %q", host)
+}
+
+// resolve returns the endpoint of the given target: the published host port
+// of its port (on localhost, if published on all interfaces), or else its
+// bridge IP.
+func (c *dockerClient) resolve(ctx context.Context, t dockerTarget) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/containers/"+url.PathEscape(t.container)+"/json", nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("inspect container %s: %w", t.container, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("container %s not found", t.container)
+	default:
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		return "", fmt.Errorf("inspect container %s: %s %s", t.container, resp.Status, e.Message)
+	}
+	var inspect dockerInspect
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return "", fmt.Errorf("inspect container %s: %w", t.container, err)
+	}
+
+	for _, b := range inspect.NetworkSettings.Ports[t.port+"/tcp"] {
+		if b.HostPort == "" {
+			continue
+		}
+		ip := b.HostIP
+		switch ip {
+		case "", "0.0.0.0":
+			ip = "127.0.0.1"
+		case "::":
+			ip = "::1"
+		}
+		return "http://" + net.JoinHostPort(ip, b.HostPort) + t.path, nil
+	}
+	ip := inspect.NetworkSettings.IPAddress
+	for _, name := range slices.Sorted(maps.Keys(inspect.NetworkSettings.Networks)) {
+		ip = cmp.Or(ip, inspect.NetworkSettings.Networks[name].IPAddress)
+	}
+	if ip == "" {
+		return "", fmt.Errorf("container %s neither publishes port %s nor has an IP address", t.container, t.port)
+	}
+	return "http://" + net.JoinHostPort(ip, t.port) + t.path, nil
+}
+
+// dockerFetcher is a Fetcher of the metrics of a container. The endpoint of
+// the container is resolved on the first fetch and again whenever a fetch
+// fails (e.g. as the container was restarted and published on another port).
+type dockerFetcher struct {
+	target    dockerTarget
+	docker    *dockerClient
+	userAgent string
+
+	mux      sync.Mutex
+	fetcher  *metrics.HTTPFetcher
+	interval time.Duration
+}
+
+func (f *dockerFetcher) Fetch(ctx context.Context) (io.ReadCloser, time.Time, error) {
+	f.mux.Lock()
+	fetcher := f.fetcher
+	f.mux.Unlock()
+	var fetchErr error
+	if fetcher != nil {
+		r, t, err := fetcher.Fetch(ctx)
+		if err == nil {
+			return r, t, nil
+		}
+		fetchErr = err
+	}
+	endpoint, err := f.docker.resolve(ctx, f.target)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if fetchErr != nil && endpoint == fetcher.Endpoint {
+		return nil, time.Time{}, fetchErr
+	}
+	next := metrics.NewHTTPFetcher(endpoint)
+	next.UserAgent = f.userAgent
+	f.mux.Lock()
+	next.SetInterval(f.interval)
+	f.mux.Unlock()
+	if fetcher != nil {
+		// The client is kept, without its connections to the previous
+		// endpoint.
+		fetcher.CloseIdleConnections()
+		next.Client = fetcher.Client
+	}
+	fetcher = next
+	f.mux.Lock()
+	f.fetcher = fetcher
+	f.mux.Unlock()
+	return fetcher.Fetch(ctx)
+}
+
+// CloseIdleConnections closes the connections kept alive to the endpoint of
+// the container (see metrics.HTTPFetcher.CloseIdleConnections).
+func (f *dockerFetcher) CloseIdleConnections() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.fetcher != nil {
+		f.fetcher.CloseIdleConnections()
+	}
+}
+
+// SetInterval sets the interval the container is fetched at (see
+// metrics.HTTPFetcher.SetInterval).
+func (f *dockerFetcher) SetInterval(d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.interval = d
+	if f.fetcher != nil {
+		f.fetcher.SetInterval(d)
+	}
+}
+
+// ClockSkew returns the clock skew of the container (see
+// metrics.HTTPFetcher.ClockSkew).
+func (f *dockerFetcher) ClockSkew() time.Duration {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.fetcher == nil {
+		return 0
+	}
+	return f.fetcher.ClockSkew()
+}
+
+// Dated returns true, if the latest fetch was timed by the container (see
+// metrics.HTTPFetcher.Dated).
+func (f *dockerFetcher) Dated() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.fetcher != nil && f.fetcher.Dated()
+}
+
+// newDockerSource returns the source of the given container target (see
+// dockerTarget).
+func newDockerSource(spec string, opts httpOptions) (source, error) {
+	t, err := parseDockerTarget(spec)
+	if err != nil {
+		return source{}, err
+	}
+	docker, err := newDockerClient()
+	if err != nil {
+		return source{}, err
+	}
+	return source{fetcher: &dockerFetcher{target: t, docker: docker, userAgent: opts.userAgent, interval: opts.interval}}, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseDockerTarget(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected dockerTarget
+		err      bool
+	}{
+		{"api:9090/metrics", dockerTarget{"api", "9090", "/metrics"}, false},
+		{"api:9090", dockerTarget{"api", "9090", "/metrics"}, false},
+		{"api:8080/actuator/prometheus", dockerTarget{"api", "8080", "/actuator/prometheus"}, false},
+		{"api", dockerTarget{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			actual, err := parseDockerTarget(tt.spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected %+v, but got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDockerFetcher_Fetch(t *testing.T) {
+	var failing atomic.Bool
+	closed := make(chan struct{}, 1)
+	metricsSrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "up 1\n")
+	}))
+	metricsSrv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	metricsSrv.Start()
+	defer metricsSrv.Close()
+	u, _ := url.Parse(metricsSrv.URL)
+	_, livePort, _ := net.SplitHostPort(u.Host)
+
+	// A port nothing listens on, as of a container before its restart.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, deadPort, _ := net.SplitHostPort(l.Addr().String())
+	_ = l.Close()
+
+	var hostPort atomic.Value
+	hostPort.Store(deadPort)
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ul, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets not supported: %v", err)
+	}
+	dockerSrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/api/json" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"message":"No such container"}`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"NetworkSettings":{"Ports":{"9090/tcp":[{"HostIp":"0.0.0.0","HostPort":%q}]}}}`, hostPort.Load())
+	}))
+	dockerSrv.Listener = ul
+	dockerSrv.Start()
+	defer dockerSrv.Close()
+	t.Setenv("DOCKER_HOST", "unix://"+socket)
+
+	src, err := newDockerSource("api:9090/metrics", httpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := src.fetcher.Fetch(context.Background()); err == nil {
+		t.Fatalf("Expected error for the port nothing listens on")
+	}
+
+	// Restarted with another port, the container is resolved again.
+	hostPort.Store(livePort)
+	r, _, err := src.fetcher.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "up 1\n" {
+		t.Errorf("Unexpected body %q", b)
+	}
+	_ = r.Close()
+
+	// Moved again, the connections to the previous port are closed.
+	otherSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "up 1\n")
+	}))
+	defer otherSrv.Close()
+	u, _ = url.Parse(otherSrv.URL)
+	_, otherPort, _ := net.SplitHostPort(u.Host)
+	failing.Store(true)
+	hostPort.Store(otherPort)
+	if r, _, err = src.fetcher.Fetch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = r.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the connection to the previous port closed")
+	}
+
+	src, _ = newDockerSource("gone:9090", httpOptions{})
+	if _, _, err := src.fetcher.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "container gone not found") {
+		t.Errorf("Expected error for a missing container, but got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// connectTimeout bounds the first sample of an endpoint without an interval
+// (see firstSampleTimeout).
+const connectTimeout = 10 * time.Second
+
+// firstSampleTimeout returns the timeout of the first sample of an endpoint
+// opened at runtime or probed: the given interval, or connectTimeout without
+// one.
+func firstSampleTimeout(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return connectTimeout
+	}
+	return interval
+}
+
+// endpointMsg is sent once the first sample of an endpoint opened at runtime
+// (see openEndpoint) is done. gen is the generation of the endpoint (see
+// model.connectGen).
+type endpointMsg struct {
+	target *target
+	gen    int
+	error  error
+}
+
+// openEndpoint switches to the target of the given endpoint. Known targets are
+// switched to right away, new ones once their first sample succeeded (see
+// updateEndpoint), for which the returned command samples them within the
+// interval (or connectTimeout without one). Endpoints that cannot be opened
+// keep the prompt open, showing the error.
+func (m *model) openEndpoint(endpoint string) tea.Cmd {
+	if i := slices.IndexFunc(m.targets, func(t *target) bool { return t.endpoint == endpoint }); i >= 0 {
+		m.prompting, m.current = promptNone, i
+		m.metricsView()
+		return nil
+	}
+	src, err := newSource(endpoint, m.httpOptions)
+	if err == nil && src.once {
+		err = errors.New("cannot read stdin at runtime")
+	}
+	if err != nil {
+		m.promptError = err.Error()
+		return nil
+	}
+	t := &target{source: src, endpoint: endpoint, store: m.newStore(src.fetcher)}
+	timeout := firstSampleTimeout(m.interval)
+	m.cancelEndpoint()
+	m.connectGen++
+	gen := m.connectGen
+	ctx, cancel := context.WithTimeout(m.sampleContext(), timeout)
+	m.connecting, m.cancelConnect, m.promptError = true, cancel, ""
+	return func() tea.Msg {
+		defer cancel()
+		_, err := t.store.Sample(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("connecting timed out after %s", timeout)
+		}
+		return endpointMsg{target: t, gen: gen, error: err}
+	}
+}
+
+// cancelEndpoint cancels the sample of the endpoint opened at runtime (if
+// any), whose result is ignored then (see updateEndpoint).
+func (m *model) cancelEndpoint() {
+	if m.cancelConnect != nil {
+		m.cancelConnect()
+		m.cancelConnect = nil
+	}
+	m.connecting = false
+}
+
+// updateEndpoint adds the target of an endpoint opened at runtime and switches
+// to it, keeping the others (e.g. to switch back with tab). If its sample
+// failed, the prompt shows the error instead. Samples of endpoints cancelled
+// or opened before the latest one are ignored. The sources of targets not
+// added are closed.
+func (m *model) updateEndpoint(msg endpointMsg) {
+	if m.prompting != promptEndpoint || !m.connecting || msg.gen != m.connectGen {
+		msg.target.close()
+		return
+	}
+	m.connecting, m.cancelConnect = false, nil
+	if msg.error != nil {
+		msg.target.close()
+		m.promptError = msg.error.Error()
+		return
+	}
+	t := msg.target
+	t.lastSample = time.Now()
+	m.checkSample(t)
+	m.targets = append(m.targets, t)
+	m.prompting, m.current = promptNone, len(m.targets)-1
+	m.metricsView()
+}
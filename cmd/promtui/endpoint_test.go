@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestModel_OpenEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.prom", "b.prom"} {
+		content := "# TYPE " + strings.TrimSuffix(name, ".prom") + "_total counter\n" + strings.TrimSuffix(name, ".prom") + "_total 1\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	first := "file://" + filepath.Join(dir, "a.prom")
+	fetcher := metrics.NewFileFetcher(filepath.Join(dir, "a.prom"))
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, endpoint: first, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		newStore: func(f metrics.Fetcher) *metrics.Store { return metrics.NewStore(3, f) },
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+	open := func(endpoint string) {
+		m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+		m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(endpoint)})
+		_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		if cmd != nil {
+			m.Update(cmd())
+		}
+	}
+
+	// Failures keep the prompt open.
+	open("ftp://localhost/metrics")
+	if m.prompting != promptEndpoint || !strings.Contains(m.headerView(), "unsupported endpoint") {
+		t.Errorf("Expected the error in the prompt, but got %q", m.headerView())
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	open("file://" + filepath.Join(dir, "missing.prom"))
+	if m.prompting != promptEndpoint || m.promptError == "" || len(m.targets) != 1 {
+		t.Errorf("Expected the error in the prompt, but got %q", m.headerView())
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+
+	// The connections of endpoints that failed are closed.
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	open(srv.URL)
+	if m.prompting != promptEndpoint || m.promptError == "" || len(m.targets) != 1 {
+		t.Errorf("Expected the error in the prompt, but got %q", m.headerView())
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the connection closed")
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+
+	// The new endpoint is added and shown.
+	open("file://" + filepath.Join(dir, "b.prom"))
+	if m.prompting != promptNone || len(m.targets) != 2 || m.current != 1 || !hasRow(m, "b_total") {
+		t.Fatalf("Expected to show the new endpoint, but got %d targets", len(m.targets))
+	}
+
+	// Known endpoints are switched to.
+	open(first)
+	if len(m.targets) != 2 || m.current != 0 || !hasRow(m, "a_total") {
+		t.Errorf("Expected to switch back, but got %d targets", len(m.targets))
+	}
+}
+
+func TestModel_OpenEndpointCancel(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "b.prom"), []byte("# TYPE b_total counter\nb_total 1\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	fetcher := metrics.NewFileFetcher(filepath.Join(dir, "b.prom"))
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, endpoint: "a", store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		newStore: func(f metrics.Fetcher) *metrics.Store { return metrics.NewStore(3, f) },
+	}
+	open := func(endpoint string) tea.Cmd {
+		m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+		m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(endpoint)})
+		_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		return cmd
+	}
+
+	// Cancelling the prompt cancels the sample in flight, whose late result
+	// does not replace the endpoint opened next.
+	first := open(srv.URL)
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	done := make(chan tea.Msg, 1)
+	go func() { done <- first() }()
+	var late tea.Msg
+	select {
+	case late = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the sample cancelled")
+	}
+	second := open("file://" + filepath.Join(dir, "b.prom"))
+	m.Update(late)
+	if !m.connecting || len(m.targets) != 1 {
+		t.Errorf("Expected the cancelled endpoint ignored, but got %d targets", len(m.targets))
+	}
+	m.Update(second())
+	if m.prompting != promptNone || len(m.targets) != 2 || m.targets[1].endpoint != "file://"+filepath.Join(dir, "b.prom") {
+		t.Errorf("Expected to show the endpoint opened next, but got %d targets", len(m.targets))
+	}
+}
+
+func TestModel_OpenEndpointTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	fetcher := metrics.NewFileFetcher(filepath.Join(t.TempDir(), "a.prom"))
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, endpoint: "a", store: metrics.NewStore(3, fetcher)}},
+		interval: 10 * time.Millisecond,
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		newStore: func(f metrics.Fetcher) *metrics.Store { return metrics.NewStore(3, f) },
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(srv.URL)})
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(cmd())
+	if m.connecting || !strings.Contains(m.promptError, "timed out") {
+		t.Errorf("Expected the open timed out, but got %q", m.promptError)
+	}
+}
+
+func TestModel_PromptTakesKeys(t *testing.T) {
+	m := newTestModel()
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("http://localhost:9090/federate?match[]=up")})
+	if m.showHelp || m.prompt != "http://localhost:9090/federate?match[]=up" {
+		t.Errorf("Expected the query typed into the prompt, but got %q (help shown: %v)", m.prompt, m.showHelp)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")})
+	if m.showHelp || !strings.HasSuffix(m.prompt, "up?") {
+		t.Errorf("Expected ? typed into the prompt, but got %q", m.prompt)
+	}
+}
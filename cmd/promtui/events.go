@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// maxEvents is the number of events kept by the event log.
+const maxEvents = 200
+
+// churnThreshold is the number of series appearing or disappearing in a
+// single sample from which on this is logged as an event.
+const churnThreshold = 10
+
+// event is an entry of the event log, e.g. a failed scrape or a rule starting
+// to fire. error marks failures and firing rules.
+type event struct {
+	at     time.Time
+	target string
+	text   string
+	error  bool
+}
+
+// eventLog is a ring buffer of the latest maxEvents events.
+type eventLog struct {
+	events []event
+	next   int
+}
+
+// add adds the given event, replacing the oldest one if the log is full.
+func (l *eventLog) add(e event) {
+	if len(l.events) < maxEvents {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % maxEvents
+}
+
+// newestFirst returns the events of the log, the newest first.
+func (l *eventLog) newestFirst() []event {
+	events := make([]event, 0, len(l.events))
+	for i := len(l.events) - 1; i >= 0; i-- {
+		events = append(events, l.events[(l.next+i)%len(l.events)])
+	}
+	return events
+}
+
+// logEvent adds an event with the given text about the given target to the
+// event log.
+func (m *model) logEvent(t *target, text string, error bool) {
+	m.events.add(event{at: time.Now(), target: t.name(), text: text, error: error})
+}
+
+// logSample logs the events of the latest sample of the given target: counter
+// resets, many series appearing or disappearing at once, and rules starting
+// or stopping to fire (given the state of the rules before the sample).
+func (m *model) logSample(t *target, dump [][]metrics.Observation, prev ruleState) {
+	var resets []string
+	appeared, disappeared := 0, 0
+	for _, series := range dump {
+		o := series[0]
+		switch {
+		case o.Appeared == 1:
+			appeared++
+		case o.Stale && len(series) > 1 && !series[1].Stale:
+			disappeared++
+		case o.Kind == metrics.ObservationCounter && !o.Stale && len(series) > 1 && o.Value < series[1].Value:
+			resets = append(resets, o.Name)
+		}
+	}
+	switch {
+	case len(resets) == 1:
+		m.logEvent(t, "counter reset: "+resets[0], false)
+	case len(resets) > 1:
+		m.logEvent(t, fmt.Sprintf("%d counters reset (e.g. %s)", len(resets), resets[0]), false)
+	}
+	if appeared >= churnThreshold {
+		m.logEvent(t, fmt.Sprintf("%d series appeared", appeared), false)
+	}
+	if disappeared >= churnThreshold {
+		m.logEvent(t, fmt.Sprintf("%d series disappeared", disappeared), false)
+	}
+	for _, r := range m.rules {
+		switch {
+		case t.rules.firing[r] && !prev.firing[r]:
+			m.logEvent(t, "rule firing: "+r.text, true)
+		case !t.rules.firing[r] && prev.firing[r]:
+			m.logEvent(t, "rule resolved: "+r.text, false)
+		}
+	}
+}
+
+// logDuplicates logs the duplicate series of the latest sample of the given
+// target (see metrics.Store.Duplicates), unless the same number of them was
+// logged for the previous sample.
+func (m *model) logDuplicates(t *target, duplicates []string) {
+	if len(duplicates) == t.duplicates {
+		return
+	}
+	t.duplicates = len(duplicates)
+	if len(duplicates) > 0 {
+		m.logEvent(t, fmt.Sprintf("%d duplicate series (e.g. %s)", len(duplicates), duplicates[0]), false)
+	}
+}
+
+// logSkipped logs the parse errors of the metric families the latest sample
+// of the given target skipped (see metrics.Store.Skipped), unless the same
+// number of them was logged for the previous sample.
+func (m *model) logSkipped(t *target, skipped []error) {
+	if len(skipped) == t.skipped {
+		return
+	}
+	t.skipped = len(skipped)
+	for _, err := range skipped {
+		m.logEvent(t, "skipped malformed family "+err.Error(), false)
+	}
+}
+
+// eventsView renders the watched series (see toggleWatch) and the event log
+// (newest first) to fill the given size.
+func (m *model) eventsView(width, height int) string {
+	events := m.events.newestFirst()
+	if len(events) == 0 && len(m.watches) == 0 {
+		return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, m.styles.muted.Render("no events yet"))
+	}
+	maxWidthStyle := lipgloss.NewStyle().MaxWidth(width)
+	lines := make([]string, 0, height)
+	for _, w := range m.watches {
+		line := " watching " + w.name
+		if len(m.targets) > 1 {
+			line = " watching " + w.target.name() + ": " + w.name
+		}
+		lines = append(lines, maxWidthStyle.Render(m.styles.changed.Render(line)+m.styles.muted.Render(" ("+m.keys.watch.Help().Key+" on its row to stop)")))
+	}
+	if len(m.watches) > 0 {
+		lines = append(lines, "")
+	}
+	for _, e := range events[:max(0, min(len(events), height-len(lines)))] {
+		line := " " + e.at.Local().Format(time.DateTime) + " "
+		if len(m.targets) > 1 {
+			line += e.target + ": "
+		}
+		text := printable(e.text)
+		if e.error {
+			text = lipgloss.NewStyle().Foreground(m.styles.error.GetForeground()).Render(text)
+		}
+		lines = append(lines, maxWidthStyle.Render(m.styles.muted.Render(line)+text))
+	}
+	lines = lines[:min(len(lines), height)]
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestEventLog(t *testing.T) {
+	var l eventLog
+	for i := range maxEvents + 5 {
+		l.add(event{text: fmt.Sprint(i)})
+	}
+	events := l.newestFirst()
+	if len(events) != maxEvents {
+		t.Fatalf("Expected %v, but got %v", maxEvents, len(events))
+	}
+	if first, last := events[0].text, events[len(events)-1].text; first != fmt.Sprint(maxEvents+4) || last != "5" {
+		t.Errorf("Expected %v to %v, but got %v to %v", maxEvents+4, 5, first, last)
+	}
+}
+
+func TestModel_LogSample(t *testing.T) {
+	series := func(name string, kind metrics.ObservationKind, values ...float64) []metrics.Observation {
+		var obs []metrics.Observation
+		for _, v := range values {
+			obs = append(obs, metrics.Observation{Name: name, Metric: name, Kind: kind, Value: v})
+		}
+		return obs
+	}
+	fired := &rule{text: "queue_depth > 1000"}
+	resolved := &rule{text: "up < 1"}
+	m := &model{rules: []*rule{fired, resolved}}
+	tg := &target{endpoint: "http://a", rules: ruleState{firing: map[*rule]bool{fired: true}}}
+
+	dump := [][]metrics.Observation{
+		series("requests_total", metrics.ObservationCounter, 3, 10),
+		series("queue_depth", metrics.ObservationGauge, 3, 10),
+	}
+	for i := range churnThreshold {
+		s := series(fmt.Sprint("new_", i), metrics.ObservationGauge, 1)
+		s[0].Appeared = 1
+		dump = append(dump, s)
+	}
+	m.logSample(tg, dump, ruleState{firing: map[*rule]bool{resolved: true}})
+
+	var actual []string
+	for _, e := range m.events.newestFirst() {
+		actual = append(actual, e.text)
+	}
+	expected := "rule resolved: up < 1; rule firing: queue_depth > 1000; 10 series appeared; counter reset: requests_total"
+	if strings.Join(actual, "; ") != expected {
+		t.Errorf("Expected %v, but got %v", expected, strings.Join(actual, "; "))
+	}
+}
+
+func TestModel_UpdateEvents(t *testing.T) {
+	tg := &target{endpoint: "http://a", store: metrics.NewStore(3, nil)}
+	m := &model{
+		targets:  []*target{tg},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		ready:    true,
+	}
+
+	// Only the first of consecutive failures is logged.
+	for range 3 {
+		m.Update(sampledMsg{target: tg, error: errors.New("connection refused")})
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	if !m.showEvents {
+		t.Fatalf("Expected the event log to be shown")
+	}
+	view := m.View()
+	if strings.Count(view, "scrape failed: connection refused") != 1 {
+		t.Errorf("Expected a single failure, but got %q", view)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.showEvents {
+		t.Errorf("Expected the event log to be closed")
+	}
+}
+
+func TestModel_LogDuplicates(t *testing.T) {
+	m := &model{}
+	tg := &target{endpoint: "http://a"}
+	for _, duplicates := range [][]string{{"a", "b"}, {"a", "b"}, nil, {"a"}} {
+		m.logDuplicates(tg, duplicates)
+	}
+	var actual []string
+	for _, e := range m.events.newestFirst() {
+		actual = append(actual, e.text)
+	}
+	expected := "1 duplicate series (e.g. a); 2 duplicate series (e.g. a)"
+	if strings.Join(actual, "; ") != expected {
+		t.Errorf("Expected %v, but got %v", expected, strings.Join(actual, "; "))
+	}
+}
+
+func TestModel_LogSkipped(t *testing.T) {
+	m := &model{}
+	tg := &target{endpoint: "http://a"}
+	a, b := errors.New("a: line 2: bad"), errors.New("b: line 4: bad")
+	for _, skipped := range [][]error{{a, b}, {a, b}, nil, {a}} {
+		m.logSkipped(tg, skipped)
+	}
+	var actual []string
+	for _, e := range m.events.newestFirst() {
+		actual = append(actual, e.text)
+	}
+	expected := "skipped malformed family a: line 2: bad; skipped malformed family b: line 4: bad; skipped malformed family a: line 2: bad"
+	if strings.Join(actual, "; ") != expected {
+		t.Errorf("Expected %v, but got %v", expected, strings.Join(actual, "; "))
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// flashDuration is how long messages flashed in the footer are shown.
+const flashDuration = 3 * time.Second
+
+// exportName returns the name of an export file created at the given time
+// with the given extension (e.g. "promtui-20250304-140211.txt").
+func exportName(t time.Time, ext string) string {
+	return "promtui-" + t.Format("20060102-150405") + "." + ext
+}
+
+// exportView writes the current view (as plain text without ANSI codes and
+// without truncating long lines) to a file in the export directory. It
+// returns the path of the file.
+func (m *model) exportView() (string, error) {
+	path := filepath.Join(m.exportDir, exportName(time.Now(), "txt"))
+	content := ansi.Strip(m.renderMetrics(lipgloss.NewStyle()))
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("write export: %w", err)
+	}
+	return path, nil
+}
+
+// exportHistory writes the history of the series of the current target
+// matching the search as CSV to a file in the export directory. It returns the
+// path of the file.
+func (m *model) exportHistory() (string, error) {
+	dump, err := m.target().store.Dump(m.search)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(m.exportDir, exportName(time.Now(), "csv"))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("create export: %w", err)
+	}
+	if err := writeCSV(f, dump, csvOptions{derived: m.showDerived, deriver: m.deriver}); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("write export: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("close export: %w", err)
+	}
+	return path, nil
+}
+
+// csvOptions configures writeCSV.
+type csvOptions struct {
+
+	// labelColumns writes each label to a column of its own instead of a
+	// single canonical labels column.
+	labelColumns bool
+
+	// derived includes the series derived by deriver (and derived kinds such
+	// as histogram averages).
+	derived bool
+	deriver metrics.Deriver
+}
+
+// writeCSV writes the given series as CSV with one row per observation, oldest
+// first, leaving out stale observations. The columns are time, name, labels
+// (either canonical, e.g. `code="200",method="get"`, or one column per label),
+// kind, and value.
+func writeCSV(w io.Writer, dump [][]metrics.Observation, opts csvOptions) error {
+	var all [][]metrics.Observation
+	for _, series := range dump {
+		ss := [][]metrics.Observation{series}
+		if opts.derived {
+			ss = opts.deriver.Derive(series)
+		}
+		for _, s := range ss {
+			if len(s) == 0 || (!opts.derived && isDerived(s[0].Kind)) {
+				continue
+			}
+			all = append(all, s)
+		}
+	}
+
+	header := []string{"time", "name", "labels", "kind", "value"}
+	var labelNames []string
+	if opts.labelColumns {
+		seen := make(map[string]bool)
+		for _, s := range all {
+			for _, l := range s[0].Labels {
+				if !seen[l.Name] {
+					seen[l.Name] = true
+					labelNames = append(labelNames, l.Name)
+				}
+			}
+		}
+		sort.Strings(labelNames)
+		header = append(append([]string{"time", "name"}, labelNames...), "kind", "value")
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, s := range all {
+		labels := []string{canonicalLabels(s[0].Labels)}
+		if opts.labelColumns {
+			labels = make([]string, len(labelNames))
+			for _, l := range s[0].Labels {
+				labels[sort.SearchStrings(labelNames, l.Name)] = l.Value
+			}
+		}
+		for i := len(s) - 1; i >= 0; i-- {
+			o := s[i]
+			if o.Stale {
+				continue
+			}
+			record := append([]string{o.Time.Format(time.RFC3339Nano), o.Metric}, labels...)
+			record = append(record, o.Kind.String(), strconv.FormatFloat(o.Value, 'f', -1, 64))
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// canonicalLabels returns the canonical form of the given labels (e.g.
+// `code="200",method="get"`).
+func canonicalLabels(labels []metrics.Label) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, fmt.Sprintf("%s=%q", l.Name, l.Value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// runCSV samples the (already sampled once) target every interval until it
+// has been sampled successfully the given number of times (unless zero) or ctx
+// is done, and then writes the series matching the search as CSV to w. Failed
+// samples are reported on stderr and counted in the returned stats, which
+// include the given stats of the initial sample.
+func runCSV(ctx context.Context, t *target, stats runStats, samples int, interval time.Duration, search string, opts csvOptions, w io.Writer) (runStats, error) {
+loop:
+	for !t.once && (samples == 0 || stats.samples < samples) {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-time.After(interval):
+		}
+		fetched, err := t.store.Sample(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching metrics:", err)
+		}
+		stats.record(fetched, err)
+	}
+	dump, err := t.store.Dump(search)
+	if err != nil {
+		return stats, err
+	}
+	return stats, writeCSV(w, dump, opts)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestModel_UpdateExport(t *testing.T) {
+	m := newTestModel()
+	fetcher := metrics.NewFileFetcher("../../metrics/testdata/metrics.prom")
+	m.targets[0].store = metrics.NewStore(3, fetcher)
+	if _, err := m.targets[0].store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.exportDir = t.TempDir()
+	m.showHistory, m.showDerived = true, true
+	m.search = "http_requests"
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	if !strings.HasSuffix(m.flash, " (ctrl+s again: history as CSV)") {
+		t.Errorf("Expected the hint on the CSV export, but got %q", m.flash)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	if !strings.HasPrefix(m.flash, "saved to ") {
+		t.Errorf("Expected flash about the export, but got %q", m.flash)
+	}
+
+	txt, _ := filepath.Glob(filepath.Join(m.exportDir, "*.txt"))
+	csv, _ := filepath.Glob(filepath.Join(m.exportDir, "*.csv"))
+	if len(txt) != 1 || len(csv) != 1 {
+		t.Fatalf("Expected a text and a CSV export, but got %v and %v", txt, csv)
+	}
+	b, _ := os.ReadFile(txt[0])
+	if strings.Contains(string(b), "\x1b") || !strings.Contains(string(b), `http_requests_total {code="200", method="get"} 1027`) {
+		t.Errorf("Unexpected text export %q", b)
+	}
+	b, _ = os.ReadFile(csv[0])
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 || lines[0] != "time,name,labels,kind,value" || !strings.HasSuffix(lines[1], `,http_requests_total,"code=""200"",method=""get""",counter,1027`) {
+		t.Errorf("Unexpected CSV export %q", b)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	t0 := time.Date(2025, 3, 4, 14, 2, 11, 0, time.UTC)
+	labels := []metrics.Label{{Name: "path", Value: `/a,"b"`}, {Name: "code", Value: "200"}}
+	series := []metrics.Observation{
+		metrics.NewObservation("requests_total", labels, metrics.ObservationCounter, t0.Add(time.Second), 12),
+		metrics.NewObservation("requests_total", labels, metrics.ObservationCounter, t0, 10),
+	}
+	deriver := metrics.Deriver{RateKinds: metrics.DefaultRateKinds}
+
+	tests := []struct {
+		name     string
+		opts     csvOptions
+		expected string
+	}{
+		{
+			name: "canonical labels",
+			opts: csvOptions{},
+			expected: `time,name,labels,kind,value
+2025-03-04T14:02:11Z,requests_total,"path=""/a,\""b\"""",code=""200""",counter,10
+2025-03-04T14:02:12Z,requests_total,"path=""/a,\""b\"""",code=""200""",counter,12
+`,
+		},
+		{
+			name: "label columns with derived",
+			opts: csvOptions{labelColumns: true, derived: true, deriver: deriver},
+			expected: `time,name,code,path,kind,value
+2025-03-04T14:02:11Z,requests_total,200,"/a,""b""",counter,10
+2025-03-04T14:02:12Z,requests_total,200,"/a,""b""",counter,12
+2025-03-04T14:02:12Z,requests_total_per_second_rate,200,"/a,""b""",counter_rate,2
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := writeCSV(&sb, [][]metrics.Observation{series}, tt.opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if sb.String() != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, sb.String())
+			}
+		})
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	tt := &target{store: metrics.NewStore(5, metrics.NewFileFetcher("../../metrics/testdata/metrics.prom"))}
+	var sb strings.Builder
+	stats, err := runCSV(context.Background(), tt, runStats{}, 3, time.Millisecond, "go_goroutines", csvOptions{}, &sb)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.samples != 3 {
+		t.Errorf("Expected 3 samples, but got %v", stats)
+	}
+	if lines := strings.Split(strings.TrimSpace(sb.String()), "\n"); len(lines) != 4 {
+		t.Errorf("Expected a header and 3 rows, but got %q", sb.String())
+	}
+}
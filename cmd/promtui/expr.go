@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// expression is a series computed from (at most) two other series or numbers
+// by one of the four arithmetic operators (e.g. `error_ratio =
+// http_requests_errors_total / http_requests_total`). It is shown like a
+// derived series, with a value for each sample both operands were seen in (see
+// evaluate).
+type expression struct {
+	text     string
+	name     string
+	op       byte
+	operands [2]operand
+}
+
+// operand is an operand of an expression: a number or a reference to a series
+// by its flat name or by a selector matching exactly one series, optionally
+// wrapped in rate(...) for its per-second rate.
+type operand struct {
+	ref      string
+	selector metrics.Selector
+	rate     bool
+	number   float64
+}
+
+// errNoMatch is the error of a reference not matching any series.
+var errNoMatch = errors.New("no match")
+
+// exprMantissa matches the mantissa of a number with an exponent, up to the
+// sign of the exponent.
+var exprMantissa = regexp.MustCompile(`^[0-9]*\.?[0-9]+[eE]$|^[0-9]+\.[eE]$`)
+
+// exprName matches the valid names of expressions (i.e. metric names).
+var exprName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// exprsFlag is a flag that may be given multiple times, each time with one
+// expression.
+type exprsFlag []*expression
+
+func (f *exprsFlag) String() string {
+	return strings.Join(f.values(), "; ")
+}
+
+func (f *exprsFlag) Set(s string) error {
+	e, err := parseExpression(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, e)
+	return nil
+}
+
+func (f *exprsFlag) values() []string {
+	texts := make([]string, 0, len(*f))
+	for _, e := range *f {
+		texts = append(texts, e.text)
+	}
+	return texts
+}
+
+// parseExpression parses an expression of the form `name = a op b`, where op
+// is one of +, -, *, and /, and a and b are operands (see operand).
+func parseExpression(s string) (*expression, error) {
+	e := &expression{text: strings.TrimSpace(s)}
+	name, rest, ok := strings.Cut(s, "=")
+	e.name = strings.TrimSpace(name)
+	if !ok || !exprName.MatchString(e.name) {
+		return nil, fmt.Errorf("missing or invalid name in expression %q (expected name = a op b)", s)
+	}
+
+	// Operator characters in braces, parentheses, and quotes belong to the
+	// operands, and so do signs (i.e. operators without a left operand, or
+	// following the exponent of a number, e.g. 1e-3).
+	i, depth, quoted := -1, 0, false
+	for j := 0; j < len(rest); j++ {
+		switch c := rest[j]; {
+		case quoted && c == '\\':
+			j++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{' || c == '(':
+			depth++
+		case c == '}' || c == ')':
+			depth--
+		case depth == 0 && strings.IndexByte("+-*/", c) >= 0:
+			start := 0
+			if i >= 0 {
+				start = i + 1
+			}
+			if left := strings.TrimSpace(rest[start:j]); left == "" || ((c == '+' || c == '-') && exprMantissa.MatchString(left)) {
+				continue
+			}
+			if i >= 0 {
+				return nil, fmt.Errorf("more than one operator in expression %q", s)
+			}
+			i = j
+		}
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("missing operator in expression %q", s)
+	}
+	e.op = rest[i]
+	refs := 0
+	for k, text := range []string{rest[:i], rest[i+1:]} {
+		o, err := parseOperand(text)
+		if err != nil {
+			return nil, fmt.Errorf("expression %q: %w", s, err)
+		}
+		if o.ref != "" {
+			refs++
+		}
+		e.operands[k] = o
+	}
+	if refs == 0 {
+		return nil, fmt.Errorf("expression %q references no series", s)
+	}
+	return e, nil
+}
+
+// parseOperand parses an operand of an expression (see operand).
+func parseOperand(s string) (operand, error) {
+	s = strings.TrimSpace(s)
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return operand{number: v}, nil
+	}
+	var o operand
+	if inner, ok := strings.CutPrefix(s, "rate("); ok && strings.HasSuffix(inner, ")") {
+		o.rate, s = true, strings.TrimSpace(strings.TrimSuffix(inner, ")"))
+	}
+	if s == "" {
+		return o, fmt.Errorf("missing operand")
+	}
+	sel, err := metrics.ParseSelector(s)
+	if err != nil {
+		return o, err
+	}
+	o.ref, o.selector = s, sel
+	return o, nil
+}
+
+// resolve returns the series the operand references, or its per-second rate,
+// from the given dump of (at least) the series matching the reference (see
+// metrics.Store.Dump). An error is returned, unless exactly one series is
+// referenced.
+func (o operand) resolve(dump [][]metrics.Observation) ([]metrics.Observation, error) {
+	var series []metrics.Observation
+	for _, s := range dump {
+		if s[0].Name == o.ref {
+			series = s
+			break
+		}
+	}
+	if series == nil {
+		matched := 0
+		for _, s := range dump {
+			if o.selector.Matches(s[0]) {
+				series = s
+				matched++
+			}
+		}
+		switch {
+		case matched == 0:
+			return nil, errNoMatch
+		case matched > 1:
+			return nil, fmt.Errorf("%d matches for %s", matched, o.ref)
+		}
+	}
+	if o.rate {
+		derived := metrics.Deriver{RateKinds: []metrics.ObservationKind{series[0].Kind}}.Derive(series)
+		if len(derived) < 2 {
+			return nil, nil
+		}
+		series = derived[1]
+	}
+	return series, nil
+}
+
+// evaluate returns the series of the expression, computed from the series the
+// given function dumps for the references of its operands (see
+// metrics.Store.Dump) and sorted from youngest to oldest. The series of a
+// dump hold an observation for each sample from the latest one on (stale
+// copies for the samples missing them), so that the operands are lined up by
+// index rather than by time, which stale copies and exposed timestamps do not
+// share: the i-th observations of both are those of the i-th latest sample.
+// Series that appeared after the oldest sample are shorter, and so is the
+// series of an expression referencing them. Its observations are stale, if any
+// of their operands is. Before a rate has two samples to be computed from, the
+// series holds a single NaN.
+func (e *expression) evaluate(dump func(ref string) ([][]metrics.Observation, error)) ([]metrics.Observation, error) {
+	var operands [2][]metrics.Observation
+	n := math.MaxInt
+	for k, o := range e.operands {
+		if o.ref == "" {
+			continue
+		}
+		d, err := dump(o.ref)
+		if err != nil {
+			return nil, err
+		}
+		series, err := o.resolve(d)
+		if err != nil {
+			return nil, err
+		}
+		operands[k] = series
+		n = min(n, len(series))
+	}
+	if n == 0 {
+		return []metrics.Observation{metrics.NewObservation(e.name, nil, metrics.ObservationExpression, time.Now(), math.NaN())}, nil
+	}
+	obs := make([]metrics.Observation, 0, n)
+	for i := range n {
+		var values [2]float64
+		var at time.Time
+		stale := false
+		for k, o := range e.operands {
+			if operands[k] == nil {
+				values[k] = o.number
+				continue
+			}
+			c := operands[k][i]
+			values[k], stale = c.Value, stale || c.Stale
+			if at.IsZero() {
+				at = c.Time
+			}
+		}
+		o := metrics.NewObservation(e.name, nil, metrics.ObservationExpression, at, apply(e.op, values[0], values[1]))
+		o.Stale = stale
+		obs = append(obs, o)
+	}
+	return obs, nil
+}
+
+// apply applies the given arithmetic operator. Division by zero yields an
+// infinite value (or NaN for 0/0).
+func apply(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	}
+	return a / b
+}
+
+// exprRows returns the rows of the expressions whose series match the search,
+// computed from the series of the current target they reference. The rows of
+// expressions that cannot be computed show the error (see row.err).
+func (m *model) exprRows() []row {
+	if !m.showDerived {
+		return nil
+	}
+	match := metrics.MatchSearch(m.search)
+	var rows []row
+	for _, e := range m.exprs {
+		obs, err := e.evaluate(m.target().store.Dump)
+		r := row{name: e.name, family: e.name, obs: obs}
+		if err != nil {
+			r.obs, r.err = []metrics.Observation{metrics.NewObservation(e.name, nil, metrics.ObservationExpression, time.Now(), math.NaN())}, err.Error()
+		}
+		if !match(r.obs[0]) {
+			continue
+		}
+		r.value = r.obs[0].Value
+		rows = append(rows, r)
+	}
+	return rows
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		text string
+		err  bool
+	}{
+		{"error_ratio = http_requests_errors_total / http_requests_total", false},
+		{`errors_5xx = http_requests_total{code=~"5.."} + http_requests_total{code="4-2/1"}`, false},
+		{"rps = rate(http_requests_total) * -1", false},
+		{"percent = 100 * queue_length", false},
+		{"x = a * 1e-3", false},
+		{"x = a / 2.5e+2", false},
+		{"x = 1E-3 * a", false},
+		{"x = a - 1e3", false},
+		{"queue_length * 2", true},
+		{"double = queue_length", true},
+		{"two = 1 + 1", true},
+		{"chained = a + b + c", true},
+		{"bad = a{ / b", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if _, err := parseExpression(tt.text); (err != nil) != tt.err {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExpression_Evaluate(t *testing.T) {
+	now := time.Now()
+	series := func(name, metric string, labels []metrics.Label, kind metrics.ObservationKind, values ...float64) []metrics.Observation {
+		var obs []metrics.Observation
+		for i, v := range values {
+			o := metrics.NewObservation(metric, labels, kind, now.Add(-time.Duration(i)*time.Second), v)
+			o.Name = name
+			obs = append(obs, o)
+		}
+		return obs
+	}
+	dump := [][]metrics.Observation{
+		series("errors_total", "errors_total", nil, metrics.ObservationCounter, 5, 3, 1),
+		series(`requests_total {code="200"}`, "requests_total", []metrics.Label{{Name: "code", Value: "200"}}, metrics.ObservationCounter, 50, 20),
+		series(`requests_total {code="500"}`, "requests_total", []metrics.Label{{Name: "code", Value: "500"}}, metrics.ObservationCounter, 10, 10),
+		series("exposed_total", "exposed_total", nil, metrics.ObservationCounter, 4, 2, 2),
+	}
+	// The operands are lined up by sample rather than by time, e.g. with
+	// timestamps exposed (here, those of an older sample).
+	for i := range dump[3] {
+		dump[3][i].Time = now.Add(-time.Hour - time.Duration(i)*time.Minute)
+	}
+	dump[3][1].Stale = true
+	dumped := func(string) ([][]metrics.Observation, error) {
+		return dump, nil
+	}
+	tests := []struct {
+		text     string
+		expected []float64
+		err      string
+	}{
+		{`ratio = errors_total / requests_total {code="200"}`, []float64{0.1, 0.15}, ""},
+		{`ratio = errors_total / requests_total{code="500"}`, []float64{0.5, 0.3}, ""},
+		{"rate = rate(errors_total) - 1", []float64{1, 1}, ""},
+		{"milli = errors_total * 1e-3", []float64{0.005, 0.003, 0.001}, ""},
+		{"scaled = errors_total / 2.5e+2", []float64{0.02, 0.012, 0.004}, ""},
+		{"sum = errors_total + exposed_total", []float64{9, 5, 3}, ""},
+		{"diff = exposed_total - requests_total {code=\"500\"}", []float64{-6, -8}, ""},
+		{"zero = errors_total / 0", []float64{math.Inf(1), math.Inf(1), math.Inf(1)}, ""},
+		{"ratio = errors_total / requests_total", nil, "2 matches for requests_total"},
+		{"ratio = errors_total / missing_total", nil, "no match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			e, err := parseExpression(tt.text)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			obs, err := e.evaluate(dumped)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected error %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual []float64
+			for _, o := range obs {
+				actual = append(actual, o.Value)
+			}
+			if len(actual) != len(tt.expected) {
+				t.Fatalf("Expected %v, but got %v", tt.expected, actual)
+			}
+			for i := range actual {
+				if math.Abs(actual[i]-tt.expected[i]) > 1e-9 && actual[i] != tt.expected[i] {
+					t.Errorf("Expected %v, but got %v", tt.expected, actual)
+				}
+			}
+		})
+	}
+
+	// Observations are stale, if any of their operands is.
+	e, _ := parseExpression("sum = errors_total + exposed_total")
+	obs, _ := e.evaluate(dumped)
+	if obs[0].Stale || !obs[1].Stale || obs[2].Stale {
+		t.Errorf("Expected the second observation stale, but got %v", obs)
+	}
+}
+
+func TestModel_ExprRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE errors_total counter\nerrors_total 1\n# TYPE requests_total counter\nrequests_total 4\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var exprs exprsFlag
+	for _, text := range []string{"error_ratio = errors_total / requests_total", "missing_ratio = missing_total / requests_total"} {
+		if err := exprs.Set(text); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:     []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:      newStyles(nil, false),
+		keys:        newKeymap(),
+		viewport:    viewport.New(120, 10),
+		showDerived: true,
+		exprs:       exprs,
+		search:      "_ratio",
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+	rows := m.rows
+	if len(rows) != 2 {
+		t.Fatalf("Expected %v, but got %v", 2, rows)
+	}
+	maxWidthStyle := lipgloss.NewStyle().MaxWidth(120)
+	if line := m.renderRow(rows[0], maxWidthStyle); !strings.HasPrefix(line, "+error_ratio 0.25") {
+		t.Errorf("Unexpected row %q", line)
+	}
+	if line := m.renderRow(rows[1], maxWidthStyle); line != "+missing_ratio expr error: no match\n" {
+		t.Errorf("Unexpected row %q", line)
+	}
+
+	// Rows of other errors are cached apart.
+	k, ok := m.cacheKey(rows[1])
+	other := rows[1]
+	other.err = "2 matches for missing_total"
+	if k2, ok2 := m.cacheKey(other); ok && ok2 && k == k2 {
+		t.Errorf("Expected the error in the cache key, but got %v", k)
+	}
+
+	// The referenced series are not searched.
+	if hasRow(m, "requests_total") {
+		t.Errorf("Expected the search to apply, but got %v", rows)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// federatePath is the path of the federation endpoint of Prometheus servers.
+const federatePath = "/federate"
+
+// matchesFlag is a flag that may be given multiple times, each time with a
+// series selector passed as match[] to federation endpoints (see
+// federateURL).
+type matchesFlag []string
+
+func (f *matchesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *matchesFlag) Set(s string) error {
+	if s = strings.TrimSpace(s); s != "" {
+		*f = append(*f, s)
+	}
+	return nil
+}
+
+func (f *matchesFlag) values() []string {
+	return *f
+}
+
+// federateURL returns the given endpoint with the given selectors appended as
+// match[] parameters, if it is a federation endpoint: its path is
+// federatePath, or federate is set (in which case an endpoint without a path
+// gets federatePath). Other endpoints are returned as is, unless selectors are
+// given, which is an error.
+func federateURL(endpoint string, matches []string, federate bool) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if federate && (u.Path == "" || u.Path == "/") {
+		u.Path = federatePath
+	}
+	if u.Path != federatePath && !federate {
+		if len(matches) > 0 {
+			return "", fmt.Errorf("match[] selectors require a %s endpoint (or -federate), not %q", federatePath, endpoint)
+		}
+		return endpoint, nil
+	}
+	q := u.Query()
+	for _, m := range matches {
+		q.Add("match[]", m)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
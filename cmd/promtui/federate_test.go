@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestFederateURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		matches  []string
+		federate bool
+		expected string
+		err      bool
+	}{
+		{"metrics", "http://api:8080/metrics", nil, false, "http://api:8080/metrics", false},
+		{"federate", "http://prom:9090/federate", []string{`{job="api"}`, "up"}, false, "http://prom:9090/federate?match%5B%5D=%7Bjob%3D%22api%22%7D&match%5B%5D=up", false},
+		{"forced", "http://prom:9090", []string{"up"}, true, "http://prom:9090/federate?match%5B%5D=up", false},
+		{"forced path", "http://gateway/prom/federate", []string{"up"}, true, "http://gateway/prom/federate?match%5B%5D=up", false},
+		{"not federated", "http://api:8080/metrics", []string{"up"}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := federateURL(tt.endpoint, tt.matches, tt.federate)
+			if (err != nil) != tt.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
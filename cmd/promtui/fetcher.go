@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// source describes where metrics are fetched from.
+type source struct {
+	fetcher metrics.Fetcher
+
+	// static describes sources that are not sampled periodically (e.g. "static
+	// file"). It is empty for all other sources.
+	static string
+
+	// once is set for sources that can be fetched only once (e.g. stdin).
+	once bool
+
+	// receiver receives the metrics of sources sampled on pushes rather than
+	// periodically (see newListenSource). It is nil for all other sources.
+	receiver *metrics.Receiver
+}
+
+// close closes the connections the fetcher of the source keeps alive between
+// fetches (e.g. of HTTP endpoints), once it is no longer used.
+func (s source) close() {
+	if c, ok := s.fetcher.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// endpointClock is implemented by fetchers of endpoints with a clock of their
+// own (see metrics.HTTPFetcher).
+type endpointClock interface {
+	SetInterval(d time.Duration)
+	ClockSkew() time.Duration
+	Dated() bool
+}
+
+// setInterval sets the interval the source is fetched at (see
+// metrics.HTTPFetcher.SetInterval).
+func (s source) setInterval(d time.Duration) {
+	if c, ok := s.fetcher.(endpointClock); ok {
+		c.SetInterval(d)
+	}
+}
+
+// now returns the current time on the clock of the endpoint, if it times the
+// fetches of the source (see metrics.HTTPFetcher.Dated), or the local time
+// otherwise.
+func (s source) now() time.Time {
+	if c, ok := s.fetcher.(endpointClock); ok && c.Dated() {
+		return time.Now().Add(c.ClockSkew())
+	}
+	return time.Now()
+}
+
+// httpOptions configures the fetchers of HTTP(S) endpoints.
+type httpOptions struct {
+	userAgent string
+
+	// interval is the interval the endpoints are fetched at, which decides
+	// whether their Date header times the fetches (see
+	// metrics.HTTPFetcher.SetInterval).
+	interval time.Duration
+
+	// promql is the query evaluated by the Prometheus servers given as
+	// endpoints (see metrics.QueryFetcher). It is empty for metrics endpoints.
+	promql string
+
+	// matches are the selectors passed to federation endpoints, or to any
+	// endpoint if federate is set (see federateURL).
+	matches  []string
+	federate bool
+
+	// sshJump is the jump host HTTP(S) endpoints are reached through, unless
+	// given by the endpoint (see parseSSHEndpoint). The host key of jump hosts
+	// is not verified, if sshInsecure is set.
+	sshJump     string
+	sshInsecure bool
+}
+
+// newSource returns the source for the given endpoint, which is either an
+// HTTP(S) URL (possibly tunneled through a jump host, see parseSSHEndpoint),
+// a file URL (e.g. "file:///tmp/dump.prom"), or "-" for stdin. HTTP(S) URLs
+// are those of Prometheus servers, if a query is given.
+func newSource(endpoint string, opts httpOptions) (source, error) {
+	jump := opts.sshJump
+	if j, inner, ok := parseSSHEndpoint(endpoint); ok {
+		if u, err := url.Parse(inner); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return source{}, fmt.Errorf("tunneling requires an HTTP(S) endpoint, not %q", inner)
+		}
+		jump, endpoint = j, inner
+	}
+	var client *http.Client
+	if u, err := url.Parse(endpoint); err == nil && jump != "" && (u.Scheme == "http" || u.Scheme == "https") {
+		if client, err = sshHTTPClient(jump, opts.sshInsecure); err != nil {
+			return source{}, err
+		}
+	}
+	if opts.promql != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return source{}, fmt.Errorf("querying requires an HTTP(S) endpoint, not %q", endpoint)
+		}
+		f := metrics.NewQueryFetcher(endpoint, opts.promql)
+		f.UserAgent = opts.userAgent
+		if client != nil {
+			f.Client = client
+		}
+		return source{fetcher: f}, nil
+	}
+	if endpoint == "-" {
+		return source{fetcher: metrics.NewReaderFetcher(os.Stdin), static: "stdin", once: true}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return source{}, err
+	}
+	switch u.Scheme {
+	case "file":
+		return source{fetcher: metrics.NewFileFetcher(u.Path), static: "static file"}, nil
+	case "http", "https":
+		endpoint, err = federateURL(endpoint, opts.matches, opts.federate)
+		if err != nil {
+			return source{}, err
+		}
+		f := metrics.NewHTTPFetcher(endpoint)
+		f.UserAgent = opts.userAgent
+		f.SetInterval(opts.interval)
+		if client != nil {
+			f.Client = client
+		}
+		return source{fetcher: f}, nil
+	}
+	return source{}, fmt.Errorf("unsupported endpoint %q", endpoint)
+}
+
+// newExecSource returns the source running the given command. The command is
+// run through the shell only if shell is set, otherwise it is split into
+// arguments (honoring single and double quotes).
+func newExecSource(command string, shell bool, timeout time.Duration) (source, error) {
+	args := []string{"sh", "-c", command}
+	if !shell {
+		var err error
+		if args, err = splitCommand(command); err != nil {
+			return source{}, err
+		}
+	}
+	if len(args) == 0 {
+		return source{}, fmt.Errorf("empty command")
+	}
+	return source{fetcher: metrics.NewExecFetcher(args, timeout)}, nil
+}
+
+// splitCommand splits the given command line into arguments. Arguments are
+// separated by whitespace, unless quoted with single or double quotes.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
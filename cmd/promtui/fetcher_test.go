@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestNewSource(t *testing.T) {
+	src, err := newSource("http://localhost:8080/metrics", httpOptions{userAgent: "test"})
+	if f, ok := src.fetcher.(*metrics.HTTPFetcher); err != nil || !ok || f.UserAgent != "test" || src.static != "" {
+		t.Errorf("Expected periodic HTTP source, but got %+v, %v", src, err)
+	}
+	src, err = newSource("file:///tmp/dump.prom", httpOptions{})
+	if f, ok := src.fetcher.(*metrics.FileFetcher); err != nil || !ok || f.Path != "/tmp/dump.prom" || src.static == "" || src.once {
+		t.Errorf("Expected static file source, but got %+v, %v", src, err)
+	}
+	src, err = newSource("-", httpOptions{})
+	if _, ok := src.fetcher.(*metrics.ReaderFetcher); err != nil || !ok || !src.once {
+		t.Errorf("Expected stdin source, but got %+v, %v", src, err)
+	}
+	if _, err = newSource("ftp://localhost/metrics", httpOptions{}); err == nil {
+		t.Errorf("Expected error for unsupported scheme")
+	}
+	src, err = newSource("http://prometheus:9090", httpOptions{promql: "up"})
+	if f, ok := src.fetcher.(*metrics.QueryFetcher); err != nil || !ok || f.Query != "up" {
+		t.Errorf("Expected query source, but got %+v, %v", src, err)
+	}
+	if _, err = newSource("file:///tmp/dump.prom", httpOptions{promql: "up"}); err == nil {
+		t.Errorf("Expected error for querying a file")
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected []string
+	}{
+		{"kubectl exec pod -- wget -qO- localhost:9100/metrics", []string{"kubectl", "exec", "pod", "--", "wget", "-qO-", "localhost:9100/metrics"}},
+		{`curl -H "Authorization: Bearer x" 'http://a b'`, []string{"curl", "-H", "Authorization: Bearer x", "http://a b"}},
+		{`echo ""`, []string{"echo", ""}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		actual, err := splitCommand(tt.command)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !slices.Equal(actual, tt.expected) {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+	if _, err := splitCommand(`echo "foo`); err == nil {
+		t.Errorf("Expected error for unterminated quote")
+	}
+}
+
+func TestNewExecSource(t *testing.T) {
+	src, err := newExecSource("echo 'up 1'", false, time.Second)
+	if f, ok := src.fetcher.(*metrics.ExecFetcher); err != nil || !ok || !slices.Equal(f.Args, []string{"echo", "up 1"}) {
+		t.Errorf("Unexpected source %+v, %v", src, err)
+	}
+	src, err = newExecSource("echo up 1 | cat", true, time.Second)
+	if f, ok := src.fetcher.(*metrics.ExecFetcher); err != nil || !ok || !slices.Equal(f.Args, []string{"sh", "-c", "echo up 1 | cat"}) {
+		t.Errorf("Unexpected source %+v, %v", src, err)
+	}
+}
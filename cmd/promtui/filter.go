@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// seriesFilter hides series matching the search from the view. The series
+// derived from a series (see metrics.Deriver) are hidden along with it.
+type seriesFilter struct {
+
+	// hideRuntime hides the runtime families (see withoutRuntime).
+	hideRuntime bool
+
+	// types selects the types of metrics shown (see withTypes).
+	types typeMask
+
+	// hideZero hides the series whose latest value is zero and hideUnchanged
+	// the series whose value did not change within the history.
+	hideZero, hideUnchanged bool
+}
+
+// hiddenSeries counts the series hidden for being zero and unchanged (see
+// seriesFilter). Series that are both count as zero.
+type hiddenSeries struct {
+	zero, unchanged int
+}
+
+// hiddenCounts describes the given counts of hidden series (e.g. "3 zero, 5
+// unchanged").
+func hiddenCounts(h hiddenSeries) string {
+	var parts []string
+	if h.zero > 0 {
+		parts = append(parts, groupDigits(strconv.Itoa(h.zero))+" zero")
+	}
+	if h.unchanged > 0 {
+		parts = append(parts, groupDigits(strconv.Itoa(h.unchanged))+" unchanged")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// apply returns the series of the given dump not hidden by the filter and how
+// many were hidden for being zero or unchanged.
+func (f seriesFilter) apply(dump [][]metrics.Observation, search string) ([][]metrics.Observation, hiddenSeries) {
+	if f.hideRuntime {
+		dump = withoutRuntime(dump, search)
+	}
+	dump = withTypes(dump, f.types)
+	var hidden hiddenSeries
+	if !f.hideZero && !f.hideUnchanged {
+		return dump, hidden
+	}
+	kept := make([][]metrics.Observation, 0, len(dump))
+	for _, series := range dump {
+		switch {
+		case f.hideZero && isZero(series):
+			hidden.zero++
+		case f.hideUnchanged && isUnchanged(series):
+			hidden.unchanged++
+		default:
+			kept = append(kept, series)
+		}
+	}
+	return kept, hidden
+}
+
+// isZero returns true, if the latest value of the given series is zero.
+func isZero(series []metrics.Observation) bool {
+	return series[0].Value == 0
+}
+
+// isUnchanged returns true, if the given series has more than one observation
+// and all of them have the same value. Stale series are considered changed,
+// as they just disappeared.
+func isUnchanged(series []metrics.Observation) bool {
+	if len(series) < 2 || series[0].Stale {
+		return false
+	}
+	for _, o := range series[1:] {
+		if o.Value != series[0].Value && !(math.IsNaN(o.Value) && math.IsNaN(series[0].Value)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestSeriesFilter_Apply(t *testing.T) {
+	series := func(name string, kind metrics.ObservationKind, values ...float64) []metrics.Observation {
+		var obs []metrics.Observation
+		for _, v := range values {
+			obs = append(obs, metrics.Observation{Name: name, Metric: name, Kind: kind, Value: v})
+		}
+		return obs
+	}
+	dump := [][]metrics.Observation{
+		series("errors_total", metrics.ObservationCounter, 0, 0, 0),
+		series("requests_total", metrics.ObservationCounter, 5, 5, 5),
+		series("queue_depth", metrics.ObservationGauge, 0, 3),
+		series("temperature", metrics.ObservationGauge, 21, 20),
+		series("ratio", metrics.ObservationGauge, math.NaN(), math.NaN()),
+		series("go_goroutines", metrics.ObservationGauge, 0, 0),
+		series("started", metrics.ObservationGauge, 7),
+	}
+	tests := []struct {
+		name     string
+		filter   seriesFilter
+		expected string
+		hidden   hiddenSeries
+	}{
+		{"none", seriesFilter{}, "errors_total requests_total queue_depth temperature ratio go_goroutines started", hiddenSeries{}},
+		{"zero", seriesFilter{hideZero: true}, "requests_total temperature ratio started", hiddenSeries{zero: 3}},
+		{"unchanged", seriesFilter{hideUnchanged: true}, "queue_depth temperature started", hiddenSeries{unchanged: 4}},
+		{"both", seriesFilter{hideZero: true, hideUnchanged: true}, "temperature started", hiddenSeries{zero: 3, unchanged: 2}},
+		{"with others", seriesFilter{hideRuntime: true, types: 1 << typeGauge, hideZero: true}, "temperature ratio started", hiddenSeries{zero: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, hidden := tt.filter.apply(dump, "")
+			var names []string
+			for _, s := range kept {
+				names = append(names, s[0].Name)
+			}
+			if actual := strings.Join(names, " "); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+			if hidden != tt.hidden {
+				t.Errorf("Expected %v, but got %v", tt.hidden, hidden)
+			}
+		})
+	}
+}
+
+func TestModel_FooterHidden(t *testing.T) {
+	m := &model{
+		targets:  []*target{{store: metrics.NewStore(3, nil)}},
+		styles:   newStyles(nil, false),
+		viewport: viewport.New(200, 10),
+		hidden:   hiddenSeries{zero: 1200, unchanged: 5},
+	}
+	if footer := m.footerView(); !strings.Contains(footer, " hidden: 1,200 zero, 5 unchanged |") {
+		t.Errorf("Expected the hidden series in the footer, but got %q", footer)
+	}
+}
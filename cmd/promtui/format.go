@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// unit is the unit of a metric as indicated by the conventional suffix of its
+// name.
+type unit int
+
+const (
+	unitNone unit = iota
+	unitBytes
+	unitSeconds
+)
+
+// numberFormat is the format of plain numbers (see valueFormatter.number).
+type numberFormat int
+
+const (
+	numberPlain numberFormat = iota
+	numberSI
+	numberGrouped
+)
+
+var numberFormatNames = []string{"plain", "si", "grouped"}
+
+var (
+	byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	siUnits   = []string{"", "k", "M", "G", "T", "P", "E"}
+)
+
+// valueFormatter formats values for display.
+type valueFormatter struct {
+
+	// humanize enables human-readable formatting of metrics with a known unit
+	// (e.g. "1.19 GiB" for "_bytes" metrics).
+	humanize bool
+
+	// numbers is the format of plain numbers.
+	numbers numberFormat
+
+	// decimals is the number of decimals values are rounded to (see round).
+	decimals int
+
+	// timestamps are the suffixes of the names of gauges holding unix
+	// timestamps, formatted as time and age (see isTimestamp). If nil, the
+	// defaultTimestampSuffixes are. (A pointer, as formatters are compared.)
+	timestamps *[]string
+
+	// timeFormat is the layout of the timestamps of the expanded history
+	// (see expandedValues). Empty, if none are shown.
+	timeFormat string
+}
+
+func (f numberFormat) String() string {
+	return numberFormatNames[f]
+}
+
+// parseNumberFormat parses the name of a number format (e.g. "grouped").
+func parseNumberFormat(s string) (numberFormat, error) {
+	for i, name := range numberFormatNames {
+		if name == s {
+			return numberFormat(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown number format %q", s)
+}
+
+// round rounds v to the configured number of decimals. Values below 1 keep at
+// least three significant digits, so that small values (e.g. 0.0000412) do not
+// round to 0.
+func (f valueFormatter) round(v float64) float64 {
+	decimals := f.decimals
+	if a := math.Abs(v); a > 0 && a < 1 {
+		decimals = max(decimals, 2-int(math.Floor(math.Log10(a))))
+	}
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
+
+func format(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// value formats the value v of (or derived from) the given observation. Values
+// of integral kinds (e.g. counters) are formatted as integers.
+func (f valueFormatter) value(o metrics.Observation, v float64) string {
+	integral := isIntegral(o.Kind)
+	if !f.humanize {
+		return f.number(v, integral)
+	}
+	if f.isTimestamp(o) {
+		return timestamp(o, v, time.Now())
+	}
+	u, perSecond := unitOf(o)
+	var s string
+	switch u {
+	case unitBytes:
+		s = f.bytes(v)
+	case unitSeconds:
+		s = f.seconds(v)
+	default:
+		return f.number(v, integral)
+	}
+	if perSecond {
+		s += "/s"
+	}
+	return s
+}
+
+// delta formats the difference d of values of (or derived from) the given
+// observation. Differences of timestamps are durations.
+func (f valueFormatter) delta(o metrics.Observation, d float64) string {
+	if f.humanize && f.isTimestamp(o) {
+		return f.seconds(d)
+	}
+	return f.value(o, d)
+}
+
+// special returns the glyph standing for the given value, if it is not finite:
+// the dash for values without an estimate (NaN, e.g. quantiles of an idle
+// summary) and the infinity sign for infinite ones.
+func special(v float64, g glyphs) (string, bool) {
+	switch {
+	case math.IsNaN(v):
+		return g.dash, true
+	case math.IsInf(v, 1):
+		return g.inf, true
+	case math.IsInf(v, -1):
+		return "-" + g.inf, true
+	}
+	return "", false
+}
+
+// finite returns true, if the given value is neither NaN nor infinite.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// number formats a plain number according to the number format. Numbers below
+// 1000 are never abbreviated.
+func (f valueFormatter) number(v float64, integral bool) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return format(v)
+	}
+	if f.numbers == numberSI && math.Abs(v) >= 1000 {
+		i := 0
+		for math.Abs(v) >= 1000 && i < len(siUnits)-1 {
+			v /= 1000
+			i++
+		}
+		return format(f.round(v)) + siUnits[i]
+	}
+	var s string
+	if integral {
+		s = strconv.FormatFloat(math.Round(v), 'f', 0, 64)
+	} else {
+		s = format(f.round(v))
+	}
+	if f.numbers == numberGrouped {
+		return groupDigits(s)
+	}
+	return s
+}
+
+// isIntegral returns true, if observations of the given kind are integral by
+// nature (e.g. counters).
+func isIntegral(kind metrics.ObservationKind) bool {
+	switch kind {
+	case metrics.ObservationCounter, metrics.ObservationHistogramCount,
+		metrics.ObservationHistogramBucket, metrics.ObservationSummaryCount:
+		return true
+	}
+	return false
+}
+
+// groupDigits inserts thousands separators into the integer part of the given
+// formatted number (e.g. "1234567.5" becomes "1,234,567.5").
+func groupDigits(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	var sb strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(r)
+	}
+	if hasFrac {
+		sb.WriteString("." + frac)
+	}
+	return sign + sb.String()
+}
+
+// unitOf returns the unit of the given observation and whether it is a
+// per-second rate of that unit. Counts (e.g. histogram buckets) have no unit,
+// even if the metric name has a unit suffix.
+func unitOf(o metrics.Observation) (unit, bool) {
+	name := o.Metric
+	var perSecond bool
+	for _, suffix := range []string{"_per_second_rate", "_per_second_avg_rate"} {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			perSecond = true
+			break
+		}
+	}
+	if strings.HasSuffix(name, "_bucket") || strings.HasSuffix(name, "_count") {
+		return unitNone, false
+	}
+	for _, suffix := range []string{"_total", "_sum", "_avg", "_interval_quantile", "_quantile"} {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			break
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, "_bytes"):
+		return unitBytes, perSecond
+	case strings.HasSuffix(name, "_seconds"):
+		return unitSeconds, perSecond
+	}
+	return unitNone, false
+}
+
+// bytes formats the given number of bytes using binary prefixes (e.g.
+// "1.19 GiB").
+func (f valueFormatter) bytes(b float64) string {
+	i := 0
+	for math.Abs(b) >= 1024 && i < len(byteUnits)-1 {
+		b /= 1024
+		i++
+	}
+	return format(f.round(b)) + " " + byteUnits[i]
+}
+
+// seconds formats the given number of seconds depending on its magnitude (e.g.
+// "12.3ms", "4.5s", "3m 20s", or "25h 5m").
+func (f valueFormatter) seconds(s float64) string {
+	if math.IsInf(s, 0) {
+		return format(s)
+	}
+	sign := ""
+	if s < 0 {
+		sign = "-"
+		s = -s
+	}
+	switch {
+	case s == 0:
+		return "0s"
+	case s < 1e-6:
+		return sign + format(f.round(s*1e9)) + "ns"
+	case s < 1e-3:
+		return sign + format(f.round(s*1e6)) + "µs"
+	case s < 1:
+		return sign + format(f.round(s*1e3)) + "ms"
+	case s < 60:
+		return sign + format(f.round(s)) + "s"
+	case s < 3600:
+		m := math.Floor(s / 60)
+		return sign + format(m) + "m " + format(math.Floor(s-m*60)) + "s"
+	default:
+		h := math.Floor(s / 3600)
+		return sign + format(h) + "h " + format(math.Floor((s-h*3600)/60)) + "m"
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestValueFormatter_Value(t *testing.T) {
+	tests := []struct {
+		metric   string
+		kind     metrics.ObservationKind
+		value    float64
+		expected string
+	}{
+		{"process_resident_memory_bytes", metrics.ObservationGauge, 1273495552, "1.19 GiB"},
+		{"process_resident_memory_bytes", metrics.ObservationGauge, 512, "512 B"},
+		{"http_request_duration_seconds_sum", metrics.ObservationHistogramSum, 90321.23, "25h 5m"},
+		{"http_request_duration_seconds_avg", metrics.ObservationHistogramAvg, 0.0123, "12.3ms"},
+		{"http_request_duration_seconds_count", metrics.ObservationHistogramCount, 1234, "1234"},
+		{"http_request_duration_seconds_bucket", metrics.ObservationHistogramBucket, 1234, "1234"},
+		{"process_cpu_seconds_total", metrics.ObservationCounter, 200, "3m 20s"},
+		{"sent_bytes_total_per_second_rate", metrics.ObservationCounterRate, 13002342.4, "12.4 MiB/s"},
+		{"requests_total_per_second_rate", metrics.ObservationCounterRate, 1.234, "1.23"},
+		{"go_goroutines", metrics.ObservationGauge, 42, "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			o := metrics.NewObservation(tt.metric, nil, tt.kind, time.Now(), tt.value)
+			if actual := (valueFormatter{humanize: true, decimals: 2}).value(o, o.Value); actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValueFormatter_ValueRaw(t *testing.T) {
+	o := metrics.NewObservation("process_resident_memory_bytes", nil, metrics.ObservationGauge, time.Now(), 1273495552)
+	if actual := (valueFormatter{decimals: 2}).value(o, o.Value); actual != "1273495552" {
+		t.Errorf("Expected %q, but got %q", "1273495552", actual)
+	}
+}
+
+func TestValueFormatter_Number(t *testing.T) {
+	tests := []struct {
+		numbers  numberFormat
+		value    float64
+		expected string
+	}{
+		{numberPlain, 1234567890, "1234567890"},
+		{numberSI, 1234567890, "1.23G"},
+		{numberSI, 999.5, "999.5"},
+		{numberSI, -1500, "-1.5k"},
+		{numberGrouped, 1234567890, "1,234,567,890"},
+		{numberGrouped, -1234.56, "-1,234.56"},
+		{numberGrouped, 123, "123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.numbers.String()+"/"+tt.expected, func(t *testing.T) {
+			if actual := (valueFormatter{numbers: tt.numbers, decimals: 2}).number(tt.value, false); actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValueFormatter_Round(t *testing.T) {
+	tests := []struct {
+		decimals int
+		value    float64
+		expected float64
+	}{
+		{2, 1.23456, 1.23},
+		{0, 1.5, 2},
+		{4, 1.23456, 1.2346},
+		{2, 0.5, 0.5},
+		{2, 0.0412345, 0.0412},
+		{2, 0.0000412345, 0.0000412},
+		{2, -0.0000412345, -0.0000412},
+		{2, 0, 0},
+	}
+	for _, tt := range tests {
+		if actual := (valueFormatter{decimals: tt.decimals}).round(tt.value); actual != tt.expected {
+			t.Errorf("Expected %v, but got %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestValueFormatter_ValueIntegral(t *testing.T) {
+	tests := []struct {
+		kind     metrics.ObservationKind
+		numbers  numberFormat
+		value    float64
+		expected string
+	}{
+		{metrics.ObservationCounter, numberPlain, 1523, "1523"},
+		{metrics.ObservationCounter, numberPlain, 1523.0000001, "1523"},
+		{metrics.ObservationHistogramCount, numberPlain, 1 << 53, "9007199254740992"},
+		{metrics.ObservationHistogramBucket, numberPlain, 1<<53 + 1, "9007199254740992"},
+		{metrics.ObservationSummaryCount, numberPlain, 1e17, "100000000000000000"},
+		{metrics.ObservationCounter, numberGrouped, 1 << 53, "9,007,199,254,740,992"},
+		{metrics.ObservationCounter, numberSI, 999, "999"},
+		{metrics.ObservationCounter, numberSI, 1 << 53, "9.01P"},
+		{metrics.ObservationGauge, numberPlain, 1523.5, "1523.5"},
+		{metrics.ObservationCounterRate, numberPlain, 0.25, "0.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String()+"/"+tt.expected, func(t *testing.T) {
+			o := metrics.NewObservation("requests", nil, tt.kind, time.Now(), tt.value)
+			f := valueFormatter{humanize: true, numbers: tt.numbers, decimals: 2}
+			if actual := f.value(o, o.Value); actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
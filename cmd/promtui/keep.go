@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// keepFlag is a flag that may be given multiple times, each time with a
+// pattern (a substring or regular expression) selecting the metric families
+// to keep (see metrics.Store.Keep).
+type keepFlag []*regexp.Regexp
+
+func (f *keepFlag) String() string {
+	return strings.Join(f.values(), "; ")
+}
+
+func (f *keepFlag) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", s, err)
+	}
+	*f = append(*f, re)
+	return nil
+}
+
+func (f *keepFlag) values() []string {
+	patterns := make([]string, 0, len(*f))
+	for _, re := range *f {
+		patterns = append(patterns, re.String())
+	}
+	return patterns
+}
+
+// keep returns the function keeping the families matched by any of the
+// patterns or, without patterns, nil (see metrics.Store.Keep).
+func (f keepFlag) keep() func(string) bool {
+	if len(f) == 0 {
+		return nil
+	}
+	return func(family string) bool {
+		for _, re := range f {
+			if re.MatchString(family) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestKeepFlag(t *testing.T) {
+	var f keepFlag
+	if f.keep() != nil {
+		t.Errorf("Expected to keep all families without patterns")
+	}
+	for _, p := range []string{"http_", "^go_(gc|memstats)_"} {
+		if err := f.Set(p); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := f.Set("("); err == nil {
+		t.Errorf("Expected an error for an invalid pattern")
+	}
+	tests := []struct {
+		family   string
+		expected bool
+	}{
+		{"http_requests_total", true},
+		{"promhttp_http_requests_total", true},
+		{"go_gc_duration_seconds", true},
+		{"go_goroutines", false},
+		{"process_cpu_seconds_total", false},
+	}
+	keep := f.keep()
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			if actual := keep(tt.family); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// keymap holds the key bindings of the TUI. Update consults it and the help
+// (see helpView) lists it, so that the help always matches the behavior.
+type keymap struct {
+	quit, help, cancel key.Binding
+
+	// Navigation.
+	up, down, pageUp, pageDown key.Binding
+	nextTarget, previousTarget key.Binding
+	endpoint                   key.Binding
+	nextFamily, previousFamily key.Binding
+
+	// Search.
+	search, deleteChar, deleteWord   key.Binding
+	browse, nextMatch, previousMatch key.Binding
+	yankName, yankLine, watch        key.Binding
+	showAll                          key.Binding
+
+	// Views.
+	rawValues, numberFormat, compare, baseline, export key.Binding
+	aggregate, runtime, types, zero, unchanged         key.Binding
+	events, unchangedFor, expandHistory, hoistLabels   key.Binding
+	pivot, gaugeArrows, top, targets                   key.Binding
+
+	// Sampling.
+	refresh, pause, longerInterval, shorterInterval key.Binding
+}
+
+// newKeymap returns the default key bindings.
+func newKeymap() keymap {
+	return keymap{
+		quit:   key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "quit")),
+		help:   key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "toggle help")),
+		cancel: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close help, event log, or prompt")),
+
+		up:             key.NewBinding(key.WithKeys("up"), key.WithHelp("up", "scroll up")),
+		down:           key.NewBinding(key.WithKeys("down"), key.WithHelp("down", "scroll down")),
+		pageUp:         key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "page up")),
+		pageDown:       key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdown", "page down")),
+		nextTarget:     key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "next endpoint")),
+		previousTarget: key.NewBinding(key.WithKeys("shift+tab"), key.WithHelp("shift+tab", "previous endpoint")),
+		endpoint:       key.NewBinding(key.WithKeys("ctrl+x"), key.WithHelp("ctrl+x", "open another endpoint")),
+		nextFamily:     key.NewBinding(key.WithKeys("]"), key.WithHelp("]", "next metric family")),
+		previousFamily: key.NewBinding(key.WithKeys("["), key.WithHelp("[", "previous metric family")),
+		browse:         key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "finish search")),
+		nextMatch:      key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "next match")),
+		previousMatch:  key.NewBinding(key.WithKeys("N"), key.WithHelp("N", "previous match")),
+		yankName:       key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "copy the name of the top row")),
+		yankLine:       key.NewBinding(key.WithKeys("Y"), key.WithHelp("Y", "copy the name and value of the top row")),
+		watch:          key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "(un-)watch the top row for changes")),
+		showAll:        key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "show all series beyond -max-lines (again: hide)")),
+
+		// Typing searches, so search has no keys of its own.
+		search:     key.NewBinding(key.WithHelp("<xyz>", `search "xyz" (a substring or a selector)`)),
+		deleteChar: key.NewBinding(key.WithKeys("backspace"), key.WithHelp("backspace", "delete last character")),
+		deleteWord: key.NewBinding(key.WithKeys("ctrl+w"), key.WithHelp("ctrl+w", "delete last word")),
+
+		rawValues:     key.NewBinding(key.WithKeys("ctrl+f"), key.WithHelp("ctrl+f", "toggle raw values")),
+		numberFormat:  key.NewBinding(key.WithKeys("ctrl+n"), key.WithHelp("ctrl+n", "cycle number format")),
+		compare:       key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("ctrl+d", "compare with next endpoint")),
+		baseline:      key.NewBinding(key.WithKeys("ctrl+b"), key.WithHelp("ctrl+b", "set baseline")),
+		export:        key.NewBinding(key.WithKeys("ctrl+s"), key.WithHelp("ctrl+s", "export view (again: history as CSV)")),
+		aggregate:     key.NewBinding(key.WithKeys("ctrl+g"), key.WithHelp("ctrl+g", "aggregate across labels")),
+		runtime:       key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("ctrl+t", "toggle runtime metrics")),
+		types:         key.NewBinding(key.WithKeys("ctrl+k"), key.WithHelp("ctrl+k", "cycle metric types shown")),
+		zero:          key.NewBinding(key.WithKeys("ctrl+o"), key.WithHelp("ctrl+o", "toggle zero series")),
+		unchanged:     key.NewBinding(key.WithKeys("ctrl+u"), key.WithHelp("ctrl+u", "toggle unchanged series")),
+		unchangedFor:  key.NewBinding(key.WithKeys("ctrl+a"), key.WithHelp("ctrl+a", "cycle unchanged times (shown, sorted by)")),
+		expandHistory: key.NewBinding(key.WithKeys("ctrl+e"), key.WithHelp("ctrl+e", "toggle expanded history")),
+		events:        key.NewBinding(key.WithKeys("ctrl+l"), key.WithHelp("ctrl+l", "toggle event log")),
+		hoistLabels:   key.NewBinding(key.WithKeys("ctrl+v"), key.WithHelp("ctrl+v", "toggle common labels in the header")),
+		pivot:         key.NewBinding(key.WithKeys("ctrl+y"), key.WithHelp("ctrl+y", "pivot a label into columns")),
+		gaugeArrows:   key.NewBinding(key.WithKeys("ctrl+q"), key.WithHelp("ctrl+q", "toggle gauge change arrows")),
+		top:           key.NewBinding(key.WithKeys("alt+t"), key.WithHelp("alt+t", "toggle top movers")),
+		targets:       key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "targets overview (after enter)")),
+
+		refresh:         key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "refresh")),
+		pause:           key.NewBinding(key.WithKeys("ctrl+p"), key.WithHelp("ctrl+p", "(un-)pause")),
+		longerInterval:  key.NewBinding(key.WithKeys("ctrl+up"), key.WithHelp("ctrl+up", "longer interval")),
+		shorterInterval: key.NewBinding(key.WithKeys("ctrl+down"), key.WithHelp("ctrl+down", "shorter interval")),
+	}
+}
+
+// named returns the bindings by the names used to remap them (see remap).
+func (k *keymap) named() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"quit":             &k.quit,
+		"help":             &k.help,
+		"cancel":           &k.cancel,
+		"up":               &k.up,
+		"down":             &k.down,
+		"page-up":          &k.pageUp,
+		"page-down":        &k.pageDown,
+		"next-target":      &k.nextTarget,
+		"previous-target":  &k.previousTarget,
+		"open-endpoint":    &k.endpoint,
+		"next-family":      &k.nextFamily,
+		"previous-family":  &k.previousFamily,
+		"delete-char":      &k.deleteChar,
+		"delete-word":      &k.deleteWord,
+		"browse":           &k.browse,
+		"next-match":       &k.nextMatch,
+		"previous-match":   &k.previousMatch,
+		"yank-name":        &k.yankName,
+		"yank-line":        &k.yankLine,
+		"watch":            &k.watch,
+		"show-all":         &k.showAll,
+		"raw-values":       &k.rawValues,
+		"number-format":    &k.numberFormat,
+		"compare":          &k.compare,
+		"baseline":         &k.baseline,
+		"export":           &k.export,
+		"aggregate":        &k.aggregate,
+		"runtime":          &k.runtime,
+		"types":            &k.types,
+		"zero":             &k.zero,
+		"unchanged":        &k.unchanged,
+		"events":           &k.events,
+		"expand-history":   &k.expandHistory,
+		"common-labels":    &k.hoistLabels,
+		"pivot":            &k.pivot,
+		"gauge-arrows":     &k.gaugeArrows,
+		"top":              &k.top,
+		"targets":          &k.targets,
+		"unchanged-for":    &k.unchangedFor,
+		"refresh":          &k.refresh,
+		"pause":            &k.pause,
+		"longer-interval":  &k.longerInterval,
+		"shorter-interval": &k.shorterInterval,
+	}
+}
+
+// keyAliases are the names of keys whose key messages read differently.
+var keyAliases = map[string]string{
+	"space": " ",
+}
+
+// keyName returns the name of the given key of a key message as given in the
+// config file (e.g. "space" for " ", see keyAliases).
+func keyName(msgKey string) string {
+	for name, alias := range keyAliases {
+		if alias == msgKey {
+			return name
+		}
+	}
+	return msgKey
+}
+
+// remap replaces the keys of the bindings with the given names (e.g. "pause"
+// to "space"). A binding mapped to no keys is disabled.
+func (k *keymap) remap(bindings map[string][]string) error {
+	named := k.named()
+	for name, keys := range bindings {
+		b, ok := named[name]
+		if !ok {
+			return fmt.Errorf("unknown key binding %q", name)
+		}
+		msgKeys := make([]string, 0, len(keys))
+		for _, msgKey := range keys {
+			msgKey = strings.TrimSpace(msgKey)
+			if msgKey == "" {
+				return fmt.Errorf("key binding %q: empty key", name)
+			}
+			if alias, ok := keyAliases[msgKey]; ok {
+				msgKey = alias
+			}
+			msgKeys = append(msgKeys, msgKey)
+		}
+		b.SetKeys(msgKeys...)
+		b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+		b.SetEnabled(len(keys) > 0)
+	}
+	return nil
+}
+
+// browseKeys are the names of the bindings applying only after enter (see
+// model.browsing), when typing no longer searches.
+var browseKeys = map[string]bool{
+	"next-match":     true,
+	"previous-match": true,
+	"yank-name":      true,
+	"yank-line":      true,
+	"watch":          true,
+	"show-all":       true,
+	"targets":        true,
+}
+
+// conflicts returns an error naming the first key bound to more than one
+// binding or, unless the binding applies only after enter (see browseKeys),
+// typed into the search (e.g. "r" or space, see isSearchRune).
+func (k *keymap) conflicts() error {
+	named := k.named()
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bound := make(map[string]string)
+	for _, name := range names {
+		for _, msgKey := range named[name].Keys() {
+			if other, ok := bound[msgKey]; ok {
+				return fmt.Errorf("key %q is bound to both %s and %s", msgKey, other, name)
+			}
+			if r := []rune(msgKey); len(r) == 1 && isSearchRune(r[0]) && !browseKeys[name] {
+				return fmt.Errorf("key %q of %s is typed into the search (bind it to a key with ctrl or alt instead)", keyName(msgKey), name)
+			}
+			bound[msgKey] = name
+		}
+	}
+	return nil
+}
+
+// keyGroup is a category of key bindings in the help.
+type keyGroup struct {
+	name     string
+	bindings []key.Binding
+}
+
+// groups returns the key bindings by category. The help of browse names the
+// keys applying after it.
+func (k keymap) groups() []keyGroup {
+	browse := k.browse
+	browse.SetHelp(browse.Help().Key, fmt.Sprintf("%s (then %s jump to matches, %s copy, %s watches, %s shows all)",
+		browse.Help().Desc, keysOf(k.nextMatch, k.previousMatch), keysOf(k.yankName, k.yankLine), keysOf(k.watch), keysOf(k.showAll)))
+	return []keyGroup{
+		{"Navigation", []key.Binding{k.up, k.down, k.pageUp, k.pageDown, k.nextTarget, k.previousTarget, k.endpoint, k.nextFamily, k.previousFamily}},
+		{"Search", []key.Binding{k.search, k.deleteChar, k.deleteWord, browse, k.nextMatch, k.previousMatch, k.yankName, k.yankLine, k.watch, k.showAll}},
+		{"Views", []key.Binding{k.rawValues, k.numberFormat, k.compare, k.baseline, k.expandHistory, k.hoistLabels, k.pivot, k.gaugeArrows, k.top, k.aggregate, k.runtime, k.types, k.zero, k.unchanged, k.unchangedFor, k.events, k.targets, k.export, k.help}},
+		{"Sampling", []key.Binding{k.refresh, k.pause, k.longerInterval, k.shorterInterval}},
+		{"General", []key.Binding{k.cancel, k.quit}},
+	}
+}
+
+// keysOf returns the keys of the given bindings as shown in the help (e.g.
+// "n/N"), leaving out disabled ones.
+func keysOf(bindings ...key.Binding) string {
+	keys := make([]string, 0, len(bindings))
+	for _, b := range bindings {
+		if b.Enabled() {
+			keys = append(keys, b.Help().Key)
+		}
+	}
+	return strings.Join(keys, "/")
+}
+
+// hint returns the hint on the given bindings shown in the footer (e.g.
+// "ctrl+c: quit | ?: help").
+func hint(bindings ...key.Binding) string {
+	parts := make([]string, 0, len(bindings))
+	for _, b := range bindings {
+		parts = append(parts, b.Help().Key+": "+b.Help().Desc)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// viewportKeyMap returns the key bindings of the viewport. Letters search, so
+// the viewport does not get any.
+func (k keymap) viewportKeyMap() viewport.KeyMap {
+	return viewport.KeyMap{
+		PageDown:     k.pageDown,
+		PageUp:       k.pageUp,
+		HalfPageUp:   key.NewBinding(key.WithDisabled()),
+		HalfPageDown: key.NewBinding(key.WithDisabled()),
+		Up:           k.up,
+		Down:         k.down,
+		Left:         key.NewBinding(key.WithDisabled()),
+		Right:        key.NewBinding(key.WithDisabled()),
+	}
+}
+
+// helpView renders the help listing the key bindings by category, centered in
+// the given area.
+func (m *model) helpView(width, height int) string {
+	keyWidth := 0
+	for _, g := range m.keys.groups() {
+		for _, b := range g.bindings {
+			keyWidth = max(keyWidth, len(b.Help().Key))
+		}
+	}
+	var sb strings.Builder
+	for i, g := range m.keys.groups() {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(m.styles.changed.Render(g.name) + "\n")
+		for _, b := range g.bindings {
+			sb.WriteString(fmt.Sprintf("  %-*s  %s\n", keyWidth, b.Help().Key, b.Help().Desc))
+		}
+	}
+	sb.WriteString("\n" + m.styles.muted.Render("press "+m.keys.help.Help().Key+" or "+m.keys.cancel.Help().Key+" to close"))
+	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, sb.String())
+}
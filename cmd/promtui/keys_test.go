@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestKeymap_Groups(t *testing.T) {
+	k := newKeymap()
+	listed := 0
+	for _, g := range k.groups() {
+		listed += len(g.bindings)
+	}
+	// Each binding is listed in the help.
+	if n := reflect.TypeOf(k).NumField(); listed != n {
+		t.Errorf("Expected %d bindings in the help, but got %d", n, listed)
+	}
+}
+
+func TestKeymap_Remap(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings map[string][]string
+		err      string
+	}{
+		{name: "defaults"},
+		{name: "f5 to pause", bindings: map[string][]string{"pause": {"f5"}, "refresh": {"ctrl+p", "ctrl+r"}}},
+		{name: "space to pause", bindings: map[string][]string{"pause": {"space"}, "refresh": {"r"}}, err: `key "space" of pause is typed into the search (bind it to a key with ctrl or alt instead)`},
+		{name: "letter to refresh", bindings: map[string][]string{"refresh": {"r"}}, err: `key "r" of refresh is typed into the search (bind it to a key with ctrl or alt instead)`},
+		{name: "letter after enter", bindings: map[string][]string{"watch": {"W"}}},
+		{name: "conflict", bindings: map[string][]string{"refresh": {"ctrl+p"}}, err: `key "ctrl+p" is bound to both pause and refresh`},
+		{name: "unknown", bindings: map[string][]string{"sleep": {"z"}}, err: `unknown key binding "sleep"`},
+		{name: "empty", bindings: map[string][]string{"pause": {" "}}, err: `key binding "pause": empty key`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newKeymap()
+			err := k.remap(tt.bindings)
+			if err == nil {
+				err = k.conflicts()
+			}
+			if actual := fmt.Sprint(err); (tt.err == "" && err != nil) || (tt.err != "" && actual != tt.err) {
+				t.Errorf("Expected error %q, but got %v", tt.err, err)
+			}
+		})
+	}
+
+	k := newKeymap()
+	if err := k.remap(map[string][]string{"pause": {"f5"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !key.Matches(tea.KeyMsg{Type: tea.KeyF5}, k.pause) || k.pause.Help().Key != "f5" {
+		t.Errorf("Expected f5 to pause, but got %v", k.pause.Keys())
+	}
+}
+
+func TestModel_HelpViewRemapped(t *testing.T) {
+	m := newTestModel()
+	if err := m.keys.remap(map[string][]string{"help": {"f1"}, "cancel": {"f2"}, "next-match": {"j"}, "watch": {"W"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	view := m.helpView(120, 80)
+	for _, s := range []string{"press f1 or f2 to close", "then j/N jump to matches", "W watches"} {
+		if !strings.Contains(view, s) {
+			t.Errorf("Expected %q in the help, but got %q", s, view)
+		}
+	}
+}
+
+func TestModel_UpdateHelp(t *testing.T) {
+	m := newTestModel()
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")})
+	if !m.showHelp {
+		t.Fatalf("Expected the help to be shown")
+	}
+	view := m.helpView(80, 60)
+	for _, s := range []string{"Navigation", "ctrl+p", "(un-)pause", "Sampling"} {
+		if !strings.Contains(view, s) {
+			t.Errorf("Expected %q in the help, but got %q", s, view)
+		}
+	}
+
+	// The help takes the keys.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	if m.search != "" {
+		t.Errorf("Expected no search, but got %q", m.search)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.showHelp {
+		t.Errorf("Expected the help to be closed")
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// kubeTarget is a pod scraped through the proxy of the Kubernetes API server,
+// given as pod/<namespace>/<name>[:<port>][/<path>] (e.g.
+// pod/default/api-7d4f:8080/metrics).
+type kubeTarget struct {
+	namespace, pod, port, path string
+}
+
+// parseKubeTarget parses the given pod target (see kubeTarget). The path
+// defaults to /metrics.
+func parseKubeTarget(s string) (kubeTarget, error) {
+	rest, ok := strings.CutPrefix(s, "pod/")
+	if !ok {
+		return kubeTarget{}, fmt.Errorf("unsupported target %q (expected pod/<namespace>/<name>[:<port>][/<path>])", s)
+	}
+	namespace, rest, _ := strings.Cut(rest, "/")
+	pod, path, _ := strings.Cut(rest, "/")
+	pod, port, _ := strings.Cut(pod, ":")
+	if namespace == "" || pod == "" {
+		return kubeTarget{}, fmt.Errorf("missing namespace or pod in %q (expected pod/<namespace>/<name>[:<port>][/<path>])", s)
+	}
+	if path == "" {
+		path = "metrics"
+	}
+	return kubeTarget{namespace: namespace, pod: pod, port: port, path: "/" + path}, nil
+}
+
+// String returns the target as given to -kube.
+func (k kubeTarget) String() string {
+	s := "pod/" + k.namespace + "/" + k.pod
+	if k.port != "" {
+		s += ":" + k.port
+	}
+	return s + k.path
+}
+
+// proxyPath returns the path of the target on the API server, e.g.
+// /api/v1/namespaces/default/pods/api-7d4f:8080/proxy/metrics.
+func (k kubeTarget) proxyPath() string {
+	pod := url.PathEscape(k.pod)
+	if k.port != "" {
+		pod += ":" + url.PathEscape(k.port)
+	}
+	return "/api/v1/namespaces/" + url.PathEscape(k.namespace) + "/pods/" + pod + "/proxy" + k.path
+}
+
+// kubeconfig is the part of a kubeconfig file needed to reach the API server.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string      `yaml:"name"`
+		Cluster kubeCluster `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User kubeUser `yaml:"user"`
+	} `yaml:"users"`
+
+	// dir is the directory of the file, which relative paths are relative
+	// to.
+	dir string
+}
+
+type kubeCluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	TLSServerName            string `yaml:"tls-server-name"`
+}
+
+type kubeUser struct {
+	Token                 string `yaml:"token"`
+	TokenFile             string `yaml:"tokenFile"`
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+
+	// Exec and AuthProvider are credential plugins, which are left to
+	// kubectl (see newKubeSource).
+	Exec         any `yaml:"exec"`
+	AuthProvider any `yaml:"auth-provider"`
+}
+
+// kubeconfigPath returns the path of the kubeconfig file: the first of
+// $KUBECONFIG, or ~/.kube/config.
+func kubeconfigPath() string {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// readKubeconfig reads the kubeconfig file at the given path.
+func readKubeconfig(path string) (*kubeconfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read kubeconfig: %w", err)
+	}
+	var c kubeconfig
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parse kubeconfig %s: %w", path, err)
+	}
+	c.dir = filepath.Dir(path)
+	return &c, nil
+}
+
+// current returns the cluster and user of the current context.
+func (c *kubeconfig) current() (kubeCluster, kubeUser, error) {
+	var clusterName, userName string
+	found := false
+	for _, ctx := range c.Contexts {
+		if ctx.Name == c.CurrentContext {
+			clusterName, userName, found = ctx.Context.Cluster, ctx.Context.User, true
+		}
+	}
+	if !found {
+		return kubeCluster{}, kubeUser{}, fmt.Errorf("kubeconfig has no current context %q", c.CurrentContext)
+	}
+	var cluster *kubeCluster
+	for i := range c.Clusters {
+		if c.Clusters[i].Name == clusterName {
+			cluster = &c.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil || cluster.Server == "" {
+		return kubeCluster{}, kubeUser{}, fmt.Errorf("kubeconfig has no cluster %q", clusterName)
+	}
+	var user kubeUser
+	for _, u := range c.Users {
+		if u.Name == userName {
+			user = u.User
+		}
+	}
+	return *cluster, user, nil
+}
+
+// data returns the given base64-encoded data, or else the contents of the
+// given file (relative to the kubeconfig), or nil if neither is given.
+func (c *kubeconfig) data(encoded, path string) ([]byte, error) {
+	if encoded != "" {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.dir, path)
+	}
+	return os.ReadFile(path)
+}
+
+// client returns a client for the given cluster authenticating as the given
+// user by certificate, and the headers authenticating by token or password.
+func (c *kubeconfig) client(cluster kubeCluster, user kubeUser) (*http.Client, http.Header, error) {
+	tlsConfig := &tls.Config{ServerName: cluster.TLSServerName, InsecureSkipVerify: cluster.InsecureSkipTLSVerify}
+	ca, err := c.data(cluster.CertificateAuthorityData, cluster.CertificateAuthority)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read certificate authority: %w", err)
+	}
+	if ca != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, nil, fmt.Errorf("no certificates in certificate authority")
+		}
+	}
+	cert, err := c.data(user.ClientCertificateData, user.ClientCertificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read client certificate: %w", err)
+	}
+	key, err := c.data(user.ClientKeyData, user.ClientKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read client key: %w", err)
+	}
+	if cert != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	header := http.Header{}
+	token := user.Token
+	if token == "" && user.TokenFile != "" {
+		b, err := c.data("", user.TokenFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read token: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	switch {
+	case token != "":
+		header.Set("Authorization", "Bearer "+token)
+	case user.Username != "":
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username+":"+user.Password)))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConnsPerHost = 2
+	transport.IdleConnTimeout = 5 * time.Minute
+	return &http.Client{Transport: transport}, header, nil
+}
+
+// newKubeSource returns the source of the given pod target (see kubeTarget),
+// fetching through the proxy of the API server of the current context of the
+// kubeconfig (see kubeconfigPath). Users authenticating by credential plugins
+// (exec or auth-provider) are left to kubectl get --raw, run with the given
+// timeout.
+func newKubeSource(spec string, opts httpOptions, timeout time.Duration) (source, error) {
+	k, err := parseKubeTarget(spec)
+	if err != nil {
+		return source{}, err
+	}
+	c, err := readKubeconfig(kubeconfigPath())
+	if err != nil {
+		return source{}, err
+	}
+	cluster, user, err := c.current()
+	if err != nil {
+		return source{}, err
+	}
+	if user.Exec != nil || user.AuthProvider != nil {
+		f := metrics.NewExecFetcher([]string{"kubectl", "get", "--raw", k.proxyPath()}, timeout)
+		return source{fetcher: kubeFetcher{Fetcher: f, target: k}}, nil
+	}
+	client, header, err := c.client(cluster, user)
+	if err != nil {
+		return source{}, err
+	}
+	f := metrics.NewHTTPFetcher(strings.TrimSuffix(cluster.Server, "/") + k.proxyPath())
+	f.Client, f.Header, f.UserAgent = client, header, opts.userAgent
+	f.SetInterval(opts.interval)
+	return source{fetcher: kubeFetcher{Fetcher: f, target: k}}, nil
+}
+
+// kubeFetcher fetches the metrics of a pod through the API server, explaining
+// the errors of the API server (e.g. of a missing pod or permission).
+type kubeFetcher struct {
+	metrics.Fetcher
+	target kubeTarget
+}
+
+func (f kubeFetcher) Fetch(ctx context.Context) (io.ReadCloser, time.Time, error) {
+	r, t, err := f.Fetcher.Fetch(ctx)
+	var statusErr *metrics.StatusError
+	if err == nil || !errors.As(err, &statusErr) {
+		return r, t, err
+	}
+	pod := f.target.namespace + "/" + f.target.pod
+	switch statusErr.StatusCode {
+	case http.StatusNotFound:
+		return nil, time.Time{}, fmt.Errorf("pod %s (or its port or path) not found: %w", pod, err)
+	case http.StatusForbidden:
+		return nil, time.Time{}, fmt.Errorf("not allowed to proxy to pod %s (RBAC needs get on pods/proxy in namespace %s): %w", pod, f.target.namespace, err)
+	case http.StatusUnauthorized:
+		return nil, time.Time{}, fmt.Errorf("not authenticated by the API server (check the credentials of the kubeconfig): %w", err)
+	}
+	return nil, time.Time{}, err
+}
+
+// CloseIdleConnections closes the connections kept alive to the API server
+// (see metrics.HTTPFetcher.CloseIdleConnections), if not left to kubectl.
+func (f kubeFetcher) CloseIdleConnections() {
+	if c, ok := f.Fetcher.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// SetInterval sets the interval the pod is fetched at (see
+// metrics.HTTPFetcher.SetInterval), if not left to kubectl.
+func (f kubeFetcher) SetInterval(d time.Duration) {
+	if c, ok := f.Fetcher.(endpointClock); ok {
+		c.SetInterval(d)
+	}
+}
+
+// ClockSkew returns the clock skew of the API server (see
+// metrics.HTTPFetcher.ClockSkew), zero if left to kubectl.
+func (f kubeFetcher) ClockSkew() time.Duration {
+	if c, ok := f.Fetcher.(endpointClock); ok {
+		return c.ClockSkew()
+	}
+	return 0
+}
+
+// Dated returns true, if the latest fetch was timed by the API server (see
+// metrics.HTTPFetcher.Dated).
+func (f kubeFetcher) Dated() bool {
+	c, ok := f.Fetcher.(endpointClock)
+	return ok && c.Dated()
+}
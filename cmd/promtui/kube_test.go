@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKubeTarget(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+		err      bool
+	}{
+		{"pod/default/api-7d4f:8080/metrics", "/api/v1/namespaces/default/pods/api-7d4f:8080/proxy/metrics", false},
+		{"pod/monitoring/exporter:9100", "/api/v1/namespaces/monitoring/pods/exporter:9100/proxy/metrics", false},
+		{"pod/default/api/actuator/prometheus", "/api/v1/namespaces/default/pods/api/proxy/actuator/prometheus", false},
+		{"pod/default", "", true},
+		{"svc/default/api:8080", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			k, err := parseKubeTarget(tt.spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err == nil && k.proxyPath() != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, k.proxyPath())
+			}
+		})
+	}
+}
+
+func TestNewKubeSource(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/api/v1/namespaces/default/pods/api:8080/proxy/metrics":
+			_, _ = io.WriteString(w, "up 1\n")
+		case strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/kube-system/"):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	closed := make(chan struct{}, 1)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	config := `apiVersion: v1
+kind: Config
+current-context: test
+contexts:
+- name: test
+  context: {cluster: test, user: test}
+clusters:
+- name: test
+  cluster:
+    server: ` + srv.URL + `
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString(ca) + `
+users:
+- name: test
+  user: {token: secret}
+`
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv("KUBECONFIG", path)
+
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{spec: "pod/default/api:8080/metrics"},
+		{spec: "pod/default/gone:8080", err: "pod default/gone (or its port or path) not found"},
+		{spec: "pod/kube-system/dns:9153", err: "not allowed to proxy to pod kube-system/dns (RBAC needs get on pods/proxy in namespace kube-system)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			src, err := newKubeSource(tt.spec, httpOptions{}, 0)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			r, _, err := src.fetcher.Fetch(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Errorf("Expected error %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if b, _ := io.ReadAll(r); string(b) != "up 1\n" {
+				t.Errorf("Unexpected body %q", b)
+			}
+			_ = r.Close()
+
+			// Closing the source closes the connection to the API server.
+			src.close()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Errorf("Expected the connection closed")
+			}
+		})
+	}
+}
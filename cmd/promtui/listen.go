@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// pushMsg reports a push received by the given target (see waitPushCmd).
+type pushMsg struct {
+	target *target
+}
+
+// newListenSource returns the source of the metrics pushed to the given
+// address (e.g. ":9201", see metrics.Receiver), limiting pushes to the given
+// number of bytes (unless zero). It is sampled on pushes rather than
+// periodically.
+func newListenSource(addr string, limit int64) (source, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return source{}, fmt.Errorf("listen: %w", err)
+	}
+	r := metrics.NewReceiver()
+	r.MaxBodySize = limit
+	srv := &http.Server{Handler: r, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return source{fetcher: r, static: "listening on " + addr, receiver: r}, nil
+}
+
+// waitPushCmd returns a command that waits for the next push to the given
+// target.
+func waitPushCmd(t *target) tea.Cmd {
+	pushed := t.receiver.Pushed()
+	return func() tea.Msg {
+		<-pushed
+		return pushMsg{target: t}
+	}
+}
+
+// lastPush describes the latest push at the given time (e.g. "last push 3s
+// ago").
+func lastPush(at, now time.Time) string {
+	if at.IsZero() {
+		return "no push yet"
+	}
+	return "last push " + shortAge(max(0, now.Sub(at))) + " ago"
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastPush(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		at       time.Time
+		expected string
+	}{
+		{time.Time{}, "no push yet"},
+		{now.Add(-3 * time.Second), "last push 3s ago"},
+		{now.Add(time.Second), "last push 0s ago"},
+	}
+	for _, tt := range tests {
+		if actual := lastPush(tt.at, now); actual != tt.expected {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+}
@@ -1,309 +1,2119 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/sebogh/promtui/internal"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/sebogh/promtui/metrics"
 )
 
-var (
-	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#7D56F4"))
+// tickMsg triggers a sample once the refresh interval has passed. gen is the
+// generation of the sleep it originates from (see sleepCmd).
+type tickMsg struct {
+	gen int
+}
 
-	infoStyle = titleStyle
+// deadlineMsg is sent once the run duration (see -duration) has passed.
+type deadlineMsg struct{}
 
-	redStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
-	greenStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00"))
-	boldStyle  = lipgloss.NewStyle().Bold(true)
+// clockMsg is sent every second to keep relative times in the view current.
+type clockMsg time.Time
 
-	grayStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
-)
+// retryMsg triggers the retry of a target backed off after failed samples.
+// gen is the generation of the retry (see target.retryGen).
+type retryMsg struct {
+	target *target
+	gen    int
+}
 
-type tickMsg time.Time
+// searchMsg triggers the render of the search edited with the given
+// generation (see searchChanged).
+type searchMsg struct {
+	gen int
+}
 
+// sampledMsg reports the outcome of sampling the given target, which took
+// the given time.
 type sampledMsg struct {
+	target  *target
 	fetched bool
 	error   error
+	took    time.Duration
+}
+
+// intervals are the refresh intervals stepped through at runtime.
+var intervals = []time.Duration{
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
 }
 
 type model struct {
-	interval    time.Duration
-	data        *internal.Store
-	search      string
-	ready       bool
-	viewport    viewport.Model
-	endpoint    string
-	ticker      *time.Ticker
-	stopped     bool
+	interval  time.Duration
+	targets   []*target
+	current   int
+	search    string
+	ready     bool
+	viewport  viewport.Model
+	stopped   bool
+	sleepGen  int
+	sleepDone chan struct{}
+
+	// nextSample is when the pending sleep ends (zero, if there is none),
+	// shown as a countdown in the header.
+	nextSample time.Time
+
 	showHistory bool
 	showDerived bool
+
+	// expandHistory shows all values of the series rather than the change
+	// to the previous one (see expandedValues).
+	expandHistory bool
+
+	// hoistLabels shows the labels common to all rows (common, see
+	// commonLabels) once in the header rather than on every row.
+	hoistLabels bool
+	common      []metrics.Label
+
+	// showTop shows only the top series that moved most with the latest
+	// sample (see topMovers).
+	showTop bool
+	top     int
+
+	// pushgateway groups the series by the grouping keys of a Pushgateway
+	// even without push times, with those of groups pushed longer than
+	// pushMaxAge ago highlighted. pushGroups and stalePushes are the number
+	// of groups and of those pushed too long ago (see pushGroup.stale).
+	pushgateway bool
+	pushMaxAge  time.Duration
+	pushGroups  int
+	stalePushes int
+
+	// maxLines limits the rows shown (unless showAll), with more the number
+	// of rows left out (see moreLine).
+	maxLines int
+	showAll  bool
+	more     int
+
+	// sortStability is the number of positions series must move by to be
+	// re-ranked in sorts other than by name, with ranks the previous ones
+	// (see stabilize).
+	sortStability int
+	ranks         map[string]int
+
+	// stripPrefixes are the prefixes stripped from the names shown (see
+	// stripPrefixes), but not from those searched or exported.
+	stripPrefixes []string
+
+	// height is the height of the terminal (see fitViewport).
+	height int
+
+	// rules are the alert rules evaluated after each sample (see
+	// checkSample), ringing the bell when they start firing with bell.
+	rules []*rule
+	bell  bool
+
+	// filter hides series from the view, hidden counts those hidden among the
+	// rendered series for being zero or unchanged.
+	filter seriesFilter
+	hidden hiddenSeries
+
+	// compare enables the side-by-side comparison of the current target
+	// (A) with the next one (B). Values differing by more than tolerance
+	// (relative to the larger value) are highlighted.
+	compare   bool
+	tolerance float64
+
+	// arrows are the types of metrics whose changes are bold with arrows
+	// (and deltas, see renderSeries), for hold samples (see heldIndex).
+	arrows typeMask
+	hold   int
+
+	// pivot is the label the series are pivoted by into columns (see
+	// pivotView), if any.
+	pivot string
+
+	formatter valueFormatter
+	deriver   metrics.Deriver
+
+	// aggregation aggregates the series across labels (see
+	// metrics.Aggregation).
+	aggregation metrics.Aggregation
+
+	// prompting is what is typed into prompt (e.g. the labels to aggregate
+	// away, see updatePrompt). promptError is the error of the latest input,
+	// and connecting is set while an endpoint typed is sampled (see
+	// openEndpoint). connectGen counts the endpoints opened, and
+	// cancelConnect cancels the sample of the one in flight.
+	prompting     promptKind
+	prompt        string
+	promptError   string
+	connecting    bool
+	connectGen    int
+	cancelConnect context.CancelFunc
+
+	// exportDir is the directory exports are written to and exportedAt the
+	// time of the latest export of the view (see exportView).
+	exportDir  string
+	exportedAt time.Time
+
+	// count and duration stop the program after the given number of
+	// successful samples or the given time (unless zero). stats counts the
+	// samples of the run.
+	count    int
+	duration time.Duration
+	stats    runStats
+
+	// targetsFile is re-read periodically (unless its path is empty) to
+	// update the targets. skipped counts its malformed targets. New targets
+	// are fetched with httpOptions into stores created by newStore.
+	targetsFile targetsFile
+	skipped     int
+	httpOptions httpOptions
+	newStore    func(metrics.Fetcher) *metrics.Store
+
+	// sampleCtx is the context of the samples in flight, cancelled by
+	// cancelSample (see sampleContext).
+	sampleCtx    context.Context
+	cancelSample context.CancelFunc
+
+	// highlightNew tags recently appeared series (see isNew). newSeries
+	// counts them among the rendered series.
+	highlightNew bool
+	newSeries    int
+
+	// unchanged shows how long series have been unchanged (and sorts them
+	// by it).
+	unchanged unchangedMode
+
+	// browsing is set by ENTER, after which n and N jump between the rows
+	// matching the search instead of extending it. match is the number of
+	// the row jumped to (starting at 1, or 0 if none) among matches rows.
+	browsing       bool
+	match, matches int
+
+	keys keymap
+
+	// searchGen counts the edits of the search. searchPending is set while
+	// the view lags behind the search, as rendering is throttled to once per
+	// searchDebounce (since renderedAt) while typing.
+	searchGen     int
+	searchPending bool
+	renderedAt    time.Time
+
+	// terminal receives the escape sequences setting the clipboard and
+	// copyLocal (if set) sets the local clipboard (see copyText).
+	terminal  io.Writer
+	copyLocal func(string) error
+
+	// showHelp shows the help (see helpView) and showEvents the event log
+	// (see eventsView) instead of the series.
+	showHelp, showEvents bool
+
+	// showTargets shows the targets overview (see targetsView) with the
+	// targetCursor-th target selected.
+	showTargets  bool
+	targetCursor int
+
+	// events logs what happened during the run (e.g. failed scrapes) and
+	// watches are the watched series (see toggleWatch).
+	events  eventLog
+	watches []*watch
+
+	// rows describes the lines of the viewport, of which only those within
+	// rendered are rendered (see renderWindow). cache holds their lines.
+	rows     []row
+	rendered span
+	cache    lineCache
+
+	// matched counts the series of the current target matching the search
+	// (of total) and families the metric families among them.
+	matched, total, families int
+
+	// highlightChanges highlights the rows that changed in the latest sample
+	// until highlightUntil.
+	highlightChanges bool
+	highlightUntil   time.Time
+
+	// exprs are the expressions shown as derived series (see exprRows).
+	exprs []*expression
+
+	// maxBackoff caps the delay of retries of failing targets (see
+	// target.recordFailure).
+	maxBackoff time.Duration
+
+	// scrapeSlots bounds the number of targets sampled at once (see
+	// -max-concurrent-scrapes). Nil means no bound.
+	scrapeSlots chan struct{}
+
+	// wait waits for the delay of a staggered sample (see sampleTargetCmd).
+	// Nil means waitContext.
+	wait func(ctx context.Context, d time.Duration) error
+
+	styles styles
+
+	// flash is a message shown in the footer until flashUntil.
+	flash      string
+	flashUntil time.Time
+}
+
+func main() {
+	help := flag.Bool("help", false, "show help")
+	version := flag.Bool("version", false, "show version")
+	configPath := flag.String("config", "", "config file setting flags by name (default "+defaultConfigPath()+")")
+	printConfigFlag := flag.Bool("print-config", false, "print the effective configuration and exit")
+	listTargets := flag.Bool("list-targets", false, "print the names of the target profiles of the config file and exit")
+	endpoints := &endpointsFlag{endpoints: []string{"http://localhost:8080/healthz/metrics"}}
+	flag.Var(endpoints, "endpoint", "metrics endpoint (an HTTP(S) URL, a file URL, or - for stdin); may be given multiple times or comma-separated")
+	targetsFilePath := flag.String("targets-file", "", "Prometheus file_sd JSON file listing the targets to sample instead of the endpoints (re-read every "+targetsRefresh.String()+")")
+	targetsPath := flag.String("targets-path", "/metrics", "path of the endpoints of the targets of -targets-file")
+	execCommand := flag.String("exec", "", "command to run on each refresh instead of fetching the endpoint (its stdout is parsed)")
+	execShell := flag.Bool("exec-shell", false, "run the -exec command through the shell")
+	execTimeout := flag.Duration("exec-timeout", 10*time.Second, "timeout of the -exec command")
+	kube := flag.String("kube", "", "pod to scrape through the Kubernetes API server of the current kubeconfig context instead of the endpoint, as pod/<namespace>/<name>[:<port>][/<path>] (e.g. pod/default/api-7d4f:8080/metrics)")
+	docker := flag.String("docker", "", "container to scrape at its published port (or bridge IP) instead of the endpoint, as <container>:<port>[/<path>] (e.g. api:9090/metrics), resolved through the Docker daemon")
+	listen := flag.String("listen", "", "address to receive metrics pushed in the text format on instead of fetching the endpoint (e.g. :9201), labeled with the address of their sender")
+	interval := flag.Duration("interval", 5*time.Second, "refresh interval (e.g., 500ms, 10s, 1m, or 0 to refresh only on CTRL+r)")
+	manual := flag.Bool("manual", false, "refresh only on CTRL+r (same as -interval 0)")
+	search := flag.String("search", "", "metrics search filter")
+	disableHistoryView := flag.Bool("disable-history", false, "disable history")
+	timeFormat := flag.String("time-format", time.Kitchen, "Go layout of the timestamps of the expanded history (e.g. 15:04:05)")
+	expandHistory := flag.Bool("expand-history", false, "show all buffered values of each series inline (newest first)")
+	hoistLabels := flag.Bool("common-labels", false, "show the labels common to all series shown once in the header rather than on every series")
+	disableDerivedView := flag.Bool("disable-derived", false, "disable derived metrics")
+	rawValues := flag.Bool("raw-values", false, "disable human-readable formatting of values (e.g. bytes and seconds)")
+	precision := flag.Int("precision", 2, "number of decimals to display (values below 1 keep at least three significant digits)")
+	numberFormatName := flag.String("number-format", "plain", "format of large numbers (plain, si, or grouped)")
+	rateWindow := flag.String("rate-window", "instant", "window of the average rate derived in addition to the instant rate (instant, buffer, or a duration)")
+	rateSmoothing := flag.Float64("rate-smoothing", 0, "smoothing factor (0-1) of the exponentially weighted moving average applied to rates (0 disables smoothing)")
+	history := flag.Int("history", 3, "number of samples to keep")
+	hold := flag.Int("indicator-hold", 1, "number of samples changes stay bold with arrows (and their cumulative delta) for")
+	showUnchanged := flag.Bool("unchanged-for", false, "show how long each series has been unchanged")
+	pushgateway := flag.Bool("pushgateway", false, "group the series of a Pushgateway by job and instance, even without "+pushTimeMetric+" (by which Pushgateways are detected otherwise)")
+	pushMaxAge := flag.Duration("push-max-age", defaultPushMaxAge, "highlight the Pushgateway groups pushed longer ago than this (0 to never highlight them)")
+	top := flag.Int("top", 0, "show only the given number of series that moved most with the latest sample (counters by rate, gauges by change, also with -plain)")
+	maxLines := flag.Int("max-lines", 0, "maximum number of series shown in the order of the sort, followed by the number of the others (0 means no limit)")
+	sortStability := flag.Int("sort-stability", 3, "number of positions series must move by to be re-ranked when not sorted by name (0 re-sorts exactly)")
+	sortName := flag.String("sort", "name", "order of the series ("+strings.Join(sortNames, ", ")+" to show the longest unchanged first)")
+	highlightNew := flag.Bool("highlight-new", true, "tag series that appeared within the last "+strconv.Itoa(newSamples)+" samples as new")
+	staleGrace := flag.Duration("stale-grace", time.Minute, "how long series missing from the latest sample are still shown (grayed out)")
+	hideRuntime := flag.Bool("hide-runtime", true, "hide the Go runtime, process, and promhttp metric families (unless searched for)")
+	hideZero := flag.Bool("hide-zero", false, "hide series whose latest value is zero")
+	hideUnchanged := flag.Bool("hide-unchanged", false, "hide series whose value did not change within the history")
+	arrowTypes := flag.String("arrows", "", "comma-separated types of metrics whose changes are bold with arrows ("+strings.Join(metricTypeNames, ", ")+", or none; default all), along with the series derived from them")
+	typeNames := flag.String("types", "", "comma-separated types of metrics to show ("+strings.Join(metricTypeNames, ", ")+"; default all), along with the series derived from them")
+	aggregate := flag.String("aggregate", "", `aggregate series across labels, e.g. "without=code,pod" (sum, like PromQL's sum without) or "without=pod gauges=max" (gauges by sum, avg, min, or max)`)
+	rateKinds := flag.String("rate-kinds", kindNames(metrics.DefaultRateKinds), "comma-separated kinds of metrics to derive per-second rates for")
+	compareTargets := flag.Bool("compare", false, "compare the first two endpoints side by side")
+	pivotLabel := flag.String("pivot", "", "pivot the series by the given label into columns (e.g. code)")
+	tolerance := flag.Float64("compare-tolerance", 0.1, "relative difference above which compared values are highlighted")
+	output := flag.String("output", "tui", "output mode (tui, plain to print the matching series every interval, csv to write their history to stdout and exit, or json to sample once and write the scrape statistics of the targets)")
+	plain := flag.Bool("plain", false, "shorthand for -output plain")
+	color := flag.Bool("color", isTerminal(os.Stdout), "color change arrows (with -output plain, default is on if stdout is a terminal)")
+	noColor := flag.Bool("no-color", os.Getenv("NO_COLOR") != "", "disable all colors and styles (default is on if NO_COLOR is set)")
+	ascii := flag.Bool("ascii", false, "use only ASCII characters (e.g. ^ and v instead of arrows)")
+	themeName := flag.String("theme", "auto", "color theme ("+strings.Join(themeNames(), ", ")+"), auto adapts to the terminal background")
+	themeColors := make(map[string]*string, len(colorNames))
+	for _, name := range colorNames {
+		themeColors[name] = flag.String("theme-"+name, "", "override the "+name+" color of the theme (e.g. #FF0000 or 196)")
+	}
+	once := flag.Bool("once", false, "sample only once (with -output csv or plain, or -assert)")
+	labelColumns := flag.Bool("csv-label-columns", false, "write each label to a column of its own (with -output csv)")
+	count := flag.Int("count", 0, "exit after the given number of successful samples (0 means no limit)")
+	duration := flag.Duration("duration", 0, "exit after the given duration (e.g. 2m, 0 means no limit)")
+	maxBackoff := flag.Duration("max-backoff", time.Minute, "maximum delay of retries after repeated scrape failures (0 disables backoff)")
+	maxConcurrentScrapes := flag.Int("max-concurrent-scrapes", 10, "maximum number of targets sampled at once (0 for no limit)")
+	bell := flag.Bool("bell", false, "ring the terminal bell when an alert rule of the config file starts firing")
+	exportDir := flag.String("export-dir", ".", "directory exports (CTRL+s) are written to")
+	var exprs exprsFlag
+	flag.Var(&exprs, "expr", "show a series computed from two series or numbers (e.g. 'error_ratio = http_requests_errors_total / http_requests_total', operators +, -, *, /, rate(...) for per-second rates, may be repeated)")
+	var assertions assertionsFlag
+	flag.Var(&assertions, "assert", "exit with 2 if the series matching a selector cross a threshold (e.g. 'queue_depth > 100' or 'increase(errors_total) > 0', may be repeated)")
+	var keep keepFlag
+	flag.Var(&keep, "keep", "keep only the metric families matching a substring or regular expression, dropping the others right after fetching (may be repeated)")
+	var dropLabels dropLabelsFlag
+	flag.Var(&dropLabels, "drop-label", "drop the label with the given name from all series, merging series that become identical (may be repeated or comma-separated)")
+	var timestampSuffixes timestampSuffixesFlag
+	flag.Var(&timestampSuffixes, "timestamp-suffix", "suffix of the names of gauges holding unix timestamps shown as time and age, in addition to "+strings.Join(defaultTimestampSuffixes, ", ")+" (may be repeated)")
+	var stripPrefixes stripPrefixesFlag
+	flag.Var(&stripPrefixes, "strip-prefix", "strip the given prefix from the names shown, the longest if several match (may be repeated)")
+	var renameLabels renameLabelsFlag
+	flag.Var(&renameLabels, "rename-label", "rename a label given as old=new in all series (may be repeated)")
+	maxBodySize := flag.String("max-body-size", "64MiB", "maximum size of fetched metrics (e.g. 512KiB, 64MiB, or 0 for no limit)")
+	userAgent := flag.String("user-agent", metrics.DefaultUserAgent+"/"+buildVersion(), "User-Agent header sent to HTTP(S) endpoints")
+	noProbe := flag.Bool("no-probe", false, "do not probe well-known metrics paths (e.g. /metrics) if the endpoint has no path or is not found")
+	var probePaths probePathsFlag
+	flag.Var(&probePaths, "probe-path", "path to probe before the well-known ones (may be repeated)")
+	sshJump := flag.String("ssh-jump", "", "jump host ([user@]host[:port]) to reach HTTP(S) endpoints through, authenticating with the SSH agent and default keys (endpoints may also be given as ssh://<jump host>/<endpoint>)")
+	sshInsecure := flag.Bool("ssh-insecure", false, "do not verify the host keys of jump hosts by ~/.ssh/known_hosts")
+	promql := flag.String("promql", "", "PromQL query to evaluate by the Prometheus servers given as endpoints (e.g. 'up{job=\"api\"}'), shown instead of scraping metrics")
+	var matches matchesFlag
+	flag.Var(&matches, "match", "series selector passed as match[] to federation endpoints (e.g. '{job=\"api\"}', may be repeated)")
+	federate := flag.Bool("federate", false, "treat endpoints as federation endpoints of Prometheus servers (implied by the path /federate)")
+	formatName := flag.String("format", "auto", "format of the fetched metrics (auto to detect it, or expvar for the JSON of Go's /debug/vars)")
+	strict := flag.Bool("strict", false, "fail scrapes holding malformed metric families (rather than skipping them with a warning)")
+	strictDuplicates := flag.Bool("strict-duplicates", false, "fail scrapes holding the same series more than once (rather than keeping the last one with a warning)")
+	fresh := flag.Bool("fresh", false, "do not restore the search and view settings of the previous run against the same target")
+
+	flag.Parse()
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+	if *version {
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			fmt.Println("Error reading Build Info")
+			os.Exit(1)
+		}
+		var revision string
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				revision = s.Value
+				break
+			}
+		}
+		fmt.Printf("version: %s, revision: %s\n", bi.Main.Version, revision)
+		os.Exit(0)
+	}
+
+	// Flags not given on the command line are taken from the environment
+	// and then from the config file.
+	path, required := *configPath, *configPath != ""
+	if !required {
+		path, required = os.LookupEnv(envPrefix + "CONFIG")
+	}
+	if !required {
+		path = defaultConfigPath()
+	}
+	config, err := loadConfig(path, required)
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+	ps, err := profiles(config)
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+	rules, err := parseRules(config)
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+	keys := newKeymap()
+	bindings, err := keyBindings(config)
+	if err == nil {
+		err = keys.remap(bindings)
+	}
+	if err == nil {
+		err = keys.conflicts()
+	}
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+	if *listTargets {
+		for _, name := range profileNames(ps) {
+			fmt.Println(name)
+		}
+		os.Exit(0)
+	}
+
+	// The optional argument names a target profile (whose settings take
+	// precedence over the environment and the rest of the config) or an
+	// endpoint.
+	if flag.NArg() > 1 {
+		fmt.Println("Error: expected at most one target, but got", strings.Join(flag.Args(), " "))
+		os.Exit(1)
+	}
+	if flag.NArg() == 1 {
+		profile, isProfile, err := resolveTarget(flag.Arg(0), ps)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if !isProfile {
+			_ = flag.Set("endpoint", flag.Arg(0))
+		}
+		noEnv := func(string) (string, bool) { return "", false }
+		if err := applyConfig(flag.CommandLine, profile, noEnv, os.Stderr); err != nil {
+			fmt.Printf("Error applying profile %q: %v\n", flag.Arg(0), err)
+			os.Exit(1)
+		}
+	}
+	if err := applyConfig(flag.CommandLine, config, os.LookupEnv, os.Stderr); err != nil {
+		fmt.Println("Error applying config:", err)
+		os.Exit(1)
+	}
+	if *printConfigFlag {
+		if err := printConfig(flag.CommandLine, os.Stdout); err != nil {
+			fmt.Println("Error printing config:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// The TUI restores the settings of the previous run against the same
+	// target (unless given on the command line, in the environment, or by
+	// the config).
+	stateTarget := strings.Join(endpoints.endpoints, ",")
+	switch {
+	case *execCommand != "":
+		stateTarget = "exec " + *execCommand
+	case *targetsFilePath != "":
+		stateTarget = "targets-file " + *targetsFilePath
+	case *kube != "":
+		stateTarget = "kube " + *kube
+	case *docker != "":
+		stateTarget = "docker " + *docker
+	case *listen != "":
+		stateTarget = "listen " + *listen
+	}
+	var stateFile string
+	if *output == "tui" && !*plain && len(assertions) == 0 {
+		stateFile = statePath(stateDir(), stateTarget)
+		if !*fresh {
+			restoreState(flag.CommandLine, loadState(stateFile, stateTarget))
+		}
+	}
+
+	if *manual {
+		*interval = 0
+	}
+	if *interval < 0 {
+		fmt.Println("Error: interval must not be negative")
+		os.Exit(1)
+	}
+
+	numbers, err := parseNumberFormat(*numberFormatName)
+	if err != nil {
+		fmt.Println("Error parsing number format:", err)
+		os.Exit(1)
+	}
+
+	if *precision < 0 {
+		fmt.Println("Error: precision must not be negative")
+		os.Exit(1)
+	}
+
+	kinds, err := parseKinds(*rateKinds)
+	if err != nil {
+		fmt.Println("Error parsing rate kinds:", err)
+		os.Exit(1)
+	}
+
+	types, err := parseTypes(*typeNames)
+	if err != nil {
+		fmt.Println("Error parsing types:", err)
+		os.Exit(1)
+	}
+	arrows, err := parseTypes(*arrowTypes)
+	if err != nil {
+		fmt.Println("Error parsing arrows:", err)
+		os.Exit(1)
+	}
+
+	mode := unchangedHidden
+	if *showUnchanged {
+		mode = unchangedShown
+	}
+	mode, err = parseSort(*sortName, mode)
+	if err != nil {
+		fmt.Println("Error parsing sort order:", err)
+		os.Exit(1)
+	}
+
+	filter := seriesFilter{hideRuntime: *hideRuntime, types: types, hideZero: *hideZero, hideUnchanged: *hideUnchanged}
+
+	aggregation, err := parseAggregation(*aggregate)
+	if err != nil {
+		fmt.Println("Error parsing aggregation:", err)
+		os.Exit(1)
+	}
+
+	window, err := parseRateWindow(*rateWindow)
+	if err != nil {
+		fmt.Println("Error parsing rate window:", err)
+		os.Exit(1)
+	}
+
+	if *tolerance < 0 {
+		fmt.Println("Error: compare tolerance must not be negative")
+		os.Exit(1)
+	}
+
+	if *plain {
+		*output = "plain"
+	}
+	switch *output {
+	case "tui":
+		if *once && len(assertions) == 0 {
+			fmt.Println("Error: -once requires -output csv or plain")
+			os.Exit(1)
+		}
+	case "plain":
+	case "csv":
+	case "json":
+		if len(assertions) > 0 {
+			fmt.Println("Error: -output json does not support -assert")
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("Error: unknown output %q\n", *output)
+		os.Exit(1)
+	}
+	// Only the TUI refreshes manually.
+	if *interval == 0 && !*once && ((*output != "tui" && *output != "json") || len(assertions) > 0) {
+		fmt.Println("Error: -output csv and plain and -assert require a positive interval (or -once)")
+		os.Exit(1)
+	}
+
+	if *staleGrace < 0 {
+		fmt.Println("Error: stale grace must not be negative")
+		os.Exit(1)
+	}
+
+	th, ok := themes[*themeName]
+	if !ok {
+		fmt.Printf("Error: unknown theme %q\n", *themeName)
+		os.Exit(1)
+	}
+	for _, name := range colorNames {
+		if c := *themeColors[name]; c != "" {
+			if err := th.override(name, c); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+	st := newStyles(&th, *ascii)
+	if *noColor {
+		st = newStyles(nil, *ascii)
+	}
+
+	if *count < 0 || *duration < 0 {
+		fmt.Println("Error: count and duration must not be negative")
+		os.Exit(1)
+	}
+
+	bodyLimit, err := parseByteSize(*maxBodySize)
+	if err != nil {
+		fmt.Println("Error parsing max body size:", err)
+		os.Exit(1)
+	}
+
+	if *rateSmoothing < 0 || *rateSmoothing > 1 {
+		fmt.Println("Error: rate smoothing must be between 0 and 1")
+		os.Exit(1)
+	}
+
+	// By default, we only need 3 data-points to show the delta between the last
+	// two values or last two rates.
+	if *history < 1 {
+		fmt.Println("Error: history must be at least 1")
+		os.Exit(1)
+	}
+	if *formatName != "auto" && *formatName != "expvar" {
+		fmt.Printf("Error: unknown format %q (expected auto or expvar)\n", *formatName)
+		os.Exit(1)
+	}
+	if *top < 0 {
+		fmt.Println("Error: top must not be negative")
+		os.Exit(1)
+	}
+	if *hold < 1 {
+		fmt.Println("Error: indicator hold must be at least 1")
+		os.Exit(1)
+	}
+	var targets []*target
+	if *promql != "" && (*execCommand != "" || *formatName == "expvar") {
+		fmt.Println("Error: -promql cannot be combined with -exec or -format expvar")
+		os.Exit(1)
+	}
+	if *federate && len(matches) == 0 {
+		fmt.Println("Error: -federate requires at least one -match")
+		os.Exit(1)
+	}
+	httpOpts := httpOptions{userAgent: *userAgent, interval: *interval, promql: *promql, matches: matches, federate: *federate, sshJump: *sshJump, sshInsecure: *sshInsecure}
+	sd := targetsFile{path: *targetsFilePath, metricsPath: *targetsPath}
+	var skipped int
+	switch {
+	case sd.path != "" && *execCommand != "":
+		fmt.Println("Error: -targets-file and -exec are mutually exclusive")
+		os.Exit(1)
+	case *listen != "" && (*kube != "" || *docker != "" || sd.path != "" || *execCommand != "" || *promql != ""):
+		fmt.Println("Error: -listen cannot be combined with -kube, -docker, -targets-file, -exec, or -promql")
+		os.Exit(1)
+	case *listen != "":
+		src, err := newListenSource(*listen, bodyLimit)
+		if err != nil {
+			fmt.Println("Error receiving pushes:", err)
+			os.Exit(1)
+		}
+		targets = append(targets, &target{source: src, endpoint: "listen " + *listen})
+	case *kube != "" && *docker != "":
+		fmt.Println("Error: -kube and -docker are mutually exclusive")
+		os.Exit(1)
+	case (*kube != "" || *docker != "") && (sd.path != "" || *execCommand != "" || *promql != ""):
+		fmt.Println("Error: -kube and -docker cannot be combined with -targets-file, -exec, or -promql")
+		os.Exit(1)
+	case *kube != "":
+		src, err := newKubeSource(*kube, httpOpts, *execTimeout)
+		if err != nil {
+			fmt.Println("Error setting up pod:", err)
+			os.Exit(1)
+		}
+		targets = append(targets, &target{source: src, endpoint: *kube})
+	case *docker != "":
+		src, err := newDockerSource(*docker, httpOpts)
+		if err != nil {
+			fmt.Println("Error setting up container:", err)
+			os.Exit(1)
+		}
+		targets = append(targets, &target{source: src, endpoint: "docker: " + *docker})
+	case sd.path != "":
+		var sds []sdTarget
+		sds, skipped, err = sd.read()
+		if err != nil {
+			fmt.Println("Error reading targets:", err)
+			os.Exit(1)
+		}
+		if len(sds) == 0 {
+			fmt.Printf("Error: no targets in %s (%d malformed targets skipped)\n", sd.path, skipped)
+			os.Exit(1)
+		}
+		for _, t := range sds {
+			src, err := newSource(t.endpoint, httpOpts)
+			if err != nil {
+				fmt.Println("Error parsing endpoint:", err)
+				os.Exit(1)
+			}
+			targets = append(targets, &target{source: src, endpoint: t.endpoint, title: t.title})
+		}
+	case *execCommand != "":
+		src, err := newExecSource(*execCommand, *execShell, *execTimeout)
+		if err != nil {
+			fmt.Println("Error parsing command:", err)
+			os.Exit(1)
+		}
+		targets = append(targets, &target{source: src, endpoint: "exec: " + *execCommand})
+	default:
+		for _, endpoint := range endpoints.endpoints {
+			src, err := newSource(endpoint, httpOpts)
+			if err != nil {
+				fmt.Println("Error parsing endpoint:", err)
+				os.Exit(1)
+			}
+			targets = append(targets, &target{source: src, endpoint: endpoint})
+		}
+	}
+	newStore := func(f metrics.Fetcher) *metrics.Store {
+		// Held changes are compared with the value before them.
+		s := metrics.NewStore(max(*history, *hold+1), f)
+		s.MaxBodySize = bodyLimit
+		s.StaleGrace = *staleGrace
+		s.StrictDuplicates = *strictDuplicates
+		s.StrictParsing = *strict
+		s.Expvar = *formatName == "expvar"
+		s.Keep = keep.keep()
+		s.Relabeling = metrics.Relabeling{Drop: dropLabels, Rename: renameLabels}
+		return s
+	}
+	var stdin bool
+	for _, t := range targets {
+		t.store = newStore(t.fetcher)
+		stdin = stdin || t.once
+	}
+
+	if *compareTargets && len(targets) < 2 {
+		fmt.Println("Error: comparing requires two endpoints")
+		os.Exit(1)
+	}
+	if len(targets) > 1 && (*output == "csv" || len(assertions) > 0) {
+		fmt.Println("Error: -output csv and -assert support a single endpoint")
+		os.Exit(1)
+	}
+
+	deriver := metrics.Deriver{
+		RateKinds:     kinds,
+		RateWindow:    window,
+		RateSmoothing: *rateSmoothing,
+	}
+
+	// Only fail if no target at all could be sampled, as the others may
+	// recover.
+	sampleAll(targets)
+	// Federation endpoints are not probed, as their path is given (or implied).
+	if !*noProbe && !*federate {
+		for _, t := range targets {
+			if needsProbe(t) {
+				probe(context.Background(), t, probePaths.paths(), firstSampleTimeout(*interval), httpOpts, newStore)
+			}
+		}
+	}
+	if *output == "json" {
+		// The initial sample is not recorded as a failure by sampleAll.
+		up := true
+		for _, t := range targets {
+			if t.err != nil {
+				t.failures++
+				up = false
+			}
+		}
+		if err := writeTargetStats(targets, os.Stdout); err != nil {
+			fmt.Println("Error writing JSON:", err)
+			os.Exit(1)
+		}
+		if !up {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var stats runStats
+	for _, t := range targets {
+		stats.record(t.err == nil, t.err)
+	}
+	if stats.samples == 0 {
+		fmt.Println("Error fetching initial metrics:", targets[0].err)
+		os.Exit(1)
+	}
+
+	if len(assertions) > 0 {
+		samples := *count
+		if *once {
+			samples = 1
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if *duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *duration)
+			defer cancel()
+		}
+		stats, ok := runAssertions(ctx, targets[0], assertions, stats, samples, *interval, os.Stdout)
+		if *count > 0 || *duration > 0 {
+			fmt.Fprintln(os.Stderr, stats)
+		}
+		if !ok {
+			os.Exit(exitAssertion)
+		}
+		return
+	}
+
+	if *output == "csv" {
+		// By default, fill the history buffer (unless limited by duration).
+		samples := *history
+		switch {
+		case *once:
+			samples = 1
+		case *count > 0:
+			samples = *count
+		case *duration > 0:
+			samples = 0
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if *duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *duration)
+			defer cancel()
+		}
+		opts := csvOptions{labelColumns: *labelColumns, derived: !*disableDerivedView, deriver: deriver}
+		stats, err := runCSV(ctx, targets[0], stats, samples, *interval, *search, opts, os.Stdout)
+		if err != nil {
+			fmt.Println("Error writing CSV:", err)
+			os.Exit(1)
+		}
+		if *count > 0 || *duration > 0 {
+			fmt.Fprintln(os.Stderr, stats)
+		}
+		return
+	}
+
+	suffixes := timestampSuffixes.suffixes()
+	formatter := valueFormatter{
+		humanize:   !*rawValues,
+		numbers:    numbers,
+		decimals:   *precision,
+		timeFormat: *timeFormat,
+		timestamps: &suffixes,
+	}
+
+	if *output == "plain" {
+		samples := *count
+		if *once {
+			samples = 1
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if *duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *duration)
+			defer cancel()
+		}
+		opts := plainOptions{
+			color:       *color && !*noColor,
+			glyphs:      newGlyphs(*ascii),
+			arrows:      arrows,
+			hold:        *hold,
+			top:         *top,
+			search:      *search,
+			showHistory: !*disableHistoryView,
+			showDerived: !*disableDerivedView,
+			filter:      filter,
+			formatter:   formatter,
+			deriver:     deriver,
+		}
+		stats = runPlain(ctx, targets, stats, samples, *interval, opts, os.Stdout)
+		if *count > 0 || *duration > 0 {
+			fmt.Fprintln(os.Stderr, stats)
+		}
+		if stats.samples == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	m := &model{
+		search:        *search,
+		interval:      *interval,
+		targets:       targets,
+		showHistory:   !*disableHistoryView,
+		showDerived:   !*disableDerivedView,
+		expandHistory: *expandHistory,
+		hoistLabels:   *hoistLabels,
+		filter:        filter,
+		rules:         rules,
+		bell:          *bell,
+		compare:       *compareTargets,
+		pivot:         *pivotLabel,
+		arrows:        arrows,
+		hold:          *hold,
+		sortStability: *sortStability,
+		maxLines:      *maxLines,
+		showTop:       *top > 0,
+		pushgateway:   *pushgateway,
+		pushMaxAge:    *pushMaxAge,
+		top:           cmp.Or(*top, defaultTop),
+		stripPrefixes: stripPrefixes,
+		tolerance:     *tolerance,
+		exportDir:     *exportDir,
+		formatter:     formatter,
+		deriver:       deriver,
+		aggregation:   aggregation,
+		count:         *count,
+		duration:      *duration,
+		stats:         stats,
+		targetsFile:   sd,
+		skipped:       skipped,
+		httpOptions:   httpOpts,
+		newStore:      newStore,
+		maxBackoff:    *maxBackoff,
+		exprs:         exprs,
+		scrapeSlots:   scrapeSlots(*maxConcurrentScrapes),
+		highlightNew:  *highlightNew,
+		unchanged:     mode,
+		styles:        st,
+		keys:          keys,
+		terminal:      os.Stdout,
+		copyLocal:     clipboard.WriteAll,
+
+		// Highlighting relies on colors.
+		highlightChanges: !*noColor,
+	}
+
+	// Without an interval, samples are taken on refresh only (see
+	// manual).
+	m.stopped = m.allStatic() || m.manual()
+
+	opts := []tea.ProgramOption{tea.WithAltScreen()}
+	if stdin {
+		// Stdin holds the metrics, so read keys from the terminal instead.
+		opts = append(opts, tea.WithInputTTY())
+	}
+	if _, err := runProgram(m, opts...); err != nil {
+		fmt.Println("Error running program:", err)
+		os.Exit(1)
+	}
+	if stateFile != "" {
+		if err := saveState(stateFile, stateTarget, m.state()); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+	}
+	if *count > 0 || *duration > 0 {
+		fmt.Println(m.stats)
+	}
+}
+
+// buildVersion returns the version of the main module (e.g. "v1.2.3", or
+// "devel" if built from a checkout).
+func buildVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok || bi.Main.Version == "" {
+		return "unknown"
+	}
+	return strings.Trim(bi.Main.Version, "()")
+}
+
+func (m *model) Init() tea.Cmd {
+	cmds := []tea.Cmd{clockCmd()}
+	if !m.stopped {
+		cmds = append(cmds, m.sleepCmd())
+	}
+	if m.targetsFile.path != "" {
+		cmds = append(cmds, m.readTargetsCmd())
+	}
+	for _, t := range m.targets {
+		if t.receiver != nil {
+			cmds = append(cmds, waitPushCmd(t))
+		}
+	}
+	if m.duration > 0 {
+		cmds = append(cmds, tea.Tick(m.duration, func(time.Time) tea.Msg {
+			return deadlineMsg{}
+		}))
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m *model) Update(teaMsg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	switch msg := teaMsg.(type) {
+	case sampledMsg:
+		// Samples cancelled on pause are neither errors nor samples.
+		if errors.Is(msg.error, context.Canceled) {
+			break
+		}
+		// Errors are shown in the footer, keeping the last good data on
+		// screen.
+		m.stats.record(msg.fetched, msg.error)
+		if m.count > 0 && m.stats.samples >= m.count {
+			return m, m.quit()
+		}
+		// Targets removed from the targets file in the meantime are
+		// ignored.
+		t := msg.target
+		if !slices.Contains(m.targets, t) {
+			break
+		}
+		switch {
+		case msg.error != nil:
+			// Only the first of consecutive failures is logged.
+			if t.failures == 0 {
+				m.logEvent(t, "scrape failed: "+msg.error.Error(), true)
+			}
+			t.err = msg.error
+			if delay := t.recordFailure(m.interval, m.maxBackoff); delay > 0 {
+				cmds = append(cmds, retryCmd(t, delay))
+			}
+		case msg.fetched:
+			t.err = nil
+			t.lastSample = time.Now()
+			t.took = msg.took
+			if t.failures > 0 {
+				m.logEvent(t, fmt.Sprintf("scrape recovered after %d failures", t.failures), false)
+			}
+			t.recordSuccess()
+			m.checkSample(t)
+			if t == m.target() || (m.compare && t == m.targets[m.other()]) {
+				m.highlightUntil = time.Now().Add(highlightDuration)
+				m.metricsView()
+			}
+		}
+	case targetsMsg:
+		cmds = append(cmds, m.readTargetsCmd())
+		if msg.error != nil {
+			m.flashMessage("reading targets failed: " + msg.error.Error())
+			break
+		}
+		m.skipped = msg.skipped
+		cmds = append(cmds, m.updateTargets(msg.targets))
+	case tickMsg:
+		// Ignore ticks of cancelled sleeps. The next sleep starts right away,
+		// so that slow targets do not delay the others.
+		if msg.gen != m.sleepGen || m.stopped {
+			break
+		}
+		m.sleepDone = nil
+		cmds = append(cmds, m.sampleCmd(false), m.sleepCmd())
+	case pushMsg:
+		cmds = append(cmds, m.sampleTargetCmd(msg.target, 0), waitPushCmd(msg.target))
+	case retryMsg:
+		// Ignore retries superseded by other samples and of removed targets.
+		if m.stopped || msg.gen != msg.target.retryGen || !slices.Contains(m.targets, msg.target) {
+			break
+		}
+		cmds = append(cmds, m.sampleTargetCmd(msg.target, 0))
+	case searchMsg:
+		// The latest edit is rendered in any case, earlier ones only once
+		// the previous render is searchDebounce old.
+		if m.searchPending && (msg.gen == m.searchGen || time.Since(m.renderedAt) >= searchDebounce) {
+			m.metricsView()
+		}
+	case endpointMsg:
+		m.updateEndpoint(msg)
+	case deadlineMsg:
+		return m, m.quit()
+	case signalMsg:
+		// Like refresh, without resuming a pause.
+		if !msg.isRefresh() {
+			return m, m.quit()
+		}
+		cmds = append(cmds, m.sampleCmd(true))
+	case clockMsg:
+		cmds = append(cmds, clockCmd())
+		if !m.highlightUntil.IsZero() && time.Now().After(m.highlightUntil) {
+			m.highlightUntil = time.Time{}
+			m.metricsView()
+		}
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		headerHeight := lipgloss.Height(m.headerView())
+		footerHeight := lipgloss.Height(m.footerView())
+		verticalMarginHeight := headerHeight + footerHeight
+		if !m.ready {
+			m.viewport = viewport.New(msg.Width, msg.Height-verticalMarginHeight)
+			m.viewport.KeyMap = m.keys.viewportKeyMap()
+			m.viewport.YPosition = headerHeight
+			m.metricsView()
+			m.ready = true
+		} else {
+			m.viewport.Width = msg.Width
+			m.viewport.Height = msg.Height - verticalMarginHeight
+		}
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.quit):
+			return m, m.quit()
+		case m.prompting != promptNone:
+			// The prompt takes all other keys (e.g. "?" of a URL).
+			return m, m.updatePrompt(msg)
+		case key.Matches(msg, m.keys.help), m.showHelp && key.Matches(msg, m.keys.cancel):
+			m.showHelp = !m.showHelp
+		case m.showHelp:
+			// The help takes all other keys.
+			return m, nil
+		case key.Matches(msg, m.keys.events), m.showEvents && key.Matches(msg, m.keys.cancel):
+			m.showEvents = !m.showEvents
+		case m.showTargets:
+			// The overview takes all other keys.
+			m.updateTargetsView(msg)
+			return m, nil
+		case key.Matches(msg, m.keys.aggregate):
+			m.prompting, m.prompt = promptAggregation, strings.Join(m.aggregation.Without, ",")
+		case key.Matches(msg, m.keys.endpoint):
+			m.prompting, m.prompt, m.promptError = promptEndpoint, m.target().endpoint, ""
+		case key.Matches(msg, m.keys.pivot):
+			m.prompting, m.prompt = promptPivot, m.pivot
+		case key.Matches(msg, m.keys.refresh):
+			// While paused, refresh once without resuming the schedule.
+			cmds = append(cmds, m.sampleCmd(true))
+			if !m.stopped {
+				cmds = append(cmds, m.sleepCmd())
+			}
+		case key.Matches(msg, m.keys.pause):
+			if m.allStatic() || m.manual() {
+				break
+			}
+			if m.stopped {
+				cmds = append(cmds, m.sampleCmd(false), m.sleepCmd())
+			} else {
+				m.cancelSleep()
+				m.cancelSamples()
+			}
+			m.stopped = !m.stopped
+		case key.Matches(msg, m.keys.nextTarget, m.keys.previousTarget):
+			step := 1
+			if key.Matches(msg, m.keys.previousTarget) {
+				step = len(m.targets) - 1
+			}
+			m.current = (m.current + step) % len(m.targets)
+			m.metricsView()
+		case key.Matches(msg, m.keys.export):
+			// A second press while the first export is flashed exports the
+			// history as CSV.
+			var path string
+			var err error
+			if time.Since(m.exportedAt) < flashDuration {
+				path, err = m.exportHistory()
+				m.exportedAt = time.Time{}
+			} else {
+				path, err = m.exportView()
+				m.exportedAt = time.Now()
+			}
+			switch {
+			case err != nil:
+				m.flashMessage("export failed: " + err.Error())
+			case !m.exportedAt.IsZero():
+				m.flashMessage("saved to " + path + " (" + m.keys.export.Help().Key + " again: history as CSV)")
+			default:
+				m.flashMessage("saved to " + path)
+			}
+		case key.Matches(msg, m.keys.baseline):
+			// Pressing again moves the baseline to now.
+			now := time.Now()
+			for _, t := range m.targets {
+				t.setBaseline(now)
+			}
+			m.metricsView()
+		case key.Matches(msg, m.keys.compare):
+			m.compare = !m.compare && len(m.targets) > 1
+			m.metricsView()
+		case key.Matches(msg, m.keys.longerInterval, m.keys.shorterInterval):
+			if m.manual() {
+				m.flashMessage("refreshing manually (" + hint(m.keys.refresh) + ")")
+				break
+			}
+			m.interval = stepInterval(m.interval, key.Matches(msg, m.keys.longerInterval))
+			m.httpOptions.interval = m.interval
+			for _, t := range m.targets {
+				t.setInterval(m.interval)
+			}
+			if !m.stopped {
+				cmds = append(cmds, m.sleepCmd())
+			}
+		case key.Matches(msg, m.keys.runtime):
+			m.filter.hideRuntime = !m.filter.hideRuntime
+			m.metricsView()
+		case key.Matches(msg, m.keys.top):
+			m.showTop = !m.showTop
+			m.metricsView()
+		case key.Matches(msg, m.keys.gaugeArrows):
+			m.arrows = m.arrows.toggle(typeGauge)
+			m.metricsView()
+		case key.Matches(msg, m.keys.types):
+			m.filter.types = m.filter.types.next()
+			m.metricsView()
+		case key.Matches(msg, m.keys.unchangedFor):
+			m.unchanged = (m.unchanged + 1) % (unchangedSorted + 1)
+			m.metricsView()
+		case key.Matches(msg, m.keys.expandHistory):
+			m.expandHistory = !m.expandHistory
+			m.metricsView()
+		case key.Matches(msg, m.keys.hoistLabels):
+			m.hoistLabels = !m.hoistLabels
+			m.metricsView()
+		case key.Matches(msg, m.keys.zero):
+			m.filter.hideZero = !m.filter.hideZero
+			m.metricsView()
+		case key.Matches(msg, m.keys.unchanged):
+			m.filter.hideUnchanged = !m.filter.hideUnchanged
+			m.metricsView()
+		case key.Matches(msg, m.keys.rawValues):
+			m.formatter.humanize = !m.formatter.humanize
+			m.metricsView()
+		case key.Matches(msg, m.keys.numberFormat):
+			m.formatter.numbers = (m.formatter.numbers + 1) % numberFormat(len(numberFormatNames))
+			m.metricsView()
+		case key.Matches(msg, m.keys.browse):
+			// Jumps and copies need the rows of the search.
+			if m.searchPending {
+				m.metricsView()
+			}
+			m.browsing = true
+		case m.browsing && key.Matches(msg, m.keys.nextMatch, m.keys.previousMatch):
+			m.jumpToMatch(key.Matches(msg, m.keys.nextMatch))
+		case m.browsing && key.Matches(msg, m.keys.yankName, m.keys.yankLine):
+			m.yank(key.Matches(msg, m.keys.yankLine))
+		case m.browsing && key.Matches(msg, m.keys.watch):
+			m.toggleWatch()
+		case m.browsing && key.Matches(msg, m.keys.targets):
+			m.showTargets, m.targetCursor = true, m.current
+		case m.browsing && key.Matches(msg, m.keys.showAll) && (m.more > 0 || m.showAll):
+			m.showAll = !m.showAll
+			m.metricsView()
+		case key.Matches(msg, m.keys.nextFamily, m.keys.previousFamily):
+			if m.searchPending {
+				m.metricsView()
+			}
+			m.jumpToFamily(key.Matches(msg, m.keys.nextFamily))
+		case key.Matches(msg, m.keys.deleteWord):
+			m.search = deleteLastWord(m.search)
+			cmds = append(cmds, m.searchChanged())
+		case key.Matches(msg, m.keys.deleteChar):
+			if r := []rune(m.search); len(r) > 0 {
+				m.search = string(r[:len(r)-1])
+			}
+			cmds = append(cmds, m.searchChanged())
+		case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+			for _, r := range msg.Runes {
+				if isSearchRune(r) {
+					m.search += string(r)
+				}
+			}
+			cmds = append(cmds, m.searchChanged())
+		}
+	}
+
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(teaMsg)
+	cmds = append(cmds, cmd)
+	m.renderVisible()
+	return m, tea.Batch(cmds...)
+}
+
+func (m *model) View() string {
+	if !m.ready {
+		return "\n  Initializing..."
+	}
+	if m.showHelp {
+		return fmt.Sprintf("%s\n%s\n%s", m.headerView(), m.helpView(m.viewport.Width, m.viewport.Height), m.footerView())
+	}
+	if m.showEvents {
+		return fmt.Sprintf("%s\n%s\n%s", m.headerView(), m.eventsView(m.viewport.Width, m.viewport.Height), m.footerView())
+	}
+	if m.showTargets {
+		return fmt.Sprintf("%s\n%s\n%s", m.headerView(), m.targetsView(m.viewport.Width, m.viewport.Height), m.footerView())
+	}
+	return fmt.Sprintf("%s\n%s\n%s", m.headerView(), m.viewport.View(), m.footerView())
+}
+
+// searchDebounce is the minimum time between renders while the search is
+// typed.
+const searchDebounce = 100 * time.Millisecond
+
+// searchChanged renders the edited search, unless the view was rendered
+// within searchDebounce. Then, it returns the command rendering it later (see
+// searchMsg). The header shows the search right away in any case.
+func (m *model) searchChanged() tea.Cmd {
+	m.browsing, m.match, m.showAll = false, 0, false
+	m.searchGen++
+	if time.Since(m.renderedAt) >= searchDebounce {
+		m.metricsView()
+		return nil
+	}
+	m.searchPending = true
+	gen := m.searchGen
+	return tea.Tick(searchDebounce, func(time.Time) tea.Msg {
+		return searchMsg{gen: gen}
+	})
+}
+
+// stepInterval returns the next longer (or shorter) interval on the interval
+// ladder. The given interval is returned, if there is none.
+func stepInterval(d time.Duration, longer bool) time.Duration {
+	if longer {
+		for _, i := range intervals {
+			if i > d {
+				return i
+			}
+		}
+		return d
+	}
+	for i := len(intervals) - 1; i >= 0; i-- {
+		if intervals[i] < d {
+			return intervals[i]
+		}
+	}
+	return d
+}
+
+// isSearchRune returns true, if the given rune may be part of a search (i.e.
+// may appear in metric names or label selectors).
+func isSearchRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:,/|{}=\"!~ ", r)
+}
+
+// deleteLastWord deletes the last (space separated) word from the given search.
+func deleteLastWord(search string) string {
+	search = strings.TrimRight(search, " ")
+	return search[:strings.LastIndex(search, " ")+1]
+}
+
+// sleepCmd cancels the pending sleep (if any) and returns a command that
+// sleeps for the refresh interval and then triggers a sample.
+func (m *model) sleepCmd() tea.Cmd {
+	m.cancelSleep()
+	gen, done := m.sleepGen, make(chan struct{})
+	m.sleepDone = done
+	m.nextSample = time.Now().Add(m.interval)
+	timer := time.NewTimer(m.interval)
+	return func() tea.Msg {
+		select {
+		case <-timer.C:
+			return tickMsg{gen: gen}
+		case <-done:
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// sampleContext returns the context of the samples, which is cancelled on
+// pause and quit (see cancelSamples).
+func (m *model) sampleContext() context.Context {
+	if m.sampleCtx == nil {
+		m.sampleCtx, m.cancelSample = context.WithCancel(context.Background())
+	}
+	return m.sampleCtx
+}
+
+// cancelSamples cancels the samples in flight (if any).
+func (m *model) cancelSamples() {
+	if m.cancelSample != nil {
+		m.cancelSample()
+		m.sampleCtx, m.cancelSample = nil, nil
+	}
+}
+
+// quit cancels the pending sleep and the samples in flight and returns the
+// command quitting the program.
+func (m *model) quit() tea.Cmd {
+	m.cancelSleep()
+	m.cancelSamples()
+	return tea.Quit
+}
+
+// cancelSleep cancels the pending sleep (if any). The command waiting for it
+// returns immediately and a tick that is already underway is ignored.
+func (m *model) cancelSleep() {
+	if m.sleepDone != nil {
+		close(m.sleepDone)
+		m.sleepDone = nil
+	}
+	m.sleepGen++
+	m.nextSample = time.Time{}
+}
+
+func clockCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return clockMsg(t)
+	})
+}
+
+// sampleCmd returns a command that samples the targets concurrently. Targets
+// that can be fetched only once are skipped, and so are static targets and
+// targets backed off after failures until their retry (see retryCmd) unless
+// refresh is set. Unless refreshed, the samples are spread over the interval
+// (see staggerDelay), so that the targets are not all hit at once.
+func (m *model) sampleCmd(refresh bool) tea.Cmd {
+	var cmds []tea.Cmd
+	for i, t := range m.targets {
+		if t.once || ((t.static != "" || time.Now().Before(t.retryAt)) && !refresh) {
+			continue
+		}
+		var delay time.Duration
+		if !refresh {
+			delay = staggerDelay(i, len(m.targets), m.interval)
+		}
+		cmds = append(cmds, m.sampleTargetCmd(t, delay))
+	}
+	return tea.Batch(cmds...)
+}
+
+// staggerDelay returns the delay of the sample of the i-th of n targets, which
+// spreads their samples evenly over the given interval.
+func staggerDelay(i, n int, interval time.Duration) time.Duration {
+	if n <= 1 {
+		return 0
+	}
+	return interval / time.Duration(n) * time.Duration(i)
+}
+
+// nextSampleOf returns when the i-th target is sampled next, given the
+// current time: at its delay (see staggerDelay) after the end of the pending
+// sleep, or after the end of the previous one, if still to come. The zero time
+// is returned, if there is no pending sleep.
+func (m *model) nextSampleOf(i int, now time.Time) time.Time {
+	if m.nextSample.IsZero() {
+		return time.Time{}
+	}
+	next := m.nextSample.Add(staggerDelay(i, len(m.targets), m.interval))
+	if previous := next.Add(-m.interval); previous.After(now) {
+		return previous
+	}
+	return next
+}
+
+// scrapeSlots returns the slots bounding the number of targets sampled at
+// once to the given maximum (see model.scrapeSlots), or nil, if there is no
+// maximum.
+func scrapeSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// retryCmd returns a command that triggers a retry of the given target after
+// the given delay.
+func retryCmd(t *target, delay time.Duration) tea.Cmd {
+	gen := t.retryGen
+	return tea.Tick(delay, func(time.Time) tea.Msg {
+		return retryMsg{target: t, gen: gen}
+	})
+}
+
+// sampleTargetCmd returns a command that samples the given target after the
+// given delay, once one of the scrape slots (if any) is free. A sample of the
+// store in flight is superseded (see metrics.Store.Sample). Samples time out
+// after the interval (if any), so that a slow target holds its slot no longer
+// than until its next sample is due.
+func (m *model) sampleTargetCmd(t *target, delay time.Duration) tea.Cmd {
+	ctx, ts, slots, timeout := m.sampleContext(), t.store, m.scrapeSlots, m.interval
+	wait := m.wait
+	if wait == nil {
+		wait = waitContext
+	}
+	return func() tea.Msg {
+		if delay > 0 {
+			if err := wait(ctx, delay); err != nil {
+				return sampledMsg{target: t, error: err}
+			}
+		}
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return sampledMsg{target: t, error: ctx.Err()}
+			}
+		}
+		sampleCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			sampleCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		fetched, err := ts.Sample(sampleCtx)
+		took := time.Since(start)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				err = fmt.Errorf("scrape timed out after %s", timeout)
+			}
+			return sampledMsg{target: t, error: err, took: took}
+		}
+		return sampledMsg{target: t, fetched: fetched, took: took}
+	}
+}
+
+// waitContext waits for the given duration, unless the given context is done
+// before, whose error it returns then.
+func waitContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flashMessage shows the given message in the footer for a short while.
+func (m *model) flashMessage(msg string) {
+	m.flash, m.flashUntil = msg, time.Now().Add(flashDuration)
+}
+
+// target returns the target currently shown.
+func (m *model) target() *target {
+	return m.targets[m.current]
+}
+
+// other returns the index of the target the current one is compared with.
+func (m *model) other() int {
+	return (m.current + 1) % len(m.targets)
+}
+
+// manual returns true, if samples are taken on refresh only (i.e. there is
+// no refresh interval).
+func (m *model) manual() bool {
+	return m.interval == 0
 }
 
-func main() {
-	help := flag.Bool("help", false, "show help")
-	version := flag.Bool("version", false, "show version")
-	endpoint := flag.String("endpoint", "http://localhost:8080/healthz/metrics", "metrics endpoint")
-	interval := flag.Duration("interval", 5*time.Second, "refresh interval (e.g., 10s, 1m)")
-	search := flag.String("search", "", "metrics search filter")
-	disableHistoryView := flag.Bool("disable-history", false, "disable history")
-	disableDerivedView := flag.Bool("disable-derived", false, "disable derived metrics")
+// allStatic returns true, if none of the targets is sampled periodically.
+func (m *model) allStatic() bool {
+	for _, t := range m.targets {
+		if t.static == "" {
+			return false
+		}
+	}
+	return true
+}
 
-	flag.Parse()
-	if *help {
-		flag.Usage()
-		os.Exit(0)
+func (m *model) headerView() string {
+	var title string
+	switch {
+	case m.prompting == promptAggregation:
+		title = m.styles.title.Render("Aggregate without (labels, ENTER to apply): " + m.prompt + " ")
+	case m.prompting == promptEndpoint:
+		title = m.styles.title.Render("Endpoint (ENTER to open): " + m.prompt + " ")
+		switch {
+		case m.connecting:
+			title += m.styles.title.Render("connecting... ")
+		case m.promptError != "":
+			title += m.styles.error.Render(" " + printable(m.promptError) + " ")
+		}
+	case m.prompting == promptPivot:
+		title = m.styles.title.Render("Pivot by (label, ENTER to apply, empty for none): " + m.prompt + " ")
+	case m.search != "":
+		title = m.styles.title.Render("Search: " + m.search + " ")
 	}
-	if *version {
-		bi, ok := debug.ReadBuildInfo()
-		if !ok {
-			fmt.Println("Error reading Build Info")
-			os.Exit(1)
+	t := m.target()
+	endpoint := t.name()
+	if t.probed && t.title == "" {
+		endpoint += " (probed)"
+	}
+	switch {
+	case m.compare && len(m.targets) > 1:
+		o := m.targets[m.other()]
+		endpoint = fmt.Sprintf("A: %d/%d %s vs. B: %d/%d %s", m.current+1, len(m.targets), endpoint, m.other()+1, len(m.targets), o.name())
+	case len(m.targets) > 1:
+		endpoint = fmt.Sprintf("%d/%d %s", m.current+1, len(m.targets), endpoint)
+	}
+	var url string
+	switch {
+	case t.receiver != nil:
+		url = m.styles.title.Render(" " + t.static + " — " + lastPush(t.receiver.LastPush(), time.Now()))
+	case t.static != "":
+		url = m.styles.title.Render(" " + t.static + " - " + endpoint)
+	case m.manual():
+		url = m.styles.title.Render(" manual" + dataAge(t.store.LastScrape(), t.took, t.now()) + " - " + endpoint)
+	case m.stopped:
+		age := time.Since(t.lastSample).Truncate(time.Second)
+		url = m.styles.title.Render(" paused — data from " + age.String() + " ago - " + endpoint)
+	case !t.retryAt.IsZero():
+		wait := max(0, time.Until(t.retryAt)).Round(time.Second)
+		url = m.styles.title.Render(fmt.Sprintf(" retrying in %s (failure %d)%s - %s", wait, t.failures, dataAge(t.store.LastScrape(), t.took, t.now()), endpoint))
+	default:
+		var next string
+		if at := m.nextSampleOf(m.current, time.Now()); !at.IsZero() {
+			next = " - next in " + max(0, time.Until(at)).Round(time.Second).String()
 		}
-		var revision string
-		for _, s := range bi.Settings {
-			if s.Key == "vcs.revision" {
-				revision = s.Value
-				break
+		url = m.styles.title.Render(" " + m.interval.String() + next + dataAge(t.store.LastScrape(), t.took, t.now()) + " - " + endpoint)
+	}
+	if f, ok := t.fetcher.(endpointClock); ok {
+		// Sample times given by the Date header (see source.now) and the
+		// timestamps the endpoint exposes are off by the skew.
+		if skew := f.ClockSkew(); skew != 0 {
+			sign := "+"
+			if skew < 0 {
+				sign = ""
 			}
+			url = m.styles.warning.Render(" endpoint clock "+sign+skew.String()+" -") + url
 		}
-		fmt.Printf("version: %s, revision: %s\n", bi.Main.Version, revision)
-		os.Exit(0)
 	}
+	if len(m.aggregation.Without) > 0 {
+		url = m.styles.title.Render(" "+aggregationName(m.aggregation)+" -") + url
+	}
+	if n := len(t.rules.firing); n > 0 {
+		style := m.styles.warning
+		if t.rules.severity() == severityCritical {
+			style = m.styles.error
+		}
+		url = style.Render(fmt.Sprintf(" firing rules: %d -", n)) + url
+	}
+	if m.unchanged == unchangedSorted {
+		url = m.styles.title.Render(" longest unchanged first -") + url
+	}
+	if m.filter.types != 0 {
+		url = m.styles.title.Render(" types: "+m.filter.types.String()+" -") + url
+	}
+	if m.arrows != 0 {
+		url = m.styles.title.Render(" arrows: "+m.arrows.String()+" -") + url
+	}
+	if m.pushGroups > 0 && !(m.compare && len(m.targets) > 1) && m.pivot == "" {
+		style, pushes := m.styles.title, fmt.Sprintf(" pushgateway groups: %d", m.pushGroups)
+		if m.stalePushes > 0 {
+			style, pushes = m.styles.warning, pushes+fmt.Sprintf(", %d stale", m.stalePushes)
+		}
+		url = style.Render(pushes+" -") + url
+	}
+	if m.showTop && !(m.compare && len(m.targets) > 1) && m.pivot == "" {
+		url = m.styles.title.Render(fmt.Sprintf(" top %d movers -", m.top)) + url
+	}
+	if len(m.stripPrefixes) > 0 {
+		url = m.styles.muted.Render(" prefix stripped -") + url
+	}
+	if m.pivot != "" && !(m.compare && len(m.targets) > 1) {
+		url = m.styles.title.Render(" pivot: "+printable(m.pivot)+" -") + url
+	}
+	if at := t.baselineAt; !at.IsZero() {
+		age := time.Since(at).Truncate(time.Second)
+		url = m.styles.title.Render(" baseline: "+at.Local().Format(time.TimeOnly)+" ("+age.String()+" ago) -") + url
+	}
+	line := m.styles.info.Render(strings.Repeat(m.styles.line, max(0, m.viewport.Width-lipgloss.Width(title)-lipgloss.Width(url))))
+	header := lipgloss.JoinHorizontal(lipgloss.Center, title, line, url)
+	if len(m.common) > 0 {
+		common := " common labels: " + labelsText(m.common)
+		header += "\n" + m.styles.muted.MaxWidth(m.viewport.Width).Render(common)
+	}
+	return header
+}
 
-	// For now, we only need 3 data-points to show the delta between the last two
-	// values or last two rates.
-	ts := internal.NewStore(3, *endpoint)
-	if _, err := ts.Sample(); err != nil {
-		fmt.Println("Error fetching initial metrics:", err)
-		os.Exit(1)
+// fitViewport fits the viewport between the header and the footer into the
+// terminal, as the header grows by the line of the common labels (see
+// hoistLabels).
+func (m *model) fitViewport() {
+	if m.height == 0 {
+		return
 	}
+	headerHeight := lipgloss.Height(m.headerView())
+	m.viewport.Height = max(0, m.height-headerHeight-lipgloss.Height(m.footerView()))
+	m.viewport.YPosition = headerHeight
+}
 
-	m := &model{
-		search:      *search,
-		interval:    *interval,
-		data:        ts,
-		endpoint:    strings.TrimSpace(*endpoint),
-		ticker:      time.NewTicker(*interval),
-		showHistory: !*disableHistoryView,
-		showDerived: !*disableDerivedView,
+// dataAge describes when the data on screen was fetched, given the time of
+// the latest successful scrape and how long it took (e.g. " - last: 14:02:31
+// (4s ago, took 120ms)"). It is empty, if there was none.
+func dataAge(scraped time.Time, took time.Duration, now time.Time) string {
+	if scraped.IsZero() {
+		return ""
+	}
+	age := max(0, now.Sub(scraped)).Truncate(time.Second)
+	if took > 0 {
+		return " - last: " + scraped.Local().Format(time.TimeOnly) + " (" + age.String() + " ago, took " + took.Round(time.Millisecond).String() + ")"
 	}
+	return " - last: " + scraped.Local().Format(time.TimeOnly) + " (" + age.String() + " ago)"
+}
 
-	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Println("Error running program:", err)
-		os.Exit(1)
+func (m *model) footerView() string {
+	info := m.styles.info.Render(fmt.Sprintf(" %s / %s series | %s families | %s ",
+		groupDigits(strconv.Itoa(m.matched)), groupDigits(strconv.Itoa(m.total)), groupDigits(strconv.Itoa(m.families)), m.lines()))
+	if m.match > 0 {
+		info = m.styles.info.Render(fmt.Sprintf(" match %d/%d |", m.match, m.matches)) + info
 	}
+	if m.hidden.zero > 0 || m.hidden.unchanged > 0 {
+		info = m.styles.info.Render(" hidden: "+hiddenCounts(m.hidden)+" |") + info
+	}
+	if m.filter.hideRuntime && !searchesRuntime(m.search) {
+		info = m.styles.info.Render(" (runtime metrics hidden) |") + info
+	}
+	if kept, total := m.target().store.Families(); kept < total {
+		info = m.styles.info.Render(fmt.Sprintf(" keeping %s of %s families |", groupDigits(strconv.Itoa(kept)), groupDigits(strconv.Itoa(total)))) + info
+	}
+	if m.skipped > 0 {
+		info = m.styles.warning.Render(fmt.Sprintf(" %d malformed targets skipped", m.skipped)) + info
+	}
+	if m.newSeries > 0 {
+		info = m.styles.info.Inherit(m.styles.new).Render(fmt.Sprintf(" %d new series", m.newSeries)) + info
+	}
+	keys := m.styles.info.Render(" " + hint(m.keys.quit, m.keys.help, m.keys.search) + " ")
+	if m.flash != "" && time.Now().Before(m.flashUntil) {
+		keys = m.styles.info.Render(" " + m.flash + " ")
+	} else if err := m.target().err; err != nil {
+		keys = m.styles.error.Render(" Error fetching metrics: " + printable(err.Error()) + " ")
+	} else if duplicates := m.familyDuplicates(); len(duplicates) > 0 {
+		keys = m.styles.warning.Render(" Duplicate series in last scrape: " + strings.Join(duplicates, ", ") + " ")
+	} else if warning := m.target().store.Warning(); warning != "" {
+		keys = m.styles.warning.Render(" Warning: " + printable(warning) + " ")
+	} else if help := m.familyHelp(); help != "" {
+		keys = m.styles.info.Render(" " + help + " ")
+	}
+	line := m.styles.info.Render(strings.Repeat(m.styles.line, max(0, m.viewport.Width-lipgloss.Width(info)-lipgloss.Width(keys))))
+	return lipgloss.JoinHorizontal(lipgloss.Center, keys, line, info)
 }
 
-func (m *model) Init() tea.Cmd {
-	return sleepCmd(m.ticker)
+// lines describes the lines shown by the viewport (e.g. "line 240–300 of
+// 2,431").
+func (m *model) lines() string {
+	total := m.viewport.TotalLineCount()
+	if total == 0 || m.viewport.VisibleLineCount() == 0 {
+		return groupDigits(strconv.Itoa(total)) + " lines"
+	}
+	first, last := m.viewport.YOffset+1, m.viewport.YOffset+m.viewport.VisibleLineCount()
+	return fmt.Sprintf("line %s%s%s of %s", groupDigits(strconv.Itoa(first)), m.styles.dash, groupDigits(strconv.Itoa(last)), groupDigits(strconv.Itoa(total)))
 }
 
-func (m *model) Update(teaMsg tea.Msg) (tea.Model, tea.Cmd) {
-	var cmds []tea.Cmd
-	switch msg := teaMsg.(type) {
-	case sampledMsg:
-		switch {
-		case msg.error != nil:
-			content := fmt.Sprintf("Error fetching metrics: %s", msg.error.Error())
-			m.viewport.SetContent(content)
-		case msg.fetched:
-			m.metricsView()
-		}
-		if !m.stopped {
-			m.ticker.Reset(m.interval)
-			cmds = append(cmds, sleepCmd(m.ticker))
+// jumpToMatch scrolls to the next (or previous) row matching the search (see
+// matchSpans), starting from the row jumped to last or else from the top of
+// the viewport. It wraps around at the end.
+func (m *model) jumpToMatch(forward bool) {
+	var matches []int
+	for i, r := range m.rows {
+		if m.search != "" && len(matchSpans(r.name, m.search)) > 0 {
+			matches = append(matches, i)
 		}
-	case tickMsg:
-		m.ticker.Stop()
-		cmds = append(cmds, sampleCmd(m.data))
-	case tea.WindowSizeMsg:
-		headerHeight := lipgloss.Height(m.headerView())
-		footerHeight := lipgloss.Height(m.footerView())
-		verticalMarginHeight := headerHeight + footerHeight
-		if !m.ready {
-			m.viewport = viewport.New(msg.Width, msg.Height-verticalMarginHeight)
-			m.viewport.YPosition = headerHeight
-			m.metricsView()
-			m.ready = true
-		} else {
-			m.viewport.Width = msg.Width
-			m.viewport.Height = msg.Height - verticalMarginHeight
+	}
+	m.matches = len(matches)
+	if len(matches) == 0 {
+		m.match = 0
+		return
+	}
+	cur := m.viewport.YOffset
+	if m.match > 0 && m.match <= len(matches) {
+		cur = matches[m.match-1]
+	} else if forward {
+		// A match at the top counts as the next one.
+		cur--
+	}
+	k := -1
+	if forward {
+		k = slices.IndexFunc(matches, func(i int) bool { return i > cur })
+		if k < 0 {
+			k = 0
 		}
-	case tea.KeyMsg:
-		switch {
-		case msg.String() == "ctrl+c":
-			return m, tea.Quit
-		case msg.String() == "ctrl+r":
-			m.ticker.Stop()
-			cmds = append(cmds, sampleCmd(m.data))
-		case msg.String() == "ctrl+p":
-			if m.stopped {
-				cmds = append(cmds, sampleCmd(m.data))
-			} else {
-				m.ticker.Stop()
-			}
-			m.stopped = !m.stopped
-		case msg.Type == tea.KeyBackspace:
-			if len(m.search) > 0 {
-				m.search = m.search[:len(m.search)-1]
-			}
-			m.metricsView()
-		case msg.Type == tea.KeyRunes:
-			for _, r := range msg.Runes {
-				if unicode.IsLetter(r) || unicode.IsDigit(r) || msg.String() == "_" || msg.String() == "-" {
-					m.search += string(r)
-				}
+	} else {
+		for j, i := range matches {
+			if i < cur {
+				k = j
 			}
-			m.metricsView()
+		}
+		if k < 0 {
+			k = len(matches) - 1
 		}
 	}
-
-	var cmd tea.Cmd
-	m.viewport, cmd = m.viewport.Update(teaMsg)
-	cmds = append(cmds, cmd)
-	return m, tea.Batch(cmds...)
+	m.match = k + 1
+	m.viewport.SetYOffset(matches[k])
 }
 
-func (m *model) View() string {
-	if !m.ready {
-		return "\n  Initializing..."
+// familyHelp returns the HELP text of the metric family of the top row while
+// browsing (e.g. "go_goroutines: Number of goroutines that currently
+// exist."), or an empty string if there is none.
+func (m *model) familyHelp() string {
+	i := m.viewport.YOffset
+	if !m.browsing || i >= len(m.rows) {
+		return ""
 	}
-	return fmt.Sprintf("%s\n%s\n%s", m.headerView(), m.viewport.View(), m.footerView())
+	family := m.rows[i].family
+	if f, ok := m.target().store.Help(family); ok && f.Help != "" {
+		return printable(family + ": " + f.Help)
+	}
+	return ""
 }
 
-func sleepCmd(t *time.Ticker) tea.Cmd {
-	return func() tea.Msg {
-		return tickMsg(<-t.C)
+// familyDuplicates returns the duplicate series of the latest sample (see
+// metrics.Store.Duplicates) of the metric family of the top row while browsing.
+func (m *model) familyDuplicates() []string {
+	i := m.viewport.YOffset
+	if !m.browsing || i >= len(m.rows) {
+		return nil
 	}
+	all := m.target().store.Duplicates()
+	if len(all) == 0 {
+		return nil
+	}
+	var duplicates []string
+	for _, r := range m.rows {
+		if r.family == m.rows[i].family && slices.Contains(all, r.name) {
+			duplicates = append(duplicates, r.name)
+		}
+	}
+	return duplicates
 }
 
-func sampleCmd(ts *internal.Store) tea.Cmd {
-	return func() tea.Msg {
-		fetched, err := ts.Sample()
-		if err != nil {
-			return sampledMsg{error: err}
+// jumpToFamily scrolls to the first row of the next metric family (or of the
+// current one, if backwards and not at it, and otherwise of the previous one).
+func (m *model) jumpToFamily(forward bool) {
+	i := min(m.viewport.YOffset, len(m.rows)-1)
+	if i < 0 {
+		return
+	}
+	if forward {
+		for j := i + 1; j < len(m.rows); j++ {
+			if m.rows[j].family != m.rows[i].family {
+				m.viewport.SetYOffset(j)
+				return
+			}
 		}
-		if !fetched {
-			return sampledMsg{}
+		return
+	}
+	start := func(i int) int {
+		for i > 0 && m.rows[i-1].family == m.rows[i].family {
+			i--
 		}
-		return sampledMsg{fetched: true}
+		return i
 	}
+	j := start(i)
+	if j == i && i > 0 {
+		j = start(i - 1)
+	}
+	m.viewport.SetYOffset(j)
 }
 
-func (m *model) headerView() string {
-	var title string
-	if m.search != "" {
-		title = titleStyle.Render("Search: " + m.search + " ")
+// countSeries counts the series of the current target in the given dump (see
+// model.matched).
+func (m *model) countSeries(dump [][]metrics.Observation) {
+	families := make(map[string]bool)
+	for _, series := range dump {
+		families[series[0].Family()] = true
 	}
-	var url string
-	if m.stopped {
-		url = titleStyle.Render(" paused - " + m.endpoint)
-	} else {
-		url = titleStyle.Render(" " + m.interval.String() + " - " + m.endpoint)
+	m.matched, m.families, m.total = len(dump), len(families), m.target().store.Len()
+}
+
+func (m *model) metricsView() {
+	m.searchPending, m.renderedAt = false, time.Now()
+	prev, top := m.rows, m.viewport.YOffset
+	if m.compare && len(m.targets) > 1 {
+		m.common = nil
+		m.fitViewport()
+		// Without the final newline, the lines of the viewport are the rows.
+		content := m.compareView(lipgloss.NewStyle().MaxWidth(m.viewport.Width))
+		m.viewport.SetContent(strings.TrimSuffix(content, "\n"))
+		return
+	}
+	if m.pivot != "" {
+		m.common = nil
+		m.fitViewport()
+		content := m.pivotView(lipgloss.NewStyle().MaxWidth(m.viewport.Width))
+		m.viewport.SetContent(strings.TrimSuffix(content, "\n"))
+		return
+	}
+	rows, err := m.buildRows()
+	m.fitViewport()
+	if err != nil {
+		m.renderError(err)
+		return
 	}
-	line := infoStyle.Render(strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(title)-lipgloss.Width(url))))
-	return lipgloss.JoinHorizontal(lipgloss.Center, title, line, url)
+	m.more = 0
+	if m.maxLines > 0 && !m.showAll && len(rows) > m.maxLines {
+		rows, m.more = rows[:m.maxLines], len(rows)-m.maxLines
+	}
+	m.rows = rows
+
+	// Series appearing or disappearing above the top row would shift it, so
+	// it is kept on top (unless scrolled to the top).
+	if top > 0 && top < len(prev) {
+		if i, ok := anchorRow(prev, top, m.rows); ok {
+			top = i
+		}
+	}
+	m.renderWindow(top)
 }
 
-func (m *model) footerView() string {
-	info := infoStyle.Render(fmt.Sprintf(" %.f%%", m.viewport.ScrollPercent()*100))
-	keys := infoStyle.Render("CTRL+c: quit | CTRL+r: refresh | CTRL+p: (un-)pause | <xyz>: search \"xyz\" ")
-	line := infoStyle.Render(strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(info)-lipgloss.Width(keys))))
-	return lipgloss.JoinHorizontal(lipgloss.Center, keys, line, info)
+// anchorRow returns the index among the given rows of the row at index i of
+// the previous rows or, if it vanished, of its nearest surviving neighbor
+// (preferring the following ones).
+func anchorRow(prev []row, i int, rows []row) (int, bool) {
+	index := make(map[string]int, len(rows))
+	for j, r := range rows {
+		index[r.name] = j
+	}
+	for d := 0; i+d < len(prev) || i-d >= 0; d++ {
+		if i+d < len(prev) {
+			if j, ok := index[prev[i+d].name]; ok {
+				return j, true
+			}
+		}
+		if i-d >= 0 {
+			if j, ok := index[prev[i-d].name]; ok {
+				return j, true
+			}
+		}
+	}
+	return 0, false
 }
 
-func (m *model) metricsView() {
-	dump, err := m.data.Dump(m.search)
-	maxWidthStyle := lipgloss.NewStyle().MaxWidth(m.viewport.Width)
+// renderMetrics renders the series of the current target matching the search
+// (or the comparison with the next target, see compareView, or the series
+// pivoted by a label, see pivotView).
+func (m *model) renderMetrics(maxWidthStyle lipgloss.Style) string {
+	if m.compare && len(m.targets) > 1 {
+		return m.compareView(maxWidthStyle)
+	}
+	if m.pivot != "" {
+		return m.pivotView(maxWidthStyle)
+	}
+	rows, err := m.buildRows()
 	if err != nil {
-		content := maxWidthStyle.Render(fmt.Sprintf("Error rendering metrics: %s", err.Error()))
-		m.viewport.SetContent(content)
+		return maxWidthStyle.Render(fmt.Sprintf("Error rendering metrics: %s", err.Error()))
 	}
+	m.rows = rows
 	sb := strings.Builder{}
-	for _, series := range dump {
-		derived := m.derive(series)
-		for _, d := range derived {
-			if len(d) == 0 {
-				continue
-			}
-			sb.WriteString(renderSeries(d, m.showHistory, m.showDerived, maxWidthStyle))
-		}
+	for _, r := range rows {
+		// Exports show the full names (without hoisting common labels or
+		// stripping prefixes).
+		r.shown, r.stripped = "", 0
+		sb.WriteString(m.renderRow(r, maxWidthStyle))
 	}
-	content := sb.String()
-	m.viewport.SetContent(content)
+	return sb.String()
 }
 
-func computeRate(c, p internal.Observation) internal.Observation {
-	dur := c.Time.Sub(p.Time)
-	delta := c.Value - p.Value
-	var rate float64
-	if dur < time.Second {
-		scale := float64(time.Second.Nanoseconds() / dur.Nanoseconds())
-		rate = delta * scale
-	} else {
-		rate = delta / dur.Seconds()
+// compareView renders the series of the current target side by side with the
+// series of the next target.
+func (m *model) compareView(maxWidthStyle lipgloss.Style) string {
+	// A target without data compares as missing all series.
+	a, _ := m.target().store.Dump(m.search)
+	b, _ := m.targets[m.other()].store.Dump(m.search)
+	a, m.hidden = m.filter.apply(a, m.search)
+	b, _ = m.filter.apply(b, m.search)
+	m.countSeries(a)
+	m.rows = nil
+	comparisons := compare(latest(a, m.deriver, m.showDerived), latest(b, m.deriver, m.showDerived))
+	return renderComparisons(comparisons, m.tolerance, m.formatter, m.styles, maxWidthStyle)
+}
+
+// kindNames returns the comma-separated names of the given kinds.
+func kindNames(kinds []metrics.ObservationKind) string {
+	names := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		names = append(names, k.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// parseKinds parses a comma-separated list of kind names.
+func parseKinds(s string) ([]metrics.ObservationKind, error) {
+	var kinds []metrics.ObservationKind
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		k, err := metrics.ParseObservationKind(name)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, k)
 	}
-	return internal.NewObservation(rateName(c.Name), internal.ObservationCounterRate, c.Time, rate)
+	return kinds, nil
 }
 
-func (m *model) derive(ots []internal.Observation) [][]internal.Observation {
-	var derived [][]internal.Observation
-	derived = append(derived, ots)
-	o := ots[0]
+// parseRateWindow parses the rate window, which is either "instant" (no
+// average rate), "buffer" (average over the whole buffer), or a duration.
+func parseRateWindow(s string) (time.Duration, error) {
+	switch s {
+	case "instant":
+		return 0, nil
+	case "buffer":
+		return metrics.RateWindowBuffer, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("rate window must be positive")
+	}
+	return d, nil
+}
 
-	// Derive a rate series from counter like items.
-	if (o.Kind == internal.ObservationCounter || o.Kind == internal.ObservationHistogramCount) && len(ots) > 1 {
-		rs := make([]internal.Observation, 0, len(ots))
-		for i := 0; i < len(ots)-1; i++ {
-			rs = append(rs, computeRate(ots[i], ots[i+1]))
+// parseByteSize parses a size in bytes, optionally followed by a binary unit
+// (e.g. "64MiB").
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1}}
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSuffix(s, u.suffix), u.factor
+			break
 		}
-		derived = append(derived, rs)
 	}
-	return derived
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	return n * factor, nil
 }
 
-func rateName(name string) string {
-	split := strings.Split(name, " ")
-	name = split[0] + "_per_second_rate"
-	if len(split) > 1 {
-		name += " " + strings.Join(split[1:], " ")
+func isDerived(kind metrics.ObservationKind) bool {
+	switch kind {
+	case metrics.ObservationCounterRate, metrics.ObservationCounterWindowRate, metrics.ObservationHistogramAvg,
+		metrics.ObservationHistogramQuantile, metrics.ObservationHistogramIntervalQuantile, metrics.ObservationExpression:
+		return true
 	}
-	return name
+	return false
 }
 
-func round(f float64) float64 {
-	return math.Round(f*100) / 100
+// seriesOptions are the options series are rendered with (see renderSeries),
+// taken from the model (see model.seriesOptions).
+type seriesOptions struct {
+	showHistory, expandHistory, showDerived, highlightNew bool
+
+	// showUnchanged shows the time series have been unchanged for.
+	showUnchanged bool
+
+	arrows typeMask
+	hold   int
+
+	// baseline holds the values of the baseline, the change since which is
+	// shown (unless nil).
+	baseline map[string]float64
+
+	search        string
+	formatter     valueFormatter
+	styles        styles
+	maxWidthStyle lipgloss.Style
 }
 
-func format(f float64) string {
-	return strconv.FormatFloat(f, 'f', -1, 64)
+// seriesOptions returns the options the series of the current target are
+// rendered with, up to the given maximum width.
+func (m *model) seriesOptions(maxWidthStyle lipgloss.Style) seriesOptions {
+	return seriesOptions{
+		showHistory:   m.showHistory,
+		expandHistory: m.expandHistory,
+		showDerived:   m.showDerived,
+		highlightNew:  m.highlightNew,
+		showUnchanged: m.unchanged != unchangedHidden,
+		arrows:        m.arrows,
+		hold:          m.hold,
+		baseline:      m.target().baseline,
+		search:        m.search,
+		formatter:     m.formatter,
+		styles:        m.styles,
+		maxWidthStyle: maxWidthStyle,
+	}
 }
 
-func isDerived(kind internal.ObservationKind) bool {
-	return kind == internal.ObservationCounterRate || kind == internal.ObservationHistogramAvg
+// renderSeries renders a single item series to a single line string, with
+// the given options (see seriesOptions). Series that just changed are
+// highlighted, unless matched by firing alert rules, which highlight them by
+// the given severity (unless none). The parts of the name matched by the
+// search are highlighted (see matchSpans). With expandHistory, all values are
+// shown instead of the latest one (see expandedValues). Names too long for the
+// maximum width are shortened in the middle (see truncateMiddle), so that the
+// values (and the end of the labels) stay visible.
+func renderSeries(name string, obs []metrics.Observation, highlight bool, alert severity, opts seriesOptions) string {
+	st, maxWidthStyle := opts.styles, opts.maxWidthStyle
+	line := renderLine(name, obs, highlight, alert, opts)
+	if line == "" {
+		return ""
+	}
+	if width := maxWidthStyle.GetMaxWidth(); width > 0 && !opts.expandHistory {
+		if excess := lipgloss.Width(line) - width; excess > 0 {
+			if name, ok := truncateMiddle(name, lipgloss.Width(name)-excess, st.glyphs.ellipsis); ok {
+				line = renderLine(name, obs, highlight, alert, opts)
+			}
+		}
+	}
+	return maxWidthStyle.Render(line) + "\n"
 }
 
-// renderSeries renders a single item series to a single line string.
-func renderSeries(obs []internal.Observation, showHistory, showDerived bool, maxWidthStyle lipgloss.Style) string {
+// renderLine renders the given series like renderSeries, but under the given
+// name and without the maximum width and the final newline.
+func renderLine(name string, obs []metrics.Observation, highlight bool, alert severity, opts seriesOptions) string {
+	f, st := opts.formatter, opts.styles
 
 	o := obs[0]
 	derived := isDerived(o.Kind)
 
 	// If we have no labels, return the name.
-	if !showDerived && derived {
+	if !opts.showDerived && derived {
 		return ""
 	}
 
@@ -313,39 +2123,315 @@ func renderSeries(obs []internal.Observation, showHistory, showDerived bool, max
 		s = "+"
 	}
 
+	// The spans are offset by the prefix.
+	var spans []span
+	if opts.search != "" {
+		for _, sp := range matchSpans(name, opts.search) {
+			spans = append(spans, span{sp.start + len(s), sp.end + len(s)})
+		}
+	}
+
+	// Series missing from the latest sample are grayed out.
+	if o.Stale {
+		return renderMatches(s+name+" "+staleValue(o, f, st.glyphs), spans, st.muted, st.match)
+	}
+
+	// Values without an estimate (e.g. quantiles of an empty histogram) and
+	// infinite ones are rendered dim (see special) and never count as
+	// changed.
+	cv := obs[0].Value
+	if v, ok := special(cv, st.glyphs); ok {
+		return renderMatches(s+name+" ", spans, lipgloss.NewStyle(), st.match) + st.muted.Render(v)
+	}
+
+	// If history view is enabled, smoothed values are followed by their raw
+	// (unsmoothed) value, and values are annotated with the age of their
+	// metric and their exemplar (if exposed). In the expanded history, values
+	// formatted otherwise (e.g. humanized or rounded) are followed by their
+	// raw float.
+	var raw string
+	switch {
+	case opts.showHistory && o.Smoothed && !math.IsNaN(o.Raw):
+		raw = st.muted.Render(" (raw " + f.value(o, o.Raw) + ")")
+	case opts.expandHistory && !o.Smoothed && f.value(o, cv) != format(cv):
+		raw = st.muted.Render(" (raw " + format(cv) + ")")
+	}
+	if opts.showHistory {
+		raw += annotations(o, f, st)
+	}
+
+	// Series appearing after the baseline changed by their full value.
+	if opts.baseline != nil && !derived {
+		delta := cv - opts.baseline[o.Name]
+		sign := "+"
+		if delta < 0 {
+			sign = "-"
+		}
+		raw = st.muted.Render(" ("+sign+f.delta(o, math.Abs(delta))+" since baseline)") + raw
+	}
+
+	if d, ok := unchangedFor(o, time.Now()); opts.showUnchanged && ok {
+		raw = st.muted.Render(" (unchanged "+f.seconds(d.Seconds())+")") + raw
+	}
+
+	// Recently appeared series are tagged (see isNew).
+	if opts.highlightNew && isNew(o) {
+		raw = st.new.Render(" new") + raw
+	}
+
+	// Aggregates are synthetic, so they are marked (see
+	// metrics.Aggregation).
+	if o.Aggregated > 0 {
+		raw = st.muted.Render(" (aggregate of "+strconv.Itoa(o.Aggregated)+")") + raw
+	}
+
+	// Rows matched by firing alert rules are highlighted by severity, rows
+	// that just changed otherwise (see changed).
+	style := lipgloss.NewStyle()
+	switch {
+	case alert == severityCritical:
+		style = st.critical
+	case alert == severityWarn:
+		style = st.warn
+	case highlight:
+		style = st.highlight
+	}
+
+	// The expanded history fills the rest of the line (without the change
+	// arrows, which would clutter it).
+	if opts.expandHistory {
+		s += name + " "
+		width := math.MaxInt
+		if w := opts.maxWidthStyle.GetMaxWidth(); w > 0 {
+			width = w - lipgloss.Width(s) - lipgloss.Width(raw)
+		}
+		s += expandedValues(obs, f, st.glyphs, width)
+		return renderMatches(s, spans, style, st.match) + raw
+	}
+
 	// If we have only one value, return name and value.
-	cv := round(obs[0].Value)
-	s += o.Name + " " + format(cv)
+	s += name + " " + f.value(o, obs[0].Value)
 	if len(obs) < 2 {
-		return maxWidthStyle.Render(s) + "\n"
+		return renderMatches(s, spans, style, st.match) + raw
+	}
+
+	// Get the previous value (or, with a hold, the one before the held
+	// changes, see heldIndex).
+	pv := obs[heldIndex(obs, opts.hold)].Value
+
+	// If unchanged (or previously without an estimate or infinite), return.
+	// Values are compared unrounded, so that changes below the display
+	// precision still count.
+	if cv == pv || !finite(pv) {
+		return renderMatches(s, spans, style, st.match) + raw
 	}
 
-	// Get the previous value.
-	pv := round(obs[1].Value)
+	// Series of types without arrows (e.g. oscillating gauges, see
+	// model.arrows) change silently.
+	if !opts.arrows.has(typeOf(o.Kind)) {
+		return renderMatches(s, spans, style, st.match) + raw
+	}
 
-	// If unchanged, return.
-	if cv == pv {
-		return maxWidthStyle.Render(s) + "\n"
+	// Timestamps change by moving on (e.g. a restart resetting the age)
+	// rather than by going up or down, so that they are highlighted without
+	// arrows, and restarts are tagged.
+	if f.humanize && f.isTimestamp(o) {
+		if isStartTime(o) && cv > pv {
+			raw = st.new.Render(" restarted") + raw
+		}
+		return renderMatches(s, spans, style.Inherit(st.changed), st.match) + raw
 	}
 
-	// Changed values will be bold.
-	s = boldStyle.Render(s)
+	// Of changed values, the digits from the first changed one on are bold
+	// (or the whole line, if the formatted values differ in length or not at
+	// all).
+	cur := f.value(o, cv)
+	if i := changedFrom(cur, f.value(o, pv)); i >= 0 && i < len(cur) {
+		s = renderMatches(s[:len(s)-len(cur)+i], spans, style, st.match) + style.Inherit(st.changed).Render(cur[i:])
+	} else {
+		s = renderMatches(s, spans, style.Inherit(st.changed), st.match)
+	}
 
 	// add colored arrows to indicate the change.
 	if cv > pv {
-		s += redStyle.Render(" ⬆")
+		s += st.increase.Render(" " + st.up)
 	} else {
-		s += greenStyle.Render(" ⬇")
+		s += st.decrease.Render(" " + st.down)
 	}
 
 	// If showHistory view is enabled, append the delta to the previous value.
-	if showHistory {
-		delta := round(math.Abs(cv - pv))
+	if opts.showHistory {
+		delta := math.Abs(cv - pv)
 		if cv > pv {
-			s += grayStyle.Render(" (+" + format(delta) + ")")
+			s += st.muted.Render(" (+" + f.value(o, delta) + ")")
 		} else {
-			s += grayStyle.Render(" (-" + format(delta) + ")")
+			s += st.muted.Render(" (-" + f.value(o, delta) + ")")
+		}
+	}
+	return s + raw
+}
+
+// heldIndex returns the index of the value of the given series the latest one
+// is compared with to indicate changes: the previous one, or, with a hold of
+// more than one sample (see -indicator-hold), the one hold samples back (at
+// most the oldest buffered one), so that changes stay indicated with their
+// cumulative delta for hold samples. Changes cancelling each other out within
+// the hold (e.g. a value going back) are indicated by the latest of them,
+// whose previous value is returned then. Holds do not decay while paused, as
+// no samples are taken.
+func heldIndex(obs []metrics.Observation, hold int) int {
+	n := max(1, min(hold, len(obs)-1))
+	if n == 1 || obs[0].Value != obs[n].Value {
+		return n
+	}
+	for i := range n {
+		if obs[i].Value != obs[i+1].Value {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// highlightDuration is how long the rows that changed in the latest sample are
+// highlighted (at least, see clockCmd).
+const highlightDuration = time.Second
+
+// changed returns true, if the value of the given series changed in the latest
+// sample or, with a hold, is still indicated as changed (see heldIndex).
+func changed(series []metrics.Observation, hold int) bool {
+	if len(series) < 2 || series[0].Stale {
+		return false
+	}
+	pv := series[heldIndex(series, hold)].Value
+	return series[0].Value != pv && finite(series[0].Value) && finite(pv)
+}
+
+// expandedValues renders the values of the given series newest first (e.g.
+// "1520 ← 1480 ← 1455"), each followed by its timestamp (if the formatter
+// has a time format), which is marked if exposed by the exporter. Older
+// values not fitting the given width are left out, which is marked by an
+// ellipsis.
+func expandedValues(obs []metrics.Observation, f valueFormatter, g glyphs, width int) string {
+	values := make([]string, 0, len(obs))
+	for _, o := range obs {
+		v, ok := special(o.Value, g)
+		if !ok {
+			v = f.value(o, o.Value)
+		}
+		if f.timeFormat != "" {
+			v += " (" + o.Time.Local().Format(f.timeFormat) + timeSourceText(o) + ")"
+		}
+		values = append(values, v)
+	}
+	sep := " " + g.left + " "
+	if s := strings.Join(values, sep); lipgloss.Width(s) <= width {
+		return s
+	}
+	s := values[0]
+	for _, v := range values[1:] {
+		if lipgloss.Width(s+sep+v+sep+g.ellipsis) > width {
+			break
+		}
+		s += sep + v
+	}
+	return s + sep + g.ellipsis
+}
+
+// nameTail is how many characters of the end of long names truncateMiddle
+// keeps at most (e.g. the values of the last labels, which often tell the
+// series apart).
+const nameTail = 20
+
+// truncateMiddle shortens the given (flat) name to the given width, replacing
+// its middle with the ellipsis. The start (e.g. the metric name) and up to
+// nameTail characters of the end are kept. It returns false, if the width is
+// too small to keep anything of the name.
+func truncateMiddle(name string, width int, ellipsis string) (string, bool) {
+	w := ansi.StringWidth(name)
+	if w <= width {
+		return name, true
+	}
+	keep := width - ansi.StringWidth(ellipsis)
+	if keep < 2 {
+		return name, false
+	}
+	tail := min(nameTail, keep/2)
+	return ansi.Truncate(name, keep-tail, "") + ellipsis + ansi.TruncateLeft(name, w-tail, ""), true
+}
+
+// changedFrom returns the byte offset of the first character of the given
+// formatted current value differing from the given formatted previous value
+// (e.g. 6 for "1,283,512,977" and "1,283,441,023"), or len(cur) if they are
+// equal. Values of different lengths (in characters) are not aligned (-1).
+func changedFrom(cur, prev string) int {
+	if utf8.RuneCountInString(cur) != utf8.RuneCountInString(prev) {
+		return -1
+	}
+	for i, r := range cur {
+		p, size := utf8.DecodeRuneInString(prev)
+		if r != p {
+			return i
+		}
+		prev = prev[size:]
+	}
+	return len(cur)
+}
+
+// newSamples is the number of samples a recently appeared series is tagged as
+// new for.
+const newSamples = 3
+
+// isNew returns true, if the series of the given (latest) observation appeared
+// within the last newSamples samples.
+func isNew(o metrics.Observation) bool {
+	return o.Appeared > 0 && o.Appeared <= newSamples
+}
+
+// staleValue renders the value of a stale observation along with the time it
+// was last seen (e.g. "42 (stale, last seen 30s ago)"). Values without an
+// estimate are rendered as the given dash.
+func staleValue(o metrics.Observation, f valueFormatter, g glyphs) string {
+	v, ok := special(o.Value, g)
+	if !ok {
+		v = f.value(o, o.Value)
+	}
+	return v + " (stale, last seen " + time.Since(o.Time).Truncate(time.Second).String() + " ago)"
+}
+
+// timeSourceText returns the note of the timestamp of the given observation
+// (", exporter time" if exposed by the exporter, nothing for the scrape
+// time).
+func timeSourceText(o metrics.Observation) string {
+	if o.TimeSource == metrics.TimeExporter {
+		return ", exporter time"
+	}
+	return ""
+}
+
+// annotations returns the annotations of the given observation: whether its
+// timestamp was exposed by the exporter, the age of counters and histogram and
+// summary counts (if their creation time is exposed) and the exemplar (if
+// any).
+func annotations(o metrics.Observation, f valueFormatter, st styles) string {
+	var s string
+	if o.TimeSource == metrics.TimeExporter {
+		s += st.muted.Render(" (exporter time)")
+	}
+	switch o.Kind {
+	case metrics.ObservationCounter, metrics.ObservationHistogramCount, metrics.ObservationSummaryCount:
+		if !o.Created.IsZero() {
+			s += st.muted.Render(" (age " + f.seconds(time.Since(o.Created).Seconds()) + ")")
+		}
+	}
+	if e := o.Exemplar; e != nil {
+		labels := make([]string, 0, len(e.Labels))
+		for _, l := range e.Labels {
+			labels = append(labels, printable(l.Name+"="+l.Value))
 		}
+		// The exemplar's value is in the unit of the metric (e.g. seconds for
+		// buckets of a "_seconds" histogram).
+		base := metrics.NewObservation(strings.TrimSuffix(o.Metric, "_bucket"), nil, metrics.ObservationGauge, o.Time, e.Value)
+		s += st.muted.Render(" (exemplar: " + strings.Join(labels, " ") + " value=" + f.value(base, e.Value) + ")")
 	}
-	return maxWidthStyle.Render(s) + "\n"
+	return s
 }
@@ -0,0 +1,1041 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// newTestModel returns a model with a single target backed by an empty store.
+func newTestModel() *model {
+	fetcher := metrics.NewHTTPFetcher("http://localhost/metrics")
+	return &model{
+		targets: []*target{{
+			source:   source{fetcher: fetcher},
+			endpoint: fetcher.Endpoint,
+			store:    metrics.NewStore(3, fetcher),
+		}},
+		interval: time.Hour,
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+	}
+}
+
+func TestModel_UpdateSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		search   string
+		msgs     []tea.KeyMsg
+		expected string
+	}{
+		{
+			name:     "pasted selector",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyRunes, Runes: []rune(`http_requests_total{code!="5xx"}`), Paste: true}},
+			expected: `http_requests_total{code!="5xx"}`,
+		},
+		{
+			name:     "dotted and colon names",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyRunes, Runes: []rune("job:my.metric-name=~")}},
+			expected: "job:my.metric-name=~",
+		},
+		{
+			name:     "quoted UTF-8 names",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyRunes, Runes: []rune(`{"http.server.requests_total", "http.route"=~"/api|/health"}`)}},
+			expected: `{"http.server.requests_total", "http.route"=~"/api|/health"}`,
+		},
+		{
+			name: "space",
+			msgs: []tea.KeyMsg{
+				{Type: tea.KeyRunes, Runes: []rune("foo")},
+				{Type: tea.KeySpace, Runes: []rune{' '}},
+				{Type: tea.KeyRunes, Runes: []rune("bar")},
+			},
+			expected: "foo bar",
+		},
+		{
+			name:     "unsupported runes are dropped",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyRunes, Runes: []rune("a#b$c")}},
+			expected: "abc",
+		},
+		{
+			name:     "backspace",
+			search:   "gö",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyBackspace}},
+			expected: "g",
+		},
+		{
+			name:     "backspace on empty search",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyBackspace}},
+			expected: "",
+		},
+		{
+			name:     "delete last word",
+			search:   "foo bar_baz",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyCtrlW}},
+			expected: "foo ",
+		},
+		{
+			name:     "delete last word with trailing space",
+			search:   "foo bar ",
+			msgs:     []tea.KeyMsg{{Type: tea.KeyCtrlW}, {Type: tea.KeyCtrlW}},
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel()
+			m.search = tt.search
+			for _, msg := range tt.msgs {
+				m.Update(msg)
+			}
+			if m.search != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, m.search)
+			}
+		})
+	}
+}
+
+func TestModel_UpdatePause(t *testing.T) {
+	m := newTestModel()
+	sleep := m.sleepCmd()
+
+	// Pausing releases the pending sleep.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	if !m.stopped {
+		t.Fatalf("Expected model to be paused")
+	}
+	released := make(chan tea.Msg)
+	go func() { released <- sleep() }()
+	select {
+	case msg := <-released:
+		if msg != nil {
+			t.Errorf("Expected no message, but got %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected sleep to be released")
+	}
+
+	// A tick of the cancelled sleep does not trigger a sample after unpausing.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	if _, cmd := m.Update(tickMsg{gen: m.sleepGen - 1}); cmd != nil {
+		if msg := cmd(); msg != nil {
+			t.Errorf("Expected stale tick to be ignored, but got %v", msg)
+		}
+	}
+}
+
+func TestModel_UpdateInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		key      tea.KeyType
+		expected time.Duration
+	}{
+		{5 * time.Second, tea.KeyCtrlUp, 10 * time.Second},
+		{5 * time.Second, tea.KeyCtrlDown, 2 * time.Second},
+		{3 * time.Second, tea.KeyCtrlUp, 5 * time.Second},
+		{3 * time.Second, tea.KeyCtrlDown, 2 * time.Second},
+		{time.Minute, tea.KeyCtrlUp, time.Minute},
+		{250 * time.Millisecond, tea.KeyCtrlDown, 250 * time.Millisecond},
+		{100 * time.Millisecond, tea.KeyCtrlUp, 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		m := newTestModel()
+		m.interval = tt.interval
+		m.sleepCmd()
+		gen := m.sleepGen
+		m.Update(tea.KeyMsg{Type: tt.key})
+		if m.interval != tt.expected {
+			t.Errorf("Expected %v, but got %v", tt.expected, m.interval)
+		}
+		if m.sleepGen == gen {
+			t.Errorf("Expected the pending sleep to be rescheduled")
+		}
+		m.cancelSleep()
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	bucket := metrics.NewObservation("latency_seconds_bucket", nil, metrics.ObservationHistogramBucket, time.Now(), 3)
+	bucket.Exemplar = &metrics.Exemplar{Labels: []metrics.Label{{Name: "trace_id", Value: "abc123"}}, Value: 1.9}
+	counter := metrics.NewObservation("requests_total", nil, metrics.ObservationCounter, time.Now(), 3)
+	counter.Created = time.Now().Add(-3*time.Hour - 2*time.Minute)
+	gauge := metrics.NewObservation("temperature", nil, metrics.ObservationGauge, time.Now(), 3)
+	gauge.Created = counter.Created
+	exported := metrics.NewObservation("temperature", nil, metrics.ObservationGauge, time.Now(), 3)
+	exported.TimeSource = metrics.TimeExporter
+
+	f := valueFormatter{humanize: true, decimals: 2}
+	tests := []struct {
+		o        metrics.Observation
+		expected string
+	}{
+		{bucket, "(exemplar: trace_id=abc123 value=1.9s)"},
+		{counter, "(age 3h 2m)"},
+		{gauge, ""},
+		{exported, "(exporter time)"},
+	}
+	for _, tt := range tests {
+		actual := annotations(tt.o, f, newStyles(nil, false))
+		if tt.expected == "" && actual != "" || !strings.Contains(actual, tt.expected) {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestRenderSeries_ExporterTime(t *testing.T) {
+	o := metrics.NewObservation("temperature", nil, metrics.ObservationGauge, time.Now(), 3)
+	o.TimeSource = metrics.TimeExporter
+	opts := seriesOptions{showHistory: true, formatter: valueFormatter{decimals: 2}, styles: newStyles(nil, false)}
+	if actual := renderSeries(o.Name, []metrics.Observation{o}, false, severityNone, opts); actual != " temperature 3 (exporter time)\n" {
+		t.Errorf("Expected the exporter time marked, but got %q", actual)
+	}
+	o.TimeSource = metrics.TimeScrape
+	if actual := renderSeries(o.Name, []metrics.Observation{o}, false, severityNone, opts); actual != " temperature 3\n" {
+		t.Errorf("Expected no mark, but got %q", actual)
+	}
+}
+
+func TestRenderSeries_RawValue(t *testing.T) {
+	o := metrics.NewObservation("heap_bytes", nil, metrics.ObservationGauge, time.Now(), 1283512977)
+	tests := []struct {
+		opts     seriesOptions
+		expected string
+	}{
+		{seriesOptions{}, " heap_bytes 1.2 GiB\n"},
+		{seriesOptions{showHistory: true}, " heap_bytes 1.2 GiB\n"},
+		{seriesOptions{expandHistory: true}, " heap_bytes 1.2 GiB (raw 1283512977)\n"},
+	}
+	for _, tt := range tests {
+		tt.opts.formatter, tt.opts.styles = valueFormatter{humanize: true, decimals: 1}, newStyles(nil, false)
+		if actual := renderSeries(o.Name, []metrics.Observation{o}, false, severityNone, tt.opts); actual != tt.expected {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected int64
+		err      bool
+	}{
+		{in: "64MiB", expected: 64 << 20},
+		{in: "512KiB", expected: 512 << 10},
+		{in: "1GiB", expected: 1 << 30},
+		{in: "1000", expected: 1000},
+		{in: "10B", expected: 10},
+		{in: "0", expected: 0},
+		{in: "-1MiB", err: true},
+		{in: "64MB", err: true},
+	}
+	for _, tt := range tests {
+		actual, err := parseByteSize(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("Unexpected error for %q: %v", tt.in, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("Expected %v, but got %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestModel_UpdateTabs(t *testing.T) {
+	m := newTestModel()
+	second, third := *m.targets[0], *m.targets[0]
+	m.targets = append(m.targets, &second, &third)
+	m.search = "foo"
+
+	steps := []struct {
+		key      tea.KeyType
+		expected int
+	}{
+		{tea.KeyTab, 1},
+		{tea.KeyTab, 2},
+		{tea.KeyTab, 0},
+		{tea.KeyShiftTab, 2},
+	}
+	for _, s := range steps {
+		m.Update(tea.KeyMsg{Type: s.key})
+		if m.current != s.expected {
+			t.Errorf("Expected target %d, but got %d", s.expected, m.current)
+		}
+		if m.search != "foo" {
+			t.Errorf("Expected search to be shared, but got %q", m.search)
+		}
+	}
+
+	// Errors are kept per target.
+	m.Update(sampledMsg{target: m.targets[1], error: fmt.Errorf("boom")})
+	if m.targets[1].err == nil || m.targets[0].err != nil {
+		t.Errorf("Expected error of target 1 only")
+	}
+}
+
+func TestModel_UpdateAutoExit(t *testing.T) {
+	m := newTestModel()
+	m.count = 2
+	m.stats = runStats{samples: 1}
+
+	if _, cmd := m.Update(sampledMsg{error: fmt.Errorf("boom")}); isQuit(cmd) {
+		t.Errorf("Expected failed sample not to count")
+	}
+	if _, cmd := m.Update(sampledMsg{fetched: true}); !isQuit(cmd) {
+		t.Errorf("Expected quit after %d samples", m.count)
+	}
+	if expected := "sampled 2 times, 1 errors"; m.stats.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, m.stats.String())
+	}
+
+	m = newTestModel()
+	if _, cmd := m.Update(deadlineMsg{}); !isQuit(cmd) {
+		t.Errorf("Expected quit at deadline")
+	}
+}
+
+// isQuit returns true, if the given command quits the program.
+func isQuit(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	_, ok := cmd().(tea.QuitMsg)
+	return ok
+}
+
+func TestModel_HeaderCountdown(t *testing.T) {
+	m := newTestModel()
+	m.sleepCmd()
+	if !strings.Contains(m.headerView(), " - next in 1h0m0s - ") {
+		t.Errorf("Expected the countdown in the header, but got %q", m.headerView())
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	if header := m.headerView(); !strings.Contains(header, " paused") || strings.Contains(header, "next in") {
+		t.Errorf("Expected the pause in the header, but got %q", header)
+	}
+}
+
+func TestModel_Manual(t *testing.T) {
+	m := newTestModel()
+	m.interval = 0
+	m.stopped = m.manual()
+	m.Init()
+	if m.sleepDone != nil {
+		t.Errorf("Expected no sleep")
+	}
+	if header := m.headerView(); !strings.Contains(header, " manual - ") || strings.Contains(header, "next in") {
+		t.Errorf("Expected manual refreshes in the header, but got %q", header)
+	}
+
+	// Neither pausing nor the interval keys start the schedule.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlUp})
+	if !m.stopped || m.interval != 0 || m.sleepDone != nil {
+		t.Errorf("Expected manual refreshes, but got %v", m.interval)
+	}
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlR}); cmd == nil {
+		t.Errorf("Expected a sample on refresh, but got none")
+	}
+}
+
+func TestModel_UpdateRetry(t *testing.T) {
+	m := newTestModel()
+	m.maxBackoff = time.Minute
+	tt := m.target()
+	for range backoffFailures {
+		m.Update(sampledMsg{target: tt, error: fmt.Errorf("boom")})
+	}
+	if tt.retryAt.IsZero() {
+		t.Fatalf("Expected a retry to be scheduled")
+	}
+	if !strings.Contains(m.headerView(), fmt.Sprintf("(failure %d)", backoffFailures)) {
+		t.Errorf("Expected the retry in the header, but got %q", m.headerView())
+	}
+
+	// Ticks skip the target until its retry.
+	if cmd := m.sampleCmd(false); cmd != nil {
+		t.Errorf("Expected no sample, but got one")
+	}
+	if cmd := m.sampleCmd(true); cmd == nil {
+		t.Errorf("Expected a forced sample, but got none")
+	}
+
+	// Superseded retries are ignored.
+	gen := tt.retryGen
+	m.Update(sampledMsg{target: tt, fetched: true})
+	if tt.failures != 0 || !tt.retryAt.IsZero() {
+		t.Errorf("Expected the backoff to be reset, but got %d failures", tt.failures)
+	}
+	if _, cmd := m.Update(retryMsg{target: tt, gen: gen}); cmd != nil {
+		t.Errorf("Expected the retry to be ignored, but got a command")
+	}
+	if _, cmd := m.Update(retryMsg{target: tt, gen: tt.retryGen}); cmd == nil {
+		t.Errorf("Expected a retry, but got none")
+	}
+}
+
+func TestModel_SampleCmd_Staggered(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "up 1\n")
+	}))
+	defer fast.Close()
+
+	// The delays are recorded rather than waited for.
+	var mux sync.Mutex
+	delays := make(map[time.Duration]int)
+	m := newTestModel()
+	m.wait = func(_ context.Context, d time.Duration) error {
+		mux.Lock()
+		defer mux.Unlock()
+		delays[d]++
+		return nil
+	}
+
+	// The slow target is sampled first, holding one of the two slots until
+	// it times out after the interval.
+	m.interval = 200 * time.Millisecond
+	m.scrapeSlots = scrapeSlots(2)
+	m.targets = nil
+	for _, endpoint := range []string{slow.URL, fast.URL, fast.URL, fast.URL} {
+		fetcher := metrics.NewHTTPFetcher(endpoint)
+		m.targets = append(m.targets, &target{source: source{fetcher: fetcher}, endpoint: endpoint, store: metrics.NewStore(3, fetcher)})
+	}
+	batch, ok := m.sampleCmd(false)().(tea.BatchMsg)
+	if !ok || len(batch) != len(m.targets) {
+		t.Fatalf("Expected a sample per target, but got %v", batch)
+	}
+	msgs := make(chan sampledMsg, len(batch))
+	for _, cmd := range batch {
+		go func() { msgs <- cmd().(sampledMsg) }()
+	}
+	for range batch {
+		msg := <-msgs
+		i := slices.Index(m.targets, msg.target)
+		if i == 0 {
+			if msg.error == nil || !strings.Contains(msg.error.Error(), "timed out") {
+				t.Errorf("Expected the slow target to time out, but got %v", msg.error)
+			}
+			continue
+		}
+		if msg.error != nil || !msg.fetched {
+			t.Errorf("Expected target %d to be sampled, but got %v", i, msg.error)
+		}
+	}
+	expected := map[time.Duration]int{50 * time.Millisecond: 1, 100 * time.Millisecond: 1, 150 * time.Millisecond: 1}
+	if !maps.Equal(delays, expected) {
+		t.Errorf("Expected %v, but got %v", expected, delays)
+	}
+
+	// Refreshes are not staggered.
+	clear(delays)
+	m.scrapeSlots = nil
+	m.targets = m.targets[1:]
+	for _, cmd := range m.sampleCmd(true)().(tea.BatchMsg) {
+		cmd()
+	}
+	if len(delays) != 0 {
+		t.Errorf("Expected an immediate refresh, but got %v", delays)
+	}
+}
+
+func TestModel_UpdateCancel(t *testing.T) {
+	m := newTestModel()
+	ctx := m.sampleContext()
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	if ctx.Err() == nil {
+		t.Errorf("Expected pausing to cancel the samples in flight")
+	}
+
+	// Cancelled samples are neither errors nor samples.
+	m.Update(sampledMsg{target: m.target(), error: ctx.Err()})
+	if m.target().err != nil || m.stats != (runStats{}) {
+		t.Errorf("Expected the cancelled sample to be ignored, but got %v (%v)", m.target().err, m.stats)
+	}
+
+	ctx = m.sampleContext()
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC}); !isQuit(cmd) || ctx.Err() == nil {
+		t.Errorf("Expected quitting to cancel the samples in flight")
+	}
+}
+
+func TestModel_NewSeries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:      []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		highlightNew: true,
+	}
+	for _, content := range []string{"# TYPE a gauge\na 1\n", "# TYPE a gauge\na 1\n# TYPE b gauge\nb 1\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	view := m.renderMetrics(lipgloss.NewStyle())
+	if m.newSeries != 1 || !strings.Contains(view, "b 1 new") || strings.Contains(view, "a 1 new") {
+		t.Errorf("Expected b to be new, but got %d new series in %q", m.newSeries, view)
+	}
+
+	m.highlightNew = false
+	if view := m.renderMetrics(lipgloss.NewStyle()); m.newSeries != 0 || strings.Contains(view, "new") {
+		t.Errorf("Expected no new series, but got %d in %q", m.newSeries, view)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	now := time.Now()
+	obs := func(v float64, stale bool) metrics.Observation {
+		o := metrics.NewObservation("a", nil, metrics.ObservationGauge, now, v)
+		o.Stale = stale
+		return o
+	}
+	tests := []struct {
+		name     string
+		series   []metrics.Observation
+		expected bool
+	}{
+		{"changed", []metrics.Observation{obs(2, false), obs(1, false)}, true},
+		{"unchanged", []metrics.Observation{obs(1, false), obs(1, false)}, false},
+		{"single", []metrics.Observation{obs(1, false)}, false},
+		{"stale", []metrics.Observation{obs(1, true), obs(2, false)}, false},
+		{"reappeared", []metrics.Observation{obs(3, false), obs(2, true)}, true},
+		{"no estimate", []metrics.Observation{obs(math.NaN(), false), obs(2, false)}, false},
+		{"infinite", []metrics.Observation{obs(math.Inf(1), false), obs(2, false)}, false},
+		{"previously infinite", []metrics.Observation{obs(2, false), obs(math.Inf(1), false)}, false},
+	}
+	// With a hold, changes of earlier samples count (see heldIndex).
+	held := []metrics.Observation{obs(1, false), obs(1, false), obs(2, false), obs(1, false)}
+	if changed(held, 1) || !changed(held, 2) || !changed(held, 3) {
+		t.Errorf("Expected the change held for 2 and 3 samples")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := changed(tt.series, 1); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestModel_UpdateHighlight(t *testing.T) {
+	m := newTestModel()
+	m.highlightChanges = true
+	m.Update(sampledMsg{target: m.target(), fetched: true})
+	if !time.Now().Before(m.highlightUntil) {
+		t.Errorf("Expected the changes to be highlighted")
+	}
+	m.highlightUntil = time.Now().Add(-time.Millisecond)
+	m.Update(clockMsg(time.Now()))
+	if !m.highlightUntil.IsZero() {
+		t.Errorf("Expected the highlight to fade, but got %v", m.highlightUntil)
+	}
+}
+
+func TestRenderSeries_Glyphs(t *testing.T) {
+	now := time.Now()
+	obs := func(v float64) metrics.Observation {
+		return metrics.NewObservation("a", nil, metrics.ObservationGauge, now, v)
+	}
+	tests := []struct {
+		name     string
+		series   []metrics.Observation
+		ascii    bool
+		expected string
+	}{
+		{"up", []metrics.Observation{obs(2), obs(1)}, false, " a 2 ⬆\n"},
+		{"ascii up", []metrics.Observation{obs(2), obs(1)}, true, " a 2 ^\n"},
+		{"ascii down", []metrics.Observation{obs(1), obs(2)}, true, " a 1 v\n"},
+		{"ascii no estimate", []metrics.Observation{obs(math.NaN())}, true, " a -\n"},
+		{"still no estimate", []metrics.Observation{obs(math.NaN()), obs(math.NaN())}, false, " a –\n"},
+		{"estimate lost", []metrics.Observation{obs(math.NaN()), obs(2)}, false, " a –\n"},
+		{"estimate regained", []metrics.Observation{obs(2), obs(math.NaN())}, false, " a 2\n"},
+		{"infinite", []metrics.Observation{obs(math.Inf(1)), obs(2)}, false, " a ∞\n"},
+		{"previously infinite", []metrics.Observation{obs(2), obs(math.Inf(1))}, false, " a 2\n"},
+		{"ascii negative infinite", []metrics.Observation{obs(math.Inf(-1))}, true, " a -Inf\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := renderSeries(tt.series[0].Name, tt.series, false, severityNone, seriesOptions{showDerived: true, hold: 1, styles: newStyles(nil, tt.ascii)})
+			if actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderSeries_Hold(t *testing.T) {
+	now := time.Now()
+	var series []metrics.Observation
+	for _, v := range []float64{5, 5, 3, 1} {
+		series = append(series, metrics.NewObservation("a", nil, metrics.ObservationGauge, now, v))
+	}
+	tests := []struct {
+		hold     int
+		expected string
+	}{
+		{1, " a 5\n"},
+		{2, " a 5 ⬆ (+2)\n"},
+		{3, " a 5 ⬆ (+4)\n"},
+		{10, " a 5 ⬆ (+4)\n"},
+	}
+	// A value going back is indicated by its latest change.
+	reverted := []metrics.Observation{series[1], series[2], series[1]}
+	if actual := renderSeries("a", reverted, false, severityNone, seriesOptions{showHistory: true, showDerived: true, hold: 3, styles: newStyles(nil, false)}); actual != " a 5 ⬆ (+2)\n" {
+		t.Errorf("Expected %q, but got %q", " a 5 ⬆ (+2)\n", actual)
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.hold), func(t *testing.T) {
+			actual := renderSeries(series[0].Name, series, false, severityNone, seriesOptions{showHistory: true, showDerived: true, hold: tt.hold, styles: newStyles(nil, false)})
+			if actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	name := `http_requests_total {code="200", handler="/api/v1/query_range", pod="api-7d9f8-x2x4q"}`
+	tests := []struct {
+		width    int
+		expected string
+		ok       bool
+	}{
+		{200, name, true},
+		{60, `http_requests_total {code="200", handle…d="api-7d9f8-x2x4q"}`, true},
+		{11, `http_…x4q"}`, true},
+		{2, name, false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.width), func(t *testing.T) {
+			actual, ok := truncateMiddle(name, tt.width, "…")
+			if actual != tt.expected || ok != tt.ok {
+				t.Errorf("Expected %q (%v), but got %q (%v)", tt.expected, tt.ok, actual, ok)
+			}
+			if ok && lipgloss.Width(actual) > tt.width {
+				t.Errorf("Expected at most %d cells, but got %d", tt.width, lipgloss.Width(actual))
+			}
+		})
+	}
+}
+
+func TestRenderSeries_Truncated(t *testing.T) {
+	now := time.Now()
+	labels := []metrics.Label{{Name: "handler", Value: "/api/v1/query_range"}, {Name: "pod", Value: "api-7d9f8-x2x4q"}}
+	obs := func(v float64) metrics.Observation {
+		return metrics.NewObservation("http_requests_total", labels, metrics.ObservationCounter, now, v)
+	}
+	series := []metrics.Observation{obs(1027), obs(1000)}
+	actual := renderSeries(series[0].Name, series, false, severityNone, seriesOptions{showDerived: true, hold: 1, styles: newStyles(nil, false), maxWidthStyle: lipgloss.NewStyle().MaxWidth(50)})
+	expected := " http_requests_total {…d=\"api-7d9f8-x2x4q\"} 1027 ⬆\n"
+	if actual != expected {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestModel_UpdateBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets: []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:  newStyles(nil, false),
+		keys:    newKeymap(),
+	}
+	sample := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	sample("# TYPE a gauge\na 5\n")
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlB})
+	sample("# TYPE a gauge\na 3\n")
+	sample("# TYPE a gauge\na 4\n# TYPE b gauge\nb 2\n")
+	view := m.renderMetrics(lipgloss.NewStyle())
+	for _, expected := range []string{" a 4 ⬆ (-1 since baseline)\n", " b 2 (+2 since baseline)\n"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("Expected %q in %q", expected, view)
+		}
+	}
+
+	// Pressing again resets the baseline.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlB})
+	if view := m.renderMetrics(lipgloss.NewStyle()); !strings.Contains(view, " a 4 ⬆ (+0 since baseline)\n") {
+		t.Errorf("Expected the baseline to be reset, but got %q", view)
+	}
+}
+
+func TestModel_Counts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE a gauge\na{x=\"1\"} 1\na{x=\"2\"} 2\n# TYPE b summary\nb_sum 1\nb_count 2\n# TYPE c gauge\nc 1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, true),
+		keys:     newKeymap(),
+		search:   "b_",
+		viewport: viewport.New(80, 1),
+	}
+	m.target().store.Keep = keepFlag{regexp.MustCompile("^[ab]$")}.keep()
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+	// The store adds three synthetic series (see metrics.SeriesUp).
+	if m.matched != 2 || m.total != 7 || m.families != 1 {
+		t.Errorf("Expected 2 of 7 series in 1 family, but got %d of %d in %d", m.matched, m.total, m.families)
+	}
+	if expected := "line 1-1 of 2"; m.lines() != expected {
+		t.Errorf("Expected %q, but got %q", expected, m.lines())
+	}
+	if footer := m.footerView(); !strings.Contains(footer, " keeping 2 of 3 families |") {
+		t.Errorf("Expected the kept families in the footer, but got %q", footer)
+	}
+}
+
+func TestModel_UpdateJump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE a gauge\na{x=\"1\"} 1\na{x=\"2\"} 2\n# TYPE b gauge\nb{x=\"1\"} 1\nb{x=\"2\"} 2\n# TYPE c gauge\nc{x=\"1\"} 1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(80, 1),
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+
+	// Rows: a{x="1"}, a{x="2"}, b{x="1"}, b{x="2"}, c{x="1"}, and the
+	// synthetic promtui_* series.
+	keys := func(s string) []tea.KeyMsg {
+		var msgs []tea.KeyMsg
+		for _, r := range s {
+			switch r {
+			case '\n':
+				msgs = append(msgs, tea.KeyMsg{Type: tea.KeyEnter})
+			case '\x7f':
+				msgs = append(msgs, tea.KeyMsg{Type: tea.KeyBackspace})
+			default:
+				msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			}
+		}
+		return msgs
+	}
+	tests := []struct {
+		keys          string
+		offset, match int
+	}{
+		{"]", 2, 0},
+		{"]", 4, 0},
+		{"[", 2, 0},
+		{"[", 0, 0},
+		{"]]", 4, 0},
+		{"[[[", 0, 0},
+		// Searching filters the rows to a{x="2"} and b{x="2"}.
+		{"x=\"2\"\n", 0, 0},
+		{"n", 0, 1},
+		{"n", 1, 2},
+		{"n", 0, 1},
+		{"N", 1, 2},
+		{"N", 0, 1},
+		// Typing extends the search again.
+		{"\x7f", 0, 0},
+	}
+	for i, tt := range tests {
+		for _, msg := range keys(tt.keys) {
+			m.Update(msg)
+		}
+		if m.viewport.YOffset != tt.offset || m.match != tt.match {
+			t.Errorf("%d: Expected offset %d and match %d, but got %d and %d", i, tt.offset, tt.match, m.viewport.YOffset, m.match)
+		}
+	}
+	if m.browsing || m.search != `x="2` {
+		t.Errorf("Expected to extend the search, but got %q", m.search)
+	}
+}
+
+func TestModel_UpdateSearchDebounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := os.WriteFile(path, []byte("# TYPE ab gauge\nab 1\n# TYPE ac gauge\nac 2\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(80, 10),
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rows := func() []string {
+		var names []string
+		for _, r := range m.rows {
+			if !strings.HasPrefix(r.name, "promtui_") {
+				names = append(names, r.name)
+			}
+		}
+		return names
+	}
+
+	// The first key renders right away.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	if actual := rows(); len(actual) != 2 || m.searchPending {
+		t.Errorf("Expected 2 rows rendered, but got %v", actual)
+	}
+
+	// Keys following within searchDebounce are rendered later, but show in
+	// the header right away.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("b")})
+	if actual := rows(); len(actual) != 2 || !m.searchPending {
+		t.Errorf("Expected the render to be pending, but got %v", actual)
+	}
+	if !strings.Contains(m.headerView(), "Search: ab") {
+		t.Errorf("Expected the search in the header, but got %q", m.headerView())
+	}
+
+	// Renders of superseded edits wait for searchDebounce to pass.
+	m.Update(searchMsg{gen: m.searchGen - 1})
+	if !m.searchPending {
+		t.Errorf("Expected the render to be pending")
+	}
+
+	// The latest edit is rendered.
+	m.Update(searchMsg{gen: m.searchGen})
+	if actual := rows(); len(actual) != 1 || actual[0] != "ab" || m.searchPending {
+		t.Errorf("Expected %v, but got %v", []string{"ab"}, actual)
+	}
+}
+
+func TestAnchorRow(t *testing.T) {
+	rows := func(names ...string) []row {
+		var rs []row
+		for _, name := range names {
+			rs = append(rs, row{name: name})
+		}
+		return rs
+	}
+	prev := rows("a", "b", "c", "d", "e")
+	tests := []struct {
+		name     string
+		rows     []row
+		expected int
+		ok       bool
+	}{
+		{"unchanged", rows("a", "b", "c", "d", "e"), 2, true},
+		{"appeared above", rows("0", "a", "b", "c", "d", "e"), 3, true},
+		{"disappeared above", rows("a", "c", "d", "e"), 1, true},
+		{"vanished", rows("a", "b", "d", "e"), 2, true},
+		{"vanished with the following", rows("a", "b"), 1, true},
+		{"all vanished", rows("x"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, ok := anchorRow(prev, 2, tt.rows)
+			if actual != tt.expected || ok != tt.ok {
+				t.Errorf("Expected %v (%v), but got %v (%v)", tt.expected, tt.ok, actual, ok)
+			}
+		})
+	}
+}
+
+func TestModel_MetricsViewAnchor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		viewport: viewport.New(80, 2),
+	}
+	sample := func(names ...string) {
+		var sb strings.Builder
+		for _, name := range names {
+			sb.WriteString("# TYPE " + name + " gauge\n" + name + " 1\n")
+		}
+		if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		m.metricsView()
+	}
+	top := func() string {
+		return m.rows[m.viewport.YOffset].name
+	}
+
+	sample("a", "c", "d", "e")
+	m.viewport.SetYOffset(1)
+	sample("a", "b", "c", "d", "e")
+	if top() != "c" {
+		t.Errorf("Expected c on top, but got %s", top())
+	}
+	sample("b", "d", "e")
+	if top() != "d" {
+		t.Errorf("Expected d on top, but got %s", top())
+	}
+	m.search = "e"
+	m.metricsView()
+	if m.viewport.YOffset != 0 {
+		t.Errorf("Expected the filtered rows from the top, but got offset %d", m.viewport.YOffset)
+	}
+}
+
+func TestChangedFrom(t *testing.T) {
+	tests := []struct {
+		cur, prev string
+		expected  int
+	}{
+		{"1,283,512,977", "1,283,441,023", 6},
+		{"1.50 MiB", "1.40 MiB", 2},
+		{"42", "42", 2},
+		{"7", "8", 0},
+		{"1,000", "999", -1},
+		{"2 µs", "3 µs", 0},
+		{"5 µs", "5 ms", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cur+" "+tt.prev, func(t *testing.T) {
+			if actual := changedFrom(tt.cur, tt.prev); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpandedValues(t *testing.T) {
+	var obs []metrics.Observation
+	for _, v := range []float64{1520, 1480, math.NaN(), 1431} {
+		obs = append(obs, metrics.Observation{Name: "requests_total", Kind: metrics.ObservationCounter, Value: v})
+	}
+	tests := []struct {
+		width    int
+		expected string
+	}{
+		{math.MaxInt, "1520 <- 1480 <- - <- 1431"},
+		{25, "1520 <- 1480 <- - <- 1431"},
+		{24, "1520 <- 1480 <- - <- ..."},
+		{15, "1520 <- ..."},
+		{1, "1520 <- ..."},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.width), func(t *testing.T) {
+			if actual := expandedValues(obs, valueFormatter{decimals: 2}, asciiGlyphs, tt.width); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+
+	// Values are followed by their timestamp in the given format.
+	obs[0].Time = time.Date(2024, 5, 1, 14, 2, 31, 0, time.Local)
+	expected := "1520 (14:02) <- ..."
+	if actual := expandedValues(obs, valueFormatter{decimals: 2, timeFormat: "15:04"}, asciiGlyphs, 20); actual != expected {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+
+	// Timestamps exposed by the exporter are marked.
+	obs[0].TimeSource = metrics.TimeExporter
+	expected = "1520 (14:02, exporter time) <- ..."
+	if actual := expandedValues(obs, valueFormatter{decimals: 2, timeFormat: "15:04"}, asciiGlyphs, 40); actual != expected {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+}
+
+func TestDataAge(t *testing.T) {
+	scraped := time.Date(2024, 5, 1, 14, 2, 31, 0, time.Local)
+	tests := []struct {
+		scraped  time.Time
+		took     time.Duration
+		now      time.Time
+		expected string
+	}{
+		{time.Time{}, 0, scraped, ""},
+		{scraped, 0, scraped.Add(4500 * time.Millisecond), " - last: 14:02:31 (4s ago)"},
+		{scraped, 0, scraped.Add(-time.Second), " - last: 14:02:31 (0s ago)"},
+		{scraped, 120400 * time.Microsecond, scraped.Add(4500 * time.Millisecond), " - last: 14:02:31 (4s ago, took 120ms)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if actual := dataAge(tt.scraped, tt.took, tt.now); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestModel_FooterError(t *testing.T) {
+	fetcher := metrics.NewFileFetcher(filepath.Join(t.TempDir(), "metrics.prom"))
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher), err: errors.New("\x1b[2Jboom\nagain")}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+	}
+	if footer := m.footerView(); strings.ContainsAny(footer, "\x1b\n") || !strings.Contains(footer, `[2Jboom\nagain`) {
+		t.Errorf("Expected the error printable, but got %q", footer)
+	}
+}
+
+func TestModel_FamilyHelp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# HELP go_goroutines Number of goroutines\\nthat currently exist.\n# TYPE go_goroutines gauge\ngo_goroutines 8\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("goroutines")})
+	m.metricsView()
+	expected := "go_goroutines: Number of goroutines that currently exist."
+	if strings.Contains(m.footerView(), expected) {
+		t.Errorf("Expected the help only while browsing, but got %q", m.footerView())
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !strings.Contains(m.footerView(), expected) {
+		t.Errorf("Expected %q in the footer, but got %q", expected, m.footerView())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// span is a range of bytes of a string ([start, end)).
+type span struct {
+	start, end int
+}
+
+// matchSpans returns the sorted and non-overlapping spans of the given name
+// (a flat metric name) matched by the search. A search is either a selector
+// (see metrics.ParseSelector), whose metric name and positive label matchers
+// are matched, or space-separated terms, each matched case-insensitively
+// wherever it occurs.
+func matchSpans(name, search string) []span {
+	var spans []span
+	if strings.Contains(search, "{") {
+		sel, err := metrics.ParseSelector(search)
+		if err != nil {
+			return nil
+		}
+		if sel.Metric != "" && strings.HasPrefix(name, sel.Metric) {
+			spans = append(spans, span{0, len(sel.Metric)})
+		}
+		for _, m := range sel.Matchers {
+			if m.Op == "=" || m.Op == "=~" {
+				if sp, ok := labelSpan(name, m.Name); ok {
+					spans = append(spans, sp)
+				}
+			}
+		}
+		return mergeSpans(spans)
+	}
+
+	lower := strings.ToLower(name)
+	if len(lower) != len(name) {
+		// The offsets in lower would not apply to name.
+		return nil
+	}
+	for _, term := range strings.Fields(strings.ToLower(search)) {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], term)
+			if j < 0 {
+				break
+			}
+			spans = append(spans, span{i + j, i + j + len(term)})
+			i += j + len(term)
+		}
+	}
+	return mergeSpans(spans)
+}
+
+// labelSpan returns the span of the label with the given name (e.g.
+// `code="200"` or `"service.name"="api"`) in the given flat metric name.
+func labelSpan(name, label string) (span, bool) {
+	_, labels, ok := strings.Cut(name, " {")
+	if !ok {
+		return span{}, false
+	}
+	offset := len(name) - len(labels)
+	label = metrics.QuoteName(label)
+	for i := 0; i < len(labels); {
+		j := strings.Index(labels[i:], label+`="`)
+		if j < 0 {
+			return span{}, false
+		}
+		start := i + j
+		// Skip matches of label name suffixes (e.g. "code" in "status_code").
+		if start > 0 && !strings.HasSuffix(labels[:start], ", ") {
+			i = start + len(label)
+			continue
+		}
+		end := start + len(label) + 2
+		for end < len(labels) && labels[end] != '"' {
+			if labels[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		return span{offset + start, offset + min(end+1, len(labels))}, true
+	}
+	return span{}, false
+}
+
+// mergeSpans sorts the given spans and merges overlapping ones.
+func mergeSpans(spans []span) []span {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var merged []span
+	for _, sp := range spans {
+		if n := len(merged); n > 0 && sp.start <= merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, sp.end)
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	return merged
+}
+
+// renderMatches renders s with the given style, except for the given spans,
+// which are rendered with the match style on top. Each part is rendered on
+// its own, so that the styles of the spans do not end the given style.
+func renderMatches(s string, spans []span, style, match lipgloss.Style) string {
+	if len(spans) == 0 {
+		return style.Render(s)
+	}
+	var sb strings.Builder
+	i := 0
+	for _, sp := range spans {
+		if sp.start > i {
+			sb.WriteString(style.Render(s[i:sp.start]))
+		}
+		sb.WriteString(match.Inherit(style).Render(s[sp.start:sp.end]))
+		i = sp.end
+	}
+	if i < len(s) {
+		sb.WriteString(style.Render(s[i:]))
+	}
+	return sb.String()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchSpans(t *testing.T) {
+	tests := []struct {
+		name     string
+		search   string
+		expected []span
+	}{
+		{`http_requests_total`, "requests", []span{{5, 13}}},
+		{`http_requests_total`, "REQ", []span{{5, 8}}},
+		{`http_requests_total`, "t", []span{{1, 3}, {11, 12}, {14, 15}, {16, 17}}},
+		{`http_requests_total`, "http total", []span{{0, 4}, {14, 19}}},
+		{`http_requests_total`, "requests req", []span{{5, 13}}},
+		{`http_requests_total`, "missing", nil},
+		{`http_requests_total {code="200", method="get"}`, `http_requests_total{method="get"}`, []span{{0, 19}, {33, 45}}},
+		{`http_requests_total {code="200", method="get"}`, `{code=~"2.."}`, []span{{21, 31}}},
+		{`http_requests_total {code="200", method="get"}`, `{code!="500"}`, nil},
+		{`http_requests_total {status_code="200", code="500"}`, `{code="500"}`, []span{{40, 50}}},
+		{`http_requests_total {code="200"}`, `{code="200"`, nil},
+		{`my.requests {"service.name"="api"}`, `{"my.requests", "service.name"="api"}`, []span{{0, 11}, {13, 33}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			if actual := matchSpans(tt.name, tt.search); !slices.Equal(actual, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// targetStats describes the scrapes of a target, as shown by the targets
+// overview (see targetsView) and written by -output json.
+type targetStats struct {
+	Endpoint string `json:"endpoint"`
+	Up       bool   `json:"up"`
+
+	// LastScrape is the time of the latest successful scrape (nil, if there
+	// was none).
+	LastScrape *time.Time `json:"last_scrape"`
+
+	// Duration is the duration of the latest scrape in seconds, and Samples
+	// and ResponseSize the samples and bytes of the latest successful one.
+	Duration     float64 `json:"scrape_duration_seconds"`
+	Samples      int     `json:"samples"`
+	ResponseSize int64   `json:"response_bytes"`
+
+	Failures int    `json:"consecutive_failures"`
+	Error    string `json:"error,omitempty"`
+}
+
+// stats returns the scrape statistics of the target, taken from the
+// synthetic series of its store (see metrics.SeriesUp).
+func (t *target) stats() targetStats {
+	s := targetStats{Endpoint: t.name(), Failures: t.failures, ResponseSize: t.store.ResponseSize()}
+	if scraped := t.store.LastScrape(); !scraped.IsZero() {
+		s.LastScrape = &scraped
+	}
+	if t.err != nil {
+		s.Error = t.err.Error()
+	}
+	dump, _ := t.store.Dump("promtui_")
+	for _, series := range dump {
+		switch o := series[0]; o.Name {
+		case metrics.SeriesUp:
+			s.Up = o.Value == 1
+		case metrics.SeriesScrapeDuration:
+			s.Duration = o.Value
+		case metrics.SeriesScrapeSamples:
+			// Failed scrapes have no samples, so that of the latest
+			// successful one is the latest one present.
+			for _, o := range series {
+				if !o.Stale {
+					s.Samples = int(o.Value)
+					break
+				}
+			}
+		}
+	}
+	return s
+}
+
+// writeTargetStats writes the scrape statistics of the given targets to w as
+// a JSON array (see targetStats).
+func writeTargetStats(targets []*target, w io.Writer) error {
+	stats := make([]targetStats, 0, len(targets))
+	for _, t := range targets {
+		stats = append(stats, t.stats())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// updateTargetsView handles the keys of the targets overview: up and down
+// select a target, ENTER shows its metrics, and the targets key or ESC close
+// the overview.
+func (m *model) updateTargetsView(msg tea.KeyMsg) {
+	switch {
+	case key.Matches(msg, m.keys.up):
+		m.targetCursor = max(0, m.targetCursor-1)
+	case key.Matches(msg, m.keys.down):
+		m.targetCursor = min(len(m.targets)-1, m.targetCursor+1)
+	case key.Matches(msg, m.keys.browse):
+		// Targets may have been removed from the targets file meanwhile.
+		m.current = min(m.targetCursor, len(m.targets)-1)
+		m.showTargets = false
+		m.metricsView()
+	case key.Matches(msg, m.keys.targets, m.keys.cancel):
+		m.showTargets = false
+	}
+}
+
+// targetsView renders a row per target (e.g. "> up  api  14:02:31 (4s ago)
+// 120ms  1,234 samples  56 KiB") with the selected one marked (see
+// targetCursor) to fill the given size.
+func (m *model) targetsView(width, height int) string {
+	maxWidthStyle := lipgloss.NewStyle().MaxWidth(width)
+	now := time.Now()
+	nameWidth := 0
+	for _, t := range m.targets {
+		nameWidth = max(nameWidth, len(t.name()))
+	}
+	lines := make([]string, 0, height)
+	lines = append(lines, maxWidthStyle.Render(m.styles.muted.Render(fmt.Sprintf("   %-5s %-*s  %-22s %9s %15s %11s  %s",
+		"state", nameWidth, "endpoint", "last scrape", "duration", "samples", "size", "failures"))))
+	for i, t := range m.targets {
+		s := t.stats()
+		marker := " "
+		if i == m.targetCursor {
+			marker = ">"
+		}
+		state, style := "up", lipgloss.NewStyle()
+		switch {
+		case t.static != "":
+			state = "once"
+		case !s.Up:
+			state, style = "down", lipgloss.NewStyle().Foreground(m.styles.error.GetForeground())
+		}
+		last := "never"
+		if s.LastScrape != nil {
+			last = s.LastScrape.Local().Format(time.TimeOnly) + " (" + max(0, now.Sub(*s.LastScrape)).Truncate(time.Second).String() + " ago)"
+		}
+		failures := ""
+		if s.Failures > 0 {
+			failures = fmt.Sprintf("%d", s.Failures)
+			if !t.retryAt.IsZero() {
+				failures += ", retrying in " + max(0, t.retryAt.Sub(now)).Round(time.Second).String()
+			}
+		}
+		line := fmt.Sprintf(" %s %s %-*s  %-22s %9s %15s %11s  %s", marker, style.Render(fmt.Sprintf("%-5s", state)), nameWidth, t.name(), last,
+			m.formatter.seconds(s.Duration), groupDigits(fmt.Sprint(s.Samples)), m.formatter.bytes(float64(s.ResponseSize)), failures)
+		lines = append(lines, maxWidthStyle.Render(line))
+	}
+	lines = append(lines, "", m.styles.muted.Render(" up/down to select, enter to show its metrics, "+m.keys.targets.Help().Key+" or esc to close"))
+	lines = lines[:min(len(lines), height)]
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestTargetsOverview(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "a 1\nb 2\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m := &model{styles: newStyles(nil, false), keys: newKeymap(), viewport: viewport.New(160, 10)}
+	for _, p := range []string{path, filepath.Join(t.TempDir(), "missing.prom")} {
+		fetcher := metrics.NewFileFetcher(p)
+		tg := &target{source: source{fetcher: fetcher}, endpoint: p, store: metrics.NewStore(3, fetcher)}
+		_, tg.err = tg.store.Sample(context.Background())
+		if tg.err != nil {
+			tg.failures = 2
+		}
+		m.targets = append(m.targets, tg)
+	}
+
+	var buf bytes.Buffer
+	if err := writeTargetStats(m.targets, &buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var stats []targetStats
+	if err := json.Unmarshal(buf.Bytes(), &stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected %v, but got %v", 2, len(stats))
+	}
+	if s := stats[0]; !s.Up || s.LastScrape == nil || s.Samples != 2 || s.ResponseSize != int64(len(content)) || s.Failures != 0 || s.Error != "" {
+		t.Errorf("Unexpected statistics of the target up %+v", s)
+	}
+	if s := stats[1]; s.Up || s.LastScrape != nil || s.Failures != 2 || s.Error == "" {
+		t.Errorf("Unexpected statistics of the target down %+v", s)
+	}
+
+	// The overview is opened while browsing, and ENTER shows the metrics of
+	// the selected target.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	if m.showTargets || m.search != "t" {
+		t.Fatalf("Expected t to search, but got %q", m.search)
+	}
+	m.search = ""
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	if !m.showTargets {
+		t.Fatalf("Expected the targets overview")
+	}
+	view := m.targetsView(160, 10)
+	lines := strings.Split(view, "\n")
+	if !strings.HasPrefix(lines[1], " > up ") || !strings.HasPrefix(lines[2], "   down ") || !strings.Contains(lines[2], "never") {
+		t.Errorf("Unexpected overview %q", view)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.showTargets || m.current != 1 {
+		t.Errorf("Expected the second target shown, but got %d", m.current)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/maruel/natural"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// pivotTable holds series pivoted by a label: a row per series without the
+// label (i.e. per metric and the other labels), and a column per value of the
+// label.
+type pivotTable struct {
+	columns []string
+	rows    []pivotRow
+}
+
+// pivotRow is a row of a pivotTable, holding the latest observation of each
+// column the series has a value in.
+type pivotRow struct {
+	name   string
+	values map[string]metrics.Observation
+}
+
+// pivot pivots the given latest observations (see latest) by the given label.
+// Series without the label are left out. Rows and columns are naturally
+// sorted (e.g. 200, 404, 500).
+func pivot(obs map[string]metrics.Observation, label string) pivotTable {
+	var t pivotTable
+	rows := make(map[string]*pivotRow)
+	columns := make(map[string]bool)
+	for _, o := range obs {
+		i := slices.IndexFunc(o.Labels, func(l metrics.Label) bool { return l.Name == label })
+		if i < 0 {
+			continue
+		}
+		column := o.Labels[i].Value
+		name := metrics.FlatName(o.Metric, slices.Delete(slices.Clone(o.Labels), i, i+1))
+		r, ok := rows[name]
+		if !ok {
+			r = &pivotRow{name: name, values: make(map[string]metrics.Observation)}
+			rows[name] = r
+		}
+		r.values[column] = o
+		columns[column] = true
+	}
+	for column := range columns {
+		t.columns = append(t.columns, column)
+	}
+	sort.Sort(natural.StringSlice(t.columns))
+	for _, r := range rows {
+		t.rows = append(t.rows, *r)
+	}
+	sort.Slice(t.rows, func(i, j int) bool { return natural.Less(t.rows[i].name, t.rows[j].name) })
+	return t
+}
+
+// renderPivot renders the given table pivoted by the given label: a header
+// line naming the columns, followed by a line per row with its values
+// right-aligned in the columns. Missing values are shown as a dash.
+func renderPivot(t pivotTable, label string, f valueFormatter, st styles, maxWidthStyle lipgloss.Style) string {
+	if len(t.rows) == 0 {
+		return maxWidthStyle.Render(st.muted.Render(fmt.Sprintf(" no series with the label %q", label))) + "\n"
+	}
+	// The columns are label values of the endpoint.
+	columns := make([]string, len(t.columns))
+	cells := make([][]string, len(t.rows))
+	widths := make([]int, len(t.columns))
+	for j, column := range t.columns {
+		columns[j] = printable(column)
+		widths[j] = lipgloss.Width(columns[j])
+	}
+	nameWidth := lipgloss.Width(label) + 1
+	for i, r := range t.rows {
+		nameWidth = max(nameWidth, lipgloss.Width(r.name))
+		cells[i] = make([]string, len(t.columns))
+		for j, column := range t.columns {
+			cell := st.dash
+			if o, ok := r.values[column]; ok {
+				if v, isSpecial := special(o.Value, st.glyphs); isSpecial {
+					cell = v
+				} else {
+					cell = f.value(o, o.Value)
+				}
+			}
+			cells[i][j] = cell
+			widths[j] = max(widths[j], lipgloss.Width(cell))
+		}
+	}
+
+	var sb strings.Builder
+	header := " " + padRight(label+":", nameWidth)
+	for j, column := range columns {
+		header += "  " + padLeft(column, widths[j])
+	}
+	sb.WriteString(maxWidthStyle.Render(st.changed.Render(header)) + "\n")
+	for i, r := range t.rows {
+		line := " " + padRight(r.name, nameWidth)
+		for j := range t.columns {
+			line += "  " + padLeft(cells[i][j], widths[j])
+		}
+		sb.WriteString(maxWidthStyle.Render(line) + "\n")
+	}
+	return sb.String()
+}
+
+// padLeft pads the given text with spaces on the left to the given width.
+func padLeft(s string, width int) string {
+	return strings.Repeat(" ", max(0, width-lipgloss.Width(s))) + s
+}
+
+// padRight pads the given text with spaces on the right to the given width.
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(0, width-lipgloss.Width(s)))
+}
+
+// pivotView renders the series of the current target matching the search
+// pivoted by the label of pivot (see renderPivot).
+func (m *model) pivotView(maxWidthStyle lipgloss.Style) string {
+	dump, err := m.target().store.Dump(m.search)
+	dump, m.hidden = m.filter.apply(dump, m.search)
+	m.countSeries(dump)
+	m.rows = nil
+	if err != nil {
+		return maxWidthStyle.Render(fmt.Sprintf("Error rendering metrics: %s", printable(err.Error())))
+	}
+	dump = m.aggregation.Aggregate(dump)
+	t := pivot(latest(dump, m.deriver, m.showDerived), m.pivot)
+	return renderPivot(t, m.pivot, m.formatter, m.styles, maxWidthStyle)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestPivot(t *testing.T) {
+	now := time.Now()
+	newObs := func(method, code string, v float64) metrics.Observation {
+		labels := []metrics.Label{{Name: "code", Value: code}, {Name: "method", Value: method}}
+		return metrics.NewObservation("http_requests_total", labels, metrics.ObservationCounter, now, v)
+	}
+	obs := make(map[string]metrics.Observation)
+	for _, o := range []metrics.Observation{
+		newObs("get", "500", 2), newObs("get", "200", 120), newObs("post", "200", 30), newObs("get", "404", 7),
+		metrics.NewObservation("up", nil, metrics.ObservationGauge, now, 1),
+	} {
+		obs[o.Name] = o
+	}
+
+	table := pivot(obs, "code")
+	if expected, actual := "200 404 500", strings.Join(table.columns, " "); actual != expected {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+	if len(table.rows) != 2 {
+		t.Fatalf("Expected 2 rows, but got %d", len(table.rows))
+	}
+
+	st := newStyles(nil, false)
+	actual := renderPivot(table, "code", valueFormatter{}, st, lipgloss.NewStyle())
+	expected := " code:                                200  404  500\n" +
+		` http_requests_total {method="get"}   120    7    2` + "\n" +
+		` http_requests_total {method="post"}   30    ` + st.dash + "    " + st.dash + "\n"
+	if actual != expected {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+
+	// Label values are shown without control characters.
+	escaped := pivotTable{columns: []string{"\x1b[31mred\nline"}}
+	escaped.rows = []pivotRow{{name: "a", values: map[string]metrics.Observation{escaped.columns[0]: newObs("get", "", 1)}}}
+	if actual := renderPivot(escaped, "code", valueFormatter{}, st, lipgloss.NewStyle()); !strings.HasPrefix(actual, " code:  [31mred\\nline\n") {
+		t.Errorf("Expected the column printable, but got %q", actual)
+	}
+
+	if actual := renderPivot(pivot(obs, "status"), "status", valueFormatter{}, st, lipgloss.NewStyle()); !strings.Contains(actual, `no series with the label "status"`) {
+		t.Errorf("Expected a note on the missing label, but got %q", actual)
+	}
+}
+
+func TestModel_Pivot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte("# TYPE http_requests_total counter\n"+content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	write("http_requests_total{code=\"200\",method=\"get\"} 120\n")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlY})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("code")})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.pivot != "code" || m.prompting != promptNone {
+		t.Fatalf("Expected to pivot by code, but got %q", m.pivot)
+	}
+	if !strings.Contains(m.headerView(), "pivot: code") {
+		t.Errorf("Expected the pivot in the header, but got %q", m.headerView())
+	}
+	if view := m.viewport.View(); !strings.Contains(view, "code:") || !strings.Contains(view, `http_requests_total {method="get"}`) {
+		t.Errorf("Expected the pivoted series, but got %q", view)
+	}
+
+	// Columns are added as values appear.
+	write("http_requests_total{code=\"200\",method=\"get\"} 130\nhttp_requests_total{code=\"500\",method=\"get\"} 1\n")
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+	if view := m.viewport.View(); !strings.Contains(view, "500") {
+		t.Errorf("Expected a column of the new value, but got %q", view)
+	}
+
+	// An empty label turns the pivot off.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlY})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.pivot != "" || !hasRow(m, `http_requests_total {code="500", method="get"}`) {
+		t.Errorf("Expected the pivot to be turned off, but got %q", m.pivot)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// ANSI codes used by the plain renderer.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// plainOptions configures the plain output (see runPlain).
+type plainOptions struct {
+
+	// color enables colored change arrows.
+	color bool
+
+	glyphs glyphs
+
+	// arrows are the types of metrics whose changes are marked with arrows
+	// (and deltas), for hold samples (see heldIndex).
+	arrows typeMask
+	hold   int
+
+	// top limits the series to those that moved most (see topMovers).
+	top int
+
+	search      string
+	showHistory bool
+	showDerived bool
+	filter      seriesFilter
+	formatter   valueFormatter
+	deriver     metrics.Deriver
+}
+
+// isTerminal returns true, if the given file is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// runPlain writes the series of the (already sampled once) targets matching
+// the search to w, and then samples the targets and writes their series every
+// interval until they have been sampled successfully the given number of times
+// (unless zero) or ctx is done. Each write starts with a timestamp line. Static
+// targets are written once. Failed samples are reported on stderr and counted
+// in the returned stats, which include the given stats of the initial sample.
+func runPlain(ctx context.Context, targets []*target, stats runStats, samples int, interval time.Duration, opts plainOptions, w io.Writer) runStats {
+	periodic := false
+	for _, t := range targets {
+		periodic = periodic || t.static == ""
+	}
+	for {
+		writePlain(w, targets, time.Now(), opts)
+		if !periodic || (samples > 0 && stats.samples >= samples) {
+			return stats
+		}
+		select {
+		case <-ctx.Done():
+			return stats
+		case <-time.After(interval):
+		}
+		var live []*target
+		for _, t := range targets {
+			if t.static == "" {
+				live = append(live, t)
+			}
+		}
+		sampleAll(live)
+		if ctx.Err() != nil {
+			return stats
+		}
+		for _, t := range live {
+			if t.err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching metrics from %s: %v\n", t.endpoint, t.err)
+			}
+			stats.record(t.err == nil, t.err)
+		}
+	}
+}
+
+// writePlain writes the series of the targets matching the search to w,
+// preceded by a line with the given time (and by the endpoint, if there are
+// multiple targets).
+func writePlain(w io.Writer, targets []*target, ts time.Time, opts plainOptions) {
+	var sb strings.Builder
+	sb.WriteString("--- " + ts.Format(time.DateTime) + " ---\n")
+	for _, t := range targets {
+		if len(targets) > 1 {
+			sb.WriteString("# " + t.name() + "\n")
+		}
+		dump, err := t.store.Dump(opts.search)
+		if err != nil {
+			sb.WriteString("Error rendering metrics: " + err.Error() + "\n")
+			continue
+		}
+		dump, _ = opts.filter.apply(dump, opts.search)
+		if opts.top > 0 {
+			dump = topMovers(dump, opts.top)
+		}
+		for _, series := range dump {
+			for _, d := range opts.deriver.Derive(series) {
+				if len(d) == 0 {
+					continue
+				}
+				sb.WriteString(renderPlain(d, opts))
+			}
+		}
+	}
+	_, _ = io.WriteString(w, sb.String())
+}
+
+// renderPlain renders a single series to a single line like renderSeries, but
+// without styles. Changes are indicated by arrows only if colors are enabled.
+func renderPlain(obs []metrics.Observation, opts plainOptions) string {
+	o := obs[0]
+	derived := isDerived(o.Kind)
+	if !opts.showDerived && derived {
+		return ""
+	}
+	s := " "
+	if derived {
+		s = "+"
+	}
+	if o.Stale {
+		return s + o.Name + " " + staleValue(o, opts.formatter, opts.glyphs) + "\n"
+	}
+	if v, ok := special(o.Value, opts.glyphs); ok {
+		return s + o.Name + " " + v + "\n"
+	}
+	s += o.Name + " " + opts.formatter.value(o, o.Value)
+	if !changed(obs, opts.hold) || !opts.arrows.has(typeOf(o.Kind)) {
+		return s + "\n"
+	}
+
+	cv, pv := o.Value, obs[heldIndex(obs, opts.hold)].Value
+	if opts.color {
+		if cv > pv {
+			s += " " + ansiRed + opts.glyphs.up + ansiReset
+		} else {
+			s += " " + ansiGreen + opts.glyphs.down + ansiReset
+		}
+	}
+	if opts.showHistory {
+		if cv > pv {
+			s += " (+" + opts.formatter.delta(o, cv-pv) + ")"
+		} else {
+			s += " (-" + opts.formatter.delta(o, pv-cv) + ")"
+		}
+	}
+	return s + "\n"
+}
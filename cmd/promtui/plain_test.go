@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestRenderPlain(t *testing.T) {
+	now := time.Now()
+	series := []metrics.Observation{
+		metrics.NewObservation("go_goroutines", nil, metrics.ObservationGauge, now, 42),
+		metrics.NewObservation("go_goroutines", nil, metrics.ObservationGauge, now.Add(-time.Second), 40),
+	}
+	tests := []struct {
+		name     string
+		opts     plainOptions
+		expected string
+	}{
+		{"plain", plainOptions{}, " go_goroutines 42\n"},
+		{"history", plainOptions{showHistory: true}, " go_goroutines 42 (+2)\n"},
+		{"color", plainOptions{color: true, glyphs: unicodeGlyphs}, " go_goroutines 42 " + ansiRed + "⬆" + ansiReset + "\n"},
+		{"ascii", plainOptions{color: true, glyphs: asciiGlyphs}, " go_goroutines 42 " + ansiRed + "^" + ansiReset + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := renderPlain(series, tt.opts); actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+
+	// With a hold, earlier changes are shown (see heldIndex).
+	held := []metrics.Observation{series[0], series[0], series[1]}
+	if actual := renderPlain(held, plainOptions{showHistory: true, hold: 2}); actual != " go_goroutines 42 (+2)\n" {
+		t.Errorf("Expected %q, but got %q", " go_goroutines 42 (+2)\n", actual)
+	}
+
+	// Stale series show their last value and when it was seen.
+	stale := series[1]
+	stale.Stale, stale.Time = true, now.Add(-30*time.Second)
+	expected := " go_goroutines 40 (stale, last seen 30s ago)\n"
+	if actual := renderPlain([]metrics.Observation{stale, series[1]}, plainOptions{}); actual != expected {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestRunPlain(t *testing.T) {
+	newTarget := func(static string) *target {
+		tt := &target{
+			source: source{static: static},
+			store:  metrics.NewStore(3, metrics.NewFileFetcher("../../metrics/testdata/metrics.prom")),
+		}
+		if _, err := tt.store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return tt
+	}
+	opts := plainOptions{search: "go_goroutines"}
+
+	var sb strings.Builder
+	stats := runPlain(context.Background(), []*target{newTarget("")}, runStats{samples: 1}, 3, time.Millisecond, opts, &sb)
+	if stats.samples != 3 || strings.Count(sb.String(), "---") != 6 || strings.Count(sb.String(), "go_goroutines 42") != 3 {
+		t.Errorf("Expected 3 writes, but got %v and %q", stats, sb.String())
+	}
+
+	// Static targets are written once.
+	sb.Reset()
+	runPlain(context.Background(), []*target{newTarget("static file")}, runStats{samples: 1}, 0, time.Millisecond, opts, &sb)
+	if strings.Count(sb.String(), "go_goroutines 42") != 1 {
+		t.Errorf("Expected a single write, but got %q", sb.String())
+	}
+}
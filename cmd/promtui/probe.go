@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// defaultProbePaths are the well-known paths of metrics endpoints, probed
+// after those of -probe-path (see probe).
+var defaultProbePaths = []string{"/metrics", "/healthz/metrics", "/actuator/prometheus", "/prometheus"}
+
+// probePathsFlag is a flag that may be given multiple times, each time with a
+// path to probe before the defaultProbePaths.
+type probePathsFlag []string
+
+func (f *probePathsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *probePathsFlag) Set(s string) error {
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + s
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+func (f *probePathsFlag) values() []string {
+	return *f
+}
+
+// paths returns the paths to probe: those given, then the default ones.
+func (f probePathsFlag) paths() []string {
+	paths := slices.Clone([]string(f))
+	for _, p := range defaultProbePaths {
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// needsProbe returns true, if the first sample of the given target failed and
+// its endpoint is an HTTP(S) URL without a path or was not found.
+func needsProbe(t *target) bool {
+	if t.err == nil || t.static != "" || t.once {
+		return false
+	}
+	// Prometheus servers are queried at the path of their API.
+	if _, ok := t.fetcher.(*metrics.QueryFetcher); ok {
+		return false
+	}
+	u, err := url.Parse(t.endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	var statusErr *metrics.StatusError
+	return u.Path == "" || u.Path == "/" || (errors.As(t.err, &statusErr) && statusErr.StatusCode == http.StatusNotFound)
+}
+
+// probe samples the given paths on the host of the endpoint of the given
+// target (with the given options, each within the given timeout) and switches
+// the target to the first returning parseable metrics, closing its previous
+// source. It returns false, if none did.
+func probe(ctx context.Context, t *target, paths []string, timeout time.Duration, opts httpOptions, newStore func(metrics.Fetcher) *metrics.Store) bool {
+	u, err := url.Parse(t.endpoint)
+	if err != nil {
+		return false
+	}
+	for _, path := range paths {
+		u.Path, u.RawPath, u.RawQuery = path, "", ""
+		src, err := newSource(u.String(), opts)
+		if err != nil {
+			continue
+		}
+		store := newStore(src.fetcher)
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		_, err = store.Sample(probeCtx)
+		cancel()
+		if err != nil {
+			src.close()
+			continue
+		}
+		t.source.close()
+		t.source, t.endpoint, t.store = src, u.String(), store
+		t.err, t.lastSample, t.probed = nil, time.Now(), true
+		return true
+	}
+	return false
+}
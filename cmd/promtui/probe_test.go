@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestProbePathsFlag(t *testing.T) {
+	var f probePathsFlag
+	for _, s := range []string{"stats/prometheus", "/metrics"} {
+		if err := f.Set(s); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expected := []string{"/stats/prometheus", "/metrics", "/healthz/metrics", "/actuator/prometheus", "/prometheus"}
+	if !slices.Equal(f.paths(), expected) {
+		t.Errorf("Expected %v, but got %v", expected, f.paths())
+	}
+}
+
+func TestProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actuator/prometheus":
+			_, _ = io.WriteString(w, "up 1\n")
+		case "/":
+			_, _ = io.WriteString(w, "<html>hello</html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	newStore := func(f metrics.Fetcher) *metrics.Store { return metrics.NewStore(3, f) }
+
+	tests := []struct {
+		endpoint string
+		probe    bool
+	}{
+		{srv.URL, true},
+		{srv.URL + "/metrics", true},
+		{srv.URL + "/actuator/prometheus", false},
+		{"file:///nonexistent.prom", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			src, err := newSource(tt.endpoint, httpOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			tg := &target{source: src, endpoint: tt.endpoint, store: newStore(src.fetcher)}
+			_, tg.err = tg.store.Sample(context.Background())
+			if actual := needsProbe(tg); actual != tt.probe {
+				t.Fatalf("Expected %v, but got %v", tt.probe, actual)
+			}
+			if !tt.probe {
+				return
+			}
+			if !probe(context.Background(), tg, defaultProbePaths, time.Second, httpOptions{}, newStore) {
+				t.Fatalf("Expected a path to be found")
+			}
+			if tg.endpoint != srv.URL+"/actuator/prometheus" || tg.err != nil || !tg.probed {
+				t.Errorf("Expected the probed endpoint, but got %v (%v)", tg.endpoint, tg.err)
+			}
+		})
+	}
+
+	// Without a path found, the target is kept.
+	tg := &target{endpoint: srv.URL + "/metrics"}
+	if probe(context.Background(), tg, []string{"/missing"}, time.Second, httpOptions{}, newStore) || tg.endpoint != srv.URL+"/metrics" {
+		t.Errorf("Expected no path to be found, but got %v", tg.endpoint)
+	}
+
+	// Paths not answering in time are skipped.
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+	tg = &target{endpoint: hanging.URL}
+	if probe(context.Background(), tg, []string{"/metrics"}, 10*time.Millisecond, httpOptions{}, newStore) {
+		t.Errorf("Expected no path to be found, but got %v", tg.endpoint)
+	}
+}
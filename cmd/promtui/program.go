@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// signalMsg is sent on the signals handled by promtui: SIGINT and SIGTERM
+// quit, the refreshSignals trigger a sample.
+type signalMsg struct {
+	os.Signal
+}
+
+// isRefresh returns true, if the signal triggers a sample.
+func (s signalMsg) isRefresh() bool {
+	return slices.Contains(refreshSignals, s.Signal)
+}
+
+// panicMsg carries a panic of a command (see guard) to the event loop, where
+// it is raised again.
+type panicMsg struct {
+	value any
+	stack []byte
+}
+
+// guardedModel wraps a model, so that panics of its commands (which run in
+// their own goroutines) are raised in the event loop and reach runProgram.
+type guardedModel struct {
+	tea.Model
+}
+
+func (g guardedModel) Init() tea.Cmd {
+	return guard(g.Model.Init())
+}
+
+func (g guardedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if p, ok := msg.(panicMsg); ok {
+		panic(fmt.Sprintf("%v\n\ncommand stack:\n%s", p.value, p.stack))
+	}
+	m, cmd := g.Model.Update(msg)
+	return guardedModel{m}, guard(cmd)
+}
+
+// guard returns a command running the given one, which turns a panic into a
+// panicMsg. The commands of a batch are guarded in turn.
+func guard(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() (msg tea.Msg) {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = panicMsg{value: r, stack: debug.Stack()}
+			}
+		}()
+		msg = cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i := range batch {
+				batch[i] = guard(batch[i])
+			}
+		}
+		return msg
+	}
+}
+
+// runProgram runs the given model in the terminal. Signals are forwarded to
+// the model as signalMsg, and panics restore the terminal before they are
+// raised again (bubbletea would otherwise swallow them, or leave the alternate
+// screen active).
+func runProgram(m tea.Model, opts ...tea.ProgramOption) (tea.Model, error) {
+	opts = append(opts, tea.WithoutSignalHandler(), tea.WithoutCatchPanics())
+	p := tea.NewProgram(guardedModel{m}, opts...)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, refreshSignals...)...)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		for s := range signals {
+			p.Send(signalMsg{s})
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = p.ReleaseTerminal()
+			panic(r)
+		}
+	}()
+	return p.Run()
+}
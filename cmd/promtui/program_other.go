@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// refreshSignals are the signals triggering a sample, of which there are none
+// on this platform.
+var refreshSignals []os.Signal
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestGuard(t *testing.T) {
+	boom := func() tea.Msg { panic("boom") }
+	if msg, ok := guard(boom)().(panicMsg); !ok || msg.value != "boom" || len(msg.stack) == 0 {
+		t.Errorf("Expected the panic as message, but got %v", msg)
+	}
+
+	// The commands of batches are guarded in turn.
+	batch, ok := guard(tea.Batch(boom, boom))().(tea.BatchMsg)
+	if !ok {
+		t.Fatalf("Expected a batch")
+	}
+	for _, cmd := range batch {
+		if _, ok := cmd().(panicMsg); !ok {
+			t.Errorf("Expected the panic as message")
+		}
+	}
+
+	if guard(nil) != nil {
+		t.Errorf("Expected no command")
+	}
+}
+
+func TestGuardedModel_UpdatePanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected the panic to be raised again")
+		}
+	}()
+	guardedModel{newTestModel()}.Update(panicMsg{value: "boom"})
+}
+
+func TestModel_UpdateSignal(t *testing.T) {
+	m := newTestModel()
+	if _, cmd := m.Update(signalMsg{syscall.SIGTERM}); !isQuit(cmd) {
+		t.Errorf("Expected quit on SIGTERM")
+	}
+	for _, s := range refreshSignals {
+		if _, cmd := m.Update(signalMsg{s}); cmd == nil || isQuit(cmd) {
+			t.Errorf("Expected a sample on %v", s)
+		}
+	}
+}
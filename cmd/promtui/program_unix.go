@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// refreshSignals are the signals triggering a sample (e.g. from a script
+// driving promtui).
+var refreshSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// pushTimeMetric is the metric exposed by a Pushgateway for each group of
+// pushed series, holding the time of the latest push and labeled with the
+// grouping key of the group (e.g. job and instance).
+const pushTimeMetric = "push_time_seconds"
+
+// defaultPushMaxAge is the age of the latest push of a group beyond which the
+// group is highlighted, if not given by -push-max-age.
+const defaultPushMaxAge = 5 * time.Minute
+
+// pushGroup is a group of series pushed to a Pushgateway: its grouping key
+// and the time of its latest push (NaN, if not known).
+type pushGroup struct {
+	key    []metrics.Label
+	pushed float64
+}
+
+// stale returns true, if the latest push of the group is older than the given
+// age (unless zero). The age is computed in seconds, so that push times out
+// of the range of time.Time (e.g. of broken clocks) do not overflow.
+func (g pushGroup) stale(maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 || !finite(g.pushed) {
+		return false
+	}
+	return float64(now.UnixNano())/1e9-g.pushed > maxAge.Seconds()
+}
+
+// holds returns true, if the given series was pushed with the group, i.e. it
+// carries all labels of the grouping key.
+func (g pushGroup) holds(series []metrics.Observation) bool {
+	for _, l := range g.key {
+		if !slices.Contains(series[0].Labels, l) {
+			return false
+		}
+	}
+	return true
+}
+
+// pushGroups returns the groups of the given dump: those of the push times
+// (see pushTimeMetric) in order. Without push times, the groups are those of
+// the job and instance labels, in order of appearance, if forced is set, and
+// there are none otherwise.
+func pushGroups(dump [][]metrics.Observation, forced bool) []pushGroup {
+	var groups []pushGroup
+	for _, series := range dump {
+		if series[0].Metric == pushTimeMetric {
+			groups = append(groups, pushGroup{key: series[0].Labels, pushed: series[0].Value})
+		}
+	}
+	if len(groups) > 0 || !forced {
+		return groups
+	}
+	for _, series := range dump {
+		var key []metrics.Label
+		for _, l := range series[0].Labels {
+			if l.Name == "job" || l.Name == "instance" {
+				key = append(key, l)
+			}
+		}
+		if len(key) > 0 && !slices.ContainsFunc(groups, func(g pushGroup) bool { return slices.Equal(g.key, key) }) {
+			groups = append(groups, pushGroup{key: key, pushed: math.NaN()})
+		}
+	}
+	return groups
+}
+
+// groupOf returns the index of the group of the given groups the given series
+// was pushed with (see pushGroup.holds), or the number of groups, if none. A
+// series holding the grouping keys of several groups belongs to the one with
+// the largest key.
+func groupOf(series []metrics.Observation, groups []pushGroup) int {
+	i := len(groups)
+	for j, g := range groups {
+		if g.holds(series) && (i == len(groups) || len(g.key) > len(groups[i].key)) {
+			i = j
+		}
+	}
+	return i
+}
+
+// stalePushed returns the names of the series of the given dump pushed with
+// the groups pushed longer than the given age ago (see pushGroup.stale).
+func stalePushed(dump [][]metrics.Observation, groups []pushGroup, maxAge time.Duration, now time.Time) map[string]bool {
+	stale := make(map[string]bool)
+	for _, series := range dump {
+		if i := groupOf(series, groups); i < len(groups) && groups[i].stale(maxAge, now) {
+			stale[series[0].Name] = true
+		}
+	}
+	return stale
+}
+
+// groupPushed returns the series of the given dump ordered by the given
+// groups (see pushGroups and groupOf), each group led by its push time,
+// followed by the series of no group (e.g. those of the Pushgateway itself).
+func groupPushed(dump [][]metrics.Observation, groups []pushGroup) [][]metrics.Observation {
+	if len(groups) == 0 {
+		return dump
+	}
+	index := make(map[string]int, len(dump))
+	for _, series := range dump {
+		index[series[0].Name] = groupOf(series, groups)
+	}
+	grouped := slices.Clone(dump)
+	slices.SortStableFunc(grouped, func(a, b []metrics.Observation) int {
+		if d := index[a[0].Name] - index[b[0].Name]; d != 0 {
+			return d
+		}
+		switch {
+		case a[0].Metric == pushTimeMetric && b[0].Metric != pushTimeMetric:
+			return -1
+		case a[0].Metric != pushTimeMetric && b[0].Metric == pushTimeMetric:
+			return 1
+		}
+		return 0
+	})
+	return grouped
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestGroupPushed(t *testing.T) {
+	now := time.Now()
+	series := func(metric string, v float64, labels ...string) []metrics.Observation {
+		var l []metrics.Label
+		for i := 0; i+1 < len(labels); i += 2 {
+			l = append(l, metrics.Label{Name: labels[i], Value: labels[i+1]})
+		}
+		return []metrics.Observation{metrics.NewObservation(metric, l, metrics.ObservationGauge, now, v)}
+	}
+	dump := [][]metrics.Observation{
+		series("backup_bytes", 1, "instance", "db1", "job", "backup"),
+		series("backup_bytes", 2, "instance", "db2", "job", "backup"),
+		series("go_goroutines", 9),
+		series("push_time_seconds", float64(now.Add(-time.Hour).Unix()), "instance", "db1", "job", "backup"),
+		series("push_time_seconds", float64(now.Add(-time.Minute).Unix()), "instance", "db2", "job", "backup"),
+	}
+	names := func(d [][]metrics.Observation) string {
+		var s []string
+		for _, series := range d {
+			s = append(s, series[0].Name)
+		}
+		return strings.Join(s, " ")
+	}
+
+	groups := pushGroups(dump, false)
+	grouped, stale := groupPushed(dump, groups), stalePushed(dump, groups, 5*time.Minute, now)
+	expected := `push_time_seconds {instance="db1", job="backup"} backup_bytes {instance="db1", job="backup"} ` +
+		`push_time_seconds {instance="db2", job="backup"} backup_bytes {instance="db2", job="backup"} go_goroutines`
+	if actual := names(grouped); actual != expected {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+	if len(stale) != 2 || !stale[`backup_bytes {instance="db1", job="backup"}`] {
+		t.Errorf("Expected the series of the first group to be stale, but got %v", stale)
+	}
+
+	// Without push times, series are grouped only if forced.
+	if groups := pushGroups(dump[:3], false); len(groups) != 0 {
+		t.Errorf("Expected no groups, but got %v", groups)
+	}
+	if groups := pushGroups(dump[:3], true); len(groups) != 2 || groups[0].stale(time.Second, now) {
+		t.Errorf("Expected 2 groups without push times, but got %v", groups)
+	}
+
+	// Push times out of the range of times do not overflow.
+	for _, pushed := range []float64{1e19, -1e19} {
+		if actual, expected := (pushGroup{pushed: pushed}).stale(time.Minute, now), pushed < 0; actual != expected {
+			t.Errorf("Expected %v for %v, but got %v", expected, pushed, actual)
+		}
+	}
+}
+
+func TestModel_Pushgateway(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	pushed := time.Now().Add(-10 * time.Minute).Unix()
+	content := fmt.Sprintf(`# TYPE backup_bytes gauge
+backup_bytes{instance="db1",job="backup"} 1
+# TYPE push_time_seconds gauge
+push_time_seconds{instance="db1",job="backup"} %d
+`, pushed)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:    []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:     newStyles(nil, false),
+		keys:       newKeymap(),
+		viewport:   viewport.New(120, 10),
+		formatter:  valueFormatter{humanize: true},
+		pushMaxAge: 5 * time.Minute,
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+
+	if len(m.rows) < 2 || m.rows[0].name != `push_time_seconds {instance="db1", job="backup"}` || m.rows[1].alert != severityWarn {
+		t.Errorf("Expected the stale group first, but got %v", m.rows)
+	}
+	if !strings.Contains(m.headerView(), " pushgateway groups: 1, 1 stale -") {
+		t.Errorf("Expected the groups in the header, but got %q", m.headerView())
+	}
+	if line := m.renderRow(m.rows[0], lipgloss.NewStyle().MaxWidth(120)); !strings.Contains(line, "pushed 10m") {
+		t.Errorf("Expected the age of the push, but got %q", line)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dropLabelsFlag is a flag that may be given multiple times, each time with
+// one or more comma-separated names of labels to drop (see
+// metrics.Relabeling).
+type dropLabelsFlag []string
+
+func (f *dropLabelsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *dropLabelsFlag) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*f = append(*f, name)
+		}
+	}
+	return nil
+}
+
+func (f *dropLabelsFlag) values() []string {
+	return *f
+}
+
+// renameLabelsFlag is a flag that may be given multiple times, each time with
+// a label to rename in the form old=new (see metrics.Relabeling).
+type renameLabelsFlag map[string]string
+
+func (f *renameLabelsFlag) String() string {
+	return strings.Join(f.values(), ",")
+}
+
+func (f *renameLabelsFlag) Set(s string) error {
+	old, name, ok := strings.Cut(s, "=")
+	old, name = strings.TrimSpace(old), strings.TrimSpace(name)
+	if !ok || old == "" || name == "" {
+		return fmt.Errorf("expected old=new, but got %q", s)
+	}
+	if *f == nil {
+		*f = make(renameLabelsFlag)
+	}
+	(*f)[old] = name
+	return nil
+}
+
+func (f *renameLabelsFlag) values() []string {
+	renames := make([]string, 0, len(*f))
+	for old, name := range *f {
+		renames = append(renames, old+"="+name)
+	}
+	sort.Strings(renames)
+	return renames
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenameLabelsFlag(t *testing.T) {
+	tests := []struct {
+		values   []string
+		expected string
+		err      bool
+	}{
+		{[]string{"instance=host"}, "instance=host", false},
+		{[]string{" pod = name ", "instance=host"}, "instance=host,pod=name", false},
+		{[]string{"instance"}, "", true},
+		{[]string{"=host"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.values, " "), func(t *testing.T) {
+			var f renameLabelsFlag
+			var err error
+			for _, v := range tt.values {
+				if err = f.Set(v); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.err {
+				t.Fatalf("Expected error %v, but got %v", tt.err, err)
+			}
+			if !tt.err && f.String() != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, f.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// row describes a line of the viewport. obs is the (possibly derived) series
+// rendered by it, highlighted with highlight or, if matched by a firing alert
+// rule, by alert (see renderSeries). err is shown instead of the series of an
+// expression that cannot be computed (see exprRows).
+type row struct {
+	name, family string
+	value        float64
+
+	// shown is the name the row is shown with, if not its name (i.e. without
+	// the common labels, see model.hoistLabels). stripped is the length of the
+	// prefix stripped from it (see model.stripPrefixes).
+	shown    string
+	stripped int
+
+	obs       []metrics.Observation
+	highlight bool
+	alert     severity
+	err       string
+}
+
+// shownName returns the name the row is shown with, before stripping its
+// prefix (see row.stripped).
+func (r row) shownName() string {
+	if r.shown != "" {
+		return r.shown
+	}
+	return r.name
+}
+
+// buildRows returns the rows of the series of the current target matching the
+// search, without rendering them (see renderRow). It also counts the series
+// (see countSeries) and the new ones among them, and finds the labels common
+// to the rows (see hoistLabels).
+func (m *model) buildRows() ([]row, error) {
+	m.common = nil
+	dump, err := m.target().store.Dump(m.search)
+	dump, m.hidden = m.filter.apply(dump, m.search)
+	m.countSeries(dump)
+	m.newSeries = 0
+	if err != nil {
+		return nil, err
+	}
+	dump = m.aggregation.Aggregate(dump)
+	if len(m.stripPrefixes) > 0 {
+		dump = sortStripped(dump, m.stripPrefixes)
+	}
+	groups := pushGroups(dump, m.pushgateway)
+	now := time.Now()
+	m.pushGroups, m.stalePushes = len(groups), 0
+	for _, g := range groups {
+		if g.stale(m.pushMaxAge, now) {
+			m.stalePushes++
+		}
+	}
+	// The series of stale groups are alerted in any order.
+	var stale map[string]bool
+	if m.stalePushes > 0 {
+		stale = stalePushed(dump, groups, m.pushMaxAge, now)
+	}
+	switch {
+	case m.showTop:
+		// The top movers replace the sort, which is kept for leaving the
+		// mode again.
+		dump = topMovers(dump, m.top)
+		m.ranks = nil
+	case m.unchanged == unchangedSorted:
+		dump = stabilize(sortByUnchanged(dump), m.ranks, m.sortStability)
+		m.ranks = ranks(dump)
+	case len(groups) > 0:
+		dump = groupPushed(dump, groups)
+		m.ranks = nil
+	default:
+		m.ranks = nil
+	}
+	// Expressions come first.
+	rows := m.exprRows()
+	highlighting := m.highlightChanges && now.Before(m.highlightUntil)
+	for _, series := range dump {
+		if m.highlightNew && isNew(series[0]) {
+			m.newSeries++
+		}
+		// The rows derived from a series are highlighted along with it.
+		highlight := highlighting && changed(series, m.hold)
+		alert := m.target().rules.series[series[0].Name]
+		if stale[series[0].Name] {
+			alert = max(alert, severityWarn)
+		}
+		for _, d := range m.deriver.Derive(series) {
+			if len(d) == 0 || (!m.showDerived && isDerived(d[0].Kind)) {
+				continue
+			}
+			// Derived rows belong to the family of their series.
+			rows = append(rows, row{name: d[0].Name, family: series[0].Family(), value: d[0].Value, obs: d, highlight: highlight, alert: alert})
+		}
+	}
+	if m.hoistLabels {
+		if m.common = commonLabels(rows); len(m.common) > 0 {
+			for i := range rows {
+				rows[i].shown = withoutLabels(rows[i].obs[0], m.common)
+			}
+		}
+	}
+	if len(m.stripPrefixes) > 0 {
+		stripPrefixes(rows, m.stripPrefixes)
+	}
+	return rows, nil
+}
+
+// renderRow renders the given row (including the final newline).
+func (m *model) renderRow(r row, maxWidthStyle lipgloss.Style) string {
+	if r.err != "" {
+		return maxWidthStyle.Render("+"+r.shownName()+" "+lipgloss.NewStyle().Foreground(m.styles.error.GetForeground()).Render("expr error: "+r.err)) + "\n"
+	}
+	return renderSeries(r.shownName()[r.stripped:], r.obs, r.highlight, r.alert, m.seriesOptions(maxWidthStyle))
+}
+
+// lineSettings are the settings lines are rendered with. Cached lines (see
+// lineCache) are dropped when they change.
+type lineSettings struct {
+	width                                  int
+	search                                 string
+	showHistory, showDerived, highlightNew bool
+	expandHistory                          bool
+	arrows                                 typeMask
+	hold                                   int
+	common                                 string
+	unchanged                              unchangedMode
+	formatter                              valueFormatter
+	target                                 *target
+	baselineAt                             time.Time
+}
+
+// lineKey identifies the rendering of a row with given settings: the row
+// renders the same as long as its latest observations (and its error, see
+// row.err) do.
+type lineKey struct {
+	name                  string
+	kind                  metrics.ObservationKind
+	value, previous, raw  uint64
+	hasPrevious, smoothed bool
+	highlight, new        bool
+	stripped              int
+	alert                 severity
+	aggregated            int
+	err                   string
+}
+
+// lineCache holds the rendered lines of the rows of the latest render.
+type lineCache struct {
+	settings lineSettings
+	lines    map[lineKey]string
+}
+
+// cacheKey returns the key of the given row in the line cache. Rows rendering
+// the current time (stale series, the time series have been unchanged for,
+// the age of timestamps, and, in the history view, ages) or exemplars are not
+// cached, and neither are rows in the expanded history view, which render
+// more values than the key holds.
+func (m *model) cacheKey(r row) (lineKey, bool) {
+	o := r.obs[0]
+	if m.expandHistory || o.Stale || (m.formatter.humanize && m.formatter.isTimestamp(o)) || (m.showHistory && (!o.Created.IsZero() || o.Exemplar != nil)) {
+		return lineKey{}, false
+	}
+	if _, ok := unchangedFor(o, time.Time{}); ok && m.unchanged != unchangedHidden {
+		return lineKey{}, false
+	}
+	k := lineKey{
+		name:       o.Name,
+		kind:       o.Kind,
+		value:      math.Float64bits(o.Value),
+		raw:        math.Float64bits(o.Raw),
+		smoothed:   o.Smoothed,
+		highlight:  r.highlight,
+		alert:      r.alert,
+		new:        isNew(o),
+		aggregated: o.Aggregated,
+		stripped:   r.stripped,
+		err:        r.err,
+	}
+	if len(r.obs) > 1 {
+		k.previous, k.hasPrevious = math.Float64bits(r.obs[heldIndex(r.obs, m.hold)].Value), true
+	}
+	return k, true
+}
+
+// renderWindow renders the rows around the viewport scrolled to the given
+// offset (a page above and below it), leaving all other lines empty, so that
+// the cost of rendering does not grow with the number of series. Lines of
+// unchanged rows are taken from the cache of the previous render.
+func (m *model) renderWindow(offset int) {
+	height := max(1, m.viewport.Height)
+	lineCount := len(m.rows)
+	if m.more > 0 {
+		lineCount++
+	}
+	offset = max(0, min(offset, lineCount-height))
+	from, to := max(0, offset-height), min(len(m.rows), offset+2*height)
+
+	settings := lineSettings{
+		width:         m.viewport.Width,
+		search:        m.search,
+		showHistory:   m.showHistory,
+		expandHistory: m.expandHistory,
+		arrows:        m.arrows,
+		hold:          m.hold,
+		common:        labelsText(m.common),
+		showDerived:   m.showDerived,
+		highlightNew:  m.highlightNew,
+		unchanged:     m.unchanged,
+		formatter:     m.formatter,
+		target:        m.target(),
+		baselineAt:    m.target().baselineAt,
+	}
+	prev := m.cache.lines
+	if m.cache.settings != settings {
+		prev = nil
+	}
+	cached := make(map[lineKey]string, to-from)
+
+	maxWidthStyle := lipgloss.NewStyle().MaxWidth(m.viewport.Width)
+	lines := make([]string, len(m.rows))
+	for i := from; i < to; i++ {
+		k, ok := m.cacheKey(m.rows[i])
+		if line, hit := prev[k]; ok && hit {
+			lines[i], cached[k] = line, line
+			continue
+		}
+		lines[i] = strings.TrimSuffix(m.renderRow(m.rows[i], maxWidthStyle), "\n")
+		if ok {
+			cached[k] = lines[i]
+		}
+	}
+	m.cache = lineCache{settings: settings, lines: cached}
+	m.rendered = span{from, to}
+
+	if m.more > 0 {
+		lines = append(lines, m.moreLine())
+	}
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+	m.viewport.SetYOffset(offset)
+}
+
+// moreLine returns the line ending the rows if some are left out (see
+// model.maxLines), e.g. "… and 4,312 more series (ENTER and m to show all)".
+func (m *model) moreLine() string {
+	text := fmt.Sprintf(" %s and %s more series (%s and %s to show all)", m.styles.ellipsis, groupDigits(strconv.Itoa(m.more)),
+		strings.ToUpper(m.keys.browse.Help().Key), m.keys.showAll.Help().Key)
+	return m.styles.muted.MaxWidth(m.viewport.Width).Render(text)
+}
+
+// renderVisible renders the rows around the viewport again, if it was
+// scrolled (or resized) beyond the rendered ones.
+func (m *model) renderVisible() {
+	if len(m.rows) == 0 {
+		return
+	}
+	top := m.viewport.YOffset
+	bottom := min(len(m.rows), top+m.viewport.Height)
+	if top < m.rendered.start || bottom > m.rendered.end || m.cache.settings.width != m.viewport.Width {
+		m.renderWindow(top)
+	}
+}
+
+// renderError shows the given error in the viewport instead of the rows.
+func (m *model) renderError(err error) {
+	m.rows = nil
+	m.viewport.SetContent(lipgloss.NewStyle().MaxWidth(m.viewport.Width).Render(fmt.Sprintf("Error rendering metrics: %s", printable(err.Error()))))
+}
+
+// printable returns the given text of an endpoint (e.g. a HELP text) fit for
+// a single line of the terminal: newlines and tabs are escaped, and other
+// control characters (e.g. of ANSI escape sequences, with which an endpoint
+// could style the terminal) are dropped.
+func printable(s string) string {
+	if !strings.ContainsFunc(s, unicode.IsControl) {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case !unicode.IsControl(r):
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// newLargeModel returns a model of a target with the given number of gauge
+// series sampled twice.
+func newLargeModel(tb testing.TB, n int) *model {
+	path := filepath.Join(tb.TempDir(), "metrics.prom")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:     []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		viewport:    viewport.New(120, 50),
+		showHistory: true,
+		showDerived: true,
+		formatter:   valueFormatter{decimals: 2},
+		keys:        newKeymap(),
+	}
+	for s := 0; s < 2; s++ {
+		var sb strings.Builder
+		sb.WriteString("# TYPE cadvisor_series gauge\n")
+		for i := 0; i < n; i++ {
+			// Every tenth series changes.
+			fmt.Fprintf(&sb, "cadvisor_series{id=\"%d\"} %d\n", i, i+s*(i%10/9))
+		}
+		if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+			tb.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			tb.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return m
+}
+
+func TestModel_RenderWindow(t *testing.T) {
+	m := newLargeModel(t, 1000)
+	m.viewport = viewport.New(120, 10)
+	m.viewport.KeyMap = m.keys.viewportKeyMap()
+	m.metricsView()
+
+	// Only the rows up to a page below the viewport are rendered.
+	if m.viewport.TotalLineCount() != len(m.rows) {
+		t.Errorf("Expected %v, but got %v", len(m.rows), m.viewport.TotalLineCount())
+	}
+	if expected := (span{0, 20}); m.rendered != expected {
+		t.Errorf("Expected %v, but got %v", expected, m.rendered)
+	}
+	if len(m.cache.lines) != 20 {
+		t.Errorf("Expected %v, but got %v", 20, len(m.cache.lines))
+	}
+
+	// Scrolling beyond the rendered rows (here, from the fourth page on)
+	// renders the rows around the viewport.
+	for i := 0; i < 5; i++ {
+		m.Update(tea.KeyMsg{Type: tea.KeyPgDown})
+	}
+	if expected := (span{30, 60}); m.rendered != expected {
+		t.Errorf("Expected %v, but got %v", expected, m.rendered)
+	}
+	if view := m.viewport.View(); !strings.HasPrefix(view, ` cadvisor_series {id="50"} 50`) {
+		t.Errorf("Expected the view to start at row 50, but got %q", view)
+	}
+
+	// Unchanged rows are taken from the cache.
+	k, ok := m.cacheKey(m.rows[50])
+	if !ok {
+		t.Fatalf("Expected row 50 to be cached")
+	}
+	m.cache.lines[k] = "cached"
+	m.metricsView()
+	if view := m.viewport.View(); !strings.HasPrefix(view, "cached ") {
+		t.Errorf("Expected the cached line, but got %q", view)
+	}
+
+	// The expanded history shows older values than the key holds.
+	m.expandHistory = true
+	if _, ok := m.cacheKey(m.rows[50]); ok {
+		t.Errorf("Expected row 50 not to be cached in the expanded history view")
+	}
+}
+
+func TestModel_MaxLines(t *testing.T) {
+	m := newLargeModel(t, 5000)
+	m.styles = newStyles(nil, false)
+	m.maxLines = 5
+	m.metricsView()
+	// The synthetic series (e.g. promtui_up) count, too.
+	if len(m.rows) != 5 || m.matched != 5003 {
+		t.Errorf("Expected 5 of 5003 series, but got %d of %d", len(m.rows), m.matched)
+	}
+	lines := strings.Split(m.viewport.View(), "\n")
+	if expected := " … and 4,998 more series (ENTER and m to show all)"; strings.TrimRight(lines[5], " ") != expected {
+		t.Errorf("Expected %q, but got %q", expected, lines[5])
+	}
+
+	// Until browsing, m extends the search.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	if m.search != "m" || m.showAll {
+		t.Errorf("Expected the search to be extended, but got %q", m.search)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	if len(m.rows) != 5003 || m.more != 0 {
+		t.Errorf("Expected all 5003 series, but got %d", len(m.rows))
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	if len(m.rows) != 5 {
+		t.Errorf("Expected 5 series again, but got %d", len(m.rows))
+	}
+}
+
+func TestModel_MaxLines_Scrolled(t *testing.T) {
+	m := newLargeModel(t, 100)
+	m.styles = newStyles(nil, false)
+	m.viewport = viewport.New(120, 10)
+	m.viewport.KeyMap = m.keys.viewportKeyMap()
+	m.maxLines = 25
+	m.metricsView()
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	for i := 0; i < 5; i++ {
+		m.Update(tea.KeyMsg{Type: tea.KeyPgDown})
+	}
+	// Scrolled to the end, the line of the more series stays shown last when
+	// rendering again (e.g. on the next sample).
+	m.metricsView()
+	lines := strings.Split(m.viewport.View(), "\n")
+	if last := strings.TrimRight(lines[len(lines)-1], " "); !strings.HasPrefix(last, " … and 78 more series") {
+		t.Errorf("Expected the more line last, but got %q", last)
+	}
+}
+
+// BenchmarkModel_RenderMetrics renders all rows (as exports do), for
+// comparison with BenchmarkModel_MetricsView, which renders only those around
+// the viewport.
+func BenchmarkModel_RenderMetrics(b *testing.B) {
+	m := newLargeModel(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.viewport.SetContent(m.renderMetrics(lipgloss.NewStyle().MaxWidth(m.viewport.Width)))
+	}
+}
+
+func BenchmarkModel_MetricsView(b *testing.B) {
+	m := newLargeModel(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.metricsView()
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"at main()\n\tmain.go:1", `at main()\n\tmain.go:1`},
+		{"\x1b[31mred\x1b[0m", "[31mred[0m"},
+		{"bell\a and \u009b31m", "bell and 31m"},
+		{"gö", "gö"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if actual := printable(tt.in); actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestModel_HostileValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# HELP hostile \x1b[2JCleared\n# TYPE hostile gauge\n" +
+		"hostile{trace=\"at main()\\n\tmain.go:1\",color=\"\x1b[31mred\"} 1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("hostile")})
+	m.metricsView()
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.rows) != 1 {
+		t.Fatalf("Expected a row, but got %v", m.rows)
+	}
+
+	// Rows stay on a single line, and escape sequences are neutralized.
+	line := m.renderRow(m.rows[0], lipgloss.NewStyle().MaxWidth(120))
+	if strings.Count(line, "\n") != 1 || strings.Contains(line, "\x1b[31m") {
+		t.Errorf("Expected a single line without escape sequences, but got %q", line)
+	}
+	if !strings.Contains(line, `trace="at main()\n\tmain.go:1"`) {
+		t.Errorf("Expected the escaped newline, but got %q", line)
+	}
+	if footer := m.footerView(); strings.Contains(footer, "\x1b[2J") || !strings.Contains(footer, "hostile: [2JCleared") {
+		t.Errorf("Expected the help without escape sequences, but got %q", footer)
+	}
+
+	// The raw values are kept.
+	if labels := m.rows[0].obs[0].Labels; labels[0].Value != "at main()\n\tmain.go:1" {
+		t.Errorf("Expected the raw value, but got %v", labels)
+	}
+}
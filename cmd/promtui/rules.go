@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// rulesKey is the config key of the alert rules (see parseRules).
+const rulesKey = "rules"
+
+// severity is the severity of a rule. Rows of series matched by firing rules
+// are highlighted by it (none for series matched by no firing rule).
+type severity int
+
+const (
+	severityNone severity = iota
+	severityWarn
+	severityCritical
+)
+
+// severityNames are the names of the severities of rules.
+var severityNames = map[string]severity{
+	"warn":     severityWarn,
+	"critical": severityCritical,
+}
+
+// rule is a threshold on the latest values of the series matching a selector
+// (e.g. `queue_depth > 1000`) or, with rate, on their per-second rates (e.g.
+// `errors_total > 5/s`). The rule fires, if any of the series crosses the
+// threshold.
+type rule struct {
+	text     string
+	selector metrics.Selector
+	op       string
+	value    float64
+	rate     bool
+	severity severity
+}
+
+// ruleState is the outcome of evaluating the rules against the series of a
+// target (see evaluateRules).
+type ruleState struct {
+
+	// firing holds the firing rules.
+	firing map[*rule]bool
+
+	// series maps the names of the series crossing the threshold of a firing
+	// rule to the highest severity among those rules.
+	series map[string]severity
+}
+
+// severity returns the highest severity of the firing rules (or severityNone).
+func (s ruleState) severity() severity {
+	sev := severityNone
+	for r := range s.firing {
+		sev = max(sev, r.severity)
+	}
+	return sev
+}
+
+// parseRules removes the alert rules from the given config and parses them.
+// Each rule is a map with a selector, an operator (see assertionOps), a value
+// (a number or, for a per-second rate, a number followed by "/s"), and an
+// optional severity (warn, the default, or critical):
+//
+//	rules:
+//	  - selector: queue_depth
+//	    op: ">"
+//	    value: 1000
+//	  - selector: errors_total{code=~"5.."}
+//	    op: ">"
+//	    value: 5/s
+//	    severity: critical
+func parseRules(config map[string]any) ([]*rule, error) {
+	v, ok := config[rulesKey]
+	delete(config, rulesKey)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("config key %q: expected a list of rules", rulesKey)
+	}
+	rules := make([]*rule, 0, len(list))
+	for i, e := range list {
+		m, ok := e.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("rule %d: expected a map", i+1)
+		}
+		r, err := parseRule(m)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parseRule parses a single rule (see parseRules).
+func parseRule(m map[string]any) (*rule, error) {
+	for key := range m {
+		if !slices.Contains([]string{"selector", "op", "value", "severity"}, key) {
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	r := &rule{op: fmt.Sprint(m["op"]), severity: severityWarn}
+	sel, _ := m["selector"].(string)
+	var err error
+	if r.selector, err = metrics.ParseSelector(sel); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(assertionOps, r.op) {
+		return nil, fmt.Errorf("invalid op %q (expected one of %s)", r.op, strings.Join(assertionOps, ", "))
+	}
+	value := strings.TrimSpace(fmt.Sprint(m["value"]))
+	value, r.rate = strings.CutSuffix(value, "/s")
+	if r.value, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+		return nil, fmt.Errorf("invalid value %q", m["value"])
+	}
+	if s, ok := m["severity"]; ok {
+		if r.severity, ok = severityNames[fmt.Sprint(s)]; !ok {
+			return nil, fmt.Errorf("unknown severity %q (expected warn or critical)", s)
+		}
+	}
+	r.text = sel + " " + r.op + " " + value
+	if r.rate {
+		r.text += "/s"
+	}
+	return r, nil
+}
+
+// checkSample evaluates the alert rules against the latest sample of the
+// given target (with -bell, ringing the terminal bell if any of them started
+// firing), logs the events of the sample (see logSample, logDuplicates, and
+// logSkipped), and checks the watched series (see checkWatches).
+func (m *model) checkSample(t *target) {
+	dump, _ := t.store.Dump("")
+	prev := t.rules
+	var started bool
+	if len(m.rules) > 0 {
+		t.rules, started = evaluateRules(m.rules, dump, prev)
+	}
+	if started && m.bell {
+		_, _ = fmt.Fprint(m.terminal, "\a")
+	}
+	m.logSample(t, dump, prev)
+	m.logDuplicates(t, t.store.Duplicates())
+	m.logSkipped(t, t.store.Skipped())
+	m.checkWatches(t, dump)
+}
+
+// rateOf returns the instant per-second rate of the given series (between its
+// latest two observations) as derived by metrics.Deriver. It returns false, if
+// there is no rate (yet).
+func rateOf(series []metrics.Observation) (float64, bool) {
+	if len(series) < 2 {
+		return 0, false
+	}
+	derived := metrics.Deriver{RateKinds: []metrics.ObservationKind{series[0].Kind}}.Derive(series[:2])
+	v := derived[1][0].Value
+	return v, !math.IsNaN(v)
+}
+
+// evaluateRules evaluates the rules against the latest observations of the
+// series in the given dump. It also returns true, if any rule started firing
+// since the given previous state.
+func evaluateRules(rules []*rule, dump [][]metrics.Observation, prev ruleState) (ruleState, bool) {
+	state := ruleState{firing: make(map[*rule]bool), series: make(map[string]severity)}
+	started := false
+	for _, r := range rules {
+		for _, series := range dump {
+			o := series[0]
+			if o.Stale || !r.selector.Matches(o) {
+				continue
+			}
+			v := o.Value
+			if r.rate {
+				var ok bool
+				if v, ok = rateOf(series); !ok {
+					continue
+				}
+			}
+			if !crosses(r.op, r.value, v) {
+				continue
+			}
+			state.firing[r] = true
+			state.series[o.Name] = max(state.series[o.Name], r.severity)
+		}
+		started = started || (state.firing[r] && !prev.firing[r])
+	}
+	return state, started
+}
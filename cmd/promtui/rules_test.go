@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/sebogh/promtui/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+		err      string
+	}{
+		{"none", "interval: 2s", nil, ""},
+		{"value", "rules:\n  - {selector: queue_depth, op: '>', value: 1000}", []string{"queue_depth > 1000 (warn)"}, ""},
+		{"rate", "rules:\n  - {selector: 'errors_total{code=~\"5..\"}', op: '>=', value: 5/s, severity: critical}", []string{`errors_total{code=~"5.."} >= 5/s (critical)`}, ""},
+		{"not a list", "rules: queue_depth > 1", nil, "expected a list of rules"},
+		{"unknown key", "rules:\n  - {selector: up, op: '<', value: 1, for: 5m}", nil, `rule 1: unknown key "for"`},
+		{"invalid op", "rules:\n  - {selector: up, op: '=', value: 1}", nil, `rule 1: invalid op "="`},
+		{"invalid value", "rules:\n  - {selector: up, op: '<', value: one}", nil, `rule 1: invalid value "one"`},
+		{"invalid selector", "rules:\n  - {selector: 'up{', op: '<', value: 1}", nil, "rule 1:"},
+		{"unknown severity", "rules:\n  - {selector: up, op: '<', value: 1, severity: page}", nil, `rule 1: unknown severity "page"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config map[string]any
+			if err := yaml.Unmarshal([]byte(tt.config), &config); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			rules, err := parseRules(config)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual []string
+			for _, r := range rules {
+				sev := "warn"
+				if r.severity == severityCritical {
+					sev = "critical"
+				}
+				actual = append(actual, r.text+" ("+sev+")")
+			}
+			if strings.Join(actual, "; ") != strings.Join(tt.expected, "; ") {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+			if _, ok := config[rulesKey]; ok {
+				t.Errorf("Expected the rules to be removed from the config")
+			}
+		})
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	now := time.Now()
+	series := func(name string, values ...float64) []metrics.Observation {
+		var obs []metrics.Observation
+		for i, v := range values {
+			obs = append(obs, metrics.Observation{Name: name, Metric: name, Value: v, Time: now.Add(-time.Duration(i) * 10 * time.Second)})
+		}
+		return obs
+	}
+	parse := func(s string) *rule {
+		var m map[string]any
+		if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		r, err := parseRule(m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return r
+	}
+	depth := parse("{selector: queue_depth, op: '>', value: 1000}")
+	errs := parse("{selector: errors_total, op: '>', value: 5/s, severity: critical}")
+	rules := []*rule{depth, errs}
+
+	// 100 errors in 10 seconds are 10/s.
+	dump := [][]metrics.Observation{series("queue_depth", 1200), series("errors_total", 150, 50)}
+	state, started := evaluateRules(rules, dump, ruleState{})
+	if !started || len(state.firing) != 2 {
+		t.Errorf("Expected both rules to start firing, but got %v", state.firing)
+	}
+	if state.series["queue_depth"] != severityWarn || state.series["errors_total"] != severityCritical {
+		t.Errorf("Expected the series by severity, but got %v", state.series)
+	}
+	if state.severity() != severityCritical {
+		t.Errorf("Expected %v, but got %v", severityCritical, state.severity())
+	}
+
+	// Rules still firing do not start again. Without a previous sample,
+	// there is no rate.
+	dump = [][]metrics.Observation{series("queue_depth", 1100), series("errors_total", 150)}
+	state, started = evaluateRules(rules, dump, state)
+	if started || !state.firing[depth] || state.firing[errs] {
+		t.Errorf("Expected only the depth to keep firing, but got %v (started %v)", state.firing, started)
+	}
+}
+
+func TestModel_CheckRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := os.WriteFile(path, []byte("# TYPE queue_depth gauge\nqueue_depth 2000\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sel, err := metrics.ParseSelector("queue_depth")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var terminal bytes.Buffer
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(200, 10),
+		rules:    []*rule{{selector: sel, op: ">", value: 1000, severity: severityWarn}},
+		bell:     true,
+		terminal: &terminal,
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.checkSample(m.target())
+	m.metricsView()
+	if terminal.String() != "\a" {
+		t.Errorf("Expected the bell, but got %q", terminal.String())
+	}
+	if header := m.headerView(); !strings.Contains(header, " firing rules: 1 -") {
+		t.Errorf("Expected the firing rules in the header, but got %q", header)
+	}
+	for _, r := range m.rows {
+		if expected := r.name == "queue_depth"; (r.alert == severityWarn) != expected {
+			t.Errorf("Expected alert %v for %s, but got %v", expected, r.name, r.alert)
+		}
+	}
+
+	// The bell rings only when a rule starts firing.
+	m.checkSample(m.target())
+	if terminal.String() != "\a" {
+		t.Errorf("Expected a single bell, but got %q", terminal.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// runtimePrefixes are the prefixes of the metric families exported by the
+// client libraries for the Go runtime, the process, and the metrics handler
+// itself, which are hidden by -hide-runtime.
+var runtimePrefixes = []string{"go_", "process_", "promhttp_"}
+
+// isRuntime returns true, if the given family is a runtime family (see
+// runtimePrefixes).
+func isRuntime(family string) bool {
+	for _, p := range runtimePrefixes {
+		if strings.HasPrefix(family, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchesRuntime returns true, if the given search names a runtime family
+// (e.g. "go_goroutines"), which is then shown even while runtime families are
+// hidden.
+func searchesRuntime(search string) bool {
+	for _, p := range runtimePrefixes {
+		if strings.Contains(search, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutRuntime returns the series of the given dump not belonging to a
+// runtime family, unless the search names one.
+func withoutRuntime(dump [][]metrics.Observation, search string) [][]metrics.Observation {
+	if searchesRuntime(search) {
+		return dump
+	}
+	kept := make([][]metrics.Observation, 0, len(dump))
+	for _, series := range dump {
+		if !isRuntime(series[0].Family()) {
+			kept = append(kept, series)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestWithoutRuntime(t *testing.T) {
+	dump := [][]metrics.Observation{
+		{{Name: "go_goroutines", Metric: "go_goroutines"}},
+		{{Name: "process_cpu_seconds_total", Metric: "process_cpu_seconds_total"}},
+		{{Name: "promhttp_metric_handler_requests_total", Metric: "promhttp_metric_handler_requests_total"}},
+		{{Name: "http_requests_total", Metric: "http_requests_total"}},
+		{{Name: "cargo_loaded_total", Metric: "cargo_loaded_total"}},
+	}
+	tests := []struct {
+		search   string
+		expected int
+	}{
+		{"", 2},
+		{"total", 2},
+		{"go_goroutines", 5},
+		{"process_", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			actual := withoutRuntime(dump, tt.search)
+			if len(actual) != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, len(actual))
+			}
+		})
+	}
+	if len(dump) != 5 || dump[0][0].Name != "go_goroutines" {
+		t.Errorf("Expected the dump to be unmodified, but got %v", dump)
+	}
+}
+
+func TestModel_UpdateRuntime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE go_goroutines gauge\ngo_goroutines 12\n# TYPE queue_length gauge\nqueue_length 3\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		filter:   seriesFilter{hideRuntime: true},
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.metricsView()
+	if hasRow(m, "go_goroutines") || !hasRow(m, "queue_length") {
+		t.Errorf("Expected only go_goroutines to be hidden, but got %v", m.rows)
+	}
+	if !strings.Contains(m.footerView(), "(runtime metrics hidden)") {
+		t.Errorf("Expected the runtime metrics to be hidden, but got %q", m.footerView())
+	}
+
+	// Searching for a runtime family finds it anyway.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("go_gor")})
+	m.metricsView()
+	if len(m.rows) != 1 || m.rows[0].name != "go_goroutines" {
+		t.Errorf("Expected to find go_goroutines, but got %v", m.rows)
+	}
+	if strings.Contains(m.footerView(), "(runtime metrics hidden)") {
+		t.Errorf("Expected the runtime metrics not to be hidden, but got %q", m.footerView())
+	}
+
+	// The toggle shows them along with the others.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	if m.filter.hideRuntime || !hasRow(m, "go_goroutines") || !hasRow(m, "queue_length") {
+		t.Errorf("Expected all rows, but got %v", m.rows)
+	}
+}
+
+// hasRow returns true, if the model has a row with the given name.
+func hasRow(m *model, name string) bool {
+	for _, r := range m.rows {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// targetsRefresh is the interval the targets file is re-read at.
+const targetsRefresh = 30 * time.Second
+
+// targetsFile is a Prometheus file_sd file listing the targets to sample (e.g.
+// `[{"targets": ["host:9100"], "labels": {"job": "node"}}]`).
+type targetsFile struct {
+	path string
+
+	// metricsPath is the path of the endpoints, unless overridden by the
+	// __metrics_path__ label.
+	metricsPath string
+}
+
+// sdGroup is a group of targets sharing labels.
+type sdGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdTarget is a target read from a targets file.
+type sdTarget struct {
+	endpoint string
+
+	// title names the target in the header (its address and labels).
+	title string
+}
+
+// read reads the targets from the file. Malformed groups and targets are
+// skipped and counted.
+func (f targetsFile) read() ([]sdTarget, int, error) {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read targets file: %w", err)
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, 0, fmt.Errorf("parse targets file %s: %w", f.path, err)
+	}
+	var targets []sdTarget
+	seen := make(map[string]bool)
+	skipped := 0
+	for _, r := range raw {
+		var g sdGroup
+		if err := json.Unmarshal(r, &g); err != nil || len(g.Targets) == 0 {
+			skipped++
+			continue
+		}
+		scheme, path := "http", f.metricsPath
+		if s, ok := g.Labels["__scheme__"]; ok {
+			scheme = s
+		}
+		if p, ok := g.Labels["__metrics_path__"]; ok {
+			path = p
+		}
+		var labels []metrics.Label
+		for name, value := range g.Labels {
+			if !strings.HasPrefix(name, "__") {
+				labels = append(labels, metrics.Label{Name: name, Value: value})
+			}
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		for _, address := range g.Targets {
+			u, err := url.Parse(scheme + "://" + address)
+			if err != nil || address == "" || u.Host != address || (scheme != "http" && scheme != "https") {
+				skipped++
+				continue
+			}
+			u.Path = "/" + strings.TrimPrefix(path, "/")
+			endpoint := u.String()
+			if seen[endpoint] {
+				continue
+			}
+			seen[endpoint] = true
+			title := address
+			if len(labels) > 0 {
+				title += " {" + canonicalLabels(labels) + "}"
+			}
+			targets = append(targets, sdTarget{endpoint: endpoint, title: title})
+		}
+	}
+	return targets, skipped, nil
+}
+
+// targetsMsg reports the targets read from the targets file.
+type targetsMsg struct {
+	targets []sdTarget
+	skipped int
+	error   error
+}
+
+// readTargetsCmd returns a command that re-reads the targets file after
+// targetsRefresh.
+func (m *model) readTargetsCmd() tea.Cmd {
+	f := m.targetsFile
+	return tea.Tick(targetsRefresh, func(time.Time) tea.Msg {
+		targets, skipped, err := f.read()
+		return targetsMsg{targets: targets, skipped: skipped, error: err}
+	})
+}
+
+// updateTargets replaces the targets by the given ones, keeping the state of
+// those already known. The current target stays selected (if it still
+// exists). It returns a command sampling the new targets.
+func (m *model) updateTargets(sds []sdTarget) tea.Cmd {
+	known := make(map[string]*target, len(m.targets))
+	for _, t := range m.targets {
+		known[t.endpoint] = t
+	}
+	current := m.target()
+	var targets []*target
+	var cmds []tea.Cmd
+	for _, sd := range sds {
+		t, ok := known[sd.endpoint]
+		if !ok {
+			src, err := newSource(sd.endpoint, m.httpOptions)
+			if err != nil {
+				continue
+			}
+			t = &target{source: src, endpoint: sd.endpoint, store: m.newStore(src.fetcher)}
+			cmds = append(cmds, m.sampleTargetCmd(t, 0))
+		}
+		t.title = sd.title
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		// Keep showing the last targets rather than nothing.
+		return nil
+	}
+	m.targets, m.current = targets, min(m.current, len(targets)-1)
+	for i, t := range targets {
+		if t == current {
+			m.current = i
+		}
+	}
+	m.metricsView()
+	return tea.Batch(cmds...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestTargetsFile_Read(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sd.json")
+	content := `[
+  {"targets": ["api-1:8080", "api-2:8080"], "labels": {"job": "api", "env": "prod", "__meta_x": "y"}},
+  {"targets": ["node:9100"], "labels": {"__metrics_path__": "/node/metrics", "__scheme__": "https"}},
+  {"targets": ["api-1:8080", "", "bad/host", "ok:1"]},
+  {"targets": []},
+  {"targets": "api-3:8080"},
+  42
+]`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	targets, skipped, err := targetsFile{path: path, metricsPath: "metrics"}.read()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []sdTarget{
+		{endpoint: "http://api-1:8080/metrics", title: `api-1:8080 {env="prod",job="api"}`},
+		{endpoint: "http://api-2:8080/metrics", title: `api-2:8080 {env="prod",job="api"}`},
+		{endpoint: "https://node:9100/node/metrics", title: "node:9100"},
+		{endpoint: "http://ok:1/metrics", title: "ok:1"},
+	}
+	if !slices.Equal(targets, expected) {
+		t.Errorf("Expected %v, but got %v", expected, targets)
+	}
+	if skipped != 5 {
+		t.Errorf("Expected 5 skipped, but got %d", skipped)
+	}
+
+	if _, _, err := (targetsFile{path: filepath.Join(t.TempDir(), "missing.json")}).read(); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
+
+func TestModel_UpdateTargets(t *testing.T) {
+	m := newTestModel()
+	m.newStore = func(f metrics.Fetcher) *metrics.Store { return metrics.NewStore(3, f) }
+	m.updateTargets([]sdTarget{{endpoint: "http://a/metrics"}, {endpoint: "http://b/metrics"}, {endpoint: "http://c/metrics"}})
+	m.current = 1
+	b := m.target()
+
+	m.updateTargets([]sdTarget{{endpoint: "http://b/metrics", title: "b"}, {endpoint: "http://d/metrics"}})
+	if len(m.targets) != 2 || m.target() != b || b.title != "b" {
+		t.Errorf("Expected target b to be kept and selected, but got %d targets and %q", len(m.targets), m.target().endpoint)
+	}
+
+	m.updateTargets(nil)
+	if len(m.targets) != 2 {
+		t.Errorf("Expected the targets to be kept, but got %d", len(m.targets))
+	}
+
+	m.current = 1
+	m.updateTargets([]sdTarget{{endpoint: "http://b/metrics"}})
+	if m.current != 0 {
+		t.Errorf("Expected target 0, but got %d", m.current)
+	}
+}
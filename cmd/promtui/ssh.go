@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTimeout bounds establishing the connection to a jump host.
+const sshTimeout = 10 * time.Second
+
+// sshKeys are the default private keys (in ~/.ssh) authenticated with, along
+// with those of the SSH agent.
+var sshKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// parseSSHEndpoint splits the given endpoint tunneled through a jump host
+// (e.g. "ssh://bastion.example.com/http://10.0.1.5:9100/metrics") into the
+// jump host and the inner endpoint. It returns false for other endpoints.
+func parseSSHEndpoint(endpoint string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(endpoint, "ssh://")
+	if !ok {
+		return "", "", false
+	}
+	jump, inner, _ := strings.Cut(rest, "/")
+	return jump, inner, true
+}
+
+// sshDialer dials connections through a jump host (e.g. user@bastion:22). The
+// connection to the jump host is established on the first dial and again
+// after it dropped.
+type sshDialer struct {
+	addr   string
+	home   string
+	config *ssh.ClientConfig
+
+	mux    sync.Mutex
+	client *ssh.Client
+}
+
+// sshDialers are the dialers of the jump hosts in use, shared by their
+// targets.
+var (
+	sshDialersMux sync.Mutex
+	sshDialers    = make(map[string]*sshDialer)
+)
+
+// sshHTTPClient returns a client sending requests through the given jump host
+// ([user@]host[:port]), authenticating with the keys of the SSH agent and the
+// default keys (see sshKeys), and verifying the host key of the jump host by
+// ~/.ssh/known_hosts, unless insecure is set.
+func sshHTTPClient(jump string, insecure bool) (*http.Client, error) {
+	sshDialersMux.Lock()
+	defer sshDialersMux.Unlock()
+	key := fmt.Sprintf("%s %t", jump, insecure)
+	d, ok := sshDialers[key]
+	if !ok {
+		var err error
+		if d, err = newSSHDialer(jump, insecure); err != nil {
+			return nil, err
+		}
+		sshDialers[key] = d
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = d.DialContext
+	transport.MaxIdleConnsPerHost = 2
+	transport.IdleConnTimeout = 5 * time.Minute
+	return &http.Client{Transport: transport}, nil
+}
+
+// newSSHDialer returns the dialer of the given jump host (see sshHTTPClient).
+func newSSHDialer(jump string, insecure bool) (*sshDialer, error) {
+	u, err := url.Parse("ssh://" + jump)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid jump host %q (expected [user@]host[:port])", jump)
+	}
+	name := u.User.Username()
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: no user: %w", jump, err)
+		}
+		name = current.Username
+	}
+	addr := net.JoinHostPort(u.Hostname(), "22")
+	if u.Port() != "" {
+		addr = u.Host
+	}
+	home, _ := os.UserHomeDir()
+	hostKey := ssh.InsecureIgnoreHostKey()
+	if !insecure {
+		if hostKey, err = knownhosts.New(filepath.Join(home, ".ssh", "known_hosts")); err != nil {
+			return nil, fmt.Errorf("jump host %s: read known hosts (or pass -ssh-insecure): %w", jump, err)
+		}
+	}
+	// The keys are added on connecting (see connect).
+	config := &ssh.ClientConfig{
+		User:            name,
+		HostKeyCallback: hostKey,
+		Timeout:         sshTimeout,
+	}
+	return &sshDialer{addr: addr, home: home, config: config}, nil
+}
+
+// sshSigners returns the keys of the SSH agent (if running) and the default
+// keys in the given home directory (see sshKeys) not protected by a
+// passphrase, along with a function closing the connection to the agent,
+// which its keys sign through.
+func sshSigners(home string) ([]ssh.Signer, func()) {
+	var signers []ssh.Signer
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { _ = conn.Close() }
+			if s, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, s...)
+			}
+		}
+	}
+	for _, name := range sshKeys {
+		b, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if s, err := ssh.ParsePrivateKey(b); err == nil {
+			signers = append(signers, s)
+		}
+	}
+	return signers, closeAgent
+}
+
+// hostKeyAlgorithms returns the algorithms of the keys the given host key
+// callback knows for the given jump host (see knownhosts), so that the jump
+// host presents one of them rather than the one it prefers, which may be
+// unknown. It returns none for unknown hosts (and without verification),
+// leaving the choice to the jump host.
+func hostKeyAlgorithms(callback ssh.HostKeyCallback, addr string, remote net.Addr) []string {
+	var keyErr *knownhosts.KeyError
+	if err := callback(addr, remote, probeKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		types := []string{known.Key.Type()}
+		if types[0] == ssh.KeyAlgoRSA {
+			// RSA keys are presented with SHA-2 signatures, unless the
+			// jump host supports SHA-1 only.
+			types = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, t := range types {
+			if !slices.Contains(algorithms, t) {
+				algorithms = append(algorithms, t)
+			}
+		}
+	}
+	return algorithms
+}
+
+// probeKey is a host key known for no host, with which hostKeyAlgorithms
+// probes the known keys.
+type probeKey struct{}
+
+func (probeKey) Type() string {
+	return "probe"
+}
+
+func (probeKey) Marshal() []byte {
+	return []byte("probe")
+}
+
+func (probeKey) Verify([]byte, *ssh.Signature) error {
+	return errors.New("probe key")
+}
+
+// DialContext dials the given address through the jump host. A failed dial
+// is retried once over a new connection to the jump host, as the previous one
+// may have dropped.
+func (d *sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	for retry := false; ; retry = true {
+		client, err := d.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := client.DialContext(ctx, network, addr)
+		if err == nil || retry || ctx.Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("dial %s through %s: %w", addr, d.addr, err)
+			}
+			return conn, nil
+		}
+		d.drop(client)
+	}
+}
+
+// connect returns the connection to the jump host, establishing it if there
+// is none.
+func (d *sshDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to jump host %s: %w", d.addr, err)
+	}
+	config := *d.config
+	config.HostKeyAlgorithms = hostKeyAlgorithms(config.HostKeyCallback, d.addr, conn.RemoteAddr())
+	signers, closeAgent := sshSigners(d.home)
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+	_ = conn.SetDeadline(time.Now().Add(sshTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, d.addr, &config)
+	_ = conn.SetDeadline(time.Time{})
+	// The keys of the agent are needed for the handshake only.
+	closeAgent()
+	if err != nil {
+		_ = conn.Close()
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			return nil, fmt.Errorf("verify jump host %s (see ~/.ssh/known_hosts or -ssh-insecure): %w", d.addr, err)
+		}
+		return nil, fmt.Errorf("connect to jump host %s: %w", d.addr, err)
+	}
+	d.client = ssh.NewClient(c, chans, reqs)
+	return d.client, nil
+}
+
+// drop closes the given connection to the jump host, unless replaced in the
+// meantime.
+func (d *sshDialer) drop(client *ssh.Client) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.client == client {
+		_ = client.Close()
+		d.client = nil
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseSSHEndpoint(t *testing.T) {
+	jump, inner, ok := parseSSHEndpoint("ssh://ops@bastion.example.com:2222/http://10.0.1.5:9100/metrics")
+	if !ok || jump != "ops@bastion.example.com:2222" || inner != "http://10.0.1.5:9100/metrics" {
+		t.Errorf("Unexpected jump host %q and endpoint %q", jump, inner)
+	}
+	if _, _, ok := parseSSHEndpoint("http://10.0.1.5:9100/metrics"); ok {
+		t.Errorf("Expected no jump host")
+	}
+}
+
+// startSSHServer starts a jump host accepting the given client key and
+// forwarding connections (direct-tcpip), and returns its address.
+func startSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					var target struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &target) != nil {
+						_ = nc.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+					if err != nil {
+						_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, chReqs, err := nc.Accept()
+					if err != nil {
+						_ = upstream.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+					go func() {
+						_, _ = io.Copy(ch, upstream)
+						_ = ch.Close()
+					}()
+					go func() {
+						_, _ = io.Copy(upstream, ch)
+						_ = upstream.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNewSource_SSH(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "up 1\n")
+	}))
+	defer srv.Close()
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(hostPriv)
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	sshClientPub, _ := ssh.NewPublicKey(clientPub)
+	addr := startSSHServer(t, hostKey, sshClientPub)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	knownHosts := filepath.Join(home, ".ssh", "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	endpoint := "ssh://test@" + addr + "/" + srv.URL + "/metrics"
+
+	// The jump host is unknown.
+	src, err := newSource(endpoint, httpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := src.fetcher.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "verify jump host") {
+		t.Errorf("Expected host key verification to fail, but got %v", err)
+	}
+
+	// Insecure, and once known (by a new dialer, as known hosts are read
+	// once), the endpoint is reached through it.
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey.PublicKey()) + "\n"
+	if err := os.WriteFile(knownHosts, []byte(line), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, opts := range []httpOptions{{sshInsecure: true}, {sshJump: "known@" + addr}} {
+		target := endpoint
+		if opts.sshJump != "" {
+			target = srv.URL + "/metrics"
+		}
+		src, err := newSource(target, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		r, _, err := src.fetcher.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, _ := io.ReadAll(r)
+		_ = r.Close()
+		if string(b) != "up 1\n" {
+			t.Errorf("Unexpected body %q", b)
+		}
+	}
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := ssh.NewSignerFromKey(edPriv)
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecKey, _ := ssh.NewSignerFromKey(ecPriv)
+	addr := "10.0.1.2:2222"
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	content := knownhosts.Line([]string{knownhosts.Normalize(addr)}, ecKey.PublicKey()) + "\n" +
+		knownhosts.Line([]string{knownhosts.Normalize(addr)}, edKey.PublicKey()) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.1.2"), Port: 2222}
+
+	// The jump host is asked for the known keys, in their order.
+	expected := ssh.KeyAlgoECDSA256 + " " + ssh.KeyAlgoED25519
+	if actual := strings.Join(hostKeyAlgorithms(callback, addr, remote), " "); actual != expected {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+	if actual := hostKeyAlgorithms(callback, "10.0.1.3:22", &net.TCPAddr{IP: net.ParseIP("10.0.1.3"), Port: 22}); actual != nil {
+		t.Errorf("Expected no algorithms for an unknown host, but got %v", actual)
+	}
+	if actual := hostKeyAlgorithms(ssh.InsecureIgnoreHostKey(), addr, remote); actual != nil {
+		t.Errorf("Expected no algorithms without verification, but got %v", actual)
+	}
+}
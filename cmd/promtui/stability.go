@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// stabilize returns the given sorted series reordered towards their given
+// previous ranks (keyed by name, see ranks): series moving by at most the
+// given number of positions keep their previous rank, so that rows do not
+// jump around with every sample, while those moving further (and new ones)
+// take their new rank. Ties go to the series ranked higher in the given
+// order.
+func stabilize(sorted [][]metrics.Observation, prev map[string]int, positions int) [][]metrics.Observation {
+	if positions <= 0 || len(prev) == 0 {
+		return sorted
+	}
+	keys := make(map[string]int, len(sorted))
+	for i, series := range sorted {
+		keys[series[0].Name] = i
+		if j, ok := prev[series[0].Name]; ok && abs(i-j) <= positions {
+			keys[series[0].Name] = j
+		}
+	}
+	stable := slices.Clone(sorted)
+	slices.SortStableFunc(stable, func(a, b []metrics.Observation) int {
+		return keys[a[0].Name] - keys[b[0].Name]
+	})
+	return stable
+}
+
+// ranks returns the ranks of the given series by name (see stabilize).
+func ranks(dump [][]metrics.Observation) map[string]int {
+	r := make(map[string]int, len(dump))
+	for i, series := range dump {
+		r[series[0].Name] = i
+	}
+	return r
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
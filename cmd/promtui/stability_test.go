@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestStabilize(t *testing.T) {
+	now := time.Now()
+	dump := func(names string) [][]metrics.Observation {
+		var d [][]metrics.Observation
+		for _, name := range strings.Split(names, " ") {
+			d = append(d, []metrics.Observation{metrics.NewObservation(name, nil, metrics.ObservationGauge, now, 1)})
+		}
+		return d
+	}
+	names := func(d [][]metrics.Observation) string {
+		var s []string
+		for _, series := range d {
+			s = append(s, series[0].Name)
+		}
+		return strings.Join(s, " ")
+	}
+	tests := []struct {
+		name      string
+		prev      string
+		sorted    string
+		positions int
+		expected  string
+	}{
+		{"swapped neighbors", "a b c d e f", "a c b d e f", 2, "a b c d e f"},
+		{"moved far", "a b c d e f", "b c d e f a", 2, "b c d e f a"},
+		{"new series", "a b c d", "x a b c d", 2, "x a b c d"},
+		{"vanished series", "a b c d", "a c d", 2, "a c d"},
+		{"exact", "a b c d e f", "a c b d e f", 0, "a c b d e f"},
+		{"first sort", "", "b a", 2, "b a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prev map[string]int
+			if tt.prev != "" {
+				prev = ranks(dump(tt.prev))
+			}
+			if actual := names(stabilize(dump(tt.sorted), prev, tt.positions)); actual != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, actual)
+			}
+		})
+	}
+
+	// Series jittering by at most the given number of positions around a
+	// stable order keep their rows.
+	r := rand.New(rand.NewSource(1))
+	base := dump("a b c d e f g h i j k l")
+	prev := ranks(base)
+	for range 100 {
+		sorted := append([][]metrics.Observation(nil), base...)
+		for i := 0; i+1 < len(sorted); i += 2 {
+			if r.Intn(2) == 0 {
+				sorted[i], sorted[i+1] = sorted[i+1], sorted[i]
+			}
+		}
+		stable := stabilize(sorted, prev, 1)
+		if names(stable) != names(base) {
+			t.Fatalf("Expected %q, but got %q", names(base), names(stable))
+		}
+		prev = ranks(stable)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// stateVersion is the version of the state file. State files of other
+// versions are ignored.
+const stateVersion = 1
+
+// Keys of the state file besides the flags (see model.state).
+const (
+	stateVersionKey = "version"
+	stateTargetKey  = "target"
+)
+
+// stateDir returns the directory of the state files (e.g.
+// ~/.local/state/promtui), or an empty string if there is no home directory.
+func stateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "promtui")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "state", "promtui")
+}
+
+// statePath returns the path of the state file of the given target (e.g. the
+// endpoints), or an empty string if there is no state directory.
+func statePath(dir, target string) string {
+	if dir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(target))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".yaml")
+}
+
+// loadState reads the state file at the given path, which maps flag names to
+// values like the config file. Missing and corrupt files, and files of other
+// versions or targets, are ignored (i.e. nil is returned).
+func loadState(path, target string) map[string]any {
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state map[string]any
+	if err := yaml.Unmarshal(b, &state); err != nil {
+		return nil
+	}
+	if state[stateVersionKey] != stateVersion || state[stateTargetKey] != target {
+		return nil
+	}
+	delete(state, stateVersionKey)
+	delete(state, stateTargetKey)
+	return state
+}
+
+// restoreState sets the flags of the given state, except those set already
+// (i.e. given on the command line, in the environment, or by the config, see
+// applyConfig), so that the state only replaces the defaults. Invalid values
+// are ignored, so that they do not prevent starting.
+func restoreState(flags *flag.FlagSet, state map[string]any) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, v := range state {
+		if set[name] || flags.Lookup(name) == nil {
+			continue
+		}
+		switch v.(type) {
+		case []any, map[string]any, nil:
+			continue
+		}
+		old := flags.Lookup(name).Value.String()
+		if err := flags.Set(name, fmt.Sprint(v)); err != nil {
+			_ = flags.Set(name, old)
+		}
+	}
+}
+
+// saveState writes the given state of the given target to the state file at
+// the given path.
+func saveState(path, target string, state map[string]any) error {
+	state[stateVersionKey] = stateVersion
+	state[stateTargetKey] = target
+	b, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
+
+// state returns the settings of the view that are changed at runtime (e.g.
+// the search), keyed by the names of the flags setting them.
+func (m *model) state() map[string]any {
+	sort := "name"
+	if m.unchanged == unchangedSorted {
+		sort = "unchanged"
+	}
+	var types, arrows string
+	if m.filter.types != 0 {
+		types = m.filter.types.String()
+	}
+	if m.arrows != 0 {
+		arrows = m.arrows.String()
+	}
+	var top int
+	if m.showTop {
+		top = m.top
+	}
+	return map[string]any{
+		"search":         m.search,
+		"sort":           sort,
+		"unchanged-for":  m.unchanged != unchangedHidden,
+		"expand-history": m.expandHistory,
+		"common-labels":  m.hoistLabels,
+		"hide-runtime":   m.filter.hideRuntime,
+		"hide-zero":      m.filter.hideZero,
+		"hide-unchanged": m.filter.hideUnchanged,
+		"types":          types,
+		"arrows":         arrows,
+		"top":            top,
+		"raw-values":     !m.formatter.humanize,
+		"number-format":  m.formatter.numbers.String(),
+		"aggregate":      aggregationFlag(m.aggregation),
+		"compare":        m.compare,
+		"pivot":          m.pivot,
+	}
+}
+
+// aggregationFlag returns the given aggregation as parsed by parseAggregation
+// (e.g. "without=code,pod gauges=max"), or an empty string if there is none.
+func aggregationFlag(a metrics.Aggregation) string {
+	if len(a.Without) == 0 {
+		return ""
+	}
+	s := "without=" + strings.Join(a.Without, ",")
+	if a.Gauges != metrics.AggregateSum {
+		s += " gauges=" + a.Gauges.String()
+	}
+	return s
+}
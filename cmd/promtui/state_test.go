@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestState(t *testing.T) {
+	path := statePath(t.TempDir(), "http://a/metrics")
+	m := &model{
+		search:      "requests",
+		unchanged:   unchangedSorted,
+		filter:      seriesFilter{hideZero: true, types: 1 << typeGauge},
+		aggregation: metrics.Aggregation{Without: []string{"code", "pod"}, Gauges: metrics.AggregateMax},
+	}
+	if err := saveState(path, "http://a/metrics", m.state()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Flags given on the command line, in the environment, or by the config
+	// take precedence.
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	search := flags.String("search", "", "")
+	sort := flags.String("sort", "name", "")
+	hideZero := flags.Bool("hide-zero", false, "")
+	types := flags.String("types", "", "")
+	aggregate := flags.String("aggregate", "", "")
+	if err := flags.Parse([]string{"-search", "errors"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	noEnv := func(string) (string, bool) { return "", false }
+	if err := applyConfig(flags, map[string]any{"hide-zero": false}, noEnv, io.Discard); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	restoreState(flags, loadState(path, "http://a/metrics"))
+	if *search != "errors" || *sort != "unchanged" || *hideZero || *types != "gauge" || *aggregate != "without=code,pod gauges=max" {
+		t.Errorf("Expected the restored state, but got %v %v %v %v %v", *search, *sort, *hideZero, *types, *aggregate)
+	}
+
+	// The state of other targets, other versions, and corrupt state is
+	// ignored.
+	if state := loadState(path, "http://b/metrics"); state != nil {
+		t.Errorf("Expected no state, but got %v", state)
+	}
+	for _, content := range []string{"version: 2\ntarget: http://a/metrics\nsearch: x\n", "{{"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if state := loadState(path, "http://a/metrics"); state != nil {
+			t.Errorf("Expected no state, but got %v", state)
+		}
+	}
+	if state := loadState(filepath.Join(t.TempDir(), "missing.yaml"), "http://a/metrics"); state != nil {
+		t.Errorf("Expected no state, but got %v", state)
+	}
+}
+
+func TestRestoreState_Invalid(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	history := flags.Int("history", 3, "")
+	restoreState(flags, map[string]any{"history": "many", "unknown": 1})
+	if *history != 3 {
+		t.Errorf("Expected %v, but got %v", 3, *history)
+	}
+}
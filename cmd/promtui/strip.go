@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/maruel/natural"
+	"github.com/sebogh/promtui/metrics"
+)
+
+// stripPrefixesFlag is a flag that may be given multiple times, each time with
+// a prefix stripped from the names shown (see stripPrefixes).
+type stripPrefixesFlag []string
+
+func (f *stripPrefixesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stripPrefixesFlag) Set(s string) error {
+	if s = strings.TrimSpace(s); s != "" {
+		*f = append(*f, s)
+	}
+	return nil
+}
+
+func (f *stripPrefixesFlag) values() []string {
+	return *f
+}
+
+// prefixOf returns the length of the longest of the given prefixes of the
+// given name, or 0 if none is (or it is all of the name).
+func prefixOf(name string, prefixes []string) int {
+	n := 0
+	for _, p := range prefixes {
+		if len(p) > n && len(p) < len(name) && strings.HasPrefix(name, p) {
+			n = len(p)
+		}
+	}
+	return n
+}
+
+// sortStripped sorts the given series naturally by their names without the
+// longest of the given prefixes (see prefixOf), so that the names shown
+// stay in order.
+func sortStripped(dump [][]metrics.Observation, prefixes []string) [][]metrics.Observation {
+	sorted := slices.Clone(dump)
+	slices.SortStableFunc(sorted, func(a, b []metrics.Observation) int {
+		na, nb := a[0].Name[prefixOf(a[0].Name, prefixes):], b[0].Name[prefixOf(b[0].Name, prefixes):]
+		switch {
+		case natural.Less(na, nb):
+			return -1
+		case natural.Less(nb, na):
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+// stripPrefixes sets the length of the prefix stripped from the names shown
+// of the given rows (see row.stripped) to that of the longest of the given
+// prefixes. Rows whose stripped names would collide with the name shown of
+// another row keep their full names.
+func stripPrefixes(rows []row, prefixes []string) {
+	for i := range rows {
+		rows[i].stripped = prefixOf(rows[i].shownName(), prefixes)
+	}
+	// Falling back to full names may collide again, so that this is repeated
+	// until no names collide.
+	for collided := true; collided; {
+		collided = false
+		count := make(map[string]int, len(rows))
+		for _, r := range rows {
+			count[r.shownName()[r.stripped:]]++
+		}
+		for i, r := range rows {
+			if r.stripped > 0 && count[r.shownName()[r.stripped:]] > 1 {
+				rows[i].stripped, collided = 0, true
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestStripPrefixes(t *testing.T) {
+	prefixes := []string{"mycompany_", "mycompany_paymentservice_"}
+	tests := []struct {
+		name     string
+		names    []string
+		expected []string
+	}{
+		{"longest", []string{"mycompany_paymentservice_requests_total", "mycompany_up"}, []string{"requests_total", "up"}},
+		{"no prefix", []string{"go_goroutines"}, []string{"go_goroutines"}},
+		{"all of the name", []string{"mycompany_"}, []string{"mycompany_"}},
+		{"collision", []string{"mycompany_paymentservice_up", "mycompany_up", "mycompany_requests_total"}, []string{"mycompany_paymentservice_up", "mycompany_up", "requests_total"}},
+		{"collision with a full name", []string{"mycompany_go_goroutines", "go_goroutines"}, []string{"mycompany_go_goroutines", "go_goroutines"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := make([]row, len(tt.names))
+			for i, name := range tt.names {
+				rows[i] = row{name: name}
+			}
+			stripPrefixes(rows, prefixes)
+			var actual []string
+			for _, r := range rows {
+				actual = append(actual, r.shownName()[r.stripped:])
+			}
+			if strings.Join(actual, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSortStripped(t *testing.T) {
+	now := time.Now()
+	var dump [][]metrics.Observation
+	for _, name := range []string{"d", "mycompany_a", "mycompany_e2", "mycompany_e10"} {
+		dump = append(dump, []metrics.Observation{metrics.NewObservation(name, nil, metrics.ObservationGauge, now, 1)})
+	}
+	var actual []string
+	for _, series := range sortStripped(dump, []string{"mycompany_"}) {
+		actual = append(actual, series[0].Name)
+	}
+	if expected := "mycompany_a d mycompany_e2 mycompany_e10"; strings.Join(actual, " ") != expected {
+		t.Errorf("Expected %q, but got %q", expected, strings.Join(actual, " "))
+	}
+}
+
+func TestModel_StripPrefixes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE mycompany_paymentservice_requests_total counter\nmycompany_paymentservice_requests_total 12\n" +
+		"# TYPE go_goroutines gauge\ngo_goroutines 8\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:       []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:        newStyles(nil, false),
+		keys:          newKeymap(),
+		viewport:      viewport.New(120, 10),
+		stripPrefixes: []string{"mycompany_paymentservice_"},
+	}
+	if _, err := m.target().store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.search = "paymentservice"
+	m.metricsView()
+	if view := m.viewport.View(); !strings.Contains(view, " requests_total 12") || strings.Contains(view, "mycompany") {
+		t.Errorf("Expected the prefix to be stripped, but got %q", view)
+	}
+	if !strings.Contains(m.headerView(), "prefix stripped") {
+		t.Errorf("Expected the stripping in the header, but got %q", m.headerView())
+	}
+	if export := m.renderMetrics(lipgloss.NewStyle()); !strings.Contains(export, " mycompany_paymentservice_requests_total 12") {
+		t.Errorf("Expected the full name in exports, but got %q", export)
+	}
+}
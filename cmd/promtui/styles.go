@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// glyphs are the non-ASCII characters of the view, which may be replaced by
+// ASCII ones (see -ascii).
+type glyphs struct {
+	up, down string
+
+	// line fills the header and the footer.
+	line string
+
+	// dash stands for values without an estimate (NaN) and inf for infinite
+	// ones (see special).
+	dash, inf string
+
+	// left separates the values of the expanded history and ellipsis ends
+	// it, if truncated. Long names are shortened with ellipsis, too (see
+	// truncateMiddle).
+	left, ellipsis string
+}
+
+var (
+	unicodeGlyphs = glyphs{up: "⬆", down: "⬇", line: "─", dash: "–", inf: "∞", left: "←", ellipsis: "…"}
+	asciiGlyphs   = glyphs{up: "^", down: "v", line: "-", dash: "-", inf: "Inf", left: "<-", ellipsis: "..."}
+)
+
+// newGlyphs returns the glyphs of the view, only ASCII ones with ascii.
+func newGlyphs(ascii bool) glyphs {
+	if ascii {
+		return asciiGlyphs
+	}
+	return unicodeGlyphs
+}
+
+// palette holds the colors of a theme for one terminal background. Colors are
+// hex colors (e.g. "#FF0000") or ANSI color numbers. Empty colors are not
+// rendered.
+type palette struct {
+	headerFg, headerBg string
+
+	// increase and decrease color the change arrows, muted annotations and
+	// stale series, and new the tag of recently appeared series.
+	increase, decrease, muted, new string
+
+	warning, error string
+
+	// highlight is the background of the rows that changed in the latest
+	// sample.
+	highlight string
+}
+
+var (
+	darkPalette = palette{
+		headerFg: "#FAFAFA", headerBg: "#7D56F4",
+		increase: "#FF0000", decrease: "#00FF00", muted: "#888888", new: "#00FFFF",
+		warning: "#FFA500", error: "#FF0000",
+		highlight: "#3A3A3A",
+	}
+	lightPalette = palette{
+		headerFg: "#FFFFFF", headerBg: "#5A3FC0",
+		increase: "#C00000", decrease: "#007A00", muted: "#6C6C6C", new: "#007C8C",
+		warning: "#B35900", error: "#C00000",
+		highlight: "#E4E4E4",
+	}
+
+	// colorblindPalette avoids red and green (based on the Okabe-Ito
+	// palette).
+	colorblindPalette = palette{
+		headerFg: "#FFFFFF", headerBg: "#0072B2",
+		increase: "#E69F00", decrease: "#56B4E9", muted: "#888888", new: "#CC79A7",
+		warning: "#F0E442", error: "#D55E00",
+		highlight: "#3A3A3A",
+	}
+)
+
+// theme is the set of colors of the view. Each color may differ for light and
+// dark terminal backgrounds.
+type theme struct {
+	light, dark palette
+}
+
+// themes are the themes selectable by -theme. The auto theme adapts to the
+// (detected) background of the terminal, mono uses text attributes only.
+var themes = map[string]theme{
+	"auto":       {light: lightPalette, dark: darkPalette},
+	"dark":       {light: darkPalette, dark: darkPalette},
+	"light":      {light: lightPalette, dark: lightPalette},
+	"colorblind": {light: colorblindPalette, dark: colorblindPalette},
+	"mono":       {},
+}
+
+// themeNames returns the sorted names of the themes.
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// colorNames are the names of the colors that may be overridden (see
+// theme.override).
+var colorNames = []string{"header-fg", "header-bg", "increase", "decrease", "muted"}
+
+// colorPattern matches hex colors and ANSI color numbers.
+var colorPattern = regexp.MustCompile(`^(#[0-9A-Fa-f]{3}|#[0-9A-Fa-f]{6}|[0-9]|[1-9][0-9]|1[0-9][0-9]|2[0-4][0-9]|25[0-5])$`)
+
+// field returns the color of the palette with the given name.
+func (p *palette) field(name string) *string {
+	switch name {
+	case "header-fg":
+		return &p.headerFg
+	case "header-bg":
+		return &p.headerBg
+	case "increase":
+		return &p.increase
+	case "decrease":
+		return &p.decrease
+	case "muted":
+		return &p.muted
+	}
+	return nil
+}
+
+// override sets the color with the given name (see colorNames) for both
+// backgrounds.
+func (t *theme) override(name, color string) error {
+	light, dark := t.light.field(name), t.dark.field(name)
+	if light == nil {
+		return fmt.Errorf("unknown color %q (expected one of %s)", name, strings.Join(colorNames, ", "))
+	}
+	if !colorPattern.MatchString(color) {
+		return fmt.Errorf("invalid color %q for %s (expected e.g. #FF0000 or 196)", color, name)
+	}
+	*light, *dark = color, color
+	return nil
+}
+
+// adaptiveColor returns the color for the given light and dark variants.
+func adaptiveColor(light, dark string) lipgloss.TerminalColor {
+	switch {
+	case light == "" && dark == "":
+		return lipgloss.NoColor{}
+	case light == dark:
+		return lipgloss.Color(dark)
+	}
+	return lipgloss.AdaptiveColor{Light: light, Dark: dark}
+}
+
+// alertStyle returns the style of rows with the given background (see
+// styles.warn). Without a background, the row is reversed instead.
+func alertStyle(light, dark string) lipgloss.Style {
+	if light == "" && dark == "" {
+		return lipgloss.NewStyle().Reverse(true)
+	}
+	return lipgloss.NewStyle().Background(adaptiveColor(light, dark)).Foreground(lipgloss.Color("#000000"))
+}
+
+// styles is the set of styles (and glyphs) the view is rendered with.
+type styles struct {
+	glyphs
+
+	title, info, warning, error lipgloss.Style
+
+	// increase and decrease style the change arrows.
+	increase, decrease lipgloss.Style
+
+	// changed styles changed values, muted annotations and stale series, new
+	// the tag of recently appeared series, highlight the rows that changed in
+	// the latest sample, and match the parts of names matched by the search.
+	changed, muted, new, highlight, match lipgloss.Style
+
+	// warn and critical style the rows of series matched by firing alert
+	// rules (see rule).
+	warn, critical lipgloss.Style
+}
+
+// newStyles returns the styles of the view with the given theme. Without a
+// theme, all styles render plain text. With ascii, only ASCII glyphs are used.
+func newStyles(t *theme, ascii bool) styles {
+	s := styles{glyphs: newGlyphs(ascii)}
+	if t == nil {
+		return s
+	}
+	l, d := t.light, t.dark
+
+	// Without colors (e.g. the mono theme), text attributes set things
+	// apart.
+	s.title = lipgloss.NewStyle().
+		Foreground(adaptiveColor(l.headerFg, d.headerFg)).
+		Background(adaptiveColor(l.headerBg, d.headerBg)).
+		Reverse(l.headerBg == "" && d.headerBg == "")
+	s.info = s.title
+	s.warning = s.info.Foreground(adaptiveColor(l.warning, d.warning))
+	s.error = s.info.Foreground(adaptiveColor(l.error, d.error))
+
+	s.increase = lipgloss.NewStyle().Foreground(adaptiveColor(l.increase, d.increase))
+	s.decrease = lipgloss.NewStyle().Foreground(adaptiveColor(l.decrease, d.decrease))
+	s.changed = lipgloss.NewStyle().Bold(true)
+	s.muted = lipgloss.NewStyle().
+		Foreground(adaptiveColor(l.muted, d.muted)).
+		Faint(l.muted == "" && d.muted == "")
+	s.new = lipgloss.NewStyle().Foreground(adaptiveColor(l.new, d.new))
+	s.highlight = lipgloss.NewStyle().
+		Background(adaptiveColor(l.highlight, d.highlight)).
+		Underline(l.highlight == "" && d.highlight == "")
+	s.match = lipgloss.NewStyle().Reverse(true)
+	s.warn = alertStyle(l.warning, d.warning)
+	s.critical = alertStyle(l.error, d.error).Bold(true)
+	return s
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestTheme_Override(t *testing.T) {
+	tests := []struct {
+		name     string
+		color    string
+		value    string
+		expected string
+		err      bool
+	}{
+		{"hex", "increase", "#E69F00", "#E69F00", false},
+		{"short hex", "header-bg", "#fff", "#fff", false},
+		{"ansi", "muted", "245", "245", false},
+		{"out of range", "muted", "256", "", true},
+		{"invalid", "decrease", "blue", "", true},
+		{"unknown", "background", "#000000", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := themes["auto"]
+			err := th.override(tt.color, tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("Expected error %v, but got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if light, dark := *th.light.field(tt.color), *th.dark.field(tt.color); light != tt.expected || dark != tt.expected {
+				t.Errorf("Expected %v, but got %v and %v", tt.expected, light, dark)
+			}
+			if auto := themes["auto"]; *auto.dark.field(tt.color) == tt.expected {
+				t.Errorf("Expected the auto theme to be unchanged")
+			}
+		})
+	}
+}
+
+func TestAdaptiveColor(t *testing.T) {
+	tests := []struct {
+		name        string
+		light, dark string
+		expected    lipgloss.TerminalColor
+	}{
+		{"none", "", "", lipgloss.NoColor{}},
+		{"same", "#FF0000", "#FF0000", lipgloss.Color("#FF0000")},
+		{"adaptive", "#C00000", "#FF0000", lipgloss.AdaptiveColor{Light: "#C00000", Dark: "#FF0000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := adaptiveColor(tt.light, tt.dark); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// target is a source of metrics along with the store holding its metrics and
+// its state.
+type target struct {
+	source
+
+	// endpoint describes the source (e.g. its URL).
+	endpoint string
+
+	// title names the target in the header instead of the endpoint (unless
+	// empty).
+	title string
+
+	// probed is set, if the path of the endpoint was probed (see probe).
+	probed bool
+
+	store *metrics.Store
+
+	// err is the error of the latest sample (if any).
+	err error
+
+	// lastSample is the time of the latest successful sample, which took
+	// took.
+	lastSample time.Time
+	took       time.Duration
+
+	// failures counts the consecutive failed samples. After backoffFailures
+	// of them, the target is retried at retryAt instead of every interval.
+	// retryGen identifies the latest scheduled retry.
+	failures int
+	retryAt  time.Time
+	retryGen int
+
+	// baseline holds the latest values of the series (by name) at
+	// baselineAt (see setBaseline).
+	baseline   map[string]float64
+	baselineAt time.Time
+
+	// rules is the state of the alert rules after the latest sample (see
+	// model.checkSample).
+	rules ruleState
+
+	// duplicates is the number of duplicate series of the latest sample (see
+	// model.logDuplicates).
+	duplicates int
+
+	// skipped is the number of metric families skipped by the latest sample
+	// (see model.logSkipped).
+	skipped int
+}
+
+// setBaseline snapshots the latest values of the series, so that their
+// changes since then can be shown.
+func (t *target) setBaseline(at time.Time) {
+	dump, _ := t.store.Dump("")
+	t.baseline = make(map[string]float64, len(dump))
+	for _, series := range dump {
+		if o := series[0]; !o.Stale {
+			t.baseline[o.Name] = o.Value
+		}
+	}
+	t.baselineAt = at
+}
+
+// backoffFailures is the number of consecutive failed samples after which a
+// target is retried with exponential backoff.
+const backoffFailures = 3
+
+// endpointsFlag is a flag that may be given multiple times, each time with
+// one or more comma-separated endpoints. Setting the flag replaces the default.
+type endpointsFlag struct {
+	endpoints []string
+	set       bool
+}
+
+func (f *endpointsFlag) String() string {
+	return strings.Join(f.endpoints, ",")
+}
+
+func (f *endpointsFlag) Set(s string) error {
+	if !f.set {
+		f.endpoints, f.set = nil, true
+	}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			f.endpoints = append(f.endpoints, e)
+		}
+	}
+	return nil
+}
+
+func (f *endpointsFlag) values() []string {
+	return f.endpoints
+}
+
+// name returns the title of the target or, if there is none, its endpoint.
+func (t *target) name() string {
+	if t.title != "" {
+		return t.title
+	}
+	return t.endpoint
+}
+
+// recordFailure records a failed sample and returns the delay until the next
+// retry, if the target is to be backed off (and zero otherwise). The delay
+// doubles with each failure, starting at twice the interval, up to the given
+// maximum (zero disables backoff, and so does a zero interval, as manual
+// refreshes are not retried).
+func (t *target) recordFailure(interval, maxBackoff time.Duration) time.Duration {
+	t.failures++
+	if maxBackoff <= 0 || interval <= 0 || t.failures < backoffFailures {
+		return 0
+	}
+	delay := maxBackoff
+	if shift := t.failures - backoffFailures + 1; shift < 32 && interval<<shift < maxBackoff {
+		delay = interval << shift
+	}
+	delay = max(delay, interval)
+	t.retryAt = time.Now().Add(delay)
+	t.retryGen++
+	return delay
+}
+
+// recordSuccess records a successful sample and resets the backoff.
+func (t *target) recordSuccess() {
+	t.failures, t.retryAt = 0, time.Time{}
+	t.retryGen++
+}
+
+// runStats counts the outcomes of the samples of a run.
+type runStats struct {
+	samples int
+	errors  int
+}
+
+// String returns a one-line summary (e.g. "sampled 10 times, 0 errors").
+func (s runStats) String() string {
+	return fmt.Sprintf("sampled %d times, %d errors", s.samples, s.errors)
+}
+
+// record records the outcome of a sample.
+func (s *runStats) record(fetched bool, err error) {
+	switch {
+	case err != nil:
+		s.errors++
+	case fetched:
+		s.samples++
+	}
+}
+
+// sampleAll samples all given targets concurrently and records the outcome
+// in the targets.
+func sampleAll(targets []*target) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, t.err = t.store.Sample(context.Background()); t.err == nil {
+				t.lastSample = time.Now()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEndpointsFlag(t *testing.T) {
+	f := &endpointsFlag{endpoints: []string{"http://localhost/metrics"}}
+	for _, s := range []string{"http://a/metrics, http://b/metrics", "http://c/metrics"} {
+		if err := f.Set(s); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expected := []string{"http://a/metrics", "http://b/metrics", "http://c/metrics"}
+	if !slices.Equal(f.endpoints, expected) {
+		t.Errorf("Expected %v, but got %v", expected, f.endpoints)
+	}
+}
+
+func TestTarget_RecordFailure(t *testing.T) {
+	tt := &target{}
+	var delays []time.Duration
+	for range 7 {
+		delays = append(delays, tt.recordFailure(time.Second, 10*time.Second))
+	}
+	expected := []time.Duration{0, 0, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	if !slices.Equal(delays, expected) {
+		t.Errorf("Expected %v, but got %v", expected, delays)
+	}
+	if tt.failures != 7 || tt.retryAt.IsZero() {
+		t.Errorf("Expected 7 failures and a retry, but got %d and %v", tt.failures, tt.retryAt)
+	}
+
+	tt.recordSuccess()
+	if tt.failures != 0 || !tt.retryAt.IsZero() {
+		t.Errorf("Expected the backoff to be reset, but got %d and %v", tt.failures, tt.retryAt)
+	}
+
+	// The delay is never shorter than the interval.
+	tt = &target{failures: backoffFailures}
+	if delay := tt.recordFailure(time.Minute, 10*time.Second); delay != time.Minute {
+		t.Errorf("Expected %v, but got %v", time.Minute, delay)
+	}
+
+	tt = &target{failures: 10}
+	if delay := tt.recordFailure(time.Second, 0); delay != 0 {
+		t.Errorf("Expected no backoff, but got %v", delay)
+	}
+
+	// Manual refreshes are not retried.
+	tt = &target{failures: 10}
+	if delay := tt.recordFailure(0, 10*time.Second); delay != 0 || !tt.retryAt.IsZero() {
+		t.Errorf("Expected no backoff, but got %v", delay)
+	}
+}
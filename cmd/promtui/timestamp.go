@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// defaultTimestampSuffixes are the suffixes of the names of gauges holding
+// unix timestamps, along with those of -timestamp-suffix (see
+// valueFormatter.isTimestamp).
+var defaultTimestampSuffixes = []string{"_timestamp_seconds", "_start_time_seconds", "_boot_time_seconds"}
+
+// timestampSuffixesFlag is a flag that may be given multiple times, each time
+// with a suffix of the names of gauges holding unix timestamps, in addition to
+// the defaultTimestampSuffixes.
+type timestampSuffixesFlag []string
+
+func (f *timestampSuffixesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *timestampSuffixesFlag) Set(s string) error {
+	if s = strings.TrimSpace(s); s != "" {
+		*f = append(*f, s)
+	}
+	return nil
+}
+
+func (f *timestampSuffixesFlag) values() []string {
+	return *f
+}
+
+// suffixes returns the suffixes of timestamps: the default ones, then those
+// given.
+func (f *timestampSuffixesFlag) suffixes() []string {
+	return append(slices.Clone(defaultTimestampSuffixes), *f...)
+}
+
+// minUnixSeconds and maxUnixSeconds bound the unix timestamps shown as time:
+// those of the years 1 to 9999 (see unixTime).
+const (
+	minUnixSeconds = -62135596800
+	maxUnixSeconds = 253402300800
+)
+
+// isTimestamp returns true, if the given observation is a gauge holding a unix
+// timestamp by the suffix of its name (e.g. process_start_time_seconds), or
+// the push time of a Pushgateway group (see pushTimeMetric).
+func (f valueFormatter) isTimestamp(o metrics.Observation) bool {
+	if o.Kind != metrics.ObservationGauge {
+		return false
+	}
+	if o.Metric == pushTimeMetric {
+		return true
+	}
+	suffixes := defaultTimestampSuffixes
+	if f.timestamps != nil {
+		suffixes = *f.timestamps
+	}
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(o.Metric, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStartTime returns true, if the given timestamp is the start time of a
+// process or host, which restarts when it increases.
+func isStartTime(o metrics.Observation) bool {
+	return strings.HasSuffix(o.Metric, "_start_time_seconds") || strings.HasSuffix(o.Metric, "_boot_time_seconds")
+}
+
+// timestamp formats the given unix timestamp of the given observation as both
+// local time and age (e.g. "2024-05-02 09:14 (up 3d4h)" of start times, or
+// "2024-05-02 09:14 (5m ago)" and "2024-05-02 09:14 (in 2h)" of others).
+// Push times (see pushTimeMetric) are formatted as age only (e.g. "pushed 42s
+// ago"). Values out of the years 1 to 9999 are formatted as numbers.
+func timestamp(o metrics.Observation, v float64, now time.Time) string {
+	t, ok := unixTime(v)
+	if !ok {
+		return format(v)
+	}
+	s := t.Local().Format("2006-01-02 15:04")
+	d := now.Sub(t)
+	switch {
+	case o.Metric == pushTimeMetric && d >= 0:
+		return "pushed " + shortAge(d) + " ago"
+	case isStartTime(o) && d >= 0:
+		return s + " (up " + shortAge(d) + ")"
+	case d < 0:
+		return s + " (in " + shortAge(-d) + ")"
+	}
+	return s + " (" + shortAge(d) + " ago)"
+}
+
+// unixTime returns the time of the given unix timestamp in (fractional)
+// seconds, unless it is out of the years 1 to 9999 (or NaN).
+func unixTime(v float64) (time.Time, bool) {
+	if !(v >= minUnixSeconds && v < maxUnixSeconds) {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// shortAge formats the given duration by its two largest units (e.g. "3d4h",
+// "2h5m", "4m30s", or "12s").
+func shortAge(d time.Duration) string {
+	s := int64(d / time.Second)
+	parts := []struct {
+		n    int64
+		unit string
+	}{{s / 86400, "d"}, {s / 3600 % 24, "h"}, {s / 60 % 60, "m"}, {s % 60, "s"}}
+	for i, p := range parts {
+		if p.n == 0 && i < len(parts)-1 {
+			continue
+		}
+		age := strconv.FormatInt(p.n, 10) + p.unit
+		if i < len(parts)-1 && parts[i+1].n > 0 {
+			age += strconv.FormatInt(parts[i+1].n, 10) + parts[i+1].unit
+		}
+		return age
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestShortAge(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0s"},
+		{12 * time.Second, "12s"},
+		{4*time.Minute + 30*time.Second, "4m30s"},
+		{2*time.Hour + 5*time.Minute + 7*time.Second, "2h5m"},
+		{76 * time.Hour, "3d4h"},
+		{72*time.Hour + 5*time.Minute, "3d"},
+	}
+	for _, tt := range tests {
+		if actual := shortAge(tt.d); actual != tt.expected {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	now := time.Date(2024, 5, 5, 13, 14, 0, 0, time.UTC)
+	at := time.Date(2024, 5, 2, 9, 14, 0, 0, time.UTC)
+	date := at.Local().Format("2006-01-02 15:04")
+	newObs := func(metric string) metrics.Observation {
+		return metrics.NewObservation(metric, nil, metrics.ObservationGauge, now, float64(at.Unix()))
+	}
+	tests := []struct {
+		metric   string
+		now      time.Time
+		expected string
+	}{
+		{"process_start_time_seconds", now, date + " (up 3d4h)"},
+		{"backup_last_success_timestamp_seconds", now, date + " (3d4h ago)"},
+		{"cert_expiry_timestamp_seconds", at.Add(-90 * time.Minute), date + " (in 1h30m)"},
+		{"push_time_seconds", at.Add(42 * time.Second), "pushed 42s ago"},
+	}
+	for _, tt := range tests {
+		if actual := timestamp(newObs(tt.metric), float64(at.Unix()), tt.now); actual != tt.expected {
+			t.Errorf("Expected %q, but got %q", tt.expected, actual)
+		}
+	}
+
+	// Values out of the range of times are formatted as numbers.
+	for _, v := range []float64{1e19, -1e19, math.Inf(1), math.NaN()} {
+		if actual, expected := timestamp(newObs("push_time_seconds"), v, now), format(v); actual != expected {
+			t.Errorf("Expected %q, but got %q", expected, actual)
+		}
+	}
+}
+
+func TestValueFormatter_IsTimestamp(t *testing.T) {
+	now := time.Now()
+	given := timestampSuffixesFlag{"_last_seen"}
+	suffixes := given.suffixes()
+	f := valueFormatter{humanize: true, timestamps: &suffixes}
+	tests := []struct {
+		metric   string
+		kind     metrics.ObservationKind
+		expected bool
+	}{
+		{"process_start_time_seconds", metrics.ObservationGauge, true},
+		{"job_last_success_timestamp_seconds", metrics.ObservationGauge, true},
+		{"device_last_seen", metrics.ObservationGauge, true},
+		{"process_cpu_seconds_total", metrics.ObservationCounter, false},
+		{"request_duration_seconds", metrics.ObservationGauge, false},
+	}
+	for _, tt := range tests {
+		if actual := f.isTimestamp(metrics.NewObservation(tt.metric, nil, tt.kind, now, 1)); actual != tt.expected {
+			t.Errorf("Expected %v for %s, but got %v", tt.expected, tt.metric, actual)
+		}
+	}
+}
+
+func TestRenderSeries_Timestamp(t *testing.T) {
+	now := time.Now()
+	obs := func(v float64) metrics.Observation {
+		return metrics.NewObservation("process_start_time_seconds", nil, metrics.ObservationGauge, now, v)
+	}
+	st := newStyles(nil, false)
+	f := valueFormatter{humanize: true}
+	started := float64(now.Add(-time.Hour).Unix())
+
+	series := []metrics.Observation{obs(started), obs(started - 3600)}
+	actual := renderSeries(series[0].Name, series, false, severityNone, seriesOptions{showDerived: true, hold: 1, formatter: f, styles: st})
+	if !strings.Contains(actual, "(up 1h)") || !strings.Contains(actual, "restarted") || strings.Contains(actual, st.up) {
+		t.Errorf("Expected a restart without arrows, but got %q", actual)
+	}
+
+	// Raw values stay plain numbers.
+	f.humanize = false
+	actual = renderSeries(series[0].Name, series, false, severityNone, seriesOptions{showDerived: true, hold: 1, formatter: f, styles: st})
+	if !strings.Contains(actual, format(started)) {
+		t.Errorf("Expected the raw value, but got %q", actual)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"slices"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// defaultTop is the number of series shown by the top movers mode, if not
+// given by -top.
+const defaultTop = 20
+
+// movement returns how much the given series moved with the latest sample:
+// the absolute per-second rate of counters (and of histograms and summaries,
+// see rateOf) and the absolute change of gauges. It returns false for series
+// that did not move (or have no previous value, or are stale), and for the
+// synthetic series, whose scrape duration moves with every sample.
+func movement(series []metrics.Observation) (float64, bool) {
+	if len(series) < 2 || series[0].Stale || isSynthetic(series[0].Metric) {
+		return 0, false
+	}
+	v := math.Abs(series[0].Value - series[1].Value)
+	if typeOf(series[0].Kind) != typeGauge {
+		var ok bool
+		if v, ok = rateOf(series); !ok {
+			return 0, false
+		}
+	}
+	if v == 0 || !finite(v) {
+		return 0, false
+	}
+	return math.Abs(v), true
+}
+
+// topMovers returns the given number of series of the given dump that moved
+// most with the latest sample (see movement), most first. Series moving the
+// same keep their order.
+func topMovers(dump [][]metrics.Observation, n int) [][]metrics.Observation {
+	type mover struct {
+		series   []metrics.Observation
+		movement float64
+	}
+	var movers []mover
+	for _, series := range dump {
+		if v, ok := movement(series); ok {
+			movers = append(movers, mover{series, v})
+		}
+	}
+	slices.SortStableFunc(movers, func(a, b mover) int {
+		switch {
+		case a.movement > b.movement:
+			return -1
+		case a.movement < b.movement:
+			return 1
+		}
+		return 0
+	})
+	top := make([][]metrics.Observation, 0, min(n, len(movers)))
+	for _, m := range movers[:min(n, len(movers))] {
+		top = append(top, m.series)
+	}
+	return top
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestTopMovers(t *testing.T) {
+	now := time.Now()
+	series := func(name string, kind metrics.ObservationKind, values ...float64) []metrics.Observation {
+		var s []metrics.Observation
+		for i, v := range values {
+			s = append(s, metrics.NewObservation(name, nil, kind, now.Add(-time.Duration(i)*10*time.Second), v))
+		}
+		return s
+	}
+	dump := [][]metrics.Observation{
+		series("a_total", metrics.ObservationCounter, 1100, 1000), // 10/s
+		series("b_total", metrics.ObservationCounter, 5, 5),
+		series("c", metrics.ObservationGauge, 3, 50), // 47
+		series("d", metrics.ObservationGauge, 7),
+		series("e", metrics.ObservationGauge, 2, 1), // 1
+	}
+	var actual []string
+	for _, s := range topMovers(dump, 2) {
+		actual = append(actual, s[0].Name)
+	}
+	if expected := "c a_total"; strings.Join(actual, " ") != expected {
+		t.Errorf("Expected %q, but got %q", expected, strings.Join(actual, " "))
+	}
+	if n := len(topMovers(dump, 10)); n != 3 {
+		t.Errorf("Expected only the 3 series that moved, but got %d", n)
+	}
+}
+
+func TestModel_UpdateTop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:   []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:    newStyles(nil, false),
+		keys:      newKeymap(),
+		viewport:  viewport.New(120, 10),
+		top:       1,
+		unchanged: unchangedSorted,
+	}
+	for _, v := range []string{"1", "2"} {
+		content := "# TYPE queue_length gauge\nqueue_length " + v + "\n# TYPE workers gauge\nworkers 4\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	m.metricsView()
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t"), Alt: true})
+	if len(m.rows) != 1 || m.rows[0].name != "queue_length" {
+		t.Errorf("Expected only the top mover, but got %v", m.rows)
+	}
+	if !strings.Contains(m.headerView(), " top 1 movers -") {
+		t.Errorf("Expected the mode in the header, but got %q", m.headerView())
+	}
+
+	// Leaving the mode restores the sort.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t"), Alt: true})
+	if m.unchanged != unchangedSorted || !hasRow(m, "workers") {
+		t.Errorf("Expected all series sorted by unchanged time, but got %v", m.rows)
+	}
+}
+
+func TestWritePlain_Top(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	tt := &target{store: metrics.NewStore(3, metrics.NewFileFetcher(path))}
+	for _, v := range []string{"1", "5"} {
+		content := "# TYPE queue_length gauge\nqueue_length " + v + "\n# TYPE workers gauge\nworkers 4\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := tt.store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	var sb strings.Builder
+	writePlain(&sb, []*target{tt}, time.Now(), plainOptions{top: 20})
+	if out := sb.String(); !strings.Contains(out, "queue_length 5") || strings.Contains(out, "workers") {
+		t.Errorf("Expected only the series that moved, but got %q", out)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// metricType is the type of the metric an observation belongs to (see
+// typeOf).
+type metricType int
+
+const (
+	typeCounter metricType = iota
+	typeGauge
+	typeHistogram
+	typeSummary
+)
+
+// metricTypeNames are the names of the metric types (see parseTypes), and
+// metricTypePlurals their plurals.
+var (
+	metricTypeNames   = []string{"counter", "gauge", "histogram", "summary"}
+	metricTypePlurals = []string{"counters", "gauges", "histograms", "summaries"}
+)
+
+// derivedKindNames are names of derived kinds of observations (see
+// metrics.Deriver), which parseTypes rejects: they go with the type they are
+// derived from (see typeOf).
+var derivedKindNames = []string{"rate", "rates", "avg", "quantile", "quantiles"}
+
+// typeMask is a set of metric types (one bit per type). Its zero value
+// selects all types, and typeNone selects none.
+type typeMask uint8
+
+// typeNone is the mask selecting no type. Its bit is none of a type, so that
+// it is told apart from the zero value.
+const typeNone typeMask = 1 << 7
+
+// typeOf returns the type of metric that observations of the given kind
+// belong to. Derived kinds belong to the type they are derived from (e.g. counter
+// rates to counters).
+func typeOf(kind metrics.ObservationKind) metricType {
+	switch kind {
+	case metrics.ObservationCounter, metrics.ObservationCounterRate, metrics.ObservationCounterWindowRate:
+		return typeCounter
+	case metrics.ObservationHistogramBucket, metrics.ObservationHistogramSum, metrics.ObservationHistogramCount,
+		metrics.ObservationHistogramAvg, metrics.ObservationHistogramQuantile, metrics.ObservationHistogramIntervalQuantile:
+		return typeHistogram
+	case metrics.ObservationSummarySum, metrics.ObservationSummaryCount:
+		return typeSummary
+	}
+	return typeGauge
+}
+
+// has returns true, if the mask selects the given type.
+func (m typeMask) has(t metricType) bool {
+	return m == 0 || m&(1<<t) != 0
+}
+
+// String returns the comma-separated names of the selected types (or "none").
+func (m typeMask) String() string {
+	if m == typeNone {
+		return "none"
+	}
+	var names []string
+	for t, name := range metricTypeNames {
+		if m.has(metricType(t)) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// toggle returns the mask with the given type selected, if it is not, or
+// deselected otherwise. Selecting all types gives the zero mask, and
+// deselecting all gives typeNone.
+func (m typeMask) toggle(t metricType) typeMask {
+	all := typeMask(1<<len(metricTypeNames) - 1)
+	switch m {
+	case 0:
+		m = all
+	case typeNone:
+		m = 0
+	}
+	switch m ^= 1 << t; m {
+	case all:
+		return 0
+	case 0:
+		return typeNone
+	}
+	return m
+}
+
+// next returns the mask following the given one when cycling through the
+// types: all types, then each type on its own, and then all types again.
+func (m typeMask) next() typeMask {
+	for t := range metricTypeNames {
+		if m == 1<<t {
+			if t == len(metricTypeNames)-1 {
+				return 0
+			}
+			return m << 1
+		}
+	}
+	if m == 0 {
+		return 1 << typeCounter
+	}
+	return 0
+}
+
+// parseTypes parses a comma-separated list of metric type names (see
+// metricTypeNames, or their plurals). An empty list selects all types, and
+// "none" none.
+func parseTypes(s string) (typeMask, error) {
+	if strings.TrimSpace(s) == "none" {
+		return typeNone, nil
+	}
+	var m typeMask
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		t := slices.Index(metricTypeNames, name)
+		if t < 0 {
+			t = slices.Index(metricTypePlurals, name)
+		}
+		switch {
+		case slices.Contains(derivedKindNames, name):
+			return 0, fmt.Errorf("%q are derived series, which go with the type they are derived from (e.g. counter rates with counter)", name)
+		case t < 0:
+			return 0, fmt.Errorf("unknown metric type %q (expected one of %s, or none)", name, strings.Join(metricTypeNames, ", "))
+		}
+		m |= 1 << t
+	}
+	return m, nil
+}
+
+// withTypes returns the series of the given dump of the types of the given
+// mask. The series derived from them (see metrics.Deriver) follow.
+func withTypes(dump [][]metrics.Observation, m typeMask) [][]metrics.Observation {
+	if m == 0 {
+		return dump
+	}
+	kept := make([][]metrics.Observation, 0, len(dump))
+	for _, series := range dump {
+		if m.has(typeOf(series[0].Kind)) {
+			kept = append(kept, series)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestParseTypes(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+		err      bool
+	}{
+		{"", "counter,gauge,histogram,summary", false},
+		{"gauge", "gauge", false},
+		{"counter, histogram", "counter,histogram", false},
+		{"untyped", "", true},
+		{"counters,gauges", "counter,gauge", false},
+		{"counters,rates", "", true},
+		{"none", "none", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			actual, err := parseTypes(tt.s)
+			if (err != nil) != tt.err {
+				t.Fatalf("Expected error %v, but got %v", tt.err, err)
+			}
+			if !tt.err && actual.String() != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTypeMask_Next(t *testing.T) {
+	var m typeMask
+	var actual []string
+	for range 6 {
+		m = m.next()
+		actual = append(actual, m.String())
+	}
+	expected := "counter; gauge; histogram; summary; counter,gauge,histogram,summary; counter"
+	if strings.Join(actual, "; ") != expected {
+		t.Errorf("Expected %v, but got %v", expected, strings.Join(actual, "; "))
+	}
+
+	// Combinations (e.g. given by -types) cycle to all types.
+	if m, _ := parseTypes("counter,gauge"); m.next() != 0 {
+		t.Errorf("Expected %v, but got %v", typeMask(0), m.next())
+	}
+}
+
+func TestModel_UpdateTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	content := "# TYPE requests_total counter\nrequests_total 1\n# TYPE queue_length gauge\nqueue_length 3\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:     []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:      newStyles(nil, false),
+		keys:        newKeymap(),
+		viewport:    viewport.New(120, 10),
+		showDerived: true,
+		deriver:     metrics.Deriver{RateKinds: metrics.DefaultRateKinds},
+	}
+	for range 2 {
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	m.metricsView()
+
+	// Counters come with their rates.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlK})
+	if !hasRow(m, "requests_total") || !hasRow(m, "requests_total_per_second_rate") || hasRow(m, "queue_length") {
+		t.Errorf("Expected only the counter and its rate, but got %v", m.rows)
+	}
+	if !strings.Contains(m.headerView(), " types: counter -") {
+		t.Errorf("Expected the types in the header, but got %q", m.headerView())
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlK})
+	if hasRow(m, "requests_total") || hasRow(m, "requests_total_per_second_rate") || !hasRow(m, "queue_length") {
+		t.Errorf("Expected only the gauge, but got %v", m.rows)
+	}
+}
+
+func TestTypeMask_Toggle(t *testing.T) {
+	m := typeMask(0).toggle(typeGauge)
+	if expected := "counter,histogram,summary"; m.String() != expected {
+		t.Errorf("Expected %v, but got %v", expected, m.String())
+	}
+	if m = m.toggle(typeGauge); m != 0 {
+		t.Errorf("Expected %v, but got %v", typeMask(0), m)
+	}
+
+	// Deselecting the only type selected selects none rather than all.
+	m = typeMask(1 << typeGauge).toggle(typeGauge)
+	if m != typeNone || m.has(typeGauge) || m.String() != "none" {
+		t.Errorf("Expected %v, but got %v", typeNone, m)
+	}
+	if m = m.toggle(typeGauge); m.String() != "gauge" {
+		t.Errorf("Expected %v, but got %v", "gauge", m)
+	}
+}
+
+func TestModel_UpdateGaugeArrows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+	}
+	for _, v := range []string{"1", "2"} {
+		content := "# TYPE requests_total counter\nrequests_total " + v + "\n# TYPE heap_bytes gauge\nheap_bytes " + v + "\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	m.metricsView()
+	if view := m.viewport.View(); !strings.Contains(view, "heap_bytes 2 ⬆") {
+		t.Errorf("Expected gauge arrows, but got %q", view)
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlQ})
+	view := m.viewport.View()
+	if strings.Contains(view, "heap_bytes 2 ⬆") || !strings.Contains(view, "requests_total 2 ⬆") {
+		t.Errorf("Expected only counter arrows, but got %q", view)
+	}
+	if !strings.Contains(m.headerView(), " arrows: counter,histogram,summary -") {
+		t.Errorf("Expected the arrows in the header, but got %q", m.headerView())
+	}
+}
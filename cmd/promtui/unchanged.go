@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// unchangedMode is whether the time series have been unchanged for is shown
+// (see unchangedFor) and whether the series are sorted by it.
+type unchangedMode int
+
+const (
+	unchangedHidden unchangedMode = iota
+	unchangedShown
+	unchangedSorted
+)
+
+// sortNames are the names of the sort orders of -sort.
+var sortNames = []string{"name", "unchanged"}
+
+// parseSort returns the unchanged mode of the sort order with the given name
+// (see sortNames), sorting by name keeping the given mode.
+func parseSort(name string, mode unchangedMode) (unchangedMode, error) {
+	switch name {
+	case "name":
+		return mode, nil
+	case "unchanged":
+		return unchangedSorted, nil
+	}
+	return 0, fmt.Errorf("unknown sort order %q (expected name or unchanged)", name)
+}
+
+// unchangedFor returns how long the series of the given latest observation
+// has been unchanged at the given time. It returns false, if unknown (e.g. for
+// derived series) or if the value changed with the observation.
+func unchangedFor(o metrics.Observation, now time.Time) (time.Duration, bool) {
+	if o.LastChange.IsZero() || !o.LastChange.Before(o.Time) {
+		return 0, false
+	}
+	return now.Sub(o.LastChange), true
+}
+
+// sortByUnchanged returns the series of the given dump sorted by how long they
+// have been unchanged, longest first. Series without a known last change come
+// last.
+func sortByUnchanged(dump [][]metrics.Observation) [][]metrics.Observation {
+	sorted := slices.Clone(dump)
+	slices.SortStableFunc(sorted, func(a, b []metrics.Observation) int {
+		ta, tb := a[0].LastChange, b[0].LastChange
+		if ta.IsZero() != tb.IsZero() {
+			if ta.IsZero() {
+				return 1
+			}
+			return -1
+		}
+		return ta.Compare(tb)
+	})
+	return sorted
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestUnchangedFor(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		lastChange time.Time
+		expected   time.Duration
+		ok         bool
+	}{
+		{"unknown", time.Time{}, 0, false},
+		{"just changed", now.Add(-time.Minute), 0, false},
+		{"unchanged", now.Add(-12 * time.Minute), 12 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := metrics.Observation{Time: now.Add(-time.Minute), LastChange: tt.lastChange}
+			actual, ok := unchangedFor(o, now)
+			if ok != tt.ok || actual != tt.expected {
+				t.Errorf("Expected %v (%v), but got %v (%v)", tt.expected, tt.ok, actual, ok)
+			}
+		})
+	}
+}
+
+func TestSortByUnchanged(t *testing.T) {
+	now := time.Now()
+	series := func(name string, lastChange time.Time) []metrics.Observation {
+		return []metrics.Observation{{Name: name, LastChange: lastChange}}
+	}
+	dump := [][]metrics.Observation{
+		series("a", now),
+		series("b_rate", time.Time{}),
+		series("c", now.Add(-time.Hour)),
+		series("d", now.Add(-time.Minute)),
+	}
+	var names []string
+	for _, s := range sortByUnchanged(dump) {
+		names = append(names, s[0].Name)
+	}
+	if actual, expected := strings.Join(names, " "), "c d a b_rate"; actual != expected {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+	if dump[0][0].Name != "a" {
+		t.Errorf("Expected the dump to be unmodified, but got %v", dump)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     unchangedMode
+		expected unchangedMode
+		err      bool
+	}{
+		{"name", unchangedHidden, unchangedHidden, false},
+		{"name", unchangedShown, unchangedShown, false},
+		{"unchanged", unchangedHidden, unchangedSorted, false},
+		{"value", unchangedHidden, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := parseSort(tt.name, tt.mode)
+			if (err != nil) != tt.err {
+				t.Fatalf("Expected error %v, but got %v", tt.err, err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/sebogh/promtui/metrics"
+)
+
+// watch is a series of a target the user waits to change (see checkWatches).
+// value is its latest value.
+type watch struct {
+	target *target
+	name   string
+	value  float64
+}
+
+// toggleWatch watches the series of the top row of the viewport or, if it is
+// watched already, stops watching it.
+func (m *model) toggleWatch() {
+	i := m.viewport.YOffset
+	if i >= len(m.rows) {
+		return
+	}
+	r := m.rows[i]
+	if j := slices.IndexFunc(m.watches, func(w *watch) bool { return w.target == m.target() && w.name == r.name }); j >= 0 {
+		m.watches = slices.Delete(m.watches, j, j+1)
+		m.flashMessage("stopped watching " + r.name)
+		return
+	}
+	// Derived series and aggregates are not sampled, but computed for the
+	// view.
+	if o := r.obs[0]; isDerived(o.Kind) || o.Aggregated > 0 {
+		m.flashMessage("cannot watch " + r.name + " (not a sampled series)")
+		return
+	}
+	m.watches = append(m.watches, &watch{target: m.target(), name: r.name, value: r.value})
+	m.flashMessage("watching " + r.name + " (" + m.keys.watch.Help().Key + " again to stop)")
+}
+
+// checkWatches checks the watched series of the given target against the
+// given dump of its latest sample (regardless of the filters of the view).
+// Changes are flashed, logged, and ring the terminal bell.
+func (m *model) checkWatches(t *target, dump [][]metrics.Observation) {
+	changed := false
+	for _, w := range m.watches {
+		if w.target != t {
+			continue
+		}
+		i := slices.IndexFunc(dump, func(series []metrics.Observation) bool { return series[0].Name == w.name })
+		if i < 0 {
+			continue
+		}
+		o := dump[i][0]
+		if o.Stale || o.Value == w.value || (math.IsNaN(o.Value) && math.IsNaN(w.value)) {
+			continue
+		}
+		text := fmt.Sprintf("%s changed: %s -> %s", w.name, m.formatter.value(o, w.value), m.formatter.value(o, o.Value))
+		m.logEvent(t, "watch: "+text, false)
+		m.flashMessage(text)
+		w.value, changed = o.Value, true
+	}
+	if changed {
+		_, _ = fmt.Fprint(m.terminal, "\a")
+	}
+}
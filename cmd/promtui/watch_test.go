@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebogh/promtui/metrics"
+)
+
+func TestModel_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	write := func(requests string) {
+		content := "# TYPE requests_total counter\nrequests_total " + requests + "\n# TYPE queue_length gauge\nqueue_length 3\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	write("1")
+	var terminal bytes.Buffer
+	fetcher := metrics.NewFileFetcher(path)
+	m := &model{
+		targets:  []*target{{source: source{fetcher: fetcher}, store: metrics.NewStore(3, fetcher)}},
+		styles:   newStyles(nil, false),
+		keys:     newKeymap(),
+		viewport: viewport.New(120, 10),
+		terminal: &terminal,
+	}
+	sample := func() {
+		if _, err := m.target().store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		m.checkSample(m.target())
+	}
+	sample()
+	m.metricsView()
+
+	// Watching needs browsing, as w types into the search otherwise.
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("requests")})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("w")})
+	if len(m.watches) != 1 || m.watches[0].name != "requests_total" {
+		t.Fatalf("Expected to watch requests_total, but got %v", m.watches)
+	}
+
+	// Changes are noticed even if the series is filtered out of view.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("queue")})
+	m.metricsView()
+	write("2")
+	sample()
+	if terminal.String() != "\a" {
+		t.Errorf("Expected the bell, but got %q", terminal.String())
+	}
+	if !strings.Contains(m.footerView(), "requests_total changed: 1 -> 2") {
+		t.Errorf("Expected the change in the footer, but got %q", m.footerView())
+	}
+	events := m.events.newestFirst()
+	if len(events) != 1 || events[0].text != "watch: requests_total changed: 1 -> 2" {
+		t.Errorf("Expected the change to be logged, but got %v", events)
+	}
+	if view := m.eventsView(120, 10); !strings.Contains(view, "watching requests_total") {
+		t.Errorf("Expected the watch to be listed, but got %q", view)
+	}
+
+	// Unchanged series stay quiet.
+	sample()
+	if terminal.String() != "\a" {
+		t.Errorf("Expected a single bell, but got %q", terminal.String())
+	}
+
+	// Pressing w again on the row stops watching.
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("requests")})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("w")})
+	if len(m.watches) != 0 {
+		t.Errorf("Expected no watches, but got %v", m.watches)
+	}
+
+	// The hints name the key of the watch binding.
+	if err := m.keys.remap(map[string][]string{"watch": {"W"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("W")})
+	if m.flash != "watching requests_total (W again to stop)" {
+		t.Errorf("Expected the remapped key in the flash, but got %q", m.flash)
+	}
+	if view := m.eventsView(120, 10); !strings.Contains(view, "(W on its row to stop)") {
+		t.Errorf("Expected the remapped key in the event log, but got %q", view)
+	}
+}
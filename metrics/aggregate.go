@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AggregateOp is the operation aggregating the values of gauges (see
+// Aggregation).
+type AggregateOp int
+
+const (
+	AggregateSum AggregateOp = iota
+	AggregateAvg
+	AggregateMin
+	AggregateMax
+)
+
+// aggregateOpNames are the names of the aggregate operations (see
+// AggregateOp.String).
+var aggregateOpNames = []string{"sum", "avg", "min", "max"}
+
+func (op AggregateOp) String() string {
+	if op < 0 || int(op) >= len(aggregateOpNames) {
+		return fmt.Sprintf("AggregateOp(%d)", int(op))
+	}
+	return aggregateOpNames[op]
+}
+
+// ParseAggregateOp returns the aggregate operation with the given name (see
+// AggregateOp.String).
+func ParseAggregateOp(name string) (AggregateOp, error) {
+	i := slices.Index(aggregateOpNames, name)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown aggregate operation %q (expected one of %s)", name, strings.Join(aggregateOpNames, ", "))
+	}
+	return AggregateOp(i), nil
+}
+
+// Aggregation aggregates dumped series across labels, like "sum without
+// (code)" in PromQL: the series of a metric differing only by the labels in
+// Without are replaced by one series aggregating them. Counters, histograms,
+// and summaries are summed (histogram averages and quantiles are estimated
+// from the summed buckets again), gauges are aggregated by Gauges.
+type Aggregation struct {
+
+	// Without holds the names of the labels aggregated away.
+	Without []string
+
+	// Gauges is the operation aggregating gauges.
+	Gauges AggregateOp
+}
+
+// aggregateGroup is the series aggregated into one with the given name and
+// labels.
+type aggregateGroup struct {
+	name   string
+	labels []Label
+	series [][]Observation
+
+	// aggregated is the aggregated series (once aggregated).
+	aggregated []Observation
+}
+
+// Aggregate returns the given dump (see Store.Dump) with the series differing
+// only by the aggregated labels replaced by their aggregate, which is in place
+// of the first of them. Aggregated observations are marked (see
+// Observation.Aggregated).
+func (a Aggregation) Aggregate(dump [][]Observation) [][]Observation {
+	if len(a.Without) == 0 {
+		return dump
+	}
+	var aggregated [][]Observation
+	groups := make(map[string]int)
+	var order []*aggregateGroup
+	for _, series := range dump {
+		o := series[0]
+		if !slices.ContainsFunc(o.Labels, func(l Label) bool { return slices.Contains(a.Without, l.Name) }) {
+			aggregated = append(aggregated, series)
+			continue
+		}
+		labels := slices.DeleteFunc(slices.Clone(o.Labels), func(l Label) bool { return slices.Contains(a.Without, l.Name) })
+		name := flatName(o.Metric, labels)
+		key := o.Kind.String() + " " + name
+		if i, ok := groups[key]; ok {
+			order[i].series = append(order[i].series, series)
+			continue
+		}
+		groups[key] = len(order)
+		order = append(order, &aggregateGroup{name: name, labels: labels, series: [][]Observation{series}})
+		// The slot is filled once all series of the group are known.
+		aggregated = append(aggregated, nil)
+	}
+
+	// Histogram averages and quantiles are estimated from the aggregated
+	// sums, counts, and buckets, which are keyed by their histogram.
+	histograms := make(map[string]*aggregatedHistogram)
+	histogram := func(o Observation, labels []Label, drop string) *aggregatedHistogram {
+		labels = slices.DeleteFunc(slices.Clone(labels), func(l Label) bool { return l.Name == drop })
+		key := flatName(o.Family(), labels)
+		if histograms[key] == nil {
+			histograms[key] = &aggregatedHistogram{}
+		}
+		return histograms[key]
+	}
+	for _, g := range order {
+		o := g.series[0][0]
+		switch o.Kind {
+		case ObservationHistogramAvg, ObservationHistogramQuantile, ObservationHistogramIntervalQuantile:
+			continue
+		}
+		g.aggregated = a.aggregate(g)
+		switch o.Kind {
+		case ObservationHistogramBucket:
+			h := histogram(o, g.labels, "le")
+			h.buckets = append(h.buckets, g.aggregated)
+		case ObservationHistogramSum:
+			histogram(o, g.labels, "").sum = g.aggregated
+		case ObservationHistogramCount:
+			histogram(o, g.labels, "").count = g.aggregated
+		}
+	}
+
+	slot := 0
+	for _, g := range order {
+		for aggregated[slot] != nil {
+			slot++
+		}
+		o := g.series[0][0]
+		switch o.Kind {
+		case ObservationHistogramAvg:
+			aggregated[slot] = histogram(o, g.labels, "").avg(g)
+		case ObservationHistogramQuantile, ObservationHistogramIntervalQuantile:
+			aggregated[slot] = histogram(o, g.labels, "quantile").quantile(g)
+		default:
+			aggregated[slot] = g.aggregated
+		}
+	}
+	return slices.DeleteFunc(aggregated, func(series []Observation) bool { return len(series) == 0 })
+}
+
+// aggregate returns the series aggregating the series of the given group.
+// Observations are aggregated by their index (i.e. by sample), stale ones
+// count with their latest value, and aggregates are stale only if all
+// aggregated observations are.
+func (a Aggregation) aggregate(g *aggregateGroup) []Observation {
+	return g.observations(func(_ int, o Observation, values []float64) float64 {
+		op := AggregateSum
+		if o.Kind == ObservationGauge {
+			op = a.Gauges
+		}
+		v := values[0]
+		for _, w := range values[1:] {
+			switch op {
+			case AggregateSum, AggregateAvg:
+				v += w
+			case AggregateMin:
+				v = math.Min(v, w)
+			case AggregateMax:
+				v = math.Max(v, w)
+			}
+		}
+		if op == AggregateAvg {
+			v /= float64(len(values))
+		}
+		return v
+	})
+}
+
+// observations returns the series of the group, each observation with the
+// value returned by value for the index and the (first of the) observations
+// of the group at the index.
+func (g *aggregateGroup) observations(value func(i int, o Observation, values []float64) float64) []Observation {
+	n := 0
+	for _, series := range g.series {
+		n = max(n, len(series))
+	}
+	aggregated := make([]Observation, 0, n)
+	for i := 0; i < n; i++ {
+		var values []float64
+		var o Observation
+		stale := true
+		for _, series := range g.series {
+			if i >= len(series) {
+				continue
+			}
+			if len(values) == 0 {
+				o = series[i]
+			}
+			values = append(values, series[i].Value)
+			stale = stale && series[i].Stale
+		}
+		aggregated = append(aggregated, Observation{
+			Name:       g.name,
+			Metric:     o.Metric,
+			Labels:     g.labels,
+			Kind:       o.Kind,
+			Time:       o.Time,
+			TimeSource: o.TimeSource,
+			Value:      value(i, o, values),
+			Stale:      stale,
+			Aggregated: len(g.series),
+		})
+	}
+	return aggregated
+}
+
+// aggregatedHistogram holds the aggregated series of a histogram.
+type aggregatedHistogram struct {
+	sum, count []Observation
+	buckets    [][]Observation
+}
+
+// avg returns the average of the histogram at each index (see
+// ObservationHistogramAvg).
+func (h *aggregatedHistogram) avg(g *aggregateGroup) []Observation {
+	return g.observations(func(i int, _ Observation, _ []float64) float64 {
+		if i >= len(h.sum) || i >= len(h.count) || h.count[i].Value <= 0 {
+			return math.NaN()
+		}
+		return h.sum[i].Value / h.count[i].Value
+	})
+}
+
+// quantile returns the quantile of the histogram at each index (see
+// ObservationHistogramQuantile and ObservationHistogramIntervalQuantile).
+func (h *aggregatedHistogram) quantile(g *aggregateGroup) []Observation {
+	var q float64
+	for _, l := range g.labels {
+		if l.Name == "quantile" {
+			q, _ = strconv.ParseFloat(l.Value, 64)
+		}
+	}
+	return g.observations(func(i int, o Observation, _ []float64) float64 {
+		cur := h.bucketsAt(i)
+		if o.Kind == ObservationHistogramIntervalQuantile {
+			cur = deltaBuckets(cur, h.bucketsAt(i+1))
+		}
+		return bucketQuantile(q, cur)
+	})
+}
+
+// bucketsAt returns the buckets of the histogram at the given index, sorted
+// by their upper bound (or nil, if the histogram has none).
+func (h *aggregatedHistogram) bucketsAt(i int) []bucket {
+	var buckets []bucket
+	for _, series := range h.buckets {
+		if i >= len(series) {
+			return nil
+		}
+		o := series[i]
+		for _, l := range o.Labels {
+			if l.Name == "le" {
+				ub, err := strconv.ParseFloat(l.Value, 64)
+				if err != nil {
+					return nil
+				}
+				buckets = append(buckets, bucket{upperBound: ub, count: o.Value})
+			}
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].upperBound < buckets[j].upperBound })
+	return buckets
+}
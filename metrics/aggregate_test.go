@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAggregation_Aggregate(t *testing.T) {
+	first := `# TYPE requests_total counter
+requests_total{code="200",path="/a"} 1
+requests_total{code="500",path="/a"} 2
+requests_total{code="200",path="/b"} 4
+# TYPE queue_length gauge
+queue_length{code="200"} 3
+queue_length{code="500"} 5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{code="200",le="0.1"} 1
+latency_seconds_bucket{code="200",le="+Inf"} 2
+latency_seconds_sum{code="200"} 1
+latency_seconds_count{code="200"} 2
+latency_seconds_bucket{code="500",le="0.1"} 3
+latency_seconds_bucket{code="500",le="+Inf"} 6
+latency_seconds_sum{code="500"} 3
+latency_seconds_count{code="500"} 6
+# TYPE build_info gauge
+build_info{version="1"} 1
+`
+	second := strings.Replace(first, `requests_total{code="500",path="/a"} 2`, `requests_total{code="500",path="/a"} 12`, 1)
+	store := NewStore(3, &sequenceFetcher{bodies: []string{first, second}})
+	for i := 0; i < 2; i++ {
+		if _, err := store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	dump, err := store.Dump("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		op         AggregateOp
+		name       string
+		values     []float64
+		aggregated int
+	}{
+		// Counters are summed at each sample.
+		{AggregateSum, `requests_total {path="/a"}`, []float64{13, 3}, 2},
+		{AggregateSum, `requests_total {path="/b"}`, []float64{4, 4}, 1},
+		// Gauges are aggregated by the given operation.
+		{AggregateSum, "queue_length", []float64{8, 8}, 2},
+		{AggregateAvg, "queue_length", []float64{4, 4}, 2},
+		{AggregateMin, "queue_length", []float64{3, 3}, 2},
+		{AggregateMax, "queue_length", []float64{5, 5}, 2},
+		// Histograms are summed and their estimates derived again.
+		{AggregateMax, `latency_seconds_bucket {le="0.1"}`, []float64{4, 4}, 2},
+		{AggregateMax, "latency_seconds_count", []float64{8, 8}, 2},
+		{AggregateMax, "latency_seconds_avg", []float64{0.5, 0.5}, 2},
+		{AggregateMax, `latency_seconds_quantile {quantile="0.5"}`, []float64{0.1, 0.1}, 2},
+		{AggregateMax, `latency_seconds_interval_quantile {quantile="0.5"}`, []float64{math.NaN(), math.NaN()}, 2},
+		// Series without the labels are left alone.
+		{AggregateSum, `build_info {version="1"}`, []float64{1, 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op.String()+" "+tt.name, func(t *testing.T) {
+			a := Aggregation{Without: []string{"code"}, Gauges: tt.op}
+			var series []Observation
+			for _, s := range a.Aggregate(dump) {
+				if s[0].Name == tt.name {
+					series = s
+				}
+			}
+			if len(series) != len(tt.values) {
+				t.Fatalf("Expected %d observations, but got %d", len(tt.values), len(series))
+			}
+			for i, o := range series {
+				if o.Value != tt.values[i] && !(math.IsNaN(o.Value) && math.IsNaN(tt.values[i])) {
+					t.Errorf("%d: Expected %v, but got %v", i, tt.values[i], o.Value)
+				}
+				if o.Aggregated != tt.aggregated {
+					t.Errorf("%d: Expected %v aggregated series, but got %v", i, tt.aggregated, o.Aggregated)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAggregateOp(t *testing.T) {
+	for _, op := range []AggregateOp{AggregateSum, AggregateAvg, AggregateMin, AggregateMax} {
+		if actual, err := ParseAggregateOp(op.String()); err != nil || actual != op {
+			t.Errorf("Expected %v, but got %v (%v)", op, actual, err)
+		}
+	}
+	if _, err := ParseAggregateOp("median"); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
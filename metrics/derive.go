@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// DefaultRateKinds are the kinds of observations for which a Deriver derives
+// per-second rates by default (i.e. all monotonically increasing kinds).
+var DefaultRateKinds = []ObservationKind{
+	ObservationCounter,
+	ObservationHistogramCount,
+	ObservationHistogramBucket,
+	ObservationSummaryCount,
+}
+
+// RateWindowBuffer is the Deriver.RateWindow spanning all observations of a
+// series.
+const RateWindowBuffer time.Duration = -1
+
+// Deriver derives additional series (e.g. per-second rates) from the series of
+// observations returned by Store.Dump.
+type Deriver struct {
+
+	// RateKinds are the kinds of observations for which a per-second rate is
+	// derived.
+	RateKinds []ObservationKind
+
+	// RateWindow is the window over which an average per-second rate is derived
+	// in addition to the instant rate (between adjacent observations). Zero
+	// disables the average rate and RateWindowBuffer averages over the whole
+	// series.
+	RateWindow time.Duration
+
+	// RateSmoothing is the smoothing factor (between 0 and 1) of the
+	// exponentially weighted moving average applied to the instant rates. Zero
+	// disables smoothing.
+	RateSmoothing float64
+}
+
+// Derive returns the given series followed by the series derived from it.
+// Observations in derived series are sorted from youngest to oldest, just like
+// in the given series.
+func (d Deriver) Derive(series []Observation) [][]Observation {
+	derived := [][]Observation{series}
+	if len(series) < 2 {
+		return derived
+	}
+
+	// Derive rate series from counter like series.
+	if slices.Contains(d.RateKinds, series[0].Kind) {
+		rs := make([]Observation, 0, len(series)-1)
+		for i := 0; i < len(series)-1; i++ {
+			rs = append(rs, rate(series[i], series[i+1]))
+		}
+		if d.RateSmoothing > 0 {
+			smooth(rs, d.RateSmoothing)
+		}
+		derived = append(derived, rs)
+
+		if d.RateWindow != 0 {
+			ws := make([]Observation, 0, len(series)-1)
+			for i := 0; i < len(series)-1; i++ {
+				ws = append(ws, d.windowRate(series[i:]))
+			}
+			derived = append(derived, ws)
+		}
+	}
+	return derived
+}
+
+// smooth replaces the values of the given series (sorted from youngest to
+// oldest) by their exponentially weighted moving average with the smoothing
+// factor alpha. The average is recomputed from the oldest observation on, so it
+// does not depend on any state outside the series. NaN values are skipped.
+func smooth(series []Observation, alpha float64) {
+	avg := math.NaN()
+	for i := len(series) - 1; i >= 0; i-- {
+		v := series[i].Value
+		switch {
+		case math.IsNaN(v):
+		case math.IsNaN(avg):
+			avg = v
+		default:
+			avg = alpha*v + (1-alpha)*avg
+		}
+		series[i].Smoothed = true
+		series[i].Raw = v
+		series[i].Value = avg
+	}
+}
+
+// windowRate returns the average per-second rate over the rate window, ending
+// at the first (youngest) observation of the given series. If the series does
+// not span the whole window, windowRate falls back to the instant rate.
+func (d Deriver) windowRate(series []Observation) Observation {
+	c := series[0]
+	end := 1
+	switch {
+	case d.RateWindow == RateWindowBuffer:
+		end = len(series) - 1
+	case c.Time.Sub(series[len(series)-1].Time) >= d.RateWindow:
+		for c.Time.Sub(series[end].Time) < d.RateWindow {
+			end++
+		}
+	}
+	var delta float64
+	for i := 0; i < end; i++ {
+		delta += increase(series[i].Value, series[i+1].Value)
+	}
+	r := NewObservation(c.Metric+"_per_second_avg_rate", c.Labels, ObservationCounterWindowRate, c.Time,
+		perSecond(delta, c.Time.Sub(series[end].Time)))
+	r.TimeSource, r.Stale, r.Aggregated = c.TimeSource, c.Stale, c.Aggregated
+	return r
+}
+
+// rate returns the per-second rate between the current observation c and the
+// previous observation p. As stale observations are copies of the latest
+// earlier observation, the rate of a metric reappearing after a gap spans the
+// gap, and the rate of a stale observation is NaN.
+func rate(c, p Observation) Observation {
+	r := NewObservation(c.Metric+"_per_second_rate", c.Labels, ObservationCounterRate, c.Time,
+		perSecond(increase(c.Value, p.Value), c.Time.Sub(p.Time)))
+	r.TimeSource, r.Stale, r.Aggregated = c.TimeSource, c.Stale, c.Aggregated
+	return r
+}
+
+// increase returns the increase of a counter from the previous value p to the
+// current value c. A decreasing value is considered a counter reset (i.e. the
+// counter restarted from zero).
+func increase(c, p float64) float64 {
+	if c < p {
+		return c
+	}
+	return c - p
+}
+
+// perSecond returns the per-second rate of the given delta over the given
+// duration. The rate is NaN, if the duration is not positive.
+func perSecond(delta float64, dur time.Duration) float64 {
+	if dur <= 0 {
+		return math.NaN()
+	}
+	return delta / dur.Seconds()
+}
@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDeriver_Derive(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	labels := []Label{{Name: "code", Value: "200"}}
+	obs := func(kind ObservationKind, offset time.Duration, value float64) Observation {
+		return NewObservation("requests_total", labels, kind, t0.Add(offset), value)
+	}
+
+	stale := func(o Observation) Observation {
+		o.Stale = true
+		return o
+	}
+
+	tests := []struct {
+		name     string
+		series   []Observation
+		expected []float64
+	}{
+		{
+			name: "counter",
+			series: []Observation{
+				obs(ObservationCounter, 10*time.Second, 30),
+				obs(ObservationCounter, 5*time.Second, 20),
+				obs(ObservationCounter, 0, 10),
+			},
+			expected: []float64{2, 2},
+		},
+		{
+			name: "histogram count",
+			series: []Observation{
+				obs(ObservationHistogramCount, 4*time.Second, 12),
+				obs(ObservationHistogramCount, 2*time.Second, 4),
+			},
+			expected: []float64{4},
+		},
+		{
+			name: "summary count",
+			series: []Observation{
+				obs(ObservationSummaryCount, 2*time.Second, 6),
+				obs(ObservationSummaryCount, 0, 2),
+			},
+			expected: []float64{2},
+		},
+		{
+			name: "histogram bucket",
+			series: []Observation{
+				obs(ObservationHistogramBucket, 2*time.Second, 3),
+				obs(ObservationHistogramBucket, 0, 1),
+			},
+			expected: []float64{1},
+		},
+		{
+			name: "counter reset",
+			series: []Observation{
+				obs(ObservationCounter, 10*time.Second, 15),
+				obs(ObservationCounter, 5*time.Second, 5),
+				obs(ObservationCounter, 0, 40),
+			},
+			expected: []float64{2, 1},
+		},
+		{
+			name: "single observation",
+			series: []Observation{
+				obs(ObservationCounter, 0, 10),
+			},
+			expected: nil,
+		},
+		{
+			name: "zero duration",
+			series: []Observation{
+				obs(ObservationCounter, 0, 20),
+				obs(ObservationCounter, 0, 10),
+			},
+			expected: []float64{math.NaN()},
+		},
+		{
+			name: "gap",
+			series: []Observation{
+				obs(ObservationCounter, 15*time.Second, 40),
+				stale(obs(ObservationCounter, 0, 10)),
+				stale(obs(ObservationCounter, 0, 10)),
+				obs(ObservationCounter, 0, 10),
+			},
+			expected: []float64{2, math.NaN(), math.NaN()},
+		},
+		{
+			name: "gauge",
+			series: []Observation{
+				obs(ObservationGauge, 5*time.Second, 3),
+				obs(ObservationGauge, 0, 1),
+			},
+			expected: nil,
+		},
+	}
+
+	d := Deriver{RateKinds: DefaultRateKinds}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			derived := d.Derive(tt.series)
+			if len(derived[0]) != len(tt.series) {
+				t.Fatalf("Expected the original series first, but got %v", derived[0])
+			}
+			if tt.expected == nil {
+				if len(derived) != 1 {
+					t.Errorf("Expected no derived series, but got %v", derived[1:])
+				}
+				return
+			}
+			if len(derived) != 2 || len(derived[1]) != len(tt.expected) {
+				t.Fatalf("Expected rates %v, but got %v", tt.expected, derived[1:])
+			}
+			for i, r := range derived[1] {
+				if r.Kind != ObservationCounterRate {
+					t.Errorf("Expected kind %v, but got %v", ObservationCounterRate, r.Kind)
+				}
+				if r.Name != `requests_total_per_second_rate {code="200"}` {
+					t.Errorf("Unexpected name %q", r.Name)
+				}
+				if !r.Time.Equal(tt.series[i].Time) {
+					t.Errorf("Expected time %v, but got %v", tt.series[i].Time, r.Time)
+				}
+				if math.IsNaN(tt.expected[i]) && math.IsNaN(r.Value) {
+					continue
+				}
+				if r.Value != tt.expected[i] {
+					t.Errorf("Expected rate %v, but got %v", tt.expected[i], r.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestDeriver_DeriveRateKinds(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := []Observation{
+		NewObservation("latency_bucket", []Label{{Name: "le", Value: "1"}}, ObservationHistogramBucket, t0.Add(time.Second), 2),
+		NewObservation("latency_bucket", []Label{{Name: "le", Value: "1"}}, ObservationHistogramBucket, t0, 1),
+	}
+	d := Deriver{RateKinds: []ObservationKind{ObservationCounter}}
+	if derived := d.Derive(series); len(derived) != 1 {
+		t.Errorf("Expected no derived series, but got %v", derived[1:])
+	}
+}
+
+func TestParseObservationKind(t *testing.T) {
+	for k := range observationKindNames {
+		actual, err := ParseObservationKind(k.String())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if actual != k {
+			t.Errorf("Expected %v, but got %v", k, actual)
+		}
+	}
+	if _, err := ParseObservationKind("foo"); err == nil {
+		t.Errorf("Expected error for unknown kind")
+	}
+}
+
+func TestDeriver_DeriveRateWindow(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	obs := func(offset time.Duration, value float64) Observation {
+		return NewObservation("requests_total", nil, ObservationCounter, t0.Add(offset), value)
+	}
+	series := []Observation{
+		obs(30*time.Second, 70),
+		obs(20*time.Second, 10),
+		obs(10*time.Second, 40),
+		obs(0, 0),
+	}
+
+	tests := []struct {
+		name     string
+		window   time.Duration
+		expected []float64
+	}{
+		// The counter was reset between 10s and 20s.
+		{name: "buffer", window: RateWindowBuffer, expected: []float64{110.0 / 30, 50.0 / 20, 4}},
+		{name: "duration", window: 20 * time.Second, expected: []float64{70.0 / 20, 50.0 / 20, 4}},
+		// The series does not span the window, fall back to the instant rate.
+		{name: "longer than series", window: time.Minute, expected: []float64{6, 1, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Deriver{RateKinds: DefaultRateKinds, RateWindow: tt.window}
+			derived := d.Derive(series)
+			if len(derived) != 3 {
+				t.Fatalf("Expected 3 series, but got %d", len(derived))
+			}
+			for i, r := range derived[2] {
+				if r.Kind != ObservationCounterWindowRate {
+					t.Errorf("Expected kind %v, but got %v", ObservationCounterWindowRate, r.Kind)
+				}
+				if math.Abs(r.Value-tt.expected[i]) > 1e-9 {
+					t.Errorf("Expected rate %v at %d, but got %v", tt.expected[i], i, r.Value)
+				}
+			}
+		})
+	}
+
+	// No average rate without a window.
+	if derived := (Deriver{RateKinds: DefaultRateKinds}).Derive(series); len(derived) != 2 {
+		t.Errorf("Expected 2 series, but got %d", len(derived))
+	}
+}
+
+func TestDeriver_DeriveRateSmoothing(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	obs := func(offset time.Duration, value float64) Observation {
+		return NewObservation("requests_total", nil, ObservationCounter, t0.Add(offset), value)
+	}
+
+	// Instant rates (oldest to newest): 0, NaN, 10, 0.
+	series := []Observation{
+		obs(3*time.Second, 10),
+		obs(2*time.Second, 10),
+		obs(1*time.Second, 0),
+		obs(1*time.Second, 0),
+		obs(0, 0),
+	}
+	d := Deriver{RateKinds: DefaultRateKinds, RateSmoothing: 0.5}
+	derived := d.Derive(series)
+	expected := []float64{2.5, 5, 0, 0}
+	raw := []float64{0, 10, math.NaN(), 0}
+	for i, r := range derived[1] {
+		if !r.Smoothed {
+			t.Errorf("Expected smoothed observation at %d", i)
+		}
+		if r.Value != expected[i] {
+			t.Errorf("Expected %v at %d, but got %v", expected[i], i, r.Value)
+		}
+		if r.Raw != raw[i] && !(math.IsNaN(raw[i]) && math.IsNaN(r.Raw)) {
+			t.Errorf("Expected raw %v at %d, but got %v", raw[i], i, r.Raw)
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		dur      time.Duration
+		expected float64
+	}{
+		{name: "100ms", dur: 100 * time.Millisecond, expected: 60},
+		{name: "600ms", dur: 600 * time.Millisecond, expected: 10},
+		{name: "1s", dur: time.Second, expected: 6},
+		{name: "1.5s", dur: 1500 * time.Millisecond, expected: 4},
+		{name: "equal timestamps", dur: 0, expected: math.NaN()},
+		{name: "negative duration", dur: -time.Second, expected: math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewObservation("requests_total", nil, ObservationCounter, t0, 4)
+			c := NewObservation("requests_total", nil, ObservationCounter, t0.Add(tt.dur), 10)
+			r := rate(c, p)
+			if math.IsNaN(tt.expected) && math.IsNaN(r.Value) {
+				return
+			}
+			if math.Abs(r.Value-tt.expected) > 1e-9 {
+				t.Errorf("Expected %v, but got %v", tt.expected, r.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Package metrics scrapes Prometheus metrics endpoints and keeps a short
+// history of the scraped metrics.
+//
+// A Store fetches the metrics from an endpoint on each call to Store.Sample,
+// flattens them into Observations (one per series, e.g. one per histogram
+// bucket) and keeps the latest samples in a ring buffer. Store.Dump returns the
+// history of each series, which a Deriver may extend by derived series (e.g.
+// per-second rates of counters):
+//
+//	store := metrics.NewStore(3, metrics.NewHTTPFetcher("http://localhost:8080/metrics"))
+//	if _, err := store.Sample(ctx); err != nil {
+//		return err
+//	}
+//	dump, err := store.Dump("http_requests")
+//	if err != nil {
+//		return err
+//	}
+//	deriver := metrics.Deriver{RateKinds: metrics.DefaultRateKinds}
+//	for _, series := range dump {
+//		for _, s := range deriver.Derive(series) {
+//			fmt.Println(s[0].Name, s[0].Value)
+//		}
+//	}
+package metrics
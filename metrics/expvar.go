@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+
+	prom "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// expvarFormat is the format of the JSON of Go's expvar package (e.g. served
+// at /debug/vars), reported by the readers of stores forced to parse expvar
+// (see Store.Expvar).
+const expvarFormat expfmt.Format = "application/json; format=expvar"
+
+// expvarCounters are the fields of runtime.MemStats (memstats in expvar)
+// that are cumulative, so that they are counters rather than gauges.
+var expvarCounters = []string{"TotalAlloc", "Mallocs", "Frees", "Lookups", "NumGC", "NumForcedGC", "PauseTotalNs"}
+
+// maybeExpvar returns true, if the given reader may be expvar JSON: a
+// FormatReader of JSON (or of expvarFormat). Readers of an unknown format may
+// be, too (see isExpvar).
+func maybeExpvar(in io.Reader) bool {
+	fr, ok := in.(FormatReader)
+	if !ok {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(string(fr.Format()))
+	return mediaType == "application/json"
+}
+
+// isExpvar returns true, if the given bytes read from the given reader are
+// expvar JSON: a JSON object (see isJSONObject), or anything read from a
+// reader of expvarFormat.
+func isExpvar(in io.Reader, b []byte) bool {
+	if fr, ok := in.(FormatReader); ok && fr.Format() == expvarFormat {
+		return true
+	}
+	return isJSONObject(b)
+}
+
+// isJSONObject returns true, if the given bytes start with a JSON object
+// holding a member (e.g. `{"cmdline": [`). An opening brace alone does not
+// do, as the text format starts with one, if the name of the first metric is
+// quoted (e.g. `{"my.metric"} 1`).
+func isJSONObject(b []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return false
+	}
+	// The member's value is read only after its name and colon.
+	for range 2 {
+		if _, err := dec.Token(); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseExpvar parses the given expvar JSON into metric families. Nested
+// objects are flattened into dotted names (e.g. memstats.HeapAlloc), numbers
+// become gauges (or counters, see expvarCounters), and the command line
+// (cmdline) becomes the label of a gauge of 1. Other values (e.g. strings or
+// the arrays of memstats) are skipped, returning their number.
+func parseExpvar(b []byte) ([]*prom.MetricFamily, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var vars map[string]any
+	if err := dec.Decode(&vars); err != nil {
+		return nil, 0, fmt.Errorf("expvar: %w", err)
+	}
+	var mfs []*prom.MetricFamily
+	skipped := 0
+	var flatten func(name string, v any)
+	flatten = func(name string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for _, key := range sortedKeys(v) {
+				flatten(name+"."+key, v[key])
+			}
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				skipped++
+				return
+			}
+			mf := &prom.MetricFamily{Name: ptr(name), Type: prom.MetricType_GAUGE.Enum()}
+			m := &prom.Metric{Gauge: &prom.Gauge{Value: &f}}
+			if field, ok := strings.CutPrefix(name, "memstats."); ok && slices.Contains(expvarCounters, field) {
+				mf.Type = prom.MetricType_COUNTER.Enum()
+				m = &prom.Metric{Counter: &prom.Counter{Value: &f}}
+			}
+			mf.Metric = []*prom.Metric{m}
+			mfs = append(mfs, mf)
+		default:
+			skipped++
+		}
+	}
+	for _, key := range sortedKeys(vars) {
+		if args, ok := vars[key].([]any); ok && key == "cmdline" {
+			mfs = append(mfs, cmdlineFamily(args))
+			continue
+		}
+		flatten(key, vars[key])
+	}
+	return mfs, skipped, nil
+}
+
+// cmdlineFamily returns the gauge of 1 labeled with the given command line of
+// expvar (e.g. cmdline{args="/bin/api -port 8080"} 1).
+func cmdlineFamily(args []any) *prom.MetricFamily {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = fmt.Sprint(arg)
+	}
+	one := 1.0
+	return &prom.MetricFamily{
+		Name: ptr("cmdline"),
+		Type: prom.MetricType_GAUGE.Enum(),
+		Metric: []*prom.Metric{{
+			Label: []*prom.LabelPair{{Name: ptr("args"), Value: ptr(strings.Join(s, " "))}},
+			Gauge: &prom.Gauge{Value: &one},
+		}},
+	}
+}
+
+// sortedKeys returns the keys of the given object in order.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// expvarText describes the values skipped by parseExpvar (e.g. "parsed as
+// expvar, 3 non-numeric values skipped").
+func expvarText(skipped int) string {
+	if skipped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("parsed as expvar, %d non-numeric values skipped", skipped)
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+const expvarFixture = `{
+"cmdline": ["/bin/api", "-port", "8080"],
+"requests": 42,
+"version": "1.2.3",
+"cache": {"hits": 7, "misses": 2},
+"memstats": {"Alloc": 1024, "NumGC": 3, "PauseNs": [1, 2, 3]}
+}
+`
+
+func TestDecode_Expvar(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		format   string
+		families string
+		warning  string
+		err      bool
+	}{
+		{
+			name:     "detected",
+			in:       expvarFixture,
+			families: "cache.hits:GAUGE cache.misses:GAUGE cmdline:GAUGE memstats.Alloc:GAUGE memstats.NumGC:COUNTER requests:GAUGE",
+			warning:  "parsed as expvar, 2 non-numeric values skipped",
+		},
+		{
+			name:     "json",
+			in:       `{"requests": 42}`,
+			format:   "application/json",
+			families: "requests:GAUGE",
+		},
+		{
+			name:     "forced",
+			in:       ` {"requests": 42}`,
+			format:   string(expvarFormat),
+			families: "requests:GAUGE",
+		},
+		{
+			name:     "text served as json",
+			in:       "# TYPE a gauge\na 1\n",
+			format:   "application/json",
+			families: "a:GAUGE",
+			warning:  `unsupported content type "application/json", parsed as text`,
+		},
+		{
+			name:     "quoted name",
+			in:       "{\"my.metric\"} 1\n",
+			families: "my.metric:UNTYPED",
+		},
+		{
+			name:   "forced text",
+			in:     "# TYPE a gauge\na 1\n",
+			format: string(expvarFormat),
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Readers of files do not report a format.
+			var in io.Reader = strings.NewReader(tt.in)
+			if tt.format != "" {
+				in = formatReader{in, expfmt.Format(tt.format)}
+			}
+			mfs, warning, err := decode(in, 0, nil)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Expected an error, but got %d families", len(mfs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var families []string
+			for _, mf := range mfs {
+				families = append(families, mf.GetName()+":"+mf.GetType().String())
+			}
+			if actual := strings.Join(families, " "); actual != tt.families {
+				t.Errorf("Expected %q, but got %q", tt.families, actual)
+			}
+			if warning != tt.warning {
+				t.Errorf("Expected warning %q, but got %q", tt.warning, warning)
+			}
+		})
+	}
+}
+
+func TestParseExpvar_Cmdline(t *testing.T) {
+	mfs, _, err := parseExpvar([]byte(expvarFixture))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "cmdline" {
+			continue
+		}
+		if args := mf.GetMetric()[0].GetLabel()[0].GetValue(); args != "/bin/api -port 8080" {
+			t.Errorf("Expected %q, but got %q", "/bin/api -port 8080", args)
+		}
+		return
+	}
+	t.Errorf("Expected a cmdline family, but got %v", mfs)
+}
@@ -0,0 +1,382 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// Fetcher fetches metrics in the Prometheus exposition format.
+type Fetcher interface {
+
+	// Fetch returns the metrics along with the time they were fetched at.
+	// The caller must close the returned reader.
+	Fetch(ctx context.Context) (io.ReadCloser, time.Time, error)
+}
+
+// FormatReader is implemented by readers returned by a Fetcher that know the
+// exposition format of the metrics they return (e.g. from the Content-Type of
+// an HTTP response). The metrics of any other reader are parsed as text.
+type FormatReader interface {
+	io.Reader
+
+	// Format returns the exposition format of the metrics. An empty format
+	// means that the format is not known.
+	Format() expfmt.Format
+}
+
+// acceptHeader lists the exposition formats supported by HTTPFetcher in order
+// of preference. UTF-8 metric and label names (e.g. of OpenTelemetry) are
+// asked for unescaped.
+var acceptHeader = strings.Join([]string{
+	string(expfmt.NewFormat(expfmt.TypeProtoDelim).WithEscapingScheme(model.NoEscaping)) + ";q=0.7",
+	string(expfmt.NewFormat(expfmt.TypeOpenMetrics).WithEscapingScheme(model.NoEscaping)) + ";q=0.6",
+	string(expfmt.NewFormat(expfmt.TypeTextPlain).WithEscapingScheme(model.NoEscaping)) + ";q=0.5",
+	"*/*;q=0.1",
+}, ",")
+
+// HTTPFetcher is a Fetcher that fetches metrics from an HTTP endpoint.
+type HTTPFetcher struct {
+
+	// Endpoint is the URL of the metrics endpoint.
+	Endpoint string
+
+	// Client is the client to send requests with. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+
+	// Header holds additional headers to send with each request (e.g. for
+	// authentication).
+	Header http.Header
+
+	// UserAgent is the User-Agent header sent with each request. If empty,
+	// DefaultUserAgent is used.
+	UserAgent string
+
+	// skew is the latest clock skew of the endpoint (see ClockSkew), dated is
+	// set if the latest fetch was timed by the endpoint (see Dated), and
+	// interval is the interval the endpoint is fetched at (see SetInterval).
+	skew     atomic.Int64
+	dated    atomic.Bool
+	interval atomic.Int64
+}
+
+// DefaultUserAgent is the User-Agent header sent by an HTTPFetcher, unless
+// overridden.
+const DefaultUserAgent = "promtui"
+
+// drainLimit is the number of unread bytes of a response body that are read
+// before closing it, so that the connection can be reused. Connections of
+// larger bodies are closed.
+const drainLimit = 64 << 10
+
+// NewHTTPFetcher returns a new HTTPFetcher for the given endpoint. It sends
+// requests with a client of its own, which keeps connections alive between
+// fetches (so that short intervals do not pay for a TCP and TLS handshake on
+// each fetch).
+func NewHTTPFetcher(endpoint string) *HTTPFetcher {
+	return &HTTPFetcher{Endpoint: endpoint, Client: newHTTPClient()}
+}
+
+// newHTTPClient returns a client with a transport of its own, keeping idle
+// connections to the endpoint alive.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 2
+	transport.IdleConnTimeout = 5 * time.Minute
+	return &http.Client{Transport: transport}
+}
+
+// Fetch fetches the metrics from the endpoint. The returned time is the time
+// given by the Date header of the response, which is more honest than the
+// local one when fetching through a caching proxy or a slow link. Since the
+// header has a resolution of a second, it is used only if the fetches are
+// further apart (see SetInterval). Otherwise, and without a (valid) Date
+// header, the returned time is the time the response was received at. Either
+// way, the header estimates the clock skew (see ClockSkew). The returned
+// reader is a FormatReader reporting the format given by the Content-Type
+// header of the response.
+func (f *HTTPFetcher) Fetch(ctx context.Context) (io.ReadCloser, time.Time, error) {
+	resp, err := get(ctx, f.Client, f.Endpoint, f.Header, acceptHeader, f.UserAgent)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return nil, time.Time{}, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	received := time.Now()
+	f.skew.Store(int64(clockSkew(resp, received)))
+	ts := received
+	date, ok := dateFromResponse(resp)
+	dated := ok && f.datable()
+	if dated {
+		ts = date
+	}
+	f.dated.Store(dated)
+	return &httpBody{ReadCloser: resp.Body, format: formatFromResponse(resp)}, ts, nil
+}
+
+// dateResolution is the resolution of the Date header of HTTP responses.
+const dateResolution = time.Second
+
+// SetInterval sets the interval the endpoint is fetched at. The Date header
+// times the fetches only if its resolution is below the interval (or none is
+// set, e.g. when fetched on demand), so that the times of fetches stay
+// apart.
+func (f *HTTPFetcher) SetInterval(d time.Duration) {
+	f.interval.Store(int64(d))
+}
+
+// datable returns true, if the Date header may time the fetches (see
+// SetInterval).
+func (f *HTTPFetcher) datable() bool {
+	d := time.Duration(f.interval.Load())
+	return d <= 0 || d > dateResolution
+}
+
+// Dated returns true, if the time of the latest fetch was given by the Date
+// header of the response (see Fetch).
+func (f *HTTPFetcher) Dated() bool {
+	return f.dated.Load()
+}
+
+// ClockSkew returns how far the clock of the endpoint was ahead of the local
+// one (negative, if behind) at the latest fetch, as estimated by the Date
+// header of the response (see clockSkew).
+func (f *HTTPFetcher) ClockSkew() time.Duration {
+	return time.Duration(f.skew.Load())
+}
+
+// CloseIdleConnections closes the connections the client of the fetcher keeps
+// alive between fetches (unless it is http.DefaultClient, which is shared).
+func (f *HTTPFetcher) CloseIdleConnections() {
+	if f.Client != nil {
+		f.Client.CloseIdleConnections()
+	}
+}
+
+// get sends a GET request for the given URL with the given client (or
+// http.DefaultClient, if nil), additional headers, Accept header and
+// User-Agent header (or DefaultUserAgent, if empty).
+func get(ctx context.Context, client *http.Client, url string, header http.Header, accept, userAgent string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for name, values := range header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set("Accept", accept)
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	return resp, nil
+}
+
+// StatusError is the error of a response with a status other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// httpBody is the body of an HTTP response along with its exposition format.
+type httpBody struct {
+	io.ReadCloser
+	format expfmt.Format
+}
+
+// Format returns the exposition format of the body.
+func (b *httpBody) Format() expfmt.Format {
+	return b.format
+}
+
+// Close drains the rest of the body (up to drainLimit), so that the
+// connection can be reused, and closes it.
+func (b *httpBody) Close() error {
+	_, _ = io.CopyN(io.Discard, b.ReadCloser, drainLimit)
+	return b.ReadCloser.Close()
+}
+
+// formatFromResponse returns the exposition format given by the Content-Type
+// header of the response. Content types unknown to expfmt.ResponseFormat are
+// returned as is, so that they can be reported.
+func formatFromResponse(resp *http.Response) expfmt.Format {
+	if format := expfmt.ResponseFormat(resp.Header); format.FormatType() != expfmt.TypeUnknown {
+		return format
+	}
+	return expfmt.Format(resp.Header.Get("Content-Type"))
+}
+
+// minClockSkew is the smallest clock skew clockSkew reports. The Date header
+// has a resolution of a second, and responses take their time to arrive, so
+// that smaller offsets cannot be told from none.
+const minClockSkew = 2 * time.Second
+
+// clockSkew returns how far the time given by the Date header of the response
+// (in RFC1123 or RFC1123Z) was ahead of the given time the response was
+// received at, rounded to seconds. Zero is returned for skews below
+// minClockSkew, and if there is no (valid) Date header.
+func clockSkew(resp *http.Response, received time.Time) time.Duration {
+	date, ok := dateFromResponse(resp)
+	if !ok {
+		return 0
+	}
+	// The header is truncated to seconds, so that the skew is half a second
+	// more on average.
+	skew := (date.Sub(received) + dateResolution/2).Round(time.Second)
+	if skew.Abs() < minClockSkew {
+		return 0
+	}
+	return skew
+}
+
+// dateFromResponse returns the time given by the Date header of the response
+// (in RFC1123 or RFC1123Z). It returns false, if there is no (valid) Date
+// header.
+func dateFromResponse(resp *http.Response) (time.Time, bool) {
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC1123, time.RFC1123Z} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// FileFetcher is a Fetcher that reads metrics from a file (e.g. a saved dump
+// of a metrics endpoint). The file is re-read on each fetch.
+type FileFetcher struct {
+
+	// Path is the path of the file.
+	Path string
+}
+
+// NewFileFetcher returns a new FileFetcher for the given file.
+func NewFileFetcher(path string) *FileFetcher {
+	return &FileFetcher{Path: path}
+}
+
+// Fetch opens the file. The returned time is the current time.
+func (f *FileFetcher) Fetch(_ context.Context) (io.ReadCloser, time.Time, error) {
+	r, err := os.Open(f.Path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("open file: %w", err)
+	}
+	return r, time.Now(), nil
+}
+
+// ReaderFetcher is a Fetcher that reads metrics from a reader which can only be
+// read once (e.g. stdin). Any but the first fetch fails.
+type ReaderFetcher struct {
+	r    io.Reader
+	mux  sync.Mutex
+	read bool
+}
+
+// NewReaderFetcher returns a new ReaderFetcher for the given reader.
+func NewReaderFetcher(r io.Reader) *ReaderFetcher {
+	return &ReaderFetcher{r: r}
+}
+
+// Fetch returns the reader on the first call and an error on subsequent calls.
+// The returned time is the current time.
+func (f *ReaderFetcher) Fetch(_ context.Context) (io.ReadCloser, time.Time, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.read {
+		return nil, time.Time{}, fmt.Errorf("reader has already been read")
+	}
+	f.read = true
+	return io.NopCloser(f.r), time.Now(), nil
+}
+
+// ExecFetcher is a Fetcher that runs a command and reads metrics from its
+// stdout. A command exiting with a non-zero status fails the fetch, with the
+// first line of the command's stderr included in the error (see
+// stderrSummary).
+type ExecFetcher struct {
+
+	// Args are the command and its arguments.
+	Args []string
+
+	// Timeout bounds the run time of the command. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// NewExecFetcher returns a new ExecFetcher for the given command and arguments.
+func NewExecFetcher(args []string, timeout time.Duration) *ExecFetcher {
+	return &ExecFetcher{Args: args, Timeout: timeout}
+}
+
+// Fetch runs the command. The returned time is the time the command finished.
+func (f *ExecFetcher) Fetch(ctx context.Context) (io.ReadCloser, time.Time, error) {
+	if len(f.Args) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no command")
+	}
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.Args[0], f.Args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := stderrSummary(stderr.String()); msg != "" {
+			return nil, time.Time{}, fmt.Errorf("run command: %w: %s", err, msg)
+		}
+		return nil, time.Time{}, fmt.Errorf("run command: %w", err)
+	}
+	return io.NopCloser(&stdout), time.Now(), nil
+}
+
+// maxStderrSummary is the maximum length (in runes) of the stderr of a
+// command included in the error of a fetch.
+const maxStderrSummary = 200
+
+// stderrSummary returns the first non-empty line of the given stderr of a
+// command, cut to maxStderrSummary runes. Later lines are noted by "...".
+func stderrSummary(stderr string) string {
+	line, _, more := strings.Cut(strings.TrimSpace(stderr), "\n")
+	line = strings.TrimSpace(line)
+	if r := []rune(line); len(r) > maxStderrSummary {
+		line, more = string(r[:maxStderrSummary]), true
+	}
+	if more {
+		line += "..."
+	}
+	return line
+}
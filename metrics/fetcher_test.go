@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPFetcher_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Date", "Tue, 04 Mar 2025 14:02:11 UTC")
+		_, _ = io.WriteString(w, "up 1\n")
+	}))
+	defer srv.Close()
+
+	f := NewHTTPFetcher(srv.URL)
+	var statusErr *StatusError
+	if _, _, err := f.Fetch(context.Background()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected error for unauthorized request, but got %v", err)
+	}
+
+	f.Header = http.Header{"Authorization": []string{"Bearer secret"}}
+	before := time.Now()
+	body, ts, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() { _ = body.Close() }()
+	b, _ := io.ReadAll(body)
+	if string(b) != "up 1\n" {
+		t.Errorf("Unexpected body %q", b)
+	}
+	// The scrape is timed by the Date header, which also gives the clock
+	// skew.
+	date := time.Date(2025, 3, 4, 14, 2, 11, 0, time.UTC)
+	if !ts.Equal(date) || !f.Dated() {
+		t.Errorf("Expected %v, but got %v", date, ts)
+	}
+	if expected := date.Sub(before); (f.ClockSkew() - expected).Abs() > time.Minute {
+		t.Errorf("Expected %v, but got %v", expected, f.ClockSkew())
+	}
+
+	// Fetches faster than the resolution of the Date header are timed
+	// locally.
+	f.SetInterval(500 * time.Millisecond)
+	before = time.Now()
+	body, ts, err = f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = body.Close()
+	if ts.Before(before) || ts.After(time.Now()) || f.Dated() {
+		t.Errorf("Expected the time received, but got %v", ts)
+	}
+}
+
+func TestHTTPFetcher_KeepAlive(t *testing.T) {
+	var addrs, agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrs = append(addrs, r.RemoteAddr)
+		agents = append(agents, r.Header.Get("User-Agent"))
+		_, _ = io.WriteString(w, "up 1\n# trailing comment\n")
+	}))
+	defer srv.Close()
+
+	f := NewHTTPFetcher(srv.URL)
+	for i := range 3 {
+		if i == 2 {
+			f.UserAgent = "promtui/v1.2.3"
+		}
+		body, _, err := f.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// Bodies that are not read completely are drained on close.
+		_, _ = body.Read(make([]byte, 2))
+		_ = body.Close()
+	}
+
+	for _, addr := range addrs {
+		if addr != addrs[0] {
+			t.Errorf("Expected a single connection, but got %v", addrs)
+			break
+		}
+	}
+	expected := []string{DefaultUserAgent, DefaultUserAgent, "promtui/v1.2.3"}
+	if strings.Join(agents, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, but got %v", expected, agents)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	received := time.Date(2025, 3, 4, 14, 2, 0, 300*int(time.Millisecond), time.UTC)
+	tests := []struct {
+		name     string
+		date     string
+		expected time.Duration
+	}{
+		{name: "RFC1123", date: "Tue, 04 Mar 2025 14:02:11 UTC", expected: 11 * time.Second},
+		{name: "RFC1123Z", date: "Tue, 04 Mar 2025 15:01:50 +0100", expected: -10 * time.Second},
+		{name: "within resolution", date: "Tue, 04 Mar 2025 14:02:01 UTC"},
+		{name: "invalid", date: "yesterday"},
+		{name: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.date != "" {
+				resp.Header.Set("Date", tt.date)
+			}
+			if actual := clockSkew(resp, received); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDateFromResponse(t *testing.T) {
+	expected := time.Date(2025, 3, 4, 14, 2, 11, 0, time.UTC)
+	tests := []struct {
+		name string
+		date string
+		ok   bool
+	}{
+		{name: "RFC1123", date: "Tue, 04 Mar 2025 14:02:11 UTC", ok: true},
+		{name: "RFC1123Z", date: "Tue, 04 Mar 2025 15:02:11 +0100", ok: true},
+		{name: "invalid", date: "yesterday"},
+		{name: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.date != "" {
+				resp.Header.Set("Date", tt.date)
+			}
+			actual, ok := dateFromResponse(resp)
+			if ok != tt.ok || (ok && !actual.Equal(expected)) {
+				t.Errorf("Expected %v (%v), but got %v (%v)", expected, tt.ok, actual, ok)
+			}
+		})
+	}
+}
+
+func TestFileFetcher_Fetch(t *testing.T) {
+	f := NewFileFetcher("testdata/metrics.prom")
+	for i := 0; i < 2; i++ {
+		body, _, err := f.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_ = body.Close()
+	}
+	if _, _, err := NewFileFetcher("testdata/missing.prom").Fetch(context.Background()); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestReaderFetcher_Fetch(t *testing.T) {
+	f := NewReaderFetcher(strings.NewReader("up 1\n"))
+	body, _, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if b, _ := io.ReadAll(body); string(b) != "up 1\n" {
+		t.Errorf("Unexpected body %q", b)
+	}
+	if _, _, err := f.Fetch(context.Background()); err == nil {
+		t.Errorf("Expected error when fetching twice")
+	}
+}
+
+func TestExecFetcher_Fetch(t *testing.T) {
+	f := NewExecFetcher([]string{"echo", "up", "1"}, time.Second)
+	body, _, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if b, _ := io.ReadAll(body); string(b) != "up 1\n" {
+		t.Errorf("Unexpected body %q", b)
+	}
+
+	f = NewExecFetcher([]string{"sh", "-c", "echo oops >&2; exit 3"}, time.Second)
+	if _, _, err := f.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("Expected error with stderr, but got %v", err)
+	}
+
+	// Only the first line of stderr is included.
+	f = NewExecFetcher([]string{"sh", "-c", "echo oops >&2; echo more >&2; exit 3"}, time.Second)
+	if _, _, err := f.Fetch(context.Background()); err == nil || !strings.HasSuffix(err.Error(), ": oops...") {
+		t.Errorf("Expected error with the first line of stderr, but got %v", err)
+	}
+
+	f = NewExecFetcher([]string{"sleep", "5"}, 10*time.Millisecond)
+	if _, _, err := f.Fetch(context.Background()); err == nil {
+		t.Errorf("Expected timeout error")
+	}
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	prom "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// formatReader is a FormatReader of the given format.
+type formatReader struct {
+	io.Reader
+	format expfmt.Format
+}
+
+func (r formatReader) Format() expfmt.Format {
+	return r.format
+}
+
+// decodeLenient decodes the given fetched metrics like decode (keeping the
+// metric families selected by the given keeper), but skips the
+// metric families that fail to parse rather than failing altogether, returning
+// the errors of the skipped families. The text formats are parsed per family
+// for this (see splitFamilies), for which the metrics read are recorded while
+// decoding. The protobuf format cannot be resynchronized after an error, so
+// that it is neither recorded nor parsed per family, and fails as with decode.
+func decodeLenient(in io.Reader, limit int64, k *keeper) ([]*prom.MetricFamily, string, []error, error) {
+	if err := checkHTML(in); err != nil {
+		return nil, "", nil, err
+	}
+	format, warning := formatOf(in)
+	fr, isFormatReader := in.(FormatReader)
+	if format.FormatType() == expfmt.TypeProtoDelim || (isFormatReader && fr.Format() == expvarFormat) {
+		mfs, w, err := decode(in, limit, k)
+		return mfs, w, nil, err
+	}
+	if limit > 0 {
+		in = &limitReader{r: in, n: limit, limit: limit}
+	}
+	var buf bytes.Buffer
+	var tee io.Reader = io.TeeReader(in, &buf)
+	if isFormatReader {
+		tee = formatReader{tee, fr.Format()}
+	}
+	mfs, w, err := decode(tee, 0, k)
+	var sizeErr *bodySizeError
+	if err == nil || errors.As(err, &sizeErr) {
+		return mfs, w, nil, err
+	}
+	// The rest of the metrics is needed to parse the families following
+	// the one that failed.
+	if _, rerr := io.Copy(&buf, in); rerr != nil {
+		return nil, "", nil, rerr
+	}
+	b := buf.Bytes()
+	if isExpvar(fr, b) {
+		return nil, "", nil, err
+	}
+
+	om := hasOMEOF(b)
+	k.reset()
+	var skipped []error
+	for _, f := range splitFamilies(b) {
+		if om {
+			f.text = append(f.text, omEOF+"\n"...)
+		}
+		fmfs, _, ferr := decode(bytes.NewReader(f.text), 0, k)
+		if ferr != nil {
+			skipped = append(skipped, fmt.Errorf("%s: %w", f.name, shiftLine(ferr, f.line)))
+			continue
+		}
+		mfs = append(mfs, fmfs...)
+	}
+	if len(skipped) == 0 {
+		// The metrics are malformed as a whole (e.g. a metric family is
+		// given twice) rather than any of their families.
+		return nil, "", nil, err
+	}
+	if format.FormatType() == expfmt.TypeOpenMetrics && !om {
+		warning = "missing " + omEOF + ", parsed as text"
+	}
+	return mfs, warning, skipped, nil
+}
+
+// shiftLine returns the given parse error with its line number moved by the
+// given number of lines.
+func shiftLine(err error, lines int) error {
+	var pe expfmt.ParseError
+	if errors.As(err, &pe) {
+		pe.Line += lines
+		return pe
+	}
+	var le *lineError
+	if errors.As(err, &le) {
+		return &lineError{le.line + lines, le.err}
+	}
+	return err
+}
+
+// family is a metric family in a text format (see splitFamilies), starting
+// after the given number of lines.
+type family struct {
+	name string
+	line int
+	text []byte
+}
+
+// splitFamilies splits the given metrics in a text format into their metric
+// families, each starting with the HELP, TYPE, or UNIT line of a new name
+// (lines before the first go with the first family). The OpenMetrics EOF
+// marker is dropped.
+func splitFamilies(b []byte) []family {
+	var families []family
+	for i := 0; len(b) > 0; i++ {
+		n := bytes.IndexByte(b, '\n') + 1
+		if n == 0 {
+			n = len(b)
+		}
+		line := b[:n]
+		b = b[n:]
+		if strings.TrimSpace(string(line)) == omEOF {
+			continue
+		}
+		name := metaName(string(line))
+		switch {
+		case name != "" && (len(families) == 0 || families[len(families)-1].name != name):
+			families = append(families, family{name: name, line: i})
+		case len(families) == 0:
+			families = append(families, family{})
+		}
+		f := &families[len(families)-1]
+		f.text = append(f.text, line...)
+	}
+	return families
+}
+
+// metaName returns the name of the metric family of the given HELP, TYPE, or
+// UNIT line (unquoted, if it is a UTF-8 name), or an empty string for other
+// lines.
+func metaName(line string) string {
+	for _, keyword := range []string{"# HELP ", "# TYPE ", "# UNIT "} {
+		if rest, ok := strings.CutPrefix(line, keyword); ok {
+			name, _, _ := cutName(strings.TrimLeft(rest, " "), " \n")
+			return name
+		}
+	}
+	return ""
+}
+
+// skippedText describes the metric families parsed and skipped by
+// decodeLenient (e.g. "parsed 12 families, 2 skipped due to errors").
+func skippedText(parsed int, skipped []error) string {
+	return fmt.Sprintf("parsed %d families, %d skipped due to errors", parsed, len(skipped))
+}
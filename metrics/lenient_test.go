@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestDecodeLenient(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		format   string
+		families string
+		skipped  string
+		err      bool
+	}{
+		{
+			name:     "well-formed",
+			in:       "# TYPE a gauge\na 1\n# TYPE b gauge\nb 2\n",
+			families: "a b",
+		},
+		{
+			name:     "malformed sample",
+			in:       "# TYPE a gauge\na 1\n# HELP b B.\n# TYPE b gauge\nb{x=\"1} 2\n# TYPE c gauge\nc 3\n",
+			families: "a c",
+			skipped:  "b: text format parsing error in line 5",
+		},
+		{
+			name:     "malformed type",
+			in:       "# TYPE a gauge\na 1\n# TYPE b bogus\nb 2\n",
+			families: "a",
+			skipped:  "b: text format parsing error in line 3",
+		},
+		{
+			name:     "openmetrics",
+			in:       "# TYPE a gauge\na 1\n# TYPE b gauge\nb x\n# TYPE c counter\nc_total 3\n# EOF\n",
+			format:   "application/openmetrics-text; version=1.0.0",
+			families: "a c_total",
+			skipped:  "b: line 4",
+		},
+		{
+			name: "family given twice",
+			in:   "# TYPE a gauge\na 1\n# TYPE b gauge\nb 2\n# TYPE a gauge\na 3\n",
+			err:  true,
+		},
+		{
+			name:   "html",
+			in:     "<html></html>",
+			format: "text/html",
+			err:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mfs, _, skipped, err := decodeLenient(formatReader{strings.NewReader(test.in), expfmt.Format(test.format)}, 0, nil)
+			if test.err {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var names []string
+			for _, mf := range mfs {
+				names = append(names, mf.GetName())
+			}
+			// The text parser does not keep the order of the families.
+			slices.Sort(names)
+			if families := strings.Join(names, " "); families != test.families {
+				t.Errorf("Expected %q, but got %q", test.families, families)
+			}
+			switch {
+			case test.skipped == "" && len(skipped) != 0:
+				t.Errorf("Expected no skipped families, but got %v", skipped)
+			case test.skipped != "" && (len(skipped) != 1 || !strings.HasPrefix(skipped[0].Error(), test.skipped)):
+				t.Errorf("Expected %q, but got %v", test.skipped, skipped)
+			}
+		})
+	}
+}
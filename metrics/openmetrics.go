@@ -0,0 +1,448 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// omEOF is the marker terminating metrics in the OpenMetrics text format.
+const omEOF = "# EOF"
+
+// omSuffixes are the suffixes of the samples of the OpenMetrics metric types.
+var omSuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"gauge":          {""},
+	"histogram":      {"_bucket", "_count", "_sum", "_created"},
+	"gaugehistogram": {"_bucket", "_gcount", "_gsum"},
+	"summary":        {"", "_count", "_sum", "_created"},
+	"info":           {"_info"},
+	"stateset":       {""},
+	"unknown":        {""},
+}
+
+// hasOMEOF returns true, if the given metrics end with the OpenMetrics EOF
+// marker.
+func hasOMEOF(b []byte) bool {
+	b = bytes.TrimRight(b, "\n")
+	i := bytes.LastIndexByte(b, '\n')
+	return string(b[i+1:]) == omEOF
+}
+
+// omFamily is the metric family currently parsed by parseOpenMetrics. It is
+// implicit, if started by a HELP or UNIT line rather than a TYPE line.
+type omFamily struct {
+	name     string
+	typ      string
+	implicit bool
+	mf       *prom.MetricFamily
+	metrics  map[string]*prom.Metric
+}
+
+// parseOpenMetrics parses metrics in the OpenMetrics text format. Counters are
+// named after their "_total" samples and infos after their "_info" samples, so
+// that they are named the same as in the Prometheus text format.
+func parseOpenMetrics(b []byte) ([]*prom.MetricFamily, error) {
+	var mfs []*prom.MetricFamily
+	var fam *omFamily
+	newFamily := func(name, typ string) {
+		mf := &prom.MetricFamily{Name: &name}
+		switch typ {
+		case "counter":
+			mf.Name = ptr(name + "_total")
+			mf.Type = prom.MetricType_COUNTER.Enum()
+		case "info":
+			mf.Name = ptr(name + "_info")
+			mf.Type = prom.MetricType_GAUGE.Enum()
+		case "gauge", "stateset":
+			mf.Type = prom.MetricType_GAUGE.Enum()
+		case "histogram":
+			mf.Type = prom.MetricType_HISTOGRAM.Enum()
+		case "gaugehistogram":
+			mf.Type = prom.MetricType_GAUGE_HISTOGRAM.Enum()
+		case "summary":
+			mf.Type = prom.MetricType_SUMMARY.Enum()
+		default:
+			typ = "unknown"
+			mf.Type = prom.MetricType_UNTYPED.Enum()
+		}
+		fam = &omFamily{name: name, typ: typ, mf: mf, metrics: make(map[string]*prom.Metric)}
+		mfs = append(mfs, mf)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case line == omEOF:
+			if i != len(lines)-1 {
+				return nil, &lineError{i + 1, fmt.Errorf("content after %s", omEOF)}
+			}
+			return mfs, nil
+
+		case strings.HasPrefix(line, "# "):
+			keyword, rest, ok := strings.Cut(line[2:], " ")
+			if !ok {
+				continue
+			}
+			name, rest, err := cutName(rest, " ")
+			if err != nil {
+				return nil, &lineError{i + 1, err}
+			}
+			text, hasText := strings.CutPrefix(rest, " ")
+			switch keyword {
+			case "TYPE":
+				if !hasText {
+					return nil, &lineError{i + 1, errors.New("missing type")}
+				}
+				// HELP and UNIT lines may precede the TYPE line of their
+				// family.
+				var help, unit *string
+				if fam != nil && fam.name == name && fam.implicit && len(fam.mf.Metric) == 0 {
+					help, unit = fam.mf.Help, fam.mf.Unit
+					mfs = mfs[:len(mfs)-1]
+				}
+				newFamily(name, text)
+				fam.mf.Help, fam.mf.Unit = help, unit
+			case "HELP":
+				if fam == nil || fam.name != name {
+					newFamily(name, "unknown")
+					fam.implicit = true
+				}
+				if hasText {
+					fam.mf.Help = ptr(omUnescape(text))
+				}
+			case "UNIT":
+				if fam == nil || fam.name != name {
+					newFamily(name, "unknown")
+					fam.implicit = true
+				}
+				if hasText {
+					fam.mf.Unit = ptr(text)
+				}
+			}
+
+		case line == "":
+			continue
+
+		default:
+			s, err := parseOMSample(line)
+			if err != nil {
+				return nil, &lineError{i + 1, err}
+			}
+			suffix, ok := fam.suffix(s.name)
+			if !ok {
+				newFamily(s.name, "unknown")
+				suffix = ""
+			}
+			if err := fam.add(suffix, s); err != nil {
+				return nil, &lineError{i + 1, err}
+			}
+		}
+	}
+	return nil, fmt.Errorf("missing %s", omEOF)
+}
+
+// lineError is an error in the given line of metrics in the OpenMetrics text
+// format.
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *lineError) Unwrap() error {
+	return e.err
+}
+
+// suffix returns the suffix of the given sample name, if the sample belongs to
+// the family.
+func (f *omFamily) suffix(name string) (string, bool) {
+	if f == nil || !strings.HasPrefix(name, f.name) {
+		return "", false
+	}
+	suffix := name[len(f.name):]
+	for _, s := range omSuffixes[f.typ] {
+		if s == suffix {
+			return suffix, true
+		}
+	}
+	return "", false
+}
+
+// add adds the given sample (with the given suffix) to the family.
+func (f *omFamily) add(suffix string, s omSample) error {
+	// Buckets and quantiles of the same metric are told apart by their le
+	// and quantile label respectively.
+	var le, quantile *float64
+	labels := make([]*prom.LabelPair, 0, len(s.labels))
+	var key strings.Builder
+	for _, l := range s.labels {
+		switch {
+		case l.GetName() == "le" && suffix == "_bucket":
+			v, err := strconv.ParseFloat(l.GetValue(), 64)
+			if err != nil {
+				return fmt.Errorf("invalid le %q", l.GetValue())
+			}
+			le = &v
+			continue
+		case l.GetName() == "quantile" && f.typ == "summary" && suffix == "":
+			v, err := strconv.ParseFloat(l.GetValue(), 64)
+			if err != nil {
+				return fmt.Errorf("invalid quantile %q", l.GetValue())
+			}
+			quantile = &v
+			continue
+		}
+		labels = append(labels, l)
+		key.WriteString(l.GetName() + "=" + strconv.Quote(l.GetValue()) + ",")
+	}
+
+	m, ok := f.metrics[key.String()]
+	if !ok {
+		m = &prom.Metric{Label: labels}
+		switch f.mf.GetType() {
+		case prom.MetricType_COUNTER:
+			m.Counter = &prom.Counter{}
+		case prom.MetricType_GAUGE:
+			m.Gauge = &prom.Gauge{}
+		case prom.MetricType_HISTOGRAM, prom.MetricType_GAUGE_HISTOGRAM:
+			m.Histogram = &prom.Histogram{}
+		case prom.MetricType_SUMMARY:
+			m.Summary = &prom.Summary{}
+		default:
+			m.Untyped = &prom.Untyped{}
+		}
+		f.metrics[key.String()] = m
+		f.mf.Metric = append(f.mf.Metric, m)
+	}
+	if s.timestampMs != nil {
+		m.TimestampMs = s.timestampMs
+	}
+
+	switch suffix {
+	case "_created":
+		created := timestamppb.New(unixSeconds(s.value))
+		switch {
+		case m.Counter != nil:
+			m.Counter.CreatedTimestamp = created
+		case m.Histogram != nil:
+			m.Histogram.CreatedTimestamp = created
+		case m.Summary != nil:
+			m.Summary.CreatedTimestamp = created
+		}
+	case "_total":
+		m.Counter.Value = &s.value
+		m.Counter.Exemplar = s.exemplar
+	case "_bucket":
+		if le == nil {
+			return fmt.Errorf("bucket without le label")
+		}
+		m.Histogram.Bucket = append(m.Histogram.Bucket, &prom.Bucket{
+			UpperBound:      le,
+			CumulativeCount: ptr(uint64(s.value)),
+			Exemplar:        s.exemplar,
+		})
+	case "_count", "_gcount":
+		if m.Histogram != nil {
+			m.Histogram.SampleCount = ptr(uint64(s.value))
+		} else {
+			m.Summary.SampleCount = ptr(uint64(s.value))
+		}
+	case "_sum", "_gsum":
+		if m.Histogram != nil {
+			m.Histogram.SampleSum = &s.value
+		} else {
+			m.Summary.SampleSum = &s.value
+		}
+	default:
+		switch {
+		case m.Summary != nil:
+			if quantile == nil {
+				return fmt.Errorf("summary sample without quantile label")
+			}
+			m.Summary.Quantile = append(m.Summary.Quantile, &prom.Quantile{Quantile: quantile, Value: &s.value})
+		case m.Gauge != nil:
+			m.Gauge.Value = &s.value
+		default:
+			m.Untyped.Value = &s.value
+		}
+	}
+	return nil
+}
+
+// omSample is a single sample line of the OpenMetrics text format.
+type omSample struct {
+	name        string
+	labels      []*prom.LabelPair
+	value       float64
+	timestampMs *int64
+	exemplar    *prom.Exemplar
+}
+
+// parseOMSample parses a sample line (e.g.
+// `foo_bucket{le="1"} 3 # {trace_id="abc"} 0.5 1700000000.123`). UTF-8 metric
+// names are quoted in the label set (e.g. `{"my.metric", code="200"} 1`).
+func parseOMSample(line string) (omSample, error) {
+	var s omSample
+	i := strings.IndexAny(line, "{ ")
+	if i < 0 || i == 0 && line[0] != '{' {
+		return s, fmt.Errorf("invalid sample %q", line)
+	}
+	s.name = line[:i]
+	rest := line[i:]
+	if rest[0] == '{' {
+		var name string
+		var err error
+		if name, s.labels, rest, err = parseOMLabels(rest); err != nil {
+			return s, err
+		}
+		switch {
+		case name != "" && s.name != "":
+			return s, fmt.Errorf("metric name given twice in %q", line)
+		case name != "":
+			s.name = name
+		case s.name == "":
+			return s, fmt.Errorf("missing metric name in %q", line)
+		}
+	}
+
+	sample, exemplar, hasExemplar := strings.Cut(rest, " # ")
+	var err error
+	if s.value, s.timestampMs, err = parseOMValue(sample); err != nil {
+		return s, err
+	}
+	if !hasExemplar {
+		return s, nil
+	}
+
+	e := &prom.Exemplar{}
+	var name string
+	if name, e.Label, exemplar, err = parseOMLabels(exemplar); err != nil {
+		return s, fmt.Errorf("exemplar: %w", err)
+	} else if name != "" {
+		return s, fmt.Errorf("exemplar: unexpected metric name %q", name)
+	}
+	var value float64
+	var ts *int64
+	if value, ts, err = parseOMValue(exemplar); err != nil {
+		return s, fmt.Errorf("exemplar: %w", err)
+	}
+	e.Value = &value
+	if ts != nil {
+		e.Timestamp = timestamppb.New(unixSeconds(float64(*ts) / 1000))
+	}
+	s.exemplar = e
+	return s, nil
+}
+
+// parseOMLabels parses the label set at the beginning of s and returns the
+// metric name it holds (if any, see parseOMSample) and the labels along with
+// the remainder of s.
+func parseOMLabels(s string) (string, []*prom.LabelPair, string, error) {
+	if !strings.HasPrefix(s, "{") {
+		return "", nil, s, fmt.Errorf("expected label set, but got %q", s)
+	}
+	s = strings.TrimLeft(s[1:], " ")
+	var metric string
+	var labels []*prom.LabelPair
+	for {
+		if strings.HasPrefix(s, "}") {
+			return metric, labels, s[1:], nil
+		}
+		name, rest, err := cutName(s, "=")
+		if err != nil || name == "" {
+			return "", nil, s, fmt.Errorf("invalid label %q", s)
+		}
+		if strings.HasPrefix(s, `"`) && metric == "" && labels == nil && !strings.HasPrefix(rest, "=") {
+			metric = name
+			s = strings.TrimLeft(strings.TrimPrefix(rest, ","), " ")
+			continue
+		}
+		value, ok := strings.CutPrefix(rest, "=\"")
+		if !ok {
+			return "", nil, s, fmt.Errorf("invalid label %q", s)
+		}
+		var sb strings.Builder
+		i := 0
+		for ; i < len(value) && value[i] != '"'; i++ {
+			if value[i] == '\\' && i+1 < len(value) {
+				i++
+				if value[i] == 'n' {
+					sb.WriteByte('\n')
+					continue
+				}
+			}
+			sb.WriteByte(value[i])
+		}
+		if i == len(value) {
+			return "", nil, s, fmt.Errorf("unterminated label value %q", s)
+		}
+		labels = append(labels, &prom.LabelPair{Name: ptr(name), Value: ptr(sb.String())})
+		s = strings.TrimLeft(strings.TrimPrefix(value[i+1:], ","), " ")
+	}
+}
+
+// cutName returns the metric or label name at the beginning of s (which ends
+// with any of the given characters, or is quoted, e.g. `"my.metric"`) and the
+// remainder of s.
+func cutName(s, end string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, end)
+		if i < 0 {
+			return s, "", nil
+		}
+		return s[:i], s[i:], nil
+	}
+	name, n, err := unquote(s)
+	if err != nil {
+		return "", s, err
+	}
+	return name, s[n:], nil
+}
+
+// parseOMValue parses a value optionally followed by a timestamp (in seconds
+// since the epoch). The timestamp is returned in milliseconds.
+func parseOMValue(s string) (float64, *int64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, nil, fmt.Errorf("invalid value %q", s)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid value %q", fields[0])
+	}
+	if len(fields) == 1 {
+		return v, nil, nil
+	}
+	ts, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	return v, ptr(int64(math.Round(ts * 1000))), nil
+}
+
+// omUnescape unescapes HELP texts.
+func omUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`).Replace(s)
+}
+
+// unixSeconds returns the time of the given (fractional) seconds since the
+// epoch.
+func unixSeconds(s float64) time.Time {
+	sec, frac := math.Modf(s)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOpenMetrics_Fixture(t *testing.T) {
+	om, err := os.ReadFile("testdata/metrics.om")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	text, err := os.ReadFile("testdata/metrics.prom")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Readers without a format are detected as OpenMetrics by the EOF marker.
+	mfs, _, err := decode(strings.NewReader(string(om)), 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	textMfs, _, err := decode(strings.NewReader(string(text)), 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Both formats yield the same observations.
+	ts := time.Now()
+	obs, _, _ := flatten(mfs, ts, nil, nil)
+	textObs, _, _ := flatten(textMfs, ts, nil, nil)
+	if len(obs) != len(textObs) {
+		t.Errorf("Expected %d observations, but got %d", len(textObs), len(obs))
+	}
+	for name, e := range textObs {
+		o, ok := obs[name]
+		if !ok {
+			t.Errorf("Missing observation %q", name)
+			continue
+		}
+		if o.Kind != e.Kind || (o.Value != e.Value && !math.IsNaN(e.Value)) {
+			t.Errorf("Expected %v %v for %q, but got %v %v", e.Kind, e.Value, name, o.Kind, o.Value)
+		}
+	}
+
+	created := time.Unix(1700000000, 0)
+	o := obs[`http_requests_total {code="200", method="get"}`]
+	if !o.Created.Equal(created) {
+		t.Errorf("Expected created %v, but got %v", created, o.Created)
+	}
+	if o.Exemplar == nil || o.Exemplar.Labels[0] != (Label{"trace_id", "abc123"}) || o.Exemplar.Value != 1 ||
+		!o.Exemplar.Time.Equal(time.UnixMilli(1700000000500)) {
+		t.Errorf("Unexpected exemplar %+v", o.Exemplar)
+	}
+	o = obs[`http_request_duration_seconds_bucket {handler="/api", le="1"}`]
+	if o.Exemplar == nil || o.Exemplar.Labels[0] != (Label{"trace_id", "def456"}) || o.Exemplar.Value != 0.93 {
+		t.Errorf("Unexpected exemplar %+v", o.Exemplar)
+	}
+	if o = obs[`http_request_duration_seconds_count {handler="/api"}`]; !o.Created.Equal(created) {
+		t.Errorf("Expected created %v, but got %v", created, o.Created)
+	}
+}
+
+func TestParseOpenMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  bool
+	}{
+		{name: "empty", in: "# EOF\n"},
+		{name: "unknown type", in: "foo 1\n# EOF\n"},
+		{name: "escaped label", in: "# TYPE foo gauge\nfoo{path=\"a\\\"b\\\\c\\nd\"} 1 1700000000\n# EOF\n"},
+		{name: "info and stateset", in: "# TYPE build info\nbuild_info{version=\"1\"} 1\n# TYPE state stateset\nstate{state=\"a\"} 1\nstate{state=\"b\"} 0\n# EOF\n"},
+		{name: "missing EOF", in: "foo 1\n", err: true},
+		{name: "content after EOF", in: "# EOF\nfoo 1\n", err: true},
+		{name: "invalid value", in: "foo one\n# EOF\n", err: true},
+		{name: "unterminated label", in: "foo{a=\"b} 1\n# EOF\n", err: true},
+		{name: "bucket without le", in: "# TYPE foo histogram\nfoo_bucket 1\n# EOF\n", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOpenMetrics([]byte(tt.in)); (err != nil) != tt.err {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseOpenMetrics_HelpBeforeType(t *testing.T) {
+	for _, in := range []string{
+		"# TYPE foo counter\n# HELP foo Foos.\n# UNIT foo seconds\nfoo_total 1\n# EOF\n",
+		"# HELP foo Foos.\n# UNIT foo seconds\n# TYPE foo counter\nfoo_total 1\n# EOF\n",
+		"# UNIT foo seconds\n# HELP foo Foos.\n# TYPE foo counter\nfoo_total 1\n# EOF\n",
+	} {
+		mfs, err := parseOpenMetrics([]byte(in))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(mfs) != 1 {
+			t.Fatalf("Expected one family, but got %v", mfs)
+		}
+		if mf := mfs[0]; mf.GetName() != "foo_total" || mf.GetType().String() != "COUNTER" || mf.GetHelp() != "Foos." || mf.GetUnit() != "seconds" || len(mf.GetMetric()) != 1 {
+			t.Errorf("Unexpected family %v of %q", mf, in)
+		}
+	}
+}
+
+func TestDecode_OpenMetricsFallback(t *testing.T) {
+	in := "# TYPE foo gauge\nfoo 1\n"
+	mfs, warning, err := decode(formatReader{strings.NewReader(in), "application/openmetrics-text; version=1.0.0; charset=utf-8"}, 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if warning == "" {
+		t.Errorf("Expected warning about the missing EOF")
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "foo" {
+		t.Errorf("Unexpected metric families %v", mfs)
+	}
+}
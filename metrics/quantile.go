@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// histogramQuantiles are the quantiles estimated for each histogram.
+var histogramQuantiles = []float64{0.5, 0.9, 0.99}
+
+// bucket is a single cumulative histogram bucket.
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// bucketQuantile estimates the q-quantile (0 <= q <= 1) from the given
+// cumulative buckets by linear interpolation within the bucket the quantile
+// falls into (like Prometheus' histogram_quantile). The buckets must be sorted
+// by upper bound and the last bucket must have an upper bound of +Inf.
+// bucketQuantile returns NaN, if the buckets contain no observations at all or
+// only observations in the +Inf bucket.
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].upperBound, +1) {
+		return math.NaN()
+	}
+	observations := buckets[len(buckets)-1].count
+	if observations <= 0 || buckets[len(buckets)-2].count <= 0 {
+		return math.NaN()
+	}
+
+	rank := q * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].count >= rank })
+
+	// The quantile falls into the +Inf bucket, return the highest finite bound.
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].upperBound
+	}
+	if b == 0 && buckets[0].upperBound <= 0 {
+		return buckets[0].upperBound
+	}
+
+	var start float64
+	end := buckets[b].upperBound
+	count := buckets[b].count
+	if b > 0 {
+		start = buckets[b-1].upperBound
+		count -= buckets[b-1].count
+		rank -= buckets[b-1].count
+	}
+	if count <= 0 {
+		return end
+	}
+	return start + (end-start)*(rank/count)
+}
+
+// deltaBuckets returns the buckets holding the observations made between prev
+// and cur. deltaBuckets returns nil, if the bucket layouts differ or if any of
+// the counts decreased (e.g. because of a counter reset).
+func deltaBuckets(cur, prev []bucket) []bucket {
+	if len(cur) != len(prev) {
+		return nil
+	}
+	delta := make([]bucket, 0, len(cur))
+	for i := range cur {
+		if cur[i].upperBound != prev[i].upperBound || cur[i].count < prev[i].count {
+			return nil
+		}
+		delta = append(delta, bucket{upperBound: cur[i].upperBound, count: cur[i].count - prev[i].count})
+	}
+	return delta
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBucketQuantile(t *testing.T) {
+	inf := math.Inf(+1)
+	tests := []struct {
+		name     string
+		q        float64
+		buckets  []bucket
+		expected float64
+	}{
+		{
+			name:     "median interpolated within bucket",
+			q:        0.5,
+			buckets:  []bucket{{1, 0}, {2, 10}, {inf, 10}},
+			expected: 1.5,
+		},
+		{
+			name:     "first bucket starts at zero",
+			q:        0.5,
+			buckets:  []bucket{{1, 10}, {2, 10}, {inf, 10}},
+			expected: 0.5,
+		},
+		{
+			name:     "quantile in +Inf bucket returns highest finite bound",
+			q:        0.99,
+			buckets:  []bucket{{1, 5}, {2, 8}, {inf, 10}},
+			expected: 2,
+		},
+		{
+			name:     "empty histogram",
+			q:        0.5,
+			buckets:  []bucket{{1, 0}, {2, 0}, {inf, 0}},
+			expected: math.NaN(),
+		},
+		{
+			name:     "all observations in +Inf bucket",
+			q:        0.5,
+			buckets:  []bucket{{1, 0}, {2, 0}, {inf, 4}},
+			expected: math.NaN(),
+		},
+		{
+			name:     "missing +Inf bucket",
+			q:        0.5,
+			buckets:  []bucket{{1, 2}, {2, 4}},
+			expected: math.NaN(),
+		},
+		{
+			name:     "no buckets",
+			q:        0.5,
+			buckets:  nil,
+			expected: math.NaN(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := bucketQuantile(tt.q, tt.buckets)
+			if math.IsNaN(tt.expected) && math.IsNaN(actual) {
+				return
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeltaBuckets(t *testing.T) {
+	inf := math.Inf(+1)
+	cur := []bucket{{1, 4}, {2, 9}, {inf, 10}}
+
+	delta := deltaBuckets(cur, []bucket{{1, 2}, {2, 3}, {inf, 4}})
+	expected := []bucket{{1, 2}, {2, 6}, {inf, 6}}
+	if len(delta) != len(expected) {
+		t.Fatalf("Expected %v, but got %v", expected, delta)
+	}
+	for i := range expected {
+		if delta[i] != expected[i] {
+			t.Errorf("Expected %v, but got %v", expected, delta)
+		}
+	}
+
+	// Unchanged counts yield no estimate.
+	if q := bucketQuantile(0.5, deltaBuckets(cur, cur)); !math.IsNaN(q) {
+		t.Errorf("Expected NaN, but got %v", q)
+	}
+
+	// Counter resets and layout changes yield no delta.
+	if delta := deltaBuckets(cur, []bucket{{1, 5}, {2, 9}, {inf, 10}}); delta != nil {
+		t.Errorf("Expected nil, but got %v", delta)
+	}
+	if delta := deltaBuckets(cur, []bucket{{1, 1}, {inf, 1}}); delta != nil {
+		t.Errorf("Expected nil, but got %v", delta)
+	}
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// QueryFetcher is a Fetcher that fetches the result of an instant query from
+// the HTTP API of a Prometheus server (/api/v1/query), e.g. for targets that
+// are not reachable directly but scraped by Prometheus. The query is evaluated
+// by Prometheus, not by the fetcher.
+type QueryFetcher struct {
+
+	// Endpoint is the URL of the Prometheus server (e.g.
+	// http://prometheus:9090).
+	Endpoint string
+
+	// Query is the PromQL expression to evaluate (e.g. up{job="api"}).
+	Query string
+
+	// Client is the client to send requests with. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+
+	// Header holds additional headers to send with each request (e.g. for
+	// authentication).
+	Header http.Header
+
+	// UserAgent is the User-Agent header sent with each request. If empty,
+	// DefaultUserAgent is used.
+	UserAgent string
+}
+
+// NewQueryFetcher returns a new QueryFetcher for the given Prometheus server
+// and query. Like NewHTTPFetcher, it sends requests with a client of its own.
+func NewQueryFetcher(endpoint, query string) *QueryFetcher {
+	return &QueryFetcher{Endpoint: endpoint, Query: query, Client: newHTTPClient()}
+}
+
+// queryResponse is the response of the query API.
+type queryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// querySample is a sample of a vector result of the query API. Samples of
+// native histograms (with a histogram rather than a value) have no value.
+type querySample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []any             `json:"value"`
+}
+
+// CloseIdleConnections closes the connections the client of the fetcher keeps
+// alive between fetches (see HTTPFetcher.CloseIdleConnections).
+func (f *QueryFetcher) CloseIdleConnections() {
+	if f.Client != nil {
+		f.Client.CloseIdleConnections()
+	}
+}
+
+// Fetch evaluates the query. The returned time is the time the response was
+// received at, while the samples carry the evaluation time reported by
+// Prometheus. The returned reader is a
+// FormatReader of the result in the protobuf format (see queryFamilies).
+// Errors reported by the API (e.g. of a malformed query) are returned as is.
+func (f *QueryFetcher) Fetch(ctx context.Context) (io.ReadCloser, time.Time, error) {
+	u, err := url.Parse(f.Endpoint)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("parse endpoint: %w", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1/query"
+	u.RawQuery = url.Values{"query": {f.Query}}.Encode()
+	resp, err := get(ctx, f.Client, u.String(), f.Header, "application/json", f.UserAgent)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	received := time.Now()
+
+	// Errors of the API come with a status other than 200 OK (e.g. 400 Bad
+	// Request for a malformed query), but are described by the body.
+	var r queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, time.Time{}, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+		return nil, time.Time{}, fmt.Errorf("decode query response: %w", err)
+	}
+	if r.Status != "success" {
+		return nil, time.Time{}, fmt.Errorf("query failed: %s: %s", r.ErrorType, r.Error)
+	}
+	mfs, err := queryFamilies(r.Data.ResultType, r.Data.Result, f.Query)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var buf bytes.Buffer
+	format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+	enc := expfmt.NewEncoder(&buf, format)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return nil, time.Time{}, fmt.Errorf("encode query result: %w", err)
+		}
+	}
+	return &httpBody{ReadCloser: io.NopCloser(&buf), format: format}, received, nil
+}
+
+// queryFamilies converts the given result of the query API (of the given
+// type) into metric families, one per metric name in order of appearance.
+// Samples are counters, if their name ends with _total, and gauges otherwise.
+// Samples without a name (e.g. of sum(...)) and scalars are named by the
+// given query. Samples of native histograms are skipped. Only vectors and
+// scalars are supported, as the result of an instant query.
+func queryFamilies(resultType string, result json.RawMessage, query string) ([]*prom.MetricFamily, error) {
+	var samples []querySample
+	switch resultType {
+	case "vector":
+		if err := json.Unmarshal(result, &samples); err != nil {
+			return nil, fmt.Errorf("decode query result: %w", err)
+		}
+	case "scalar":
+		var value []any
+		if err := json.Unmarshal(result, &value); err != nil {
+			return nil, fmt.Errorf("decode query result: %w", err)
+		}
+		samples = []querySample{{Value: value}}
+	default:
+		return nil, fmt.Errorf("unsupported query result type %q", resultType)
+	}
+
+	var mfs []*prom.MetricFamily
+	families := make(map[string]*prom.MetricFamily)
+	for _, s := range samples {
+		if s.Value == nil {
+			continue
+		}
+		ts, v, err := queryValue(s.Value)
+		if err != nil {
+			return nil, err
+		}
+		name := cmp.Or(s.Metric["__name__"], query)
+		mf, ok := families[name]
+		if !ok {
+			mf = &prom.MetricFamily{Name: ptr(name), Type: prom.MetricType_GAUGE.Enum()}
+			if strings.HasSuffix(name, "_total") {
+				mf.Type = prom.MetricType_COUNTER.Enum()
+			}
+			families[name] = mf
+			mfs = append(mfs, mf)
+		}
+		m := &prom.Metric{TimestampMs: &ts}
+		for _, label := range slices.Sorted(maps.Keys(s.Metric)) {
+			if label != "__name__" {
+				m.Label = append(m.Label, &prom.LabelPair{Name: ptr(label), Value: ptr(s.Metric[label])})
+			}
+		}
+		if mf.GetType() == prom.MetricType_COUNTER {
+			m.Counter = &prom.Counter{Value: &v}
+		} else {
+			m.Gauge = &prom.Gauge{Value: &v}
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+	return mfs, nil
+}
+
+// queryValue returns the timestamp (in milliseconds) and the value of the
+// given sample value of the query API, e.g. [1700000000.123, "42"].
+func queryValue(value []any) (int64, float64, error) {
+	if len(value) != 2 {
+		return 0, 0, fmt.Errorf("malformed query sample %v", value)
+	}
+	ts, ok := value[0].(float64)
+	s, ok2 := value[1].(string)
+	if !ok || !ok2 {
+		return 0, 0, fmt.Errorf("malformed query sample %v", value)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed query sample value: %w", err)
+	}
+	return int64(math.Round(ts * 1000)), v, nil
+}
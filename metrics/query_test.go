@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryFetcher_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("query") {
+		case `up{job="api"} or requests_total`:
+			_, _ = io.WriteString(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"__name__":"up","job":"api","instance":"a:8080"},"value":[1700000000.5,"1"]},
+				{"metric":{"__name__":"requests_total","job":"api"},"value":[1700000000.5,"42"]},
+				{"metric":{"__name__":"up","job":"api","instance":"b:8080"},"value":[1700000000.5,"0"]}
+			]}}`)
+		case "sum(up)":
+			_, _ = io.WriteString(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"NaN"]}]}}`)
+		case "time()":
+			_, _ = io.WriteString(w, `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"1700000000"]}}`)
+		case "up[5m]":
+			_, _ = io.WriteString(w, `{"status":"success","data":{"resultType":"matrix","result":[]}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"status":"error","errorType":"bad_data","error":"invalid parameter \"query\": 1:3: parse error"}`)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		query    string
+		expected string
+		err      string
+	}{
+		{query: `up{job="api"} or requests_total`, expected: `requests_total {job="api"} 42,up {instance="a:8080", job="api"} 1,up {instance="b:8080", job="api"} 0`},
+		{query: "sum(up)", expected: "sum(up) NaN"},
+		{query: "time()", expected: "time() 1.7e+09"},
+		{query: "up[5m]", err: `unsupported query result type "matrix"`},
+		{query: "up{", err: `query failed: bad_data: invalid parameter "query": 1:3: parse error`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			store := NewStore(3, NewQueryFetcher(srv.URL+"/", tt.query))
+			_, err := store.Sample(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+					t.Errorf("Expected error %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			dump, err := store.Dump("")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual []string
+			for _, series := range dump {
+				o := series[0]
+				if strings.HasPrefix(o.Name, "promtui_") {
+					continue
+				}
+				if !o.Time.Equal(time.UnixMilli(1700000000500)) && !o.Time.Equal(time.UnixMilli(1700000000000)) {
+					t.Errorf("Expected the evaluation time, but got %v", o.Time)
+				}
+				actual = append(actual, o.Name+" "+strconv.FormatFloat(o.Value, 'g', -1, 64))
+			}
+			if strings.Join(actual, ",") != tt.expected {
+				t.Errorf("Expected %q, but got %q", tt.expected, strings.Join(actual, ","))
+			}
+		})
+	}
+}
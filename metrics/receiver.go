@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// SenderLabel is the label added by a Receiver to the pushed metrics, holding
+// the IP address of their sender.
+const SenderLabel = "sender"
+
+// DefaultMaxIdle is the default of Receiver.MaxIdle.
+const DefaultMaxIdle = 5 * time.Minute
+
+// Receiver is a Fetcher of metrics pushed to it over HTTP (it is an
+// http.Handler), for services that cannot be scraped. Each POST (or PUT)
+// replaces the metrics of its sender, labeled with its address (see
+// SenderLabel), and fetches return those of all senders. Pushes to
+// /metrics/job/<job>[/<label>/<value>...] (like to a Pushgateway) are grouped
+// by these labels as well, so that several pushers on one host do not replace
+// each other's metrics. The metrics are pushed in any of the formats of
+// scrapes (see FormatReader), as given by the Content-Type header.
+type Receiver struct {
+
+	// MaxBodySize limits the size of pushes in bytes. Zero means no limit.
+	MaxBodySize int64
+
+	// MaxIdle is how long the metrics of a sender are kept after its latest
+	// push. Expired metrics are missing from fetches, so that their series
+	// go stale (see Store.StaleGrace). Zero keeps them forever.
+	MaxIdle time.Duration
+
+	mux     sync.Mutex
+	senders map[string]push
+	last    time.Time
+	expiry  *time.Timer
+	pushed  chan struct{}
+}
+
+// push is the latest push of a sender (keyed by its address and grouping
+// labels, see Receiver), received at the given time.
+type push struct {
+	families []*prom.MetricFamily
+	at       time.Time
+}
+
+// NewReceiver returns a new Receiver without any metrics.
+func NewReceiver() *Receiver {
+	return &Receiver{MaxIdle: DefaultMaxIdle, senders: make(map[string]push), pushed: make(chan struct{}, 1)}
+}
+
+// ServeHTTP accepts a push. Pushes that cannot be parsed (or to an invalid
+// grouping path) are rejected with 400 Bad Request, and remote write
+// (snappy-compressed protobuf) is not supported.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "push metrics with POST or PUT", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Header.Get("Content-Encoding") == "snappy" {
+		http.Error(w, "remote write is not supported, push the text format instead", http.StatusUnsupportedMediaType)
+		return
+	}
+	grouping, err := groupingLabels(req.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Like formatFromResponse, content types unknown to expfmt are kept.
+	format := expfmt.ResponseFormat(req.Header)
+	if format.FormatType() == expfmt.TypeUnknown {
+		format = expfmt.Format(req.Header.Get("Content-Type"))
+	}
+	mfs, _, err := decode(formatReader{req.Body, format}, r.MaxBodySize, nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parse metrics: %v", err), http.StatusBadRequest)
+		return
+	}
+	sender, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		sender = req.RemoteAddr
+	}
+	grouping = append(grouping, &prom.LabelPair{Name: ptr(SenderLabel), Value: ptr(sender)})
+	key := sender
+	for _, l := range grouping[:len(grouping)-1] {
+		key += fmt.Sprintf(" %s=%q", l.GetName(), l.GetValue())
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			m.Label = slices.DeleteFunc(m.Label, func(l *prom.LabelPair) bool {
+				return slices.ContainsFunc(grouping, func(g *prom.LabelPair) bool { return g.GetName() == l.GetName() })
+			})
+			m.Label = append(m.Label, grouping...)
+		}
+	}
+
+	r.mux.Lock()
+	r.last = time.Now()
+	r.senders[key] = push{families: mfs, at: r.last}
+	if r.MaxIdle > 0 && r.expiry == nil {
+		r.expiry = time.AfterFunc(r.MaxIdle, r.expire)
+	}
+	r.mux.Unlock()
+	r.notify()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// groupingLabels returns the grouping labels of the given push path (see
+// Receiver). Other paths than those below /metrics/ have none.
+func groupingLabels(path string) ([]*prom.LabelPair, error) {
+	rest, ok := strings.CutPrefix(path, "/metrics/")
+	if !ok {
+		return nil, nil
+	}
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	if len(parts)%2 != 0 || parts[0] != "job" {
+		return nil, fmt.Errorf("invalid grouping path %q (expected /metrics/job/<job>[/<label>/<value>...])", path)
+	}
+	var labels []*prom.LabelPair
+	for i := 0; i < len(parts); i += 2 {
+		if parts[i] == "" || parts[i] == SenderLabel || parts[i+1] == "" {
+			return nil, fmt.Errorf("invalid grouping label %q=%q in %q", parts[i], parts[i+1], path)
+		}
+		labels = append(labels, &prom.LabelPair{Name: ptr(parts[i]), Value: ptr(parts[i+1])})
+	}
+	return labels, nil
+}
+
+// expire drops the metrics of the senders idle for MaxIdle (see dropIdle) and
+// reports it like a push, so that their series go stale. It is scheduled again
+// for the next sender to expire.
+func (r *Receiver) expire() {
+	r.mux.Lock()
+	now := time.Now()
+	r.dropIdle(now)
+	r.expiry = nil
+	var next time.Time
+	for _, p := range r.senders {
+		if next.IsZero() || p.at.Before(next) {
+			next = p.at
+		}
+	}
+	if !next.IsZero() {
+		r.expiry = time.AfterFunc(next.Add(r.MaxIdle).Sub(now), r.expire)
+	}
+	r.mux.Unlock()
+	r.notify()
+}
+
+// dropIdle drops the metrics of the senders that have not pushed for MaxIdle
+// at the given time. The lock must be held.
+func (r *Receiver) dropIdle(now time.Time) {
+	if r.MaxIdle <= 0 {
+		return
+	}
+	maps.DeleteFunc(r.senders, func(_ string, p push) bool {
+		return now.Sub(p.at) >= r.MaxIdle
+	})
+}
+
+// notify reports a push (see Pushed).
+func (r *Receiver) notify() {
+	select {
+	case r.pushed <- struct{}{}:
+	default:
+	}
+}
+
+// Pushed returns a channel receiving a value after pushes (and after the
+// metrics of idle senders expired, see MaxIdle). Pushes in quick succession
+// may be reported once.
+func (r *Receiver) Pushed() <-chan struct{} {
+	return r.pushed
+}
+
+// LastPush returns the time of the latest push. The zero time is returned, if
+// there was none.
+func (r *Receiver) LastPush() time.Time {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.last
+}
+
+// Fetch returns the latest metrics of all senders not idle for MaxIdle (in
+// the protobuf format, see FormatReader) along with the time of the latest
+// push (or the current time, if there was none). Families pushed by several
+// senders are merged, keeping the type of the first sender (by address) and
+// dropping the metrics of other types.
+func (r *Receiver) Fetch(_ context.Context) (io.ReadCloser, time.Time, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.dropIdle(time.Now())
+	var merged []*prom.MetricFamily
+	byName := make(map[string]*prom.MetricFamily)
+	for _, sender := range slices.Sorted(maps.Keys(r.senders)) {
+		for _, mf := range r.senders[sender].families {
+			m, ok := byName[mf.GetName()]
+			if !ok {
+				m = &prom.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Unit: mf.Unit}
+				byName[mf.GetName()] = m
+				merged = append(merged, m)
+			}
+			if m.GetType() == mf.GetType() {
+				m.Metric = append(m.Metric, mf.Metric...)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+	enc := expfmt.NewEncoder(&buf, format)
+	for _, mf := range merged {
+		if err := enc.Encode(mf); err != nil {
+			return nil, time.Time{}, fmt.Errorf("encode pushed metrics: %w", err)
+		}
+	}
+	t := r.last
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return &httpBody{ReadCloser: io.NopCloser(&buf), format: format}, t, nil
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceiver(t *testing.T) {
+	r := NewReceiver()
+	push := func(method, sender, contentType, body string) int {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.RemoteAddr = sender + ":40000"
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if contentType == "application/x-protobuf" {
+			req.Header.Set("Content-Encoding", "snappy")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		sender   string
+		ctype    string
+		body     string
+		expected int
+	}{
+		{"text", http.MethodPost, "10.0.0.1", "text/plain; version=0.0.4", "# TYPE jobs_total counter\njobs_total 3\n", http.StatusNoContent},
+		{"other sender", http.MethodPut, "10.0.0.2", "", "# TYPE jobs_total counter\njobs_total 5\n", http.StatusNoContent},
+		{"replaced", http.MethodPost, "10.0.0.1", "", "# TYPE jobs_total counter\njobs_total{sender=\"spoofed\"} 4\n", http.StatusNoContent},
+		{"malformed", http.MethodPost, "10.0.0.3", "", "jobs_total{\n", http.StatusBadRequest},
+		{"remote write", http.MethodPost, "10.0.0.3", "application/x-protobuf", "", http.StatusUnsupportedMediaType},
+		{"get", http.MethodGet, "10.0.0.3", "", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if code := push(tt.method, tt.sender, tt.ctype, tt.body); code != tt.expected {
+			t.Errorf("%s: Expected %d, but got %d", tt.name, tt.expected, code)
+		}
+	}
+	select {
+	case <-r.Pushed():
+	default:
+		t.Errorf("Expected pushes to be reported")
+	}
+	if r.LastPush().IsZero() {
+		t.Errorf("Expected the time of the latest push")
+	}
+
+	store := NewStore(3, r)
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dump, err := store.Dump("jobs_total")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var actual []string
+	for _, series := range dump {
+		actual = append(actual, series[0].Name)
+	}
+	expected := `jobs_total {sender="10.0.0.1"},jobs_total {sender="10.0.0.2"}`
+	if strings.Join(actual, ",") != expected {
+		t.Errorf("Expected %q, but got %q", expected, strings.Join(actual, ","))
+	}
+}
+
+func TestReceiver_Grouping(t *testing.T) {
+	r := NewReceiver()
+	push := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("# TYPE jobs_total counter\njobs_total{instance=\"pushed\"} 1\n"))
+		req.RemoteAddr = "10.0.0.1:40000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/metrics/job/backup/instance/a", http.StatusNoContent},
+		{"/metrics/job/backup/instance/b", http.StatusNoContent},
+		{"/metrics/job/backup/instance/b/", http.StatusNoContent},
+		{"/metrics/job/backup/instance", http.StatusBadRequest},
+		{"/metrics/instance/a", http.StatusBadRequest},
+		{"/metrics/job/backup/sender/spoofed", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code := push(tt.path); code != tt.expected {
+			t.Errorf("%s: Expected %d, but got %d", tt.path, tt.expected, code)
+		}
+	}
+
+	// Pushers on one host are told apart by their grouping labels.
+	store := NewStore(3, r)
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dump, _ := store.Dump("jobs_total")
+	var actual []string
+	for _, series := range dump {
+		actual = append(actual, series[0].Name)
+	}
+	expected := `jobs_total {job="backup", instance="a", sender="10.0.0.1"},jobs_total {job="backup", instance="b", sender="10.0.0.1"}`
+	if strings.Join(actual, ",") != expected {
+		t.Errorf("Expected %q, but got %q", expected, strings.Join(actual, ","))
+	}
+}
+
+func TestReceiver_MaxIdle(t *testing.T) {
+	r := NewReceiver()
+	r.MaxIdle = time.Minute
+	for _, sender := range []string{"10.0.0.1", "10.0.0.2"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("# TYPE jobs_total counter\njobs_total 1\n"))
+		req.RemoteAddr = sender + ":40000"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	store := NewStore(3, r)
+	store.StaleGrace = time.Hour
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first sender stopped pushing a minute ago.
+	r.mux.Lock()
+	p := r.senders["10.0.0.1"]
+	p.at = p.at.Add(-time.Minute)
+	r.senders["10.0.0.1"] = p
+	r.mux.Unlock()
+	<-r.Pushed()
+	r.expire()
+	select {
+	case <-r.Pushed():
+	default:
+		t.Errorf("Expected the expiry to be reported")
+	}
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dump, _ := store.Dump("jobs_total")
+	var actual []string
+	for _, series := range dump {
+		actual = append(actual, fmt.Sprintf("%s %v", series[0].Name, series[0].Stale))
+	}
+	expected := `jobs_total {sender="10.0.0.1"} true,jobs_total {sender="10.0.0.2"} false`
+	if strings.Join(actual, ",") != expected {
+		t.Errorf("Expected %q, but got %q", expected, strings.Join(actual, ","))
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.senders) != 1 || r.expiry == nil {
+		t.Errorf("Expected one sender left to expire, but got %v", r.senders)
+	}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	prom "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Relabeling rewrites the labels of the fetched metrics before they are
+// flattened (see Store.Relabeling). Metrics of a family that become identical
+// are merged into one:
+//   - counters, summaries, and histograms are summed (histogram buckets by
+//     their upper bound, summary quantiles are dropped),
+//   - gauges and untyped metrics are not summed: the last one (in the order
+//     of the exposition) wins.
+//
+// Merged metrics take the latest timestamp, the earliest creation time and the
+// last exemplar of the merged ones.
+type Relabeling struct {
+
+	// Drop holds the names of the labels to remove.
+	Drop []string
+
+	// Rename maps the names of labels to their new names.
+	Rename map[string]string
+}
+
+// enabled returns true, if the relabeling changes any labels.
+func (r Relabeling) enabled() bool {
+	return len(r.Drop) > 0 || len(r.Rename) > 0
+}
+
+// relabel returns the given metric families with their labels rewritten (see
+// Relabeling). Families without affected labels are returned as they are.
+func relabel(mfs []*prom.MetricFamily, r Relabeling) []*prom.MetricFamily {
+	if !r.enabled() {
+		return mfs
+	}
+	relabeled := make([]*prom.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		if !slices.ContainsFunc(mf.GetMetric(), r.affects) {
+			relabeled = append(relabeled, mf)
+			continue
+		}
+		merged := &prom.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Unit: mf.Unit}
+		index := make(map[string]*prom.Metric)
+		for _, m := range mf.GetMetric() {
+			labels := r.labels(m.GetLabel())
+			key := flatName("", newLabels(labels))
+			if acc, ok := index[key]; ok {
+				merge(acc, m, mf.GetType())
+				continue
+			}
+			acc := proto.Clone(m).(*prom.Metric)
+			acc.Label = labels
+			if mf.GetType() == prom.MetricType_SUMMARY && acc.Summary != nil {
+				acc.Summary.Quantile = nil
+			}
+			index[key] = acc
+			merged.Metric = append(merged.Metric, acc)
+		}
+		relabeled = append(relabeled, merged)
+	}
+	return relabeled
+}
+
+// affects returns true, if the relabeling drops or renames a label of the
+// given metric.
+func (r Relabeling) affects(m *prom.Metric) bool {
+	for _, l := range m.GetLabel() {
+		if _, ok := r.Rename[l.GetName()]; ok || slices.Contains(r.Drop, l.GetName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// labels returns the given labels relabeled and sorted by name.
+func (r Relabeling) labels(pairs []*prom.LabelPair) []*prom.LabelPair {
+	labels := make([]*prom.LabelPair, 0, len(pairs))
+	for _, l := range pairs {
+		if slices.Contains(r.Drop, l.GetName()) {
+			continue
+		}
+		if name, ok := r.Rename[l.GetName()]; ok {
+			l = &prom.LabelPair{Name: ptr(name), Value: l.Value}
+		}
+		labels = append(labels, l)
+	}
+	slices.SortStableFunc(labels, func(a, b *prom.LabelPair) int { return strings.Compare(a.GetName(), b.GetName()) })
+	return labels
+}
+
+// merge merges the metric m (of a family of the given type) into acc (see
+// Relabeling).
+func merge(acc, m *prom.Metric, typ prom.MetricType) {
+	if m.GetTimestampMs() > acc.GetTimestampMs() {
+		acc.TimestampMs = m.TimestampMs
+	}
+	switch typ {
+	case prom.MetricType_COUNTER:
+		if acc.Counter == nil {
+			acc.Counter = &prom.Counter{}
+		}
+		acc.Counter.Value = ptr(acc.GetCounter().GetValue() + m.GetCounter().GetValue())
+		acc.Counter.CreatedTimestamp = earliest(acc.Counter.CreatedTimestamp, m.GetCounter().GetCreatedTimestamp())
+		if e := m.GetCounter().GetExemplar(); e != nil {
+			acc.Counter.Exemplar = e
+		}
+	case prom.MetricType_GAUGE:
+		acc.Gauge = m.Gauge
+	case prom.MetricType_UNTYPED:
+		acc.Untyped = m.Untyped
+	case prom.MetricType_SUMMARY:
+		if acc.Summary == nil {
+			acc.Summary = &prom.Summary{}
+		}
+		acc.Summary.SampleSum = ptr(acc.GetSummary().GetSampleSum() + m.GetSummary().GetSampleSum())
+		acc.Summary.SampleCount = ptr(acc.GetSummary().GetSampleCount() + m.GetSummary().GetSampleCount())
+		acc.Summary.CreatedTimestamp = earliest(acc.Summary.CreatedTimestamp, m.GetSummary().GetCreatedTimestamp())
+	case prom.MetricType_HISTOGRAM, prom.MetricType_GAUGE_HISTOGRAM:
+		if acc.Histogram == nil {
+			acc.Histogram = &prom.Histogram{}
+		}
+		mergeHistogram(acc.Histogram, m.GetHistogram())
+	}
+}
+
+// mergeHistogram adds the observations of the histogram h to acc. Buckets
+// are summed by their upper bound. Buckets missing from either histogram are
+// taken as they are.
+func mergeHistogram(acc, h *prom.Histogram) {
+	acc.SampleSum = ptr(acc.GetSampleSum() + h.GetSampleSum())
+	acc.SampleCount = ptr(acc.GetSampleCount() + h.GetSampleCount())
+	if acc.SampleCountFloat != nil || h.SampleCountFloat != nil {
+		acc.SampleCountFloat = ptr(acc.GetSampleCountFloat() + h.GetSampleCountFloat())
+	}
+	acc.CreatedTimestamp = earliest(acc.CreatedTimestamp, h.GetCreatedTimestamp())
+	for _, b := range h.GetBucket() {
+		i := slices.IndexFunc(acc.Bucket, func(a *prom.Bucket) bool { return a.GetUpperBound() == b.GetUpperBound() })
+		if i < 0 {
+			acc.Bucket = append(acc.Bucket, proto.Clone(b).(*prom.Bucket))
+			continue
+		}
+		a := acc.Bucket[i]
+		a.CumulativeCount = ptr(a.GetCumulativeCount() + b.GetCumulativeCount())
+		if a.CumulativeCountFloat != nil || b.CumulativeCountFloat != nil {
+			a.CumulativeCountFloat = ptr(a.GetCumulativeCountFloat() + b.GetCumulativeCountFloat())
+		}
+		if b.Exemplar != nil {
+			a.Exemplar = b.Exemplar
+		}
+	}
+	slices.SortFunc(acc.Bucket, func(a, b *prom.Bucket) int { return cmp.Compare(a.GetUpperBound(), b.GetUpperBound()) })
+}
+
+// earliest returns the earlier of the given timestamps (ignoring nil ones).
+func earliest(a, b *timestamppb.Timestamp) *timestamppb.Timestamp {
+	if a == nil || (b != nil && b.AsTime().Before(a.AsTime())) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelabel(t *testing.T) {
+	in := `# TYPE requests_total counter
+requests_total{code="200",pod="a"} 1
+requests_total{code="200",pod="b"} 2
+requests_total{code="500",pod="a"} 4
+# TYPE queue_length gauge
+queue_length{pod="a"} 3
+queue_length{pod="b"} 5
+# TYPE rpc_seconds summary
+rpc_seconds{pod="a",quantile="0.5"} 0.1
+rpc_seconds_sum{pod="a"} 1
+rpc_seconds_count{pod="a"} 10
+rpc_seconds{pod="b",quantile="0.5"} 0.3
+rpc_seconds_sum{pod="b"} 2
+rpc_seconds_count{pod="b"} 5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{pod="a",le="0.1"} 1
+latency_seconds_bucket{pod="a",le="+Inf"} 2
+latency_seconds_sum{pod="a"} 1
+latency_seconds_count{pod="a"} 2
+latency_seconds_bucket{pod="b",le="0.1"} 3
+latency_seconds_bucket{pod="b",le="1"} 4
+latency_seconds_bucket{pod="b",le="+Inf"} 6
+latency_seconds_sum{pod="b"} 3
+latency_seconds_count{pod="b"} 6
+# TYPE up gauge
+up{instance="x"} 1
+# TYPE temperature untyped
+temperature{pod="a"} 20
+temperature{pod="b"} 22
+`
+	mfs, _, err := decode(strings.NewReader(in), 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := Relabeling{Drop: []string{"pod"}, Rename: map[string]string{"instance": "host"}}
+	obs, _, _ := flatten(relabel(mfs, r), time.Now(), nil, nil)
+
+	tests := []struct {
+		name     string
+		expected float64
+	}{
+		// Counters are summed.
+		{`requests_total {code="200"}`, 3},
+		{`requests_total {code="500"}`, 4},
+		// The last gauge wins.
+		{"queue_length", 5},
+		// And so does the last untyped metric.
+		{"temperature", 22},
+		// Summaries are summed (without their quantiles).
+		{"rpc_seconds_sum", 3},
+		{"rpc_seconds_count", 15},
+		// Histograms are summed by bucket.
+		{`latency_seconds_bucket {le="0.1"}`, 4},
+		{`latency_seconds_bucket {le="1"}`, 4},
+		{`latency_seconds_bucket {le="+Inf"}`, 8},
+		{"latency_seconds_sum", 4},
+		{"latency_seconds_count", 8},
+		{"latency_seconds_avg", 0.5},
+		// Renamed labels keep their values.
+		{`up {host="x"}`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, ok := obs[tt.name]
+			if !ok {
+				t.Fatalf("Expected %s to exist", tt.name)
+			}
+			if o.Value != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, o.Value)
+			}
+		})
+	}
+	for name := range obs {
+		if strings.Contains(name, "pod=") || strings.Contains(name, "instance=") {
+			t.Errorf("Expected %s to be relabeled", name)
+		}
+	}
+
+	// The fetched families are not modified.
+	for _, mf := range mfs {
+		if n := len(mf.GetMetric()); mf.GetName() == "requests_total" && n != 3 {
+			t.Errorf("Expected %v, but got %v", 3, n)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package internal
+package metrics
 
 // See: https://medium.com/checker-engineering/a-practical-guide-to-implementing-a-generic-ring-buffer-in-go-866d27ec1a05
 
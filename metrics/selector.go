@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Selector selects observations by metric name and labels, similar to a
+// Prometheus series selector (e.g. `http_requests_total{code!="200"}`).
+type Selector struct {
+
+	// Metric is the metric name. An empty name matches all metrics.
+	Metric string
+
+	// Matchers are the label matchers all of which must match.
+	Matchers []Matcher
+}
+
+// Matcher matches the value of a label. A missing label has the empty value.
+type Matcher struct {
+	Name string
+
+	// Op is one of "=", "!=", "=~", and "!~".
+	Op    string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// ParseSelector parses a selector consisting of an optional metric name and
+// optional label matchers in braces (e.g. `up`, `{job="api"}`, or
+// `http_requests_total{code=~"5..",method!="get"}`). UTF-8 names are quoted,
+// metric names in the braces (e.g. `{"my.metric", "service.name"="api"}`).
+func ParseSelector(s string) (Selector, error) {
+	s = strings.TrimSpace(s)
+	name, rest, hasMatchers := strings.Cut(s, "{")
+	sel := Selector{Metric: strings.TrimSpace(name)}
+	if !hasMatchers {
+		if sel.Metric == "" {
+			return sel, fmt.Errorf("empty selector")
+		}
+		return sel, nil
+	}
+	rest = strings.TrimSpace(rest)
+	if !strings.HasSuffix(rest, "}") {
+		return sel, fmt.Errorf("missing closing brace in selector %q", s)
+	}
+	rest = strings.TrimSuffix(rest, "}")
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		var m Matcher
+		if strings.HasPrefix(rest, `"`) {
+			name, n, err := unquote(rest)
+			if err != nil {
+				return sel, fmt.Errorf("invalid name in selector %q: %w", s, err)
+			}
+			rest = strings.TrimSpace(rest[n:])
+			if rest == "" || rest[0] == ',' {
+				// A quoted metric name.
+				if sel.Metric != "" {
+					return sel, fmt.Errorf("metric name given twice in selector %q", s)
+				}
+				sel.Metric = name
+				rest = strings.TrimPrefix(rest, ",")
+				continue
+			}
+			m.Name = name
+		} else {
+			i := strings.IndexAny(rest, "=!")
+			if i <= 0 {
+				return sel, fmt.Errorf("invalid label matcher %q", rest)
+			}
+			m.Name = strings.TrimSpace(rest[:i])
+			rest = rest[i:]
+		}
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(rest, op) {
+				m.Op = op
+				break
+			}
+		}
+		if m.Op == "" {
+			return sel, fmt.Errorf("invalid operator in label matcher %q", rest)
+		}
+		rest = strings.TrimSpace(rest[len(m.Op):])
+		value, n, err := unquote(rest)
+		if err != nil {
+			return sel, fmt.Errorf("label matcher %q: %w", m.Name, err)
+		}
+		m.Value = value
+		if m.Op == "=~" || m.Op == "!~" {
+			if m.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+				return sel, fmt.Errorf("label matcher %q: %w", m.Name, err)
+			}
+		}
+		sel.Matchers = append(sel.Matchers, m)
+		rest = strings.TrimPrefix(strings.TrimSpace(rest[n:]), ",")
+	}
+	return sel, nil
+}
+
+// unquote returns the double-quoted string at the beginning of s and the
+// number of bytes it spans in s.
+func unquote(s string) (string, int, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", 0, fmt.Errorf("expected quoted value, but got %q", s)
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return sb.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					sb.WriteByte('\n')
+					continue
+				}
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return "", 0, fmt.Errorf("unterminated value %q", s)
+}
+
+// Matches returns true, if the selector matches the given observation.
+func (s Selector) Matches(o Observation) bool {
+	if s.Metric != "" && s.Metric != o.Metric {
+		return false
+	}
+	for _, m := range s.Matchers {
+		if !m.matches(labelValue(o.Labels, m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Matcher) matches(v string) bool {
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// labelValue returns the value of the label with the given name, or the empty
+// string, if there is none.
+func labelValue(labels []Label, name string) string {
+	for _, l := range labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// String returns the selector in its textual form.
+func (s Selector) String() string {
+	legacy := s.Metric == "" || model.IsValidLegacyMetricName(s.Metric)
+	if len(s.Matchers) == 0 && legacy {
+		return s.Metric
+	}
+	parts := make([]string, 0, len(s.Matchers)+1)
+	if !legacy {
+		parts = append(parts, strconv.Quote(s.Metric))
+	}
+	for _, m := range s.Matchers {
+		parts = append(parts, fmt.Sprintf("%s%s%q", QuoteName(m.Name), m.Op, m.Value))
+	}
+	if !legacy {
+		return "{" + strings.Join(parts, ",") + "}"
+	}
+	return s.Metric + "{" + strings.Join(parts, ",") + "}"
+}
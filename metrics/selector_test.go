@@ -0,0 +1,74 @@
+package metrics
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+		err      bool
+	}{
+		{in: "up", expected: "up"},
+		{in: ` http_requests_total { code = "200" , method!="get" } `, expected: `http_requests_total{code="200",method!="get"}`},
+		{in: `{job=~"api|web"}`, expected: `{job=~"api|web"}`},
+		{in: `x{a="q\"uoted"}`, expected: `x{a="q\"uoted"}`},
+		{in: `{"my.metric", "service.name"="api"}`, expected: `{"my.metric","service.name"="api"}`},
+		{in: `{"my_metric"}`, expected: `my_metric`},
+		{in: `x{"a", "b"}`, err: true},
+		{in: `{"a}`, err: true},
+		{in: "", err: true},
+		{in: `x{a="b"`, err: true},
+		{in: `x{a~"b"}`, err: true},
+		{in: `x{a=b}`, err: true},
+		{in: `x{a="b}`, err: true},
+		{in: `x{a=~"("}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			sel, err := ParseSelector(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Expected an error, but got %v", sel)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if sel.String() != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, sel.String())
+			}
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	o := Observation{
+		Metric: "http_requests_total",
+		Labels: []Label{{Name: "code", Value: "500"}, {Name: "method", Value: "get"}},
+	}
+	tests := []struct {
+		selector string
+		expected bool
+	}{
+		{selector: "http_requests_total", expected: true},
+		{selector: "http_requests", expected: false},
+		{selector: `{code="500"}`, expected: true},
+		{selector: `http_requests_total{code!="500"}`, expected: false},
+		{selector: `http_requests_total{code=~"5.."}`, expected: true},
+		{selector: `http_requests_total{code=~"5"}`, expected: false},
+		{selector: `http_requests_total{code!~"2..",method="get"}`, expected: true},
+		{selector: `http_requests_total{path=""}`, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual := sel.Matches(o); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
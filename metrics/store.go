@@ -0,0 +1,1239 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/maruel/natural"
+	prom "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Kinds of observations. Kinds without a direct counterpart in the exposition
+// format (e.g. ObservationCounterRate) are derived from other observations.
+const (
+	ObservationCounter ObservationKind = iota
+	ObservationCounterRate
+	ObservationCounterWindowRate
+	ObservationGauge
+	ObservationHistogramBucket
+	ObservationHistogramSum
+	ObservationHistogramCount
+	ObservationHistogramAvg
+	ObservationHistogramQuantile
+	ObservationHistogramIntervalQuantile
+	ObservationSummarySum
+	ObservationSummaryCount
+
+	// ObservationExpression observations are computed from other series by
+	// an arithmetic expression (e.g. a ratio of two counters).
+	ObservationExpression
+)
+
+var promFormat = expfmt.NewFormat(expfmt.TypeTextPlain)
+
+// Store is a structure that holds observations of different metrics over time.
+type Store struct {
+
+	// MaxBodySize limits the size of fetched metrics in bytes. Fetches
+	// exceeding it fail. Zero means no limit.
+	MaxBodySize int64
+
+	// StaleGrace is how long metrics missing from the latest sample are still
+	// dumped (marked as stale, see Observation.Stale). Zero drops them right
+	// away.
+	StaleGrace time.Duration
+
+	// StrictDuplicates fails samples holding the same series more than once
+	// (see Duplicates) rather than keeping the last one with a warning.
+	StrictDuplicates bool
+
+	// StrictParsing fails samples holding malformed metric families rather
+	// than skipping them with a warning (see Skipped).
+	StrictParsing bool
+
+	// Expvar parses the fetched metrics as expvar JSON (see parseExpvar),
+	// whatever format the fetcher reports. JSON objects are detected
+	// otherwise.
+	Expvar bool
+
+	// Keep (unless nil) selects the metric families to keep by their name.
+	// The others are dropped while decoding, family by family, so that they
+	// are neither collected, flattened, nor stored.
+	Keep func(family string) bool
+
+	// Relabeling rewrites the labels of the kept metric families, merging
+	// metrics that become identical.
+	Relabeling Relabeling
+
+	fetcher Fetcher
+	rb      *ringBuffer[map[string]Observation]
+	mux     sync.RWMutex
+
+	// sampling serializes samples. The latest sample (identified by
+	// sampleGen) supersedes the others, which are cancelled by
+	// cancelSample (see Sample).
+	sampling     sync.Mutex
+	inflightMux  sync.Mutex
+	sampleGen    uint64
+	cancelSample context.CancelFunc
+
+	// scraped is the time of the latest successful scrape in nanoseconds
+	// since the epoch (see LastScrape).
+	scraped atomic.Int64
+
+	// warning is a warning about the latest successful scrape (see Warning).
+	warning atomic.Value
+
+	// duplicates holds the names of the duplicate series of the latest
+	// successful scrape (see Duplicates).
+	duplicates atomic.Value
+
+	// skipped holds the parse errors of the metric families skipped by the
+	// latest successful scrape (see Skipped).
+	skipped atomic.Value
+
+	// kept and families count the metric families kept of those of the
+	// latest successful scrape (see Families).
+	kept, families atomic.Int64
+
+	// size is the size of the response of the latest successful scrape in
+	// bytes (see ResponseSize).
+	size atomic.Int64
+
+	// help describes the metric families of the latest successful scrape
+	// (keyed by name, see Help).
+	help map[string]Family
+
+	// buckets holds the histogram buckets of the latest sample (keyed by the
+	// flat histogram name) to estimate quantiles over the sampling interval.
+	buckets map[string][]bucket
+
+	// interned holds the flat names of the latest sample, which are reused
+	// by the next one (see interner).
+	interned interner
+
+	// seen holds the latest observation of each metric seen within the
+	// StaleGrace (keyed by name). added counts the added samples.
+	seen  map[string]seenObservation
+	added int
+
+	// names holds the names of the seen metrics in natural order. It is
+	// replaced (not modified), when metrics are added or forgotten.
+	names []string
+
+	// dumped holds the latest dumps (at most dumpCacheSize) of the latest
+	// generation, returned again until a sample is added.
+	dumpMux sync.Mutex
+	dumped  []dump
+}
+
+// dumpCacheSize is the number of dumps cached per generation (see
+// Store.dumped), so that the dumps of a few different filters (e.g. of a
+// search and of the series a view references) do not evict each other.
+const dumpCacheSize = 16
+
+// dump is the result of a Dump with the given filter at the given generation
+// (see Store.Generation).
+type dump struct {
+	filter string
+	gen    int
+	series [][]Observation
+}
+
+// seenObservation is the latest observation of a metric along with the time
+// and number of the sample it was seen in, of the sample it appeared in, and
+// the time of the observation its value last changed with.
+type seenObservation struct {
+	Observation
+	at        time.Time
+	sample    int
+	first     int
+	changedAt time.Time
+}
+
+// Observation represents a single observation (e.g. the value of a given metric
+// at a given time).
+type Observation struct {
+
+	// Name is the flat name of the metric (the metric name followed by its
+	// labels).
+	Name string
+
+	// Metric is the name of the metric without labels.
+	Metric string
+
+	// Labels are the labels of the metric.
+	Labels []Label
+
+	// Kind is the type of observation (e.g. counter, gauge, etc.).
+	Kind ObservationKind
+
+	// Time is the time of the observation (see TimeSource).
+	Time time.Time
+
+	// TimeSource indicates where Time comes from.
+	TimeSource TimeSource
+
+	// Value is the value of the observation.
+	Value float64
+
+	// Smoothed is true, if Value has been smoothed (see Deriver.RateSmoothing).
+	Smoothed bool
+
+	// Raw is the unsmoothed value of a smoothed observation.
+	Raw float64
+
+	// Created is the time the metric was created (e.g. the time a counter was
+	// last reset), if exposed along with the metric. Zero otherwise.
+	Created time.Time
+
+	// Exemplar is the exemplar exposed along with the observation (e.g. with
+	// a histogram bucket), if any.
+	Exemplar *Exemplar
+
+	// Stale marks a sample missing the metric. The observation is a copy of
+	// the latest earlier observation of the metric then (see
+	// Store.StaleGrace).
+	Stale bool
+
+	// Appeared is the number of samples since a metric that was missing from
+	// an earlier sample appeared (1, if it appeared in the latest sample).
+	// It is only set for the latest observation of a dumped series and zero,
+	// if the metric has been present since the first sample.
+	Appeared int
+
+	// Aggregated is the number of series aggregated into the observation
+	// (see Aggregation), zero if none.
+	Aggregated int
+
+	// LastChange is the time of the observation the metric last changed its
+	// value with (or appeared with), tracked beyond the observations kept by
+	// the store. Like Appeared, it is only set for the latest observation of
+	// a dumped series.
+	LastChange time.Time
+}
+
+// Exemplar is an exemplary observation (e.g. a traced request) that
+// contributed to a metric.
+type Exemplar struct {
+
+	// Labels are the labels of the exemplar (e.g. a trace ID).
+	Labels []Label
+
+	// Value is the observed value.
+	Value float64
+
+	// Time is the time of the exemplar. Zero, if not exposed.
+	Time time.Time
+}
+
+// ObservationKind represents the type of observation (e.g. counter, gauge, etc.).
+type ObservationKind int
+
+// observationKindNames are the names of the observation kinds as returned by
+// ObservationKind.String.
+var observationKindNames = map[ObservationKind]string{
+	ObservationCounter:                   "counter",
+	ObservationCounterRate:               "counter_rate",
+	ObservationCounterWindowRate:         "counter_window_rate",
+	ObservationGauge:                     "gauge",
+	ObservationHistogramBucket:           "histogram_bucket",
+	ObservationHistogramSum:              "histogram_sum",
+	ObservationHistogramCount:            "histogram_count",
+	ObservationHistogramAvg:              "histogram_avg",
+	ObservationHistogramQuantile:         "histogram_quantile",
+	ObservationHistogramIntervalQuantile: "histogram_interval_quantile",
+	ObservationSummarySum:                "summary_sum",
+	ObservationSummaryCount:              "summary_count",
+	ObservationExpression:                "expression",
+}
+
+// String returns the name of the observation kind (e.g. "histogram_count").
+func (k ObservationKind) String() string {
+	if name, ok := observationKindNames[k]; ok {
+		return name
+	}
+	return "unknown(" + strconv.Itoa(int(k)) + ")"
+}
+
+// ParseObservationKind returns the observation kind with the given name (see
+// ObservationKind.String).
+func ParseObservationKind(name string) (ObservationKind, error) {
+	for k, n := range observationKindNames {
+		if n == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown observation kind %q", name)
+}
+
+// TimeSource indicates where the time of an observation comes from.
+type TimeSource int
+
+const (
+	// TimeScrape is the time the observation was fetched as reported by the
+	// fetcher (e.g. the time given by the Date header of the server's
+	// response).
+	TimeScrape TimeSource = iota
+
+	// TimeExporter is the timestamp exposed along with the metric.
+	TimeExporter
+)
+
+// Label is a single label (name and value) of a metric.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// NewStore returns a new Store.
+func NewStore(size int, fetcher Fetcher) *Store {
+	return &Store{
+		fetcher: fetcher,
+		rb:      newRingBuffer[map[string]Observation](size),
+	}
+}
+
+// NewObservation creates a new Observation for the given metric and labels.
+func NewObservation(metric string, labels []Label, kind ObservationKind, ts time.Time, value float64) Observation {
+	return Observation{
+		Name:   flatName(metric, labels),
+		Metric: metric,
+		Labels: labels,
+		Kind:   kind,
+		Time:   ts,
+		Value:  value,
+	}
+}
+
+// familySuffixes are the suffixes the metric names of the flattened
+// observations of histograms and summaries add to the name of their family.
+var familySuffixes = map[ObservationKind]string{
+	ObservationHistogramBucket:           "_bucket",
+	ObservationHistogramSum:              "_sum",
+	ObservationHistogramCount:            "_count",
+	ObservationHistogramAvg:              "_avg",
+	ObservationHistogramQuantile:         "_quantile",
+	ObservationHistogramIntervalQuantile: "_interval_quantile",
+	ObservationSummarySum:                "_sum",
+	ObservationSummaryCount:              "_count",
+}
+
+// Family returns the name of the metric family of the observation (e.g.
+// "http_request_duration_seconds" for "http_request_duration_seconds_bucket").
+func (o Observation) Family() string {
+	return strings.TrimSuffix(o.Metric, familySuffixes[o.Kind])
+}
+
+// Synthetic series added to each set of observations to describe the scrape
+// itself (similar to the series Prometheus adds per target).
+const (
+	SeriesUp             = "promtui_up"
+	SeriesScrapeDuration = "promtui_scrape_duration_seconds"
+	SeriesScrapeSamples  = "promtui_scrape_samples"
+)
+
+// Sample fetches a set of observations (metrics) using the store's fetcher and
+// adds them to the store along with the synthetic series describing the
+// scrape (see SeriesUp). The given context bounds the fetch. A Sample-call
+// supersedes the one in flight (if any), which is cancelled. Sample returns:
+//   - true and nil, if new observations were fetched and added to the store,
+//   - false and nil, if no new observations were fetched nor added (because
+//     the call was superseded by a later one),
+//   - false and the context's error, if the given context was cancelled
+//     before the fetch completed, and
+//   - false and an error, if something went wrong while fetching (including
+//     the given context's deadline expiring). A set holding only the
+//     synthetic series (with SeriesUp being 0) is added then.
+func (h *Store) Sample(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	h.inflightMux.Lock()
+	if h.cancelSample != nil {
+		h.cancelSample()
+	}
+	h.sampleGen++
+	gen := h.sampleGen
+	h.cancelSample = cancel
+	h.inflightMux.Unlock()
+	superseded := func() bool {
+		h.inflightMux.Lock()
+		defer h.inflightMux.Unlock()
+		return h.sampleGen != gen
+	}
+
+	h.sampling.Lock()
+	defer h.sampling.Unlock()
+	if superseded() {
+		return false, nil
+	}
+
+	start := time.Now()
+	k := &keeper{keep: h.Keep}
+	mfs, ts, size, warning, skipped, err := h.fetch(ctx, k)
+	duration := time.Since(start).Seconds()
+	if err != nil {
+		switch {
+		case superseded():
+			return false, nil
+		case errors.Is(ctx.Err(), context.Canceled):
+			// Cancelled by the caller rather than failed (whereas an expired
+			// deadline is a failed scrape).
+			return false, ctx.Err()
+		}
+		h.addFailed(start, duration)
+		return false, err
+	}
+
+	// The samples of the endpoint are counted, whether kept or not.
+	samples, families := k.samples, k.families
+	if len(skipped) > 0 {
+		warning = strings.TrimPrefix(warning+"; "+skippedText(families, skipped), "; ")
+	}
+	mfs = relabel(mfs, h.Relabeling)
+	obs, buckets, duplicates := flatten(mfs, ts, h.buckets, &h.interned)
+	if len(duplicates) > 0 {
+		if h.StrictDuplicates {
+			h.addFailed(start, duration)
+			return false, errors.New(duplicatesText(duplicates))
+		}
+		warning = strings.TrimPrefix(warning+"; "+duplicatesText(duplicates), "; ")
+	}
+	for _, o := range []Observation{
+		NewObservation(SeriesUp, nil, ObservationGauge, ts, 1),
+		NewObservation(SeriesScrapeDuration, nil, ObservationGauge, ts, duration),
+		NewObservation(SeriesScrapeSamples, nil, ObservationGauge, ts, float64(samples)),
+	} {
+		obs[o.Name] = o
+	}
+	h.add(obs, false)
+	h.setHelp(mfs)
+	h.buckets = buckets
+	h.scraped.Store(ts.UnixNano())
+	h.warning.Store(warning)
+	h.duplicates.Store(duplicates)
+	h.skipped.Store(skipped)
+	h.kept.Store(int64(len(mfs)))
+	h.families.Store(int64(families))
+	h.size.Store(size)
+	return true, nil
+}
+
+// addFailed adds the set of a failed sample started at the given time, which
+// holds only the synthetic series (see SeriesUp).
+func (h *Store) addFailed(start time.Time, duration float64) {
+	obs := make(map[string]Observation, 2)
+	for _, o := range []Observation{
+		NewObservation(SeriesUp, nil, ObservationGauge, start, 0),
+		NewObservation(SeriesScrapeDuration, nil, ObservationGauge, start, duration),
+	} {
+		obs[o.Name] = o
+	}
+	h.add(obs, true)
+}
+
+// duplicatesText describes the given duplicate series (e.g. "2 duplicate
+// series in last scrape (e.g. a)").
+func duplicatesText(duplicates []string) string {
+	return fmt.Sprintf("%d duplicate series in last scrape (e.g. %s)", len(duplicates), duplicates[0])
+}
+
+// Duplicates returns the names of the series the latest successful scrape
+// held more than once (of which the last one is kept), sorted.
+func (h *Store) Duplicates() []string {
+	duplicates, _ := h.duplicates.Load().([]string)
+	return duplicates
+}
+
+// Skipped returns the parse errors of the metric families the latest
+// successful scrape skipped (unless StrictParsing), each naming its family.
+func (h *Store) Skipped() []error {
+	skipped, _ := h.skipped.Load().([]error)
+	return skipped
+}
+
+// add adds the given observations (of a failed sample, if failed) to the
+// store and records them as seen. Metrics not seen within the StaleGrace are
+// forgotten, unless only missing from failed samples, which do not count when
+// it comes to whether metrics have appeared (see Observation.Appeared).
+func (h *Store) add(obs map[string]Observation, failed bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.rb.add(obs)
+	now, n := time.Now(), h.added
+	h.added++
+	if h.seen == nil {
+		h.seen = make(map[string]seenObservation, len(obs))
+	}
+	changed := false
+	for name, o := range h.seen {
+		_, ok := obs[name]
+		switch {
+		case !ok && failed && o.sample == n-1:
+			o.sample = n
+			h.seen[name] = o
+		case !ok && now.Sub(o.at) > h.StaleGrace:
+			delete(h.seen, name)
+			changed = true
+		}
+	}
+	for name, o := range obs {
+		first := n
+		prev, ok := h.seen[name]
+		if ok && prev.sample == n-1 {
+			first = prev.first
+		}
+		changedAt := o.Time
+		if ok && (prev.Value == o.Value || (math.IsNaN(prev.Value) && math.IsNaN(o.Value))) {
+			changedAt = prev.changedAt
+		}
+		changed = changed || !ok
+		h.seen[name] = seenObservation{Observation: o, at: now, sample: n, first: first, changedAt: changedAt}
+	}
+
+	// Sorting is costly for large endpoints, so it is done only when the set
+	// of metrics changes rather than on every Dump.
+	if changed {
+		names := make([]string, 0, len(h.seen))
+		for name := range h.seen {
+			names = append(names, name)
+		}
+		sort.Sort(natural.StringSlice(names))
+		h.names = names
+	}
+}
+
+// fetch fetches and decodes a set of metric families, keeping those selected
+// by the given keeper. fetch returns the time the metrics were fetched at and
+// the number of bytes read along with a warning (see decode), and the parse
+// errors of the skipped metric families (see decodeLenient).
+func (h *Store) fetch(ctx context.Context, k *keeper) ([]*prom.MetricFamily, time.Time, int64, string, []error, error) {
+	body, ts, err := h.fetcher.Fetch(ctx)
+	if err != nil {
+		return nil, ts, 0, "", nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	counter := &countingReader{r: body}
+	var in io.Reader = counter
+	if fr, ok := body.(FormatReader); ok {
+		in = formatReader{counter, fr.Format()}
+	}
+	if h.Expvar {
+		in = formatReader{counter, expvarFormat}
+	}
+	var mfs []*prom.MetricFamily
+	var warning string
+	var skipped []error
+	if h.StrictParsing {
+		mfs, warning, err = decode(in, h.MaxBodySize, k)
+	} else {
+		mfs, warning, skipped, err = decodeLenient(in, h.MaxBodySize, k)
+	}
+	var sizeErr *bodySizeError
+	if errors.As(err, &sizeErr) {
+		return nil, ts, 0, "", nil, sizeErr
+	} else if err != nil {
+		return nil, ts, 0, "", nil, fmt.Errorf("parse response: %w", err)
+	}
+	return mfs, ts, counter.n, warning, skipped, nil
+}
+
+// countingReader is a reader counting the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// keeper selects the metric families kept while decoding (see Store.Keep),
+// counting the families and samples (see countSamples) of all, kept or not. A
+// nil keeper keeps all families without counting them.
+type keeper struct {
+	keep              func(family string) bool
+	families, samples int
+}
+
+// kept counts the given decoded metric family and returns true, if it is
+// kept.
+func (k *keeper) kept(mf *prom.MetricFamily) bool {
+	if k == nil {
+		return true
+	}
+	k.families++
+	k.samples += countSamples([]*prom.MetricFamily{mf})
+	return k.keep == nil || k.keep(mf.GetName())
+}
+
+// filter returns the kept ones of the given decoded metric families (see
+// kept).
+func (k *keeper) filter(mfs []*prom.MetricFamily) []*prom.MetricFamily {
+	return slices.DeleteFunc(mfs, func(mf *prom.MetricFamily) bool { return !k.kept(mf) })
+}
+
+// reset forgets the counted metric families (e.g. of a failed decode).
+func (k *keeper) reset() {
+	if k != nil {
+		k.families, k.samples = 0, 0
+	}
+}
+
+// countSamples returns the number of samples of the given metric families as
+// exposed in the text format (e.g. a histogram has a sample per bucket, a sum,
+// and a count).
+func countSamples(mfs []*prom.MetricFamily) int {
+	n := 0
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch {
+			case m.GetHistogram() != nil:
+				n += len(m.GetHistogram().GetBucket()) + 2
+			case m.GetSummary() != nil:
+				n += len(m.GetSummary().GetQuantile()) + 2
+			default:
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Warning returns a warning about the latest successful scrape (e.g. that the
+// metrics were parsed as text, because the endpoint did not report a supported
+// format). An empty string is returned, if there is none.
+func (h *Store) Warning() string {
+	warning, _ := h.warning.Load().(string)
+	return warning
+}
+
+// formatOf returns the exposition format of the given fetched metrics, along
+// with a warning, if the metrics are parsed as text for lack of a supported
+// format (see FormatReader). The unknown format is returned for readers not
+// reporting a format.
+func formatOf(r io.Reader) (expfmt.Format, string) {
+	fr, ok := r.(FormatReader)
+	if !ok {
+		return expfmt.NewFormat(expfmt.TypeUnknown), ""
+	}
+	format := fr.Format()
+	switch format.FormatType() {
+	case expfmt.TypeProtoDelim, expfmt.TypeTextPlain, expfmt.TypeOpenMetrics:
+		return format, ""
+	}
+	if format == "" {
+		return promFormat, "missing content type, parsed as text"
+	}
+	return promFormat, fmt.Sprintf("unsupported content type %q, parsed as text", format)
+}
+
+// LastScrape returns the time of the latest successful scrape as reported by
+// the fetcher. The zero time is returned, if there was none.
+func (h *Store) LastScrape() time.Time {
+	n := h.scraped.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// Family describes a metric family as exposed by its HELP and TYPE lines.
+type Family struct {
+	// Help is the HELP text, collapsed to a single line. Empty, if there is
+	// none.
+	Help string
+
+	// Type is the type of the family (e.g. "counter" or "untyped").
+	Type string
+}
+
+// setHelp records the descriptions of the given metric families (see Help).
+func (h *Store) setHelp(mfs []*prom.MetricFamily) {
+	help := make(map[string]Family, len(mfs))
+	for _, mf := range mfs {
+		help[mf.GetName()] = Family{
+			Help: strings.Join(strings.Fields(mf.GetHelp()), " "),
+			Type: strings.ToLower(mf.GetType().String()),
+		}
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.help = help
+}
+
+// Help returns the description of the metric family with the given name (see
+// Observation.Family) as of the latest successful scrape. It returns false, if
+// the family was not part of it.
+func (h *Store) Help(family string) (Family, bool) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	f, ok := h.help[family]
+	return f, ok
+}
+
+// Families returns the number of metric families kept (see Keep) of those
+// of the latest successful scrape.
+func (h *Store) Families() (kept, total int) {
+	return int(h.kept.Load()), int(h.families.Load())
+}
+
+// ResponseSize returns the size of the response of the latest successful
+// scrape in bytes (as read, i.e. after decompression).
+func (h *Store) ResponseSize() int64 {
+	return h.size.Load()
+}
+
+// Len returns the number of metrics a Dump without filter would return.
+func (h *Store) Len() int {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	return len(h.seen)
+}
+
+// Generation returns the number of samples added to the store (including
+// those of failed fetches, see Sample). Dumps differ only between
+// generations.
+func (h *Store) Generation() int {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	return h.added
+}
+
+// Dump dumps the store. Dump returns a sorted list of different metrics and their
+// observations over time. The metrics are those of the latest sample and those
+// missing from it, but seen within the StaleGrace. Samples missing a metric are
+// represented by stale observations (see Observation.Stale). If a non-empty
+// filter is given, only the metrics matching the filter are returned. A filter
+// with label matchers in braces is a selector (see ParseSelector), any other
+// filter matches metrics containing it (ignoring case). Until the next sample,
+// repeated dumps with the same filter (of the latest few filters) return the
+// same (shared) result, which must not be modified: functions filtering or
+// reordering a dump return a copy instead.
+func (h *Store) Dump(f string) ([][]Observation, error) {
+	h.mux.RLock()
+	data := h.rb.get()
+	if len(data) == 0 {
+		h.mux.RUnlock()
+		return nil, fmt.Errorf("no data points")
+	}
+	gen := h.added
+	h.dumpMux.Lock()
+	for _, cached := range h.dumped {
+		if cached.gen == gen && cached.filter == f {
+			h.dumpMux.Unlock()
+			h.mux.RUnlock()
+			return cached.series, nil
+		}
+	}
+	h.dumpMux.Unlock()
+	// The latest observations (including those of stale series) are
+	// collected in order, so that neither a copy of the seen metrics nor
+	// sorting is needed.
+	latest := data[len(data)-1]
+	last := make([]Observation, 0, len(h.names))
+	for _, name := range h.names {
+		o, ok := h.seen[name]
+		if !ok {
+			continue
+		}
+		l, ok := latest[name]
+		if !ok {
+			o.Observation.LastChange = o.changedAt
+			last = append(last, o.Observation)
+			continue
+		}
+		if o.first > 0 {
+			l.Appeared = h.added - o.first
+		}
+		l.LastChange = o.changedAt
+		last = append(last, l)
+	}
+	h.mux.RUnlock()
+
+	// Filtering before collecting the series spares narrow filters the
+	// allocation of all series.
+	match := matcher(f)
+	var series [][]Observation
+	for _, o := range last {
+		if !match(o) {
+			continue
+		}
+		values := getSeries(data, o.Name, o)
+		if len(values) == 0 {
+			continue
+		}
+		values[0].Appeared, values[0].LastChange = o.Appeared, o.LastChange
+		series = append(series, values)
+	}
+
+	// A dump racing with a later one must not replace its results.
+	h.dumpMux.Lock()
+	switch {
+	case len(h.dumped) == 0 || gen > h.dumped[0].gen:
+		h.dumped = []dump{{filter: f, gen: gen, series: series}}
+	case gen == h.dumped[0].gen:
+		if len(h.dumped) == dumpCacheSize {
+			h.dumped = slices.Delete(h.dumped, 0, 1)
+		}
+		h.dumped = append(h.dumped, dump{filter: f, gen: gen, series: series})
+	}
+	h.dumpMux.Unlock()
+	return series, nil
+}
+
+// MatchSearch returns a function matching the observations Dump returns for
+// the given filter.
+func MatchSearch(f string) func(Observation) bool {
+	return matcher(f)
+}
+
+// matcher returns a function matching the observations, whose flat name
+// contains the filter (ignoring case) or, if the filter is a selector, which
+// the selector matches.
+func matcher(f string) func(Observation) bool {
+	if strings.Contains(f, "{") {
+		if sel, err := ParseSelector(f); err == nil {
+			return sel.Matches
+		}
+	}
+	lower := strings.ToLower(f)
+	return func(o Observation) bool {
+		return f == "" || strings.Contains(strings.ToLower(o.Name), lower)
+	}
+}
+
+// getSeries returns the series of observations for a given metric-name over
+// time. Observations are sorted from youngest to oldest. Samples not containing
+// an observation for the given metric-name are represented by a stale copy of
+// the next older observation or, if there is none, of the given last seen
+// observation. The series ends with the oldest observation.
+func getSeries(data []map[string]Observation, name string, last Observation) []Observation {
+	series := make([]Observation, 0, len(data))
+	gap := 0
+	for i := len(data) - 1; i >= 0; i-- {
+		o, ok := data[i][name]
+		if !ok {
+			gap++
+			continue
+		}
+		series = appendStale(series, o, gap)
+		series = append(series, o)
+		gap = 0
+	}
+	if len(series) == 0 {
+		series = appendStale(series, last, gap)
+	}
+	return series
+}
+
+// appendStale appends n stale copies of the given observation to the series.
+func appendStale(series []Observation, o Observation, n int) []Observation {
+	o.Stale = true
+	for range n {
+		series = append(series, o)
+	}
+	return series
+}
+
+// decode decodes the metrics fetched from a Prometheus metrics endpoint. The
+// format of the metrics is given by the reader, if it is a FormatReader, and
+// is otherwise detected from the metrics. decode returns a warning, if the
+// metrics are parsed as text for lack of a supported format. Metrics larger
+// than limit bytes (unless zero) and HTML pages are not decoded at all. Only
+// the metric families selected by the given keeper are returned.
+func decode(in io.Reader, limit int64, k *keeper) ([]*prom.MetricFamily, string, error) {
+	if err := checkHTML(in); err != nil {
+		return nil, "", err
+	}
+	format, warning := formatOf(in)
+	r := in
+	if limit > 0 {
+		in = &limitReader{r: in, n: limit, limit: limit}
+	}
+	switch {
+	case maybeExpvar(r) || format.FormatType() == expfmt.TypeOpenMetrics || format.FormatType() == expfmt.TypeUnknown:
+		b, err := io.ReadAll(in)
+		if err != nil {
+			return nil, "", err
+		}
+		if isExpvar(r, b) {
+			mfs, skipped, err := parseExpvar(b)
+			return k.filter(mfs), expvarText(skipped), err
+		}
+		if hasOMEOF(b) {
+			mfs, err := parseOpenMetrics(b)
+			return k.filter(mfs), warning, err
+		}
+		if format.FormatType() == expfmt.TypeOpenMetrics {
+			warning = "missing " + omEOF + ", parsed as text"
+		}
+		in = bytes.NewReader(b)
+	}
+
+	dec := expfmt.NewDecoder(in, promFormat)
+	if format.FormatType() == expfmt.TypeProtoDelim {
+		dec = expfmt.NewDecoder(in, format)
+	}
+	var mfs []*prom.MetricFamily
+	for {
+		mf := &prom.MetricFamily{}
+		if err := dec.Decode(mf); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		if k.kept(mf) {
+			mfs = append(mfs, mf)
+		}
+	}
+	return mfs, warning, nil
+}
+
+// checkHTML returns an error, if the given fetched metrics are an HTML page
+// (e.g. a login page) according to their format (see FormatReader).
+func checkHTML(in io.Reader) error {
+	if fr, ok := in.(FormatReader); ok {
+		if mediaType, _, _ := mime.ParseMediaType(string(fr.Format())); mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			return fmt.Errorf("response is an HTML page (%s), not metrics", mediaType)
+		}
+	}
+	return nil
+}
+
+// bodySizeError is the error of fetched metrics exceeding the size limit.
+type bodySizeError struct {
+	limit int64
+}
+
+func (e *bodySizeError) Error() string {
+	return "response exceeded " + formatSize(e.limit)
+}
+
+// limitReader is a reader that fails with a bodySizeError once more than limit
+// bytes have been read.
+type limitReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), &bodySizeError{limit: l.limit}
+	}
+	return n, err
+}
+
+// formatSize formats the given number of bytes using the largest binary
+// prefix that divides it (e.g. "64MiB").
+func formatSize(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && n%1024 == 0 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return strconv.FormatInt(n, 10) + units[i]
+}
+
+// flatten takes a map of Prometheus families and flattens them into a map of
+// observations. For histograms, flatten additionally returns the buckets and
+// derives quantile estimates, both over all observations and over the
+// observations made since prev. Unless nil, names are interned with the given
+// interner. Series given more than once are returned as duplicates (sorted),
+// of which the last one is kept.
+func flatten(mfs []*prom.MetricFamily, ts time.Time, prev map[string][]bucket, in *interner) (map[string]Observation, map[string][]bucket, []string) {
+	in.reset()
+	obs := make(map[string]Observation, max(len(mfs), in.len()))
+	buckets := make(map[string][]bucket)
+	var duplicates []string
+	var mTime, mCreated time.Time
+	var mSource TimeSource
+	add := func(metric string, labels []Label, kind ObservationKind, value float64) string {
+		name := in.flatName(metric, labels)
+		if _, ok := obs[name]; ok {
+			duplicates = append(duplicates, name)
+		}
+		obs[name] = Observation{
+			Name:       name,
+			Metric:     metric,
+			Labels:     labels,
+			Kind:       kind,
+			Time:       mTime,
+			TimeSource: mSource,
+			Value:      value,
+			Created:    mCreated,
+		}
+		return name
+	}
+	addExemplar := func(name string, e *prom.Exemplar) {
+		if e == nil {
+			return
+		}
+		o := obs[name]
+		o.Exemplar = &Exemplar{Labels: newLabels(e.GetLabel()), Value: e.GetValue()}
+		if e.GetTimestamp() != nil {
+			o.Exemplar.Time = e.GetTimestamp().AsTime()
+		}
+		obs[name] = o
+	}
+
+	for _, mf := range mfs {
+		mfName := mf.GetName()
+
+		// The names of the flattened metrics are shared by all metrics of
+		// the family.
+		var bucketName, sumName, countName, avgName, quantileName, intervalQuantileName string
+		switch mf.GetType() {
+		case prom.MetricType_HISTOGRAM, prom.MetricType_GAUGE_HISTOGRAM:
+			bucketName, sumName, countName, avgName = mfName+"_bucket", mfName+"_sum", mfName+"_count", mfName+"_avg"
+			quantileName, intervalQuantileName = mfName+"_quantile", mfName+"_interval_quantile"
+		case prom.MetricType_SUMMARY:
+			sumName, countName = mfName+"_sum", mfName+"_count"
+		}
+
+		for _, m := range mf.GetMetric() {
+			mLabels := newLabels(m.GetLabel())
+			mType := mf.GetType()
+			mTime, mSource = ts, TimeScrape
+			if ms := m.GetTimestampMs(); ms != 0 {
+				mTime, mSource = time.UnixMilli(ms), TimeExporter
+			}
+			mCreated = time.Time{}
+			for _, c := range []*timestamppb.Timestamp{
+				m.GetCounter().GetCreatedTimestamp(),
+				m.GetHistogram().GetCreatedTimestamp(),
+				m.GetSummary().GetCreatedTimestamp(),
+			} {
+				if c != nil {
+					mCreated = c.AsTime()
+				}
+			}
+			switch mType {
+
+			case prom.MetricType_HISTOGRAM, prom.MetricType_GAUGE_HISTOGRAM:
+				hBuckets := make([]bucket, 0, len(m.GetHistogram().GetBucket())+1)
+				for _, b := range m.GetHistogram().GetBucket() {
+					// The bound is kept exact, so that close ones (e.g.
+					// 0.005 and 0.01) do not collide.
+					bLabels := withLabel(mLabels, "le", strconv.FormatFloat(b.GetUpperBound(), 'f', -1, 64))
+					value := b.GetCumulativeCountFloat()
+					if value <= 0 {
+						value = float64(b.GetCumulativeCount())
+					}
+					addExemplar(add(bucketName, bLabels, ObservationHistogramBucket, value), b.GetExemplar())
+					hBuckets = append(hBuckets, bucket{upperBound: b.GetUpperBound(), count: value})
+				}
+
+				sampleSum := m.GetHistogram().GetSampleSum()
+				add(sumName, mLabels, ObservationHistogramSum, sampleSum)
+
+				sampleCount := m.GetHistogram().GetSampleCountFloat()
+				if sampleCount <= 0 {
+					sampleCount = float64(m.GetHistogram().GetSampleCount())
+				}
+				add(countName, mLabels, ObservationHistogramCount, sampleCount)
+
+				if sampleCount > 0 {
+					avg := sampleSum / sampleCount
+					add(avgName, mLabels, ObservationHistogramAvg, avg)
+				}
+
+				// The +Inf bucket is implicit in some exposition formats.
+				if len(hBuckets) == 0 || !math.IsInf(hBuckets[len(hBuckets)-1].upperBound, +1) {
+					hBuckets = append(hBuckets, bucket{upperBound: math.Inf(+1), count: sampleCount})
+				}
+				key := in.flatName(mfName, mLabels)
+				buckets[key] = hBuckets
+				delta := deltaBuckets(hBuckets, prev[key])
+				for _, q := range histogramQuantiles {
+					qLabels := withLabel(mLabels, "quantile", strconv.FormatFloat(q, 'f', -1, 64))
+					add(quantileName, qLabels, ObservationHistogramQuantile, bucketQuantile(q, hBuckets))
+					add(intervalQuantileName, qLabels, ObservationHistogramIntervalQuantile, bucketQuantile(q, delta))
+				}
+
+			case prom.MetricType_COUNTER:
+				addExemplar(add(mfName, mLabels, ObservationCounter, m.GetCounter().GetValue()), m.GetCounter().GetExemplar())
+
+			case prom.MetricType_GAUGE:
+				add(mfName, mLabels, ObservationGauge, m.GetGauge().GetValue())
+
+			// Untyped metrics (e.g. of federation endpoints, or of unknown
+			// type in OpenMetrics) are taken as gauges, like Prometheus does.
+			case prom.MetricType_UNTYPED:
+				add(mfName, mLabels, ObservationGauge, m.GetUntyped().GetValue())
+
+			case prom.MetricType_SUMMARY:
+				add(sumName, mLabels, ObservationSummarySum, m.GetSummary().GetSampleSum())
+				add(countName, mLabels, ObservationSummaryCount, float64(m.GetSummary().GetSampleCount()))
+			}
+		}
+	}
+	slices.Sort(duplicates)
+	return obs, buckets, slices.Compact(duplicates)
+}
+
+// newLabels converts the given Prometheus label pairs into labels.
+func newLabels(pairs []*prom.LabelPair) []Label {
+	labels := make([]Label, 0, len(pairs))
+	for _, p := range pairs {
+		labels = append(labels, Label{Name: p.GetName(), Value: p.GetValue()})
+	}
+	return labels
+}
+
+// withLabel returns a copy of the given labels with an additional label
+// appended.
+func withLabel(labels []Label, name, value string) []Label {
+	return append(labels[:len(labels):len(labels)], Label{Name: name, Value: value})
+}
+
+// FlatName returns the flat name of the given metric and labels, as given to
+// observations (see Observation.Name), e.g. to show a series with fewer
+// labels.
+func FlatName(metric string, labels []Label) string {
+	return flatName(metric, labels)
+}
+
+// flatName creates a flat Name for the Observation and its labels.
+func flatName(name string, labels []Label) string {
+	if len(labels) == 0 && !strings.ContainsFunc(name, unicode.IsControl) {
+		return name
+	}
+	return string(appendFlatName(make([]byte, 0, 64), name, labels))
+}
+
+// appendFlatName appends the flat name of the given metric and labels (e.g.
+// `http_requests_total {code="200", method="get"}`) to buf. Control
+// characters (e.g. newlines or ANSI escape sequences) are escaped, so that
+// flat names are safe to print on a single line of a terminal.
+func appendFlatName(buf []byte, name string, labels []Label) []byte {
+	buf = appendMetricName(buf, name)
+	if len(labels) == 0 {
+		return buf
+	}
+	buf = append(buf, " {"...)
+	for i, label := range labels {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = appendName(buf, label.Name)
+		buf = append(buf, '=')
+		buf = strconv.AppendQuote(buf, label.Value)
+	}
+	return append(buf, '}')
+}
+
+// QuoteName returns the given label name as shown in flat names and
+// selectors: quoted, unless it is a legacy label name (e.g. `code`, but
+// `"service.name"`).
+func QuoteName(name string) string {
+	if model.LabelName(name).IsValidLegacy() {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// appendName appends the given name to buf, quoted like QuoteName.
+func appendName(buf []byte, name string) []byte {
+	if model.LabelName(name).IsValidLegacy() {
+		return append(buf, name...)
+	}
+	return strconv.AppendQuote(buf, name)
+}
+
+// appendMetricName appends the given metric name to buf, escaping control
+// characters as in Go strings (e.g. `\n`). Legacy metric names (see
+// model.IsValidLegacyMetricName) have none.
+func appendMetricName(buf []byte, name string) []byte {
+	if !strings.ContainsFunc(name, unicode.IsControl) {
+		return append(buf, name...)
+	}
+	q := strconv.AppendQuote(nil, name)
+	return append(buf, q[1:len(q)-1]...)
+}
+
+// interner reuses the flat names of a sample in the next one, so that
+// repeated samples of an endpoint do not allocate the same names over and
+// over. Names are looked up by the flat name built into a reused buffer, which
+// does not allocate either.
+type interner struct {
+	names  map[string]internedName
+	sample int
+	buf    []byte
+}
+
+// internedName is a name along with the latest sample that used it.
+type internedName struct {
+	name   string
+	sample int
+}
+
+// reset starts a sample: names not used by the previous one are forgotten.
+func (in *interner) reset() {
+	if in == nil {
+		return
+	}
+	if in.names == nil {
+		in.names = make(map[string]internedName)
+	}
+	for name, n := range in.names {
+		if n.sample < in.sample {
+			delete(in.names, name)
+		}
+	}
+	in.sample++
+}
+
+// len returns the number of names of the previous sample, which is a good
+// guess for the size of the next one.
+func (in *interner) len() int {
+	if in == nil {
+		return 0
+	}
+	return len(in.names)
+}
+
+// flatName returns the flat name of the given metric and labels (see
+// flatName), reusing the one of the previous sample (if any).
+func (in *interner) flatName(name string, labels []Label) string {
+	if in == nil || len(labels) == 0 {
+		return flatName(name, labels)
+	}
+	in.buf = appendFlatName(in.buf[:0], name, labels)
+	n, ok := in.names[string(in.buf)]
+	if !ok {
+		n.name = string(in.buf)
+	}
+	if n.sample != in.sample {
+		n.sample = in.sample
+		in.names[n.name] = n
+	}
+	return n.name
+}
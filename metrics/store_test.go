@@ -0,0 +1,797 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	prom "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestFlatten_Timestamps(t *testing.T) {
+	in := `# TYPE requests_total counter
+requests_total{code="200"} 10 1700000000000
+requests_total{code="500"} 1
+`
+	now := time.Now()
+	mfs, _, err := decode(strings.NewReader(in), 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	obs, _, _ := flatten(mfs, now, nil, nil)
+
+	o := obs[`requests_total {code="200"}`]
+	if !o.Time.Equal(time.UnixMilli(1700000000000)) || o.TimeSource != TimeExporter {
+		t.Errorf("Expected exporter timestamp, but got %v (%v)", o.Time, o.TimeSource)
+	}
+	o = obs[`requests_total {code="500"}`]
+	if !o.Time.Equal(now) || o.TimeSource != TimeScrape {
+		t.Errorf("Expected scrape timestamp, but got %v (%v)", o.Time, o.TimeSource)
+	}
+}
+
+func TestFlatten_Untyped(t *testing.T) {
+	// As served by the federation endpoint of Prometheus.
+	in := `# TYPE up untyped
+up{instance="a:8080",job="api",replica="r1"} 1 1700000000000
+`
+	mfs, _, err := decode(strings.NewReader(in), 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	obs, _, _ := flatten(mfs, time.Now(), nil, nil)
+	o, ok := obs[`up {instance="a:8080", job="api", replica="r1"}`]
+	if !ok || o.Kind != ObservationGauge || o.Value != 1 || o.TimeSource != TimeExporter {
+		t.Errorf("Expected a gauge, but got %+v", obs)
+	}
+}
+
+func TestInterner_FlatName(t *testing.T) {
+	labels := []Label{{"code", "200"}, {"path", `/a "b"`}}
+	var in interner
+	in.reset()
+	first := in.flatName("requests_total", labels)
+	if expected := `requests_total {code="200", path="/a \"b\""}`; first != expected {
+		t.Errorf("Expected %v, but got %v", expected, first)
+	}
+
+	// Names of the previous sample are reused, others are forgotten.
+	in.reset()
+	if second := in.flatName("requests_total", labels); unsafe.StringData(second) != unsafe.StringData(first) {
+		t.Errorf("Expected the name to be reused")
+	}
+	in.reset()
+	in.reset()
+	if third := in.flatName("requests_total", labels); unsafe.StringData(third) == unsafe.StringData(first) {
+		t.Errorf("Expected the name to be forgotten")
+	}
+}
+
+func TestFlatName_ControlCharacters(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   []Label
+		expected string
+	}{
+		{"up", nil, "up"},
+		{"up", []Label{{"trace", "at main()\n\tmain.go:1"}}, `up {trace="at main()\n\tmain.go:1"}`},
+		{"up", []Label{{"x", "\x1b[31mred\x1b[0m"}}, `up {x="\x1b[31mred\x1b[0m"}`},
+		{"up", []Label{{"x\x1b[31m", "1"}}, `up {"x\x1b[31m"="1"}`},
+		{"my.up\x1b[2J", nil, `my.up\x1b[2J`},
+		{"my.up\n", []Label{{"x", "1"}}, `my.up\n {x="1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if actual := flatName(tt.name, tt.labels); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+// BenchmarkFlatten flattens a sample of 10k series, either building all
+// names anew or reusing those of the previous sample.
+func BenchmarkFlatten(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("# TYPE requests_total counter\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&sb, "requests_total{code=\"%d\",instance=\"host-%d\",method=\"get\"} %d\n", 200+i%5, i, i)
+	}
+	mfs, _, err := decode(strings.NewReader(sb.String()), 0, nil)
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		in   *interner
+	}{
+		{"fresh", nil},
+		{"interned", &interner{}},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				flatten(mfs, time.Now(), nil, tt.in)
+			}
+		})
+	}
+}
+
+func TestFlatten_Fixture(t *testing.T) {
+	f, err := os.Open("testdata/metrics.prom")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	mfs, _, err := decode(f, 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	obs, buckets, _ := flatten(mfs, time.Now(), nil, nil)
+
+	expected := []struct {
+		name  string
+		kind  ObservationKind
+		value float64
+	}{
+		{`go_goroutines`, ObservationGauge, 42},
+		{`http_requests_total {code="200", method="get"}`, ObservationCounter, 1027},
+		{`http_requests_total {code="500", method="get"}`, ObservationCounter, 3},
+		{`http_request_duration_seconds_bucket {handler="/api", le="0.1"}`, ObservationHistogramBucket, 60},
+		{`http_request_duration_seconds_bucket {handler="/api", le="0.5"}`, ObservationHistogramBucket, 90},
+		{`http_request_duration_seconds_bucket {handler="/api", le="1"}`, ObservationHistogramBucket, 100},
+		{`http_request_duration_seconds_bucket {handler="/api", le="+Inf"}`, ObservationHistogramBucket, 100},
+		{`http_request_duration_seconds_sum {handler="/api"}`, ObservationHistogramSum, 25.5},
+		{`http_request_duration_seconds_count {handler="/api"}`, ObservationHistogramCount, 100},
+		{`http_request_duration_seconds_avg {handler="/api"}`, ObservationHistogramAvg, 0.255},
+		{`http_request_duration_seconds_quantile {handler="/api", quantile="0.5"}`, ObservationHistogramQuantile, 0.1 / 60 * 50},
+		{`http_request_duration_seconds_quantile {handler="/api", quantile="0.9"}`, ObservationHistogramQuantile, 0.5},
+		{`http_request_duration_seconds_quantile {handler="/api", quantile="0.99"}`, ObservationHistogramQuantile, 0.95},
+		{`go_gc_duration_seconds_sum`, ObservationSummarySum, 0.25},
+		{`go_gc_duration_seconds_count`, ObservationSummaryCount, 1000},
+	}
+	for _, e := range expected {
+		o, ok := obs[e.name]
+		if !ok {
+			t.Errorf("Missing observation %q", e.name)
+			continue
+		}
+		if o.Kind != e.kind {
+			t.Errorf("Expected kind %v for %q, but got %v", e.kind, e.name, o.Kind)
+		}
+		if math.Abs(o.Value-e.value) > 1e-9 {
+			t.Errorf("Expected value %v for %q, but got %v", e.value, e.name, o.Value)
+		}
+	}
+
+	// Without a previous sample, there are no interval quantiles.
+	o := obs[`http_request_duration_seconds_interval_quantile {handler="/api", quantile="0.5"}`]
+	if o.Kind != ObservationHistogramIntervalQuantile || !math.IsNaN(o.Value) {
+		t.Errorf("Expected NaN interval quantile, but got %v", o)
+	}
+
+	// 4 plain series, 4 buckets, sum, count, avg, 3 quantiles and 3 interval
+	// quantiles.
+	if len(obs) != 18 {
+		t.Errorf("Expected 18 observations, but got %d", len(obs))
+	}
+	if len(buckets[`http_request_duration_seconds {handler="/api"}`]) != 4 {
+		t.Errorf("Expected 4 buckets, but got %v", buckets)
+	}
+}
+
+func TestFlatten_UTF8Fixture(t *testing.T) {
+	for _, path := range []string{"testdata/utf8.prom", "testdata/utf8.om"} {
+		t.Run(path, func(t *testing.T) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			mfs, _, err := decode(strings.NewReader(string(b)), 0, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			obs, _, _ := flatten(mfs, time.Now(), nil, nil)
+			var names []string
+			for name := range obs {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			expected := []string{
+				`http.server.requests_total {"http.route"="/api", code="200"}`,
+				`http.server.requests_total {"http.route"="/health", code="200"}`,
+				`process_open_fds {"service.name"="api"}`,
+			}
+			if !slices.Equal(names, expected) {
+				t.Errorf("Expected %v, but got %v", expected, names)
+			}
+
+			sel, err := ParseSelector(`{"http.server.requests_total", "http.route"="/api"}`)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var selected []string
+			for _, name := range names {
+				if sel.Matches(obs[name]) {
+					selected = append(selected, name)
+				}
+			}
+			if len(selected) != 1 || selected[0] != expected[0] {
+				t.Errorf("Expected %v, but got %v", expected[:1], selected)
+			}
+		})
+	}
+}
+
+// fixtureFetcher is a Fetcher returning the contents of a file.
+type fixtureFetcher struct {
+	path string
+	time time.Time
+}
+
+func (f fixtureFetcher) Fetch(_ context.Context) (io.ReadCloser, time.Time, error) {
+	r, err := os.Open(f.path)
+	return r, f.time, err
+}
+
+func TestStore_Sample(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 14, 2, 11, 0, time.UTC)
+	store := NewStore(3, fixtureFetcher{path: "testdata/metrics.prom", time: ts})
+	if _, err := store.Dump(""); err == nil {
+		t.Errorf("Expected error for empty store")
+	}
+
+	fetched, err := store.Sample(context.Background())
+	if err != nil || !fetched {
+		t.Fatalf("Expected successful sample, but got %v, %v", fetched, err)
+	}
+	if !store.LastScrape().Equal(ts) {
+		t.Errorf("Expected last scrape %v, but got %v", ts, store.LastScrape())
+	}
+	dump, err := store.Dump("http_requests_total")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(dump) != 2 || dump[0][0].Name != `http_requests_total {code="200", method="get"}` {
+		t.Errorf("Unexpected dump %v", dump)
+	}
+
+	dump, _ = store.Dump("promtui_")
+	expected := map[string]float64{SeriesUp: 1, SeriesScrapeSamples: 14}
+	for _, series := range dump {
+		if v, ok := expected[series[0].Name]; ok && series[0].Value != v {
+			t.Errorf("Expected %v for %q, but got %v", v, series[0].Name, series[0].Value)
+		}
+	}
+	if len(dump) != 3 {
+		t.Errorf("Expected 3 synthetic series, but got %d", len(dump))
+	}
+
+	store = NewStore(3, fixtureFetcher{path: "testdata/missing.prom"})
+	if _, err := store.Sample(context.Background()); err == nil {
+		t.Errorf("Expected fetch error")
+	}
+	dump, _ = store.Dump(SeriesUp)
+	if len(dump) != 1 || dump[0][0].Value != 0 {
+		t.Errorf("Expected %s 0 after failed scrape, but got %v", SeriesUp, dump)
+	}
+}
+
+// blockingFetcher is a Fetcher blocking until its context is done, unless it
+// is the given number of fetches.
+type blockingFetcher struct {
+	fixtureFetcher
+	started chan struct{}
+	fetches atomic.Int32
+	pass    int32
+}
+
+func (f *blockingFetcher) Fetch(ctx context.Context) (io.ReadCloser, time.Time, error) {
+	if f.fetches.Add(1) == f.pass {
+		return f.fixtureFetcher.Fetch(ctx)
+	}
+	f.started <- struct{}{}
+	<-ctx.Done()
+	return nil, time.Time{}, ctx.Err()
+}
+
+func TestStore_SampleSupersede(t *testing.T) {
+	f := &blockingFetcher{fixtureFetcher: fixtureFetcher{path: "testdata/metrics.prom"}, started: make(chan struct{}), pass: 2}
+	store := NewStore(3, f)
+
+	type result struct {
+		fetched bool
+		err     error
+	}
+	results := make(chan result)
+	go func() {
+		fetched, err := store.Sample(context.Background())
+		results <- result{fetched, err}
+	}()
+	<-f.started
+
+	// The later sample cancels the one in flight, which neither fails nor
+	// adds anything.
+	fetched, err := store.Sample(context.Background())
+	if err != nil || !fetched {
+		t.Errorf("Expected successful sample, but got %v, %v", fetched, err)
+	}
+	if r := <-results; r.err != nil || r.fetched {
+		t.Errorf("Expected superseded sample, but got %v, %v", r.fetched, r.err)
+	}
+	dump, _ := store.Dump(SeriesUp)
+	if len(dump) != 1 || len(dump[0]) != 1 || dump[0][0].Value != 1 {
+		t.Errorf("Expected a single successful sample, but got %v", dump)
+	}
+
+	// Samples cancelled by the caller do not count as failed scrapes.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-f.started
+		cancel()
+	}()
+	if _, err := store.Sample(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v, but got %v", context.Canceled, err)
+	}
+	dump, _ = store.Dump(SeriesUp)
+	if len(dump[0]) != 1 {
+		t.Errorf("Expected no failed sample, but got %v", dump)
+	}
+}
+
+func TestStore_SampleDeadline(t *testing.T) {
+	f := &blockingFetcher{fixtureFetcher: fixtureFetcher{path: "testdata/metrics.prom"}, started: make(chan struct{}, 1)}
+	store := NewStore(3, f)
+
+	// Samples timing out count as failed scrapes.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.Sample(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+	dump, _ := store.Dump(SeriesUp)
+	if len(dump) != 1 || len(dump[0]) != 1 || dump[0][0].Value != 0 {
+		t.Errorf("Expected %s 0 after timed out scrape, but got %v", SeriesUp, dump)
+	}
+}
+
+// sequenceFetcher is a Fetcher returning the given bodies (one per fetch, each
+// a second after the previous one). Empty bodies fail.
+type sequenceFetcher struct {
+	bodies  []string
+	fetches int
+}
+
+func (f *sequenceFetcher) Fetch(_ context.Context) (io.ReadCloser, time.Time, error) {
+	body := f.bodies[f.fetches]
+	ts := time.Unix(int64(f.fetches), 0)
+	f.fetches++
+	if body == "" {
+		return nil, ts, errors.New("down")
+	}
+	return io.NopCloser(strings.NewReader(body)), ts, nil
+}
+
+func TestStore_Stale(t *testing.T) {
+	a, b := "# TYPE a gauge\na %d\n", "# TYPE b gauge\nb %d\n"
+	bodies := []string{
+		fmt.Sprintf(a+b, 1, 1),
+		fmt.Sprintf(a, 2),
+		"",
+		fmt.Sprintf(a+b, 3, 5),
+		fmt.Sprintf(a, 4),
+	}
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		expected []string
+	}{
+		{
+			name:  "grace",
+			grace: time.Hour,
+			expected: []string{
+				"b 1",
+				"b 1 (stale), b 1",
+				"b 1 (stale), b 1 (stale), b 1",
+				"b 5, b 1 (stale), b 1 (stale), b 1",
+				"b 5 (stale), b 5, b 1 (stale), b 1 (stale), b 1",
+			},
+		},
+		{
+			name: "no grace",
+			expected: []string{
+				"b 1",
+				"",
+				"",
+				"b 5, b 1 (stale), b 1 (stale), b 1",
+				"",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(len(bodies), &sequenceFetcher{bodies: bodies})
+			store.StaleGrace = tt.grace
+			for i, expected := range tt.expected {
+				_, _ = store.Sample(context.Background())
+				dump, err := store.Dump("b")
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				var values []string
+				for _, series := range dump {
+					for _, o := range series {
+						v := fmt.Sprintf("%s %v", o.Name, o.Value)
+						if o.Stale {
+							v += " (stale)"
+						}
+						values = append(values, v)
+					}
+				}
+				if actual := strings.Join(values, ", "); actual != expected {
+					t.Errorf("%d: Expected %q, but got %q", i, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_Appeared(t *testing.T) {
+	a, b := "# TYPE a gauge\na 1\n", "# TYPE b gauge\nb 1\n"
+	store := NewStore(3, &sequenceFetcher{bodies: []string{a, a + b, "", a + b, a, a + b}})
+	expected := []string{"a 0", "a 0, b 1", "a 0, b 0", "a 0, b 3", "a 0", "a 0, b 1"}
+	for i, e := range expected {
+		_, _ = store.Sample(context.Background())
+		dump, err := store.Dump("")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if n := store.Len(); n != len(dump) {
+			t.Errorf("%d: Expected %d metrics, but got %d", i, len(dump), n)
+		}
+		var appeared []string
+		for _, series := range dump {
+			if o := series[0]; !strings.HasPrefix(o.Name, "promtui_") {
+				appeared = append(appeared, fmt.Sprintf("%s %d", o.Name, o.Appeared))
+			}
+		}
+		if actual := strings.Join(appeared, ", "); actual != e {
+			t.Errorf("%d: Expected %q, but got %q", i, e, actual)
+		}
+	}
+}
+
+func TestStore_LastChange(t *testing.T) {
+	a := "# TYPE a gauge\na %d\n"
+	bodies := []string{fmt.Sprintf(a, 1), fmt.Sprintf(a, 1), fmt.Sprintf(a, 1), fmt.Sprintf(a, 2), "", fmt.Sprintf(a, 2)}
+	store := NewStore(2, &sequenceFetcher{bodies: bodies})
+	store.StaleGrace = time.Minute
+	// The change is tracked beyond the two samples kept and across failed
+	// samples.
+	expected := []int64{0, 0, 0, 3, 3, 3}
+	for i, e := range expected {
+		_, _ = store.Sample(context.Background())
+		dump, err := store.Dump("a")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if actual := dump[0][0].LastChange.Unix(); actual != e {
+			t.Errorf("%d: Expected %d, but got %d", i, e, actual)
+		}
+	}
+}
+
+func TestStore_Help(t *testing.T) {
+	body := "# HELP go_goroutines Number of goroutines\\nthat currently exist.\n# TYPE go_goroutines gauge\ngo_goroutines 8\n# TYPE a_total counter\na_total 1\n"
+	store := NewStore(2, &sequenceFetcher{bodies: []string{body, ""}})
+	for range 2 {
+		_, _ = store.Sample(context.Background())
+		// Failed samples keep the descriptions.
+		f, ok := store.Help("go_goroutines")
+		if expected := (Family{Help: "Number of goroutines that currently exist.", Type: "gauge"}); !ok || f != expected {
+			t.Errorf("Expected %v, but got %v", expected, f)
+		}
+		if f, ok := store.Help("a_total"); !ok || f.Help != "" || f.Type != "counter" {
+			t.Errorf("Expected a counter without help, but got %v", f)
+		}
+		if _, ok := store.Help("b"); ok {
+			t.Errorf("Expected no description of an unknown family")
+		}
+	}
+}
+
+func TestStore_Duplicates(t *testing.T) {
+	body := "# TYPE a gauge\na{x=\"1\"} 1\na{x=\"1\"} 2\na{x=\"2\"} 3\n"
+	store := NewStore(2, &sequenceFetcher{bodies: []string{body}})
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{`a {x="1"}`}; !slices.Equal(store.Duplicates(), expected) {
+		t.Errorf("Expected %v, but got %v", expected, store.Duplicates())
+	}
+	if expected := `1 duplicate series in last scrape (e.g. a {x="1"})`; store.Warning() != expected {
+		t.Errorf("Expected %q, but got %q", expected, store.Warning())
+	}
+	dump, err := store.Dump(`a{x="1"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(dump) != 1 || dump[0][0].Value != 2 {
+		t.Errorf("Expected the last value to be kept, but got %v", dump)
+	}
+
+	// Strictly, duplicates fail the sample.
+	store = NewStore(2, &sequenceFetcher{bodies: []string{body}})
+	store.StrictDuplicates = true
+	if _, err := store.Sample(context.Background()); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestStore_DefaultBuckets(t *testing.T) {
+	// The default buckets of the Go client (prometheus.DefBuckets).
+	var body strings.Builder
+	body.WriteString("# TYPE lat histogram\n")
+	for i, le := range []string{"0.005", "0.01", "0.025", "0.05", "0.1", "0.25", "0.5", "1", "2.5", "5", "10", "+Inf"} {
+		fmt.Fprintf(&body, "lat_bucket{le=%q} %d\n", le, i+1)
+	}
+	body.WriteString("lat_sum 1\nlat_count 12\n")
+	for _, strict := range []bool{false, true} {
+		store := NewStore(2, &sequenceFetcher{bodies: []string{body.String()}})
+		store.StrictDuplicates = strict
+		if _, err := store.Sample(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(store.Duplicates()) != 0 || store.Warning() != "" {
+			t.Errorf("Expected no duplicates, but got %v (%q)", store.Duplicates(), store.Warning())
+		}
+		dump, err := store.Dump(`lat_bucket{le="0.005"}`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(dump) != 1 || dump[0][0].Value != 1 {
+			t.Errorf("Expected the 0.005 bucket, but got %v", dump)
+		}
+	}
+}
+
+func TestStore_Skipped(t *testing.T) {
+	body := "# TYPE a gauge\na 1\n# TYPE b gauge\nb{x=\"1} 2\n"
+	store := NewStore(2, &sequenceFetcher{bodies: []string{body}})
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if skipped := store.Skipped(); len(skipped) != 1 || !strings.HasPrefix(skipped[0].Error(), "b: ") {
+		t.Errorf("Expected b to be skipped, but got %v", skipped)
+	}
+	if expected := "parsed 1 families, 1 skipped due to errors"; store.Warning() != expected {
+		t.Errorf("Expected %q, but got %q", expected, store.Warning())
+	}
+	if dump, err := store.Dump("a"); err != nil || len(dump) == 0 || dump[0][0].Name != "a" {
+		t.Errorf("Expected a to be kept, but got %v (%v)", dump, err)
+	}
+
+	// Strictly, malformed families fail the sample.
+	store = NewStore(2, &sequenceFetcher{bodies: []string{body}})
+	store.StrictParsing = true
+	if _, err := store.Sample(context.Background()); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestStore_DumpCache(t *testing.T) {
+	a, b := "# TYPE a gauge\na 1\n", "# TYPE b gauge\nb 2\n"
+	store := NewStore(3, &sequenceFetcher{bodies: []string{a + b, "", a}})
+	store.StaleGrace = time.Minute
+	names := func(dump [][]Observation) string {
+		var names []string
+		for _, series := range dump {
+			if o := series[0]; !strings.HasPrefix(o.Name, "promtui_") {
+				names = append(names, fmt.Sprintf("%s %v", o.Name, o.Stale))
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	tests := []struct {
+		sample   bool
+		filter   string
+		gen      int
+		cached   bool
+		expected string
+	}{
+		{true, "", 1, false, "a false, b false"},
+		{false, "", 1, true, "a false, b false"},
+		{false, "b", 1, false, "b false"},
+		{false, "b", 1, true, "b false"},
+		// Failed samples count as well.
+		{true, "b", 2, false, "b true"},
+		{true, "b", 3, false, "b true"},
+		{false, "", 3, false, "a false, b true"},
+	}
+	var prev [][]Observation
+	for i, tt := range tests {
+		if tt.sample {
+			_, _ = store.Sample(context.Background())
+		}
+		if gen := store.Generation(); gen != tt.gen {
+			t.Errorf("%d: Expected generation %d, but got %d", i, tt.gen, gen)
+		}
+		dump, err := store.Dump(tt.filter)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if actual := names(dump); actual != tt.expected {
+			t.Errorf("%d: Expected %q, but got %q", i, tt.expected, actual)
+		}
+		// Cached dumps share their series.
+		cached := len(prev) > 0 && len(dump) > 0 && &prev[0][0] == &dump[0][0]
+		if cached != tt.cached {
+			t.Errorf("%d: Expected cached %v, but got %v", i, tt.cached, cached)
+		}
+		prev = dump
+	}
+
+	// The dumps of a few filters are cached alongside.
+	onlyB, _ := store.Dump("b")
+	all, _ := store.Dump("")
+	if again, _ := store.Dump("b"); &again[0][0] != &onlyB[0][0] {
+		t.Errorf("Expected the cached dump of b")
+	}
+	if again, _ := store.Dump(""); &again[0][0] != &all[0][0] {
+		t.Errorf("Expected the cached dump of all series")
+	}
+}
+
+func TestStore_Keep(t *testing.T) {
+	body := "# TYPE a gauge\na 1\n# TYPE b_seconds histogram\nb_seconds_bucket{le=\"+Inf\"} 1\nb_seconds_sum 1\nb_seconds_count 1\n"
+	store := NewStore(3, &sequenceFetcher{bodies: []string{body}})
+	store.Keep = func(family string) bool { return family == "a" }
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dump, err := store.Dump("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, series := range dump {
+		names = append(names, series[0].Name)
+	}
+	expected := []string{"a", SeriesScrapeDuration, SeriesScrapeSamples, SeriesUp}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, but got %v", expected, names)
+	}
+	if kept, total := store.Families(); kept != 1 || total != 2 {
+		t.Errorf("Expected 1 of 2 families, but got %d of %d", kept, total)
+	}
+	if size := store.ResponseSize(); size != int64(len(body)) {
+		t.Errorf("Expected %v, but got %v", len(body), size)
+	}
+	if samples := dump[2][0].Value; samples != 4 {
+		t.Errorf("Expected %v, but got %v", 4, samples)
+	}
+
+	// The families parsed leniently (see decodeLenient) are counted once.
+	store = NewStore(3, &sequenceFetcher{bodies: []string{body + "# TYPE c gauge\nc{ 1\n"}})
+	store.Keep = func(family string) bool { return family == "a" }
+	if _, err := store.Sample(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kept, total := store.Families(); kept != 1 || total != 2 || len(store.Skipped()) != 1 {
+		t.Errorf("Expected 1 of 2 families and 1 skipped, but got %d of %d and %v", kept, total, store.Skipped())
+	}
+}
+
+func TestObservation_Family(t *testing.T) {
+	tests := []struct {
+		metric   string
+		kind     ObservationKind
+		expected string
+	}{
+		{"http_requests_total", ObservationCounter, "http_requests_total"},
+		{"queue_length_count", ObservationGauge, "queue_length_count"},
+		{"latency_seconds_bucket", ObservationHistogramBucket, "latency_seconds"},
+		{"latency_seconds_interval_quantile", ObservationHistogramIntervalQuantile, "latency_seconds"},
+		{"rpc_duration_seconds_count", ObservationSummaryCount, "rpc_duration_seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			o := NewObservation(tt.metric, nil, tt.kind, time.Now(), 1)
+			if actual := o.Family(); actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestStore_SampleFormat(t *testing.T) {
+	f, err := os.Open("testdata/metrics.prom")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	var text, proto bytes.Buffer
+	dec := expfmt.NewDecoder(io.TeeReader(f, &text), promFormat)
+	enc := expfmt.NewEncoder(&proto, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for {
+		mf := &prom.MetricFamily{}
+		if err := dec.Decode(mf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := enc.Encode(mf); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		maxBodySize int64
+		warning     bool
+		err         string
+	}{
+		{name: "protobuf", contentType: string(expfmt.NewFormat(expfmt.TypeProtoDelim)), body: proto.Bytes()},
+		{name: "text", contentType: "text/plain; version=0.0.4; charset=utf-8", body: text.Bytes()},
+		{name: "mismatched", contentType: "application/json", body: text.Bytes(), warning: true},
+		{name: "missing", body: text.Bytes(), warning: true},
+		{name: "limited", contentType: "text/plain", body: text.Bytes(), maxBodySize: int64(text.Len())},
+		{name: "too large", contentType: "text/plain", body: text.Bytes(), maxBodySize: 1024, err: "response exceeded 1KiB"},
+		{name: "html", contentType: "text/html; charset=utf-8", body: []byte("<html></html>"), err: "response is an HTML page (text/html), not metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.Header.Get("Accept"), expfmt.ProtoType) {
+					t.Errorf("Expected protobuf to be preferred, but got %q", r.Header.Get("Accept"))
+				}
+				// A nil Content-Type prevents the server from sniffing one.
+				w.Header()["Content-Type"] = nil
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				_, _ = w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			store := NewStore(3, NewHTTPFetcher(srv.URL))
+			store.MaxBodySize = tt.maxBodySize
+			if tt.err != "" {
+				if _, err := store.Sample(context.Background()); err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+					t.Errorf("Expected error %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if fetched, err := store.Sample(context.Background()); err != nil || !fetched {
+				t.Fatalf("Expected successful sample, but got %v, %v", fetched, err)
+			}
+			if warning := store.Warning(); (warning != "") != tt.warning {
+				t.Errorf("Unexpected warning %q", warning)
+			}
+			dump, err := store.Dump("")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// The fixture's 18 series and the 3 synthetic series.
+			if len(dump) != 21 {
+				t.Errorf("Expected 21 series, but got %d", len(dump))
+			}
+		})
+	}
+}